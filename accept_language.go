@@ -0,0 +1,35 @@
+package cronet
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptLanguageHeader returns the Accept-Language header for |languages| in
+// order of preference, e.g. "en-US,en;q=0.9,de;q=0.8" for "en-US", "en" and
+// "de". The quality values are the ones Chrome generates from its language
+// settings; Cronet sends the value set with EngineParams.SetAcceptLanguage
+// as it is, the same with and without ICU, so use this to match Chrome.
+func AcceptLanguageHeader(languages ...string) string {
+	var builder strings.Builder
+	quality := 10
+	for _, language := range languages {
+		language = strings.TrimSpace(language)
+		if language == "" {
+			continue
+		}
+		if quality == 10 {
+			builder.WriteString(language)
+		} else {
+			builder.WriteString(",")
+			builder.WriteString(language)
+			builder.WriteString(";q=0.")
+			builder.WriteString(strconv.Itoa(quality))
+		}
+		// q=0 would mean not acceptable
+		if quality > 1 {
+			quality--
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,53 @@
+package cronet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestAcceptLanguageHeader(t *testing.T) {
+	for _, testCase := range []struct {
+		languages []string
+		header    string
+	}{
+		{nil, ""},
+		{[]string{"en-US"}, "en-US"},
+		{[]string{"en-US", " en ", "", "de"}, "en-US,en;q=0.9,de;q=0.8"},
+		{[]string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}, "a,b;q=0.9,c;q=0.8,d;q=0.7,e;q=0.6,f;q=0.5,g;q=0.4,h;q=0.3,i;q=0.2,j;q=0.1,k;q=0.1,l;q=0.1"},
+	} {
+		if header := cronet.AcceptLanguageHeader(testCase.languages...); header != testCase.header {
+			t.Errorf("AcceptLanguageHeader(%q) = %q, want %q", testCase.languages, header, testCase.header)
+		}
+	}
+}
+
+func TestRoundTripperAcceptLanguage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Accept-Language", request.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &cronet.RoundTripper{
+		AcceptLanguage: cronet.AcceptLanguageHeader("de-DE", "de"),
+	}}
+	send := func(acceptLanguage string) string {
+		request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		if acceptLanguage != "" {
+			request.Header.Set("Accept-Language", acceptLanguage)
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.Header.Get("X-Accept-Language")
+	}
+	if acceptLanguage := send(""); acceptLanguage != "de-DE,de;q=0.9" {
+		t.Error("unexpected default Accept-Language", acceptLanguage)
+	}
+	if acceptLanguage := send("fr"); acceptLanguage != "fr" {
+		t.Error("request Accept-Language not sent", acceptLanguage)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ActiveRequest is a request an engine has in flight, see
+// Engine.ActiveRequests.
+type ActiveRequest struct {
+	// ID is the request ID RoundTripper gave the request, see
+	// RequestIDFromContext, or one of its own for other requests.
+	ID     RequestID
+	Method string
+	// URL is the URL the request was created with, before redirects.
+	URL     string
+	Started time.Time
+	Elapsed time.Duration
+	// BytesReceived is the number of bytes received over the network so
+	// far, as of the last callback of the request.
+	BytesReceived int64
+}
+
+// ActiveRequests returns the requests of the engine started and not finished
+// yet, the longest running first, e.g. for an admin endpoint to find stuck
+// transfers. The requests may finish any time after the call.
+func (e Engine) ActiveRequests() []ActiveRequest {
+	stats, loaded := engineStatsRegistry.load(uintptr(unsafe.Pointer(e.ptr)))
+	if !loaded {
+		return nil
+	}
+	now := time.Now()
+	stats.access.Lock()
+	requests := make([]ActiveRequest, 0, len(stats.active))
+	for _, stat := range stats.active {
+		requests = append(requests, ActiveRequest{
+			ID:            stat.id,
+			Method:        stat.method,
+			URL:           stat.url,
+			Started:       stat.startTime,
+			Elapsed:       now.Sub(stat.startTime),
+			BytesReceived: atomic.LoadInt64(&stat.bytesReceived),
+		})
+	}
+	stats.access.Unlock()
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Started.Before(requests[j].Started)
+	})
+	return requests
+}
+
+// CancelRequest cancels the active request with |id| as URLRequest.Cancel
+// does, and reports whether it was found. A RoundTripper request fails with
+// context.Canceled, as if its body had been closed.
+func (e Engine) CancelRequest(id RequestID) bool {
+	stats, loaded := engineStatsRegistry.load(uintptr(unsafe.Pointer(e.ptr)))
+	if !loaded {
+		return false
+	}
+	// The lock keeps the final callback from destroying the request meanwhile
+	stats.access.Lock()
+	defer stats.access.Unlock()
+	stat := stats.active[id]
+	if stat == nil {
+		return false
+	}
+	stat.request.Cancel()
+	return true
+}
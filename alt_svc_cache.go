@@ -0,0 +1,274 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// AltSvcEntry is an alternative service mapping learned from an Alt-Svc
+// header, e.g. that https://example.com:443 is also served over HTTP/3.
+type AltSvcEntry struct {
+	// Origin is the origin the mapping belongs to, e.g. "https://example.com:443".
+	Origin string `json:"origin"`
+	// Protocol is the alternative protocol: "quic" for HTTP/3 or "h2".
+	Protocol string `json:"protocol"`
+	// Host is the alternative host, empty if it is the origin host.
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port"`
+	// Expiration is when the mapping expires. Zero means one day after it is written.
+	Expiration time.Time `json:"expiration"`
+	// AdvertisedALPNs lists the ALPNs of a QUIC alternative, e.g. ["h3"].
+	AdvertisedALPNs []string `json:"advertised_alpns,omitempty"`
+}
+
+// The engine persists its HTTP server properties, including Alt-Svc mappings,
+// and the host cache in this file below the storage path.
+const localPrefsFile = "prefs/local_prefs.json"
+
+// windowsEpochOffset is the offset between the base::Time epoch
+// (1601-01-01) and the Unix epoch in microseconds.
+const windowsEpochOffset = 11644473600 * 1000 * 1000
+
+// ReadAltSvcCache returns the Alt-Svc mappings the engine persisted in
+// |storagePath|, the directory passed to EngineParams.SetStoragePath.
+// The file is written periodically and on Engine.Shutdown, so a running
+// engine may know mappings not returned yet.
+func ReadAltSvcCache(storagePath string) ([]AltSvcEntry, error) {
+	prefs, err := readLocalPrefs(storagePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []AltSvcEntry
+	for _, server := range altSvcServers(prefs) {
+		origin, _ := server["server"].(string)
+		services, _ := server["alternative_service"].([]any)
+		for _, rawService := range services {
+			service, isObject := rawService.(map[string]any)
+			if !isObject {
+				continue
+			}
+			entry := AltSvcEntry{Origin: origin}
+			entry.Protocol, _ = service["protocol_str"].(string)
+			entry.Host, _ = service["host"].(string)
+			entry.Port = prefsInt(service["port"])
+			expiration, _ := service["expiration"].(string)
+			if microseconds, err := strconv.ParseInt(expiration, 10, 64); err == nil {
+				entry.Expiration = time.UnixMicro(microseconds - windowsEpochOffset)
+			}
+			alpns, _ := service["advertised_alpns"].([]any)
+			for _, alpn := range alpns {
+				if alpnString, isString := alpn.(string); isString {
+					entry.AdvertisedALPNs = append(entry.AdvertisedALPNs, alpnString)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// WriteAltSvcCache replaces the persisted Alt-Svc mappings in |storagePath|
+// with |entries|, so an engine started on it uses the alternative services
+// immediately instead of after the first response. Other server properties
+// are kept. The engine must not be running on |storagePath|.
+func WriteAltSvcCache(storagePath string, entries []AltSvcEntry) error {
+	prefs, err := readLocalPrefs(storagePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		prefs = make(map[string]any)
+	}
+	serversByOrigin := make(map[string]map[string]any)
+	var servers []any
+	for _, server := range altSvcServers(prefs) {
+		delete(server, "alternative_service")
+		if origin, _ := server["server"].(string); origin != "" {
+			serversByOrigin[origin] = server
+		}
+		servers = append(servers, server)
+	}
+	for _, entry := range entries {
+		server := serversByOrigin[entry.Origin]
+		if server == nil {
+			server = map[string]any{
+				"server":        entry.Origin,
+				"anonymization": []any{},
+			}
+			serversByOrigin[entry.Origin] = server
+			servers = append(servers, server)
+		}
+		expiration := entry.Expiration
+		if expiration.IsZero() {
+			expiration = time.Now().Add(24 * time.Hour)
+		}
+		service := map[string]any{
+			"protocol_str": entry.Protocol,
+			"port":         entry.Port,
+			"expiration":   strconv.FormatInt(expiration.UnixMicro()+windowsEpochOffset, 10),
+		}
+		if entry.Host != "" {
+			service["host"] = entry.Host
+		}
+		if len(entry.AdvertisedALPNs) > 0 {
+			service["advertised_alpns"] = entry.AdvertisedALPNs
+		}
+		services, _ := server["alternative_service"].([]any)
+		server["alternative_service"] = append(services, service)
+	}
+
+	netPrefs, _ := prefs["net"].(map[string]any)
+	if netPrefs == nil {
+		netPrefs = make(map[string]any)
+		prefs["net"] = netPrefs
+	}
+	properties, _ := netPrefs["http_server_properties"].(map[string]any)
+	if properties == nil {
+		properties = map[string]any{"version": 5}
+		netPrefs["http_server_properties"] = properties
+	}
+	if servers == nil {
+		servers = []any{}
+	}
+	properties["servers"] = servers
+	return writeLocalPrefs(storagePath, prefs)
+}
+
+// ClearAltSvcCache removes all persisted Alt-Svc mappings from |storagePath|.
+// The engine must not be running on |storagePath|.
+func ClearAltSvcCache(storagePath string) error {
+	_, err := os.Stat(filepath.Join(storagePath, localPrefsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return WriteAltSvcCache(storagePath, nil)
+}
+
+// SaveAltSvcEntries writes |entries| to the JSON file at |path|, e.g. to
+// carry mappings over to another storage path or device.
+func SaveAltSvcEntries(path string, entries []AltSvcEntry) error {
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// LoadAltSvcEntries reads entries written by SaveAltSvcEntries, dropping
+// expired ones.
+func LoadAltSvcEntries(path string) ([]AltSvcEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []AltSvcEntry
+	err = json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	live := entries[:0]
+	for _, entry := range entries {
+		if entry.Expiration.IsZero() || entry.Expiration.After(now) {
+			live = append(live, entry)
+		}
+	}
+	return live, nil
+}
+
+// AddAltSvcQuicHints adds a QUIC hint for every HTTP/3 mapping of |entries|
+// to the parameters. Unlike WriteAltSvcCache this works without a storage
+// path, but hints only cover alternatives on the origin host.
+func (p EngineParams) AddAltSvcQuicHints(entries []AltSvcEntry) {
+	for _, entry := range entries {
+		if entry.Protocol != "quic" || entry.Host != "" {
+			continue
+		}
+		host, port, ok := splitAltSvcOrigin(entry.Origin)
+		if !ok {
+			continue
+		}
+		hint := NewQuicHint()
+		hint.SetHost(host)
+		hint.SetPort(int32(port))
+		hint.SetAlternatePort(int32(entry.Port))
+		p.AddQuicHint(hint)
+		hint.Destroy()
+	}
+}
+
+func splitAltSvcOrigin(origin string) (host string, port int, ok bool) {
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Scheme != "https" || originURL.Hostname() == "" {
+		return
+	}
+	port = 443
+	if originURL.Port() != "" {
+		port, err = strconv.Atoi(originURL.Port())
+		if err != nil {
+			return
+		}
+	}
+	return originURL.Hostname(), port, true
+}
+
+func readLocalPrefs(storagePath string) (map[string]any, error) {
+	content, err := os.ReadFile(filepath.Join(storagePath, localPrefsFile))
+	if err != nil {
+		return nil, err
+	}
+	// Numbers are kept as json.Number, so the prefs Cronet owns are written
+	// back without losing the precision of large integers.
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var prefs map[string]any
+	err = decoder.Decode(&prefs)
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// prefsInt returns the integer a pref read by readLocalPrefs holds, or zero.
+func prefsInt(value any) int {
+	number, _ := value.(json.Number)
+	integer, _ := strconv.Atoi(string(number))
+	return integer
+}
+
+func writeLocalPrefs(storagePath string, prefs map[string]any) error {
+	path := filepath.Join(storagePath, localPrefsFile)
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+func altSvcServers(prefs map[string]any) []map[string]any {
+	netPrefs, _ := prefs["net"].(map[string]any)
+	properties, _ := netPrefs["http_server_properties"].(map[string]any)
+	rawServers, _ := properties["servers"].([]any)
+	servers := make([]map[string]any, 0, len(rawServers))
+	for _, rawServer := range rawServers {
+		if server, isObject := rawServer.(map[string]any); isObject {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
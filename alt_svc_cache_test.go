@@ -0,0 +1,65 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestAltSvcCache(t *testing.T) {
+	storagePath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(storagePath, "prefs"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(storagePath, "prefs", "local_prefs.json"), []byte(`{"net":{"http_server_properties":{"servers":[{"server":"https://example.com","supports_spdy":true,"anonymization":[]}],"version":5}},"other":1,"large":9007199254740993}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiration := time.UnixMicro(time.Now().Add(time.Hour).UnixMicro())
+	err = cronet.WriteAltSvcCache(storagePath, []cronet.AltSvcEntry{
+		{Origin: "https://example.com", Protocol: "quic", Port: 443, Expiration: expiration, AdvertisedALPNs: []string{"h3"}},
+		{Origin: "https://example.org:8443", Protocol: "quic", Host: "alt.example.org", Port: 443, Expiration: expiration},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := cronet.ReadAltSvcCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("bad entries", entries)
+	}
+	if entries[0].Origin != "https://example.com" || entries[0].AdvertisedALPNs[0] != "h3" || !entries[0].Expiration.Equal(expiration) {
+		t.Fatal("bad entry", entries[0])
+	}
+	if entries[1].Host != "alt.example.org" || entries[1].Port != 443 {
+		t.Fatal("bad entry", entries[1])
+	}
+	// Prefs the cache does not own are written back unchanged
+	content, err := os.ReadFile(filepath.Join(storagePath, "prefs", "local_prefs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"large":9007199254740993`) {
+		t.Fatal("large integer not preserved", string(content))
+	}
+	err = cronet.ClearAltSvcCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = cronet.ReadAltSvcCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatal("cache not cleared", entries)
+	}
+}
@@ -0,0 +1,30 @@
+package cronet
+
+import "context"
+
+type annotationsKey struct{}
+
+// WithAnnotations returns a copy of |ctx| carrying |annotations| in addition
+// to those already in |ctx|, which they replace by key. Annotations are
+// application values of a request, e.g. a trace or tenant ID, for middleware
+// to read from the request context, the context of http.Response.Request
+// included, and for finished request listeners from
+// URLRequestFinishedInfo.Annotations, without maps keyed by request.
+func WithAnnotations(ctx context.Context, annotations map[string]any) context.Context {
+	parent := AnnotationsFromContext(ctx)
+	merged := make(map[string]any, len(parent)+len(annotations))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range annotations {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, annotationsKey{}, merged)
+}
+
+// AnnotationsFromContext returns the annotations in |ctx|, or nil. The map
+// must not be modified.
+func AnnotationsFromContext(ctx context.Context) map[string]any {
+	annotations, _ := ctx.Value(annotationsKey{}).(map[string]any)
+	return annotations
+}
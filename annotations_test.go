@@ -0,0 +1,38 @@
+package cronet_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestAnnotations(t *testing.T) {
+	ctx := cronet.WithAnnotations(context.Background(), map[string]any{"trace": "a", "tenant": "t"})
+	parent := cronet.AnnotationsFromContext(ctx)
+	ctx = cronet.WithAnnotations(ctx, map[string]any{"trace": "b"})
+	annotations := cronet.AnnotationsFromContext(ctx)
+	if annotations["trace"] != "b" || annotations["tenant"] != "t" {
+		t.Fatal("unexpected annotations", annotations)
+	}
+	if parent["trace"] != "a" {
+		t.Fatal("parent annotations modified", parent)
+	}
+	if cronet.AnnotationsFromContext(context.Background()) != nil {
+		t.Fatal("expected no annotations")
+	}
+
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "body")
+	transport := &cronet.RoundTripper{Interceptor: interceptor}
+	response, err := transport.RoundTrip(newRequest(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if annotations := cronet.AnnotationsFromContext(response.Request.Context()); annotations["trace"] != "b" {
+		t.Fatal("annotations lost on the response", annotations)
+	}
+}
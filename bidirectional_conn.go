@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 import (
@@ -25,6 +27,7 @@ type BidirectionalConn struct {
 	read             chan int
 	write            chan struct{}
 	headers          map[string]string
+	trailers         map[string]string
 }
 
 func (e StreamEngine) CreateConn(readWaitHeaders bool, writeWaitHeaders bool) *BidirectionalConn {
@@ -152,6 +155,58 @@ func (c *BidirectionalConn) Write(p []byte) (n int, err error) {
 	}
 }
 
+// CloseWrite sends end of stream to the remote side. Reads are not affected.
+func (c *BidirectionalConn) CloseWrite() error {
+	select {
+	case <-c.close:
+		return net.ErrClosed
+	case <-c.done:
+		return net.ErrClosed
+	default:
+	}
+
+	if c.writeWaitHeaders {
+		select {
+		case <-c.handshake:
+			break
+		case <-c.done:
+			return c.err
+		}
+	} else {
+		select {
+		case <-c.ready:
+			break
+		case <-c.done:
+			return c.err
+		}
+	}
+
+	c.access.Lock()
+
+	select {
+	case <-c.close:
+		c.access.Unlock()
+		return net.ErrClosed
+	case <-c.done:
+		c.access.Unlock()
+		return net.ErrClosed
+	default:
+	}
+
+	c.stream.Write(nil, true)
+	c.access.Unlock()
+
+	select {
+	case <-c.write:
+		return nil
+	case <-c.done:
+		if c.err == io.EOF {
+			return nil
+		}
+		return c.err
+	}
+}
+
 // Done implements context.Context
 func (c *BidirectionalConn) Done() <-chan struct{} {
 	return c.done
@@ -222,6 +277,14 @@ func (c *BidirectionalConn) WaitForHeaders() (map[string]string, error) {
 	}
 }
 
+// Trailers returns the response trailers, or nil if the server sent none.
+// Trailers are only available after Read returned io.EOF.
+func (c *BidirectionalConn) Trailers() map[string]string {
+	c.access.Lock()
+	defer c.access.Unlock()
+	return c.trailers
+}
+
 type bidirectionalHandler struct {
 	*BidirectionalConn
 }
@@ -274,6 +337,9 @@ func (c *bidirectionalHandler) OnWriteCompleted(stream BidirectionalStream) {
 }
 
 func (c *bidirectionalHandler) OnResponseTrailersReceived(stream BidirectionalStream, trailers map[string]string) {
+	c.access.Lock()
+	c.trailers = trailers
+	c.access.Unlock()
 }
 
 func (c *bidirectionalHandler) OnSucceeded(stream BidirectionalStream) {
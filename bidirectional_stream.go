@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdbool.h>
@@ -106,9 +108,7 @@ type BidirectionalStreamCallback interface {
 // Both |calback| and |engine| must remain valid until stream is destroyed.
 func (e StreamEngine) CreateStream(callback BidirectionalStreamCallback) BidirectionalStream {
 	ptr := C.bidirectional_stream_create(e.ptr, nil, &bidirectionalStreamCallback)
-	bidirectionalStreamAccess.Lock()
-	bidirectionalStreamMap[uintptr(unsafe.Pointer(ptr))] = callback
-	bidirectionalStreamAccess.Unlock()
+	bidirectionalStreams.store(uintptr(unsafe.Pointer(ptr)), callback)
 	return BidirectionalStream{ptr}
 }
 
@@ -116,9 +116,7 @@ func (e StreamEngine) CreateStream(callback BidirectionalStreamCallback) Bidirec
 // network thread, but is posted, so |stream| is valid until calling task is
 // complete.
 func (c BidirectionalStream) Destroy() bool {
-	bidirectionalStreamAccess.Lock()
-	delete(bidirectionalStreamMap, uintptr(unsafe.Pointer(c.ptr)))
-	bidirectionalStreamAccess.Unlock()
+	bidirectionalStreams.delete(uintptr(unsafe.Pointer(c.ptr)))
 	return C.bidirectional_stream_destroy(c.ptr) == 0
 }
 
@@ -195,7 +193,11 @@ func (c BidirectionalStream) Read(buffer []byte) int {
 // The callback's BidirectionalStreamCallback.OnSucceeded() method is also invoked if |endOfStream| is
 // set and all response data has been read.
 func (c BidirectionalStream) Write(buffer []byte, endOfStream bool) int {
-	return int(C.bidirectional_stream_write(c.ptr, (*C.char)(unsafe.Pointer(&buffer[0])), C.int(len(buffer)), C.bool(endOfStream)))
+	var data *C.char
+	if len(buffer) > 0 {
+		data = (*C.char)(unsafe.Pointer(&buffer[0]))
+	}
+	return int(C.bidirectional_stream_write(c.ptr, data, C.int(len(buffer)), C.bool(endOfStream)))
 }
 
 // Flush Flushes pending writes. This method should not be called before invocation of
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdbool.h>
@@ -15,18 +17,15 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
 var (
-	bidirectionalStreamAccess   sync.RWMutex
-	bidirectionalStreamMap      map[uintptr]BidirectionalStreamCallback
+	bidirectionalStreams        handleRegistry[BidirectionalStreamCallback]
 	bidirectionalStreamCallback C.bidirectional_stream_callback
 )
 
 func init() {
-	bidirectionalStreamMap = make(map[uintptr]BidirectionalStreamCallback)
 	bidirectionalStreamCallback.on_stream_ready = (*[0]byte)(C.cronetBidirectionalStreamOnStreamReady)
 	bidirectionalStreamCallback.on_response_headers_received = (*[0]byte)(C.cronetBidirectionalStreamOnResponseHeadersReceived)
 	bidirectionalStreamCallback.on_read_completed = (*[0]byte)(C.cronetBidirectionalStreamOnReadCompleted)
@@ -38,9 +37,8 @@ func init() {
 }
 
 func instanceOfBidirectionalStream(stream *C.bidirectional_stream) BidirectionalStreamCallback {
-	bidirectionalStreamAccess.RLock()
-	defer bidirectionalStreamAccess.RUnlock()
-	return bidirectionalStreamMap[uintptr(unsafe.Pointer(stream))]
+	callback, _ := bidirectionalStreams.load(uintptr(unsafe.Pointer(stream)))
+	return callback
 }
 
 //export cronetBidirectionalStreamOnStreamReady
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -7,36 +9,22 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
 func NewBufferCallback(callbackFunc BufferCallbackFunc) BufferCallback {
 	ptr := C.Cronet_BufferCallback_CreateWith((*[0]byte)(C.cronetBufferCallbackOnDestroy))
 	if callbackFunc != nil {
-		bufferCallbackAccess.Lock()
-		bufferCallbackMap[uintptr(unsafe.Pointer(ptr))] = callbackFunc
-		bufferCallbackAccess.Unlock()
+		bufferCallbacks.store(uintptr(unsafe.Pointer(ptr)), callbackFunc)
 	}
 	return BufferCallback{ptr}
 }
 
-var (
-	bufferCallbackAccess sync.Mutex
-	bufferCallbackMap    map[uintptr]BufferCallbackFunc
-)
-
-func init() {
-	bufferCallbackMap = make(map[uintptr]BufferCallbackFunc)
-}
+var bufferCallbacks handleRegistry[BufferCallbackFunc]
 
 //export cronetBufferCallbackOnDestroy
 func cronetBufferCallbackOnDestroy(self C.Cronet_BufferCallbackPtr, buffer C.Cronet_BufferPtr) {
-	ptrInt := uintptr(unsafe.Pointer(self))
-	bufferCallbackAccess.Lock()
-	callback := bufferCallbackMap[ptrInt]
-	delete(bufferCallbackMap, ptrInt)
-	bufferCallbackAccess.Unlock()
+	callback, _ := bufferCallbacks.loadAndDelete(uintptr(unsafe.Pointer(self)))
 	if callback != nil {
 		callback(BufferCallback{self}, Buffer{buffer})
 	}
@@ -0,0 +1,72 @@
+package cronet
+
+import (
+	_ "embed"
+	"encoding/json"
+	"runtime"
+	"sync"
+)
+
+// buildManifest is written by go run ./cmd/build package next to the
+// libraries. A checkout without packaged libraries has an empty manifest.
+//
+//go:embed BUILD_MANIFEST.json
+var buildManifest []byte
+
+// BuildManifest records how the packaged native libraries were built.
+type BuildManifest struct {
+	ChromiumVersion  string `json:"chromium_version"`
+	NaiveProxyCommit string `json:"naiveproxy_commit"`
+	// NaiveProxyVersion is git describe of the naiveproxy checkout, e.g.
+	// v143.0.7499.109-1 for its first release on that Chromium version.
+	NaiveProxyVersion string `json:"naiveproxy_version"`
+	// Packaged is the time the libraries were packaged, in RFC 3339.
+	Packaged  string         `json:"packaged"`
+	Libraries []BuildLibrary `json:"libraries"`
+}
+
+// BuildLibrary is the packaged library of one target.
+type BuildLibrary struct {
+	// Target is the target of cmd/build, e.g. linux/amd64 or linux/amd64-musl.
+	Target string `json:"target"`
+	// File is the library relative to the module root.
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Shared bool   `json:"shared,omitempty"`
+	// GNArgs are the gn args the library was built with.
+	GNArgs string `json:"gn_args"`
+	// Clang and NDK are the first line of clang --version and the NDK
+	// revision of Android libraries.
+	Clang string `json:"clang"`
+	NDK   string `json:"ndk,omitempty"`
+}
+
+var (
+	buildInfoOnce     sync.Once
+	buildInfoManifest BuildManifest
+	buildInfoOK       bool
+)
+
+// BuildInfo returns the manifest of the packaged libraries embedded in the
+// package, or false if the libraries were not packaged by cmd/build.
+func BuildInfo() (BuildManifest, bool) {
+	buildInfoOnce.Do(func() {
+		buildInfoOK = json.Unmarshal(buildManifest, &buildInfoManifest) == nil && buildInfoManifest.ChromiumVersion != ""
+	})
+	return buildInfoManifest, buildInfoOK
+}
+
+// Library returns the entry of the library linked into this binary.
+func (m BuildManifest) Library() (BuildLibrary, bool) {
+	target := runtime.GOOS + "/" + runtime.GOARCH
+	if buildLibc != "" {
+		target += "-" + buildLibc
+	}
+	for _, library := range m.Libraries {
+		if library.Target == target {
+			return library, true
+		}
+	}
+	return BuildLibrary{}, false
+}
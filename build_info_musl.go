@@ -0,0 +1,6 @@
+//go:build musl
+
+package cronet
+
+// buildLibc is the libc of the linked library, selected by the musl build tag.
+const buildLibc = "musl"
@@ -0,0 +1,5 @@
+//go:build !musl
+
+package cronet
+
+const buildLibc = ""
@@ -0,0 +1,30 @@
+package cronet_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestBuildInfo(t *testing.T) {
+	manifest, ok := cronet.BuildInfo()
+	if !ok {
+		t.Skip("libraries not packaged by cmd/build")
+	}
+	library, ok := manifest.Library()
+	if !ok {
+		t.Fatalf("manifest of Chromium %s has no library for this target", manifest.ChromiumVersion)
+	}
+	content, err := os.ReadFile(filepath.FromSlash(library.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != library.SHA256 {
+		t.Errorf("%s does not match its SHA-256 in the manifest", library.File)
+	}
+}
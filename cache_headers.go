@@ -0,0 +1,261 @@
+package cronet
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDeltaSeconds is the largest delta-seconds value, to which larger
+// values are capped as RFC 9111 requires.
+const maxDeltaSeconds = math.MaxInt32
+
+// CacheControl is a parsed Cache-Control header of a request or response.
+// Durations are -1 if their directive is absent; invalid values are read as
+// zero, which makes a response stale, as RFC 9111 advises.
+type CacheControl struct {
+	MaxAge               time.Duration
+	SharedMaxAge         time.Duration
+	MaxStale             time.Duration
+	MinFresh             time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+
+	// NoCache is set by no-cache with or without a list of header names,
+	// which are in NoCacheHeaders.
+	NoCache        bool
+	NoCacheHeaders []string
+	// Private is set by private with or without a list of header names, which
+	// are in PrivateHeaders.
+	Private        bool
+	PrivateHeaders []string
+
+	NoStore         bool
+	NoTransform     bool
+	Public          bool
+	MustRevalidate  bool
+	ProxyRevalidate bool
+	MustUnderstand  bool
+	Immutable       bool
+	OnlyIfCached    bool
+
+	// Extensions are the other directives by lower case name, with their
+	// unquoted values.
+	Extensions map[string]string
+}
+
+// ParseCacheControl parses the Cache-Control headers of |header|. Of
+// repeated directives the first counts.
+func ParseCacheControl(header http.Header) CacheControl {
+	control := CacheControl{
+		MaxAge:               -1,
+		SharedMaxAge:         -1,
+		MaxStale:             -1,
+		MinFresh:             -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+	seen := make(map[string]bool)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range parseDirectives(value) {
+			if seen[directive.name] {
+				continue
+			}
+			seen[directive.name] = true
+			switch directive.name {
+			case "max-age":
+				control.MaxAge = parseDeltaSeconds(directive.value)
+			case "s-maxage":
+				control.SharedMaxAge = parseDeltaSeconds(directive.value)
+			case "max-stale":
+				// Without a value any staleness is accepted
+				if directive.hasValue {
+					control.MaxStale = parseDeltaSeconds(directive.value)
+				} else {
+					control.MaxStale = maxDeltaSeconds * time.Second
+				}
+			case "min-fresh":
+				control.MinFresh = parseDeltaSeconds(directive.value)
+			case "stale-while-revalidate":
+				control.StaleWhileRevalidate = parseDeltaSeconds(directive.value)
+			case "stale-if-error":
+				control.StaleIfError = parseDeltaSeconds(directive.value)
+			case "no-cache":
+				control.NoCache = true
+				control.NoCacheHeaders = parseFieldNames(directive.value)
+			case "private":
+				control.Private = true
+				control.PrivateHeaders = parseFieldNames(directive.value)
+			case "no-store":
+				control.NoStore = true
+			case "no-transform":
+				control.NoTransform = true
+			case "public":
+				control.Public = true
+			case "must-revalidate":
+				control.MustRevalidate = true
+			case "proxy-revalidate":
+				control.ProxyRevalidate = true
+			case "must-understand":
+				control.MustUnderstand = true
+			case "immutable":
+				control.Immutable = true
+			case "only-if-cached":
+				control.OnlyIfCached = true
+			default:
+				if control.Extensions == nil {
+					control.Extensions = make(map[string]string)
+				}
+				control.Extensions[directive.name] = directive.value
+			}
+		}
+	}
+	return control
+}
+
+// ParseAge returns the Age header of |header|, the time a response spent in
+// caches.
+func ParseAge(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Age"))
+	if !isDeltaSeconds(value) {
+		return 0, false
+	}
+	return parseDeltaSeconds(value), true
+}
+
+// ParseDate returns the HTTP date in the header |name| of |header|, e.g.
+// Date, Expires or Last-Modified. An invalid Expires header, e.g. "0",
+// means the response has already expired.
+func ParseDate(header http.Header, name string) (time.Time, bool) {
+	value := strings.TrimSpace(header.Get(name))
+	if value == "" {
+		return time.Time{}, false
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// ParseRetryAfter returns how long to wait before retrying as asked by the
+// Retry-After header of |header|, a number of seconds or an HTTP date. Dates
+// are taken relative to the Date header, or to |now| without one, so a
+// skewed local clock does not matter; dates in the past mean no wait.
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if isDeltaSeconds(value) {
+		return parseDeltaSeconds(value), true
+	}
+	retryAt, ok := ParseDate(header, "Retry-After")
+	if !ok {
+		return 0, false
+	}
+	if date, ok := ParseDate(header, "Date"); ok {
+		now = date
+	}
+	delay := retryAt.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+func isDeltaSeconds(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if value[i] < '0' || value[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDeltaSeconds parses a delta-seconds value, capped at maxDeltaSeconds.
+// Invalid values are zero.
+func parseDeltaSeconds(value string) time.Duration {
+	if !isDeltaSeconds(value) {
+		return 0
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds > maxDeltaSeconds {
+		// Only overflow fails for digits
+		seconds = maxDeltaSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+type cacheDirective struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// parseDirectives splits a header value into comma separated directives of
+// the form name[=token|quoted-string]. Names are lower cased, quoted values
+// unquoted; commas inside quotes do not split.
+func parseDirectives(value string) []cacheDirective {
+	var directives []cacheDirective
+	for len(value) > 0 {
+		var current cacheDirective
+		end := strings.IndexAny(value, ",=")
+		if end < 0 {
+			end = len(value)
+		}
+		current.name = strings.ToLower(strings.TrimSpace(value[:end]))
+		value = value[end:]
+		if strings.HasPrefix(value, "=") {
+			current.hasValue = true
+			value = strings.TrimLeft(value[1:], " \t")
+			if strings.HasPrefix(value, `"`) {
+				var quoted strings.Builder
+				i := 1
+				for ; i < len(value) && value[i] != '"'; i++ {
+					if value[i] == '\\' && i+1 < len(value) {
+						i++
+					}
+					quoted.WriteByte(value[i])
+				}
+				current.value = quoted.String()
+				if i < len(value) {
+					// Skip the closing quote
+					i++
+				}
+				value = value[i:]
+				if comma := strings.IndexByte(value, ','); comma >= 0 {
+					value = value[comma:]
+				} else {
+					value = ""
+				}
+			} else {
+				end := strings.IndexByte(value, ',')
+				if end < 0 {
+					end = len(value)
+				}
+				current.value = strings.TrimSpace(value[:end])
+				value = value[end:]
+			}
+		}
+		value = strings.TrimPrefix(value, ",")
+		if current.name != "" {
+			directives = append(directives, current)
+		}
+	}
+	return directives
+}
+
+// parseFieldNames parses the header names listed in the value of a no-cache
+// or private directive.
+func parseFieldNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+	return names
+}
@@ -0,0 +1,87 @@
+package cronet_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	header := http.Header{"Cache-Control": {
+		`Public, max-age=60, no-cache="Set-Cookie, X-Token", S-MAXAGE = 120`,
+		`max-age=5, stale-while-revalidate=30, max-stale, foo="a\"b,c", bar, immutable`,
+	}}
+	control := cronet.ParseCacheControl(header)
+	if control.MaxAge != time.Minute || control.SharedMaxAge != 2*time.Minute || control.StaleWhileRevalidate != 30*time.Second {
+		t.Errorf("unexpected durations %+v", control)
+	}
+	if control.StaleIfError != -1 || control.MinFresh != -1 || control.MaxStale <= 0 {
+		t.Errorf("unexpected absent durations %+v", control)
+	}
+	if !control.Public || !control.NoCache || !control.Immutable || control.NoStore || control.Private {
+		t.Errorf("unexpected flags %+v", control)
+	}
+	if !reflect.DeepEqual(control.NoCacheHeaders, []string{"Set-Cookie", "X-Token"}) {
+		t.Error("unexpected no-cache headers", control.NoCacheHeaders)
+	}
+	if !reflect.DeepEqual(control.Extensions, map[string]string{"foo": `a"b,c`, "bar": ""}) {
+		t.Error("unexpected extensions", control.Extensions)
+	}
+
+	control = cronet.ParseCacheControl(http.Header{"Cache-Control": {"max-age=abc, s-maxage=99999999999, private, no-store"}})
+	if control.MaxAge != 0 || control.SharedMaxAge != (1<<31-1)*time.Second || !control.Private || !control.NoStore {
+		t.Errorf("unexpected invalid values %+v", control)
+	}
+	if control = cronet.ParseCacheControl(http.Header{}); control.MaxAge != -1 || control.NoCache {
+		t.Errorf("unexpected empty header %+v", control)
+	}
+}
+
+func TestParseAgeAndDate(t *testing.T) {
+	header := http.Header{
+		"Age":     {" 42 "},
+		"Date":    {"Sun, 06 Nov 1994 08:49:37 GMT"},
+		"Expires": {"0"},
+	}
+	if age, ok := cronet.ParseAge(header); !ok || age != 42*time.Second {
+		t.Error("unexpected age", age, ok)
+	}
+	if _, ok := cronet.ParseAge(http.Header{"Age": {"-1"}}); ok {
+		t.Error("negative age accepted")
+	}
+	date, ok := cronet.ParseDate(header, "Date")
+	if !ok || !date.Equal(time.Date(1994, 11, 6, 8, 49, 37, 0, time.UTC)) {
+		t.Error("unexpected date", date, ok)
+	}
+	if date, ok = cronet.ParseDate(http.Header{"Date": {"Sunday, 06-Nov-94 08:49:37 GMT"}}, "Date"); !ok || date.Year() != 1994 {
+		t.Error("RFC 850 date not parsed", date, ok)
+	}
+	if _, ok := cronet.ParseDate(header, "Expires"); ok {
+		t.Error("invalid Expires accepted")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		header http.Header
+		delay  time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"120"}}, 2 * time.Minute, true},
+		{http.Header{"Retry-After": {"Mon, 01 Jan 2024 00:00:30 GMT"}}, 30 * time.Second, true},
+		// Relative to the server clock
+		{http.Header{"Retry-After": {"Mon, 01 Jan 2024 01:00:30 GMT"}, "Date": {"Mon, 01 Jan 2024 01:00:00 GMT"}}, 30 * time.Second, true},
+		{http.Header{"Retry-After": {"Sun, 31 Dec 2023 23:00:00 GMT"}}, 0, true},
+		{http.Header{"Retry-After": {"soon"}}, 0, false},
+		{http.Header{}, 0, false},
+	} {
+		delay, ok := cronet.ParseRetryAfter(test.header, now)
+		if delay != test.delay || ok != test.ok {
+			t.Errorf("%v: got %s %v", test.header, delay, ok)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cronet
+
+// Capabilities reports what the network stack of the binary supports, so
+// programs built with and without the cronet_nolib tag can tell them apart
+// at run time.
+type Capabilities struct {
+	// NativeLibrary reports whether the Cronet library is linked. Without
+	// it, built with the cronet_nolib tag, the engine types do not exist and
+	// RoundTripper sends requests with net/http.
+	NativeLibrary bool
+	// HTTP2 and HTTP3 report the protocols requests can be sent over.
+	HTTP2 bool
+	HTTP3 bool
+	// Brotli reports whether responses can be brotli encoded.
+	Brotli bool
+	// DiskCache reports whether responses can be cached on disk, see
+	// EngineParams.SetHTTPCacheMode.
+	DiskCache bool
+	// NetLog reports whether network events can be logged, see
+	// Engine.StartNetLogToFile.
+	NetLog bool
+	// ExpectContinue reports whether requests with an "Expect: 100-continue"
+	// header hold back their body until the server answers 100 Continue, as
+	// net/http does. The native stack skips interim responses, which the C
+	// API does not report, and can only hold back the body for
+	// RoundTripper.ExpectContinueTimeout.
+	ExpectContinue bool
+	// InformationalResponses reports whether 1xx responses, e.g. 103 Early
+	// Hints, are reported to the Got1xxResponse hook of an
+	// httptrace.ClientTrace in the request context before the final
+	// response. The native stack skips them; ReadNetLogInformationalResponses
+	// finds 103 Early Hints in the NetLog.
+	InformationalResponses bool
+}
+
+// SupportedCapabilities returns the capabilities of the network stack linked
+// into the binary.
+func SupportedCapabilities() Capabilities {
+	return Capabilities{
+		NativeLibrary:          nativeLibrary,
+		HTTP2:                  true,
+		HTTP3:                  nativeLibrary,
+		Brotli:                 nativeLibrary,
+		DiskCache:              nativeLibrary,
+		NetLog:                 nativeLibrary,
+		ExpectContinue:         !nativeLibrary,
+		InformationalResponses: !nativeLibrary,
+	}
+}
@@ -0,0 +1,255 @@
+package cronet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is wrapped by the errors of requests a CircuitBreaker
+// rejected without sending them.
+var ErrCircuitOpen = errors.New("cronet: circuit open")
+
+// CircuitState is the state of the circuit of a host.
+type CircuitState int
+
+const (
+	// CircuitClosed sends requests.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen sends a limited number of probe requests, which
+	// close the circuit on success and open it again on failure.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitBreaker stops sending requests to a host after consecutive
+// failures, failing them fast with an error wrapping ErrCircuitOpen instead
+// of waiting for a dead upstream to time out. After OpenDuration the circuit
+// half-opens and lets probe requests through to find out whether the host
+// is back. Hosts are told apart by host and port.
+//
+// A request counts once its response headers arrived or it failed. The
+// fields must not be changed once the CircuitBreaker is in use. A
+// CircuitBreaker is safe for concurrent use and can be shared between
+// RoundTrippers.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures opening the
+	// circuit of a host. Zero means 5.
+	FailureThreshold int
+	// OpenDuration is how long a circuit stays open before it half-opens.
+	// Zero means 30 seconds.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of requests sent at once while the
+	// circuit is half-open. Zero means 1.
+	HalfOpenProbes int
+	// IsFailure reports whether a request failed. Nil counts errors, except
+	// cancellations by the caller, and 502, 503 and 504 responses.
+	IsFailure func(response *http.Response, err error) bool
+	// OnStateChange, if set, is called when the circuit of |host| changes to
+	// |state|.
+	OnStateChange func(host string, state CircuitState)
+
+	access   sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// State returns the state of the circuit of |host|, e.g. "example.com:443".
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.access.Lock()
+	defer b.access.Unlock()
+	c := b.circuits[strings.ToLower(host)]
+	if c == nil {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.openDuration() {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// Reset closes the circuit of |host|.
+func (b *CircuitBreaker) Reset(host string) {
+	host = strings.ToLower(host)
+	b.access.Lock()
+	c := b.circuits[host]
+	delete(b.circuits, host)
+	b.access.Unlock()
+	if c != nil && c.state != CircuitClosed {
+		b.stateChanged(host, CircuitClosed)
+	}
+}
+
+func (b *CircuitBreaker) failureThreshold() int {
+	if b.FailureThreshold > 0 {
+		return b.FailureThreshold
+	}
+	return defaultCircuitFailureThreshold
+}
+
+func (b *CircuitBreaker) openDuration() time.Duration {
+	if b.OpenDuration > 0 {
+		return b.OpenDuration
+	}
+	return defaultCircuitOpenDuration
+}
+
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes > 0 {
+		return b.HalfOpenProbes
+	}
+	return 1
+}
+
+func (b *CircuitBreaker) stateChanged(host string, state CircuitState) {
+	if b.OnStateChange != nil {
+		b.OnStateChange(host, state)
+	}
+}
+
+// circuitRequest is a request let through by a CircuitBreaker. Its methods do
+// nothing on a nil circuitRequest, which is what startCircuit returns
+// without a breaker.
+type circuitRequest struct {
+	breaker *CircuitBreaker
+	host    string
+	ctx     context.Context
+	probe   bool
+}
+
+// startCircuit lets |request| through |breaker|, which may be nil, or
+// returns an error wrapping ErrCircuitOpen.
+func startCircuit(breaker *CircuitBreaker, request *http.Request) (*circuitRequest, error) {
+	if breaker == nil {
+		return nil, nil
+	}
+	host := strings.ToLower(request.URL.Host)
+	breaker.access.Lock()
+	c := breaker.circuits[host]
+	if c == nil || c.state == CircuitClosed {
+		breaker.access.Unlock()
+		return &circuitRequest{breaker: breaker, host: host, ctx: request.Context()}, nil
+	}
+	halfOpened := false
+	if c.state == CircuitOpen {
+		remaining := breaker.openDuration() - time.Since(c.openedAt)
+		if remaining > 0 {
+			breaker.access.Unlock()
+			return nil, fmt.Errorf("%w: %s for another %s", ErrCircuitOpen, host, remaining.Round(time.Millisecond))
+		}
+		c.state = CircuitHalfOpen
+		halfOpened = true
+	}
+	if c.probes >= breaker.halfOpenProbes() {
+		breaker.access.Unlock()
+		return nil, fmt.Errorf("%w: %s is being probed", ErrCircuitOpen, host)
+	}
+	c.probes++
+	breaker.access.Unlock()
+	if halfOpened {
+		breaker.stateChanged(host, CircuitHalfOpen)
+	}
+	return &circuitRequest{breaker: breaker, host: host, ctx: request.Context(), probe: true}, nil
+}
+
+// abort lets the request go uncounted, e.g. if it was not sent.
+func (r *circuitRequest) abort() {
+	if r == nil || !r.probe {
+		return
+	}
+	r.breaker.access.Lock()
+	if c := r.breaker.circuits[r.host]; c != nil {
+		c.probes--
+	}
+	r.breaker.access.Unlock()
+}
+
+// finish counts the outcome of the request.
+func (r *circuitRequest) finish(response *http.Response, err error) {
+	if r == nil {
+		return
+	}
+	b := r.breaker
+	var failed, ignored bool
+	if b.IsFailure != nil {
+		failed = b.IsFailure(response, err)
+	} else {
+		// Requests the caller gave up on tell nothing about the host
+		ignored = err != nil && errors.Is(err, context.Canceled) && r.ctx.Err() != nil
+		failed = err != nil || isUpstreamFailureStatus(response.StatusCode)
+	}
+
+	changed := false
+	var state CircuitState
+	b.access.Lock()
+	c := b.circuits[r.host]
+	if r.probe && c != nil {
+		c.probes--
+	}
+	switch {
+	case ignored:
+	case !failed:
+		if c != nil {
+			changed = c.state != CircuitClosed
+			delete(b.circuits, r.host)
+		}
+		state = CircuitClosed
+	default:
+		if c == nil {
+			if b.circuits == nil {
+				b.circuits = make(map[string]*circuit)
+			}
+			c = &circuit{}
+			b.circuits[r.host] = c
+		}
+		c.failures++
+		if c.state == CircuitHalfOpen || c.state == CircuitClosed && c.failures >= b.failureThreshold() {
+			changed = c.state != CircuitOpen
+			c.state = CircuitOpen
+			c.openedAt = time.Now()
+		}
+		state = c.state
+	}
+	b.access.Unlock()
+	if changed {
+		b.stateChanged(r.host, state)
+	}
+}
+
+func isUpstreamFailureStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
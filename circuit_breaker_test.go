@@ -0,0 +1,95 @@
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").Times(2).RespondError(io.ErrUnexpectedEOF)
+	interceptor.On(http.MethodGet, "https://example.com/").Times(1).RespondString(http.StatusServiceUnavailable, "")
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "")
+	var states []cronet.CircuitState
+	breaker := &cronet.CircuitBreaker{
+		FailureThreshold: 2,
+		OpenDuration:     50 * time.Millisecond,
+		OnStateChange: func(host string, state cronet.CircuitState) {
+			if host != "example.com" {
+				t.Error("unexpected host", host)
+			}
+			states = append(states, state)
+		},
+	}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, CircuitBreaker: breaker}
+	send := func() (*http.Response, error) {
+		response, err := transport.RoundTrip(newRequest(t, context.Background()))
+		if err == nil {
+			response.Body.Close()
+		}
+		return response, err
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := send(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatal("expected the request to be sent, got", err)
+		}
+	}
+	if breaker.State("example.com") != cronet.CircuitOpen {
+		t.Fatal("expected the circuit to open, got", breaker.State("example.com"))
+	}
+	if _, err := send(); !errors.Is(err, cronet.ErrCircuitOpen) {
+		t.Fatal("expected ErrCircuitOpen, got", err)
+	}
+	if len(interceptor.Requests()) != 2 {
+		t.Fatal("request sent through an open circuit")
+	}
+
+	// The probe fails with 503 and opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if response, err := send(); err != nil || response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("expected the probe to be sent, got", err)
+	}
+	if _, err := send(); !errors.Is(err, cronet.ErrCircuitOpen) {
+		t.Fatal("expected ErrCircuitOpen, got", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := send(); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.State("example.com") != cronet.CircuitClosed {
+		t.Fatal("expected the circuit to close, got", breaker.State("example.com"))
+	}
+	expected := []cronet.CircuitState{cronet.CircuitOpen, cronet.CircuitHalfOpen, cronet.CircuitOpen, cronet.CircuitHalfOpen, cronet.CircuitClosed}
+	if len(states) != len(expected) {
+		t.Fatal("unexpected state changes", states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Fatal("unexpected state changes", states)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "")
+	breaker := &cronet.CircuitBreaker{FailureThreshold: 1}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, CircuitBreaker: breaker}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := transport.RoundTrip(newRequest(t, ctx)); !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	if breaker.State("example.com") != cronet.CircuitClosed {
+		t.Fatal("canceled request opened the circuit")
+	}
+}
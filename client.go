@@ -0,0 +1,176 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrResponseTooLarge = errors.New("cronet: response body too large")
+
+// Response is a response with its body read completely by Client.
+type Response struct {
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Request is the request that was sent.
+	Request *http.Request
+}
+
+// Date returns the Date header, when the response was generated.
+func (r *Response) Date() (time.Time, bool) {
+	return ParseDate(r.Header, "Date")
+}
+
+// Expires returns the Expires header. A response with an invalid Expires
+// header, e.g. "0", has already expired.
+func (r *Response) Expires() (time.Time, bool) {
+	return ParseDate(r.Header, "Expires")
+}
+
+// Age returns the Age header, the time the response spent in caches.
+func (r *Response) Age() (time.Duration, bool) {
+	return ParseAge(r.Header)
+}
+
+// CacheControl returns the parsed Cache-Control header.
+func (r *Response) CacheControl() CacheControl {
+	return ParseCacheControl(r.Header)
+}
+
+// RetryAfter returns how long to wait before retrying, e.g. after a 429 or
+// 503 response, as asked by the Retry-After header. See ParseRetryAfter.
+func (r *Response) RetryAfter() (time.Duration, bool) {
+	return ParseRetryAfter(r.Header, time.Now())
+}
+
+// DecodeJSON decodes the JSON body of the response into |v|. Client reads
+// bodies completely; use DecodeJSON on the response of a RoundTripper to
+// decode while the body is received.
+func (r *Response) DecodeJSON(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Client is a synchronous client for requests without streaming, reading
+// each response body completely. The zero value is ready to use and sends
+// requests with a RoundTripper on a default engine.
+type Client struct {
+	// Transport sends the requests. If nil, a RoundTripper created on first
+	// use with Engine is used.
+	Transport *RoundTripper
+	// Engine is the engine of the RoundTripper created when Transport is nil.
+	// If unset, the RoundTripper starts its own engine.
+	Engine Engine
+	// Timeout limits the time of a request including reading the body. Zero
+	// means no timeout.
+	Timeout time.Duration
+	// MaxBodySize limits the response body size; larger responses fail with
+	// ErrResponseTooLarge. Zero means unlimited.
+	MaxBodySize int64
+
+	transportOnce sync.Once
+}
+
+func (c *Client) transport() *RoundTripper {
+	c.transportOnce.Do(func() {
+		if c.Transport == nil {
+			c.Transport = &RoundTripper{Engine: c.Engine}
+		}
+	})
+	return c.Transport
+}
+
+// Get sends a GET request to |url|.
+func (c *Client) Get(url string) (*Response, error) {
+	return c.send(http.MethodGet, url, "", nil)
+}
+
+// Head sends a HEAD request to |url|. The response has no body.
+func (c *Client) Head(url string) (*Response, error) {
+	return c.send(http.MethodHead, url, "", nil)
+}
+
+// Options sends an OPTIONS request to |url|, e.g. to find the methods it
+// allows in the Allow header.
+func (c *Client) Options(url string) (*Response, error) {
+	return c.send(http.MethodOptions, url, "", nil)
+}
+
+// Post sends a POST request with |body| of |contentType| to |url|.
+func (c *Client) Post(url string, contentType string, body io.Reader) (*Response, error) {
+	return c.send(http.MethodPost, url, contentType, body)
+}
+
+// Put sends a PUT request with |body| of |contentType| to |url|.
+func (c *Client) Put(url string, contentType string, body io.Reader) (*Response, error) {
+	return c.send(http.MethodPut, url, contentType, body)
+}
+
+// Patch sends a PATCH request with |body| of |contentType| to |url|.
+func (c *Client) Patch(url string, contentType string, body io.Reader) (*Response, error) {
+	return c.send(http.MethodPatch, url, contentType, body)
+}
+
+// Delete sends a DELETE request to |url|.
+func (c *Client) Delete(url string) (*Response, error) {
+	return c.send(http.MethodDelete, url, "", nil)
+}
+
+// send sends a request with |method| and |body| of |contentType|, if any, to
+// |url|.
+func (c *Client) send(method string, url string, contentType string, body io.Reader) (*Response, error) {
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	return c.Do(request)
+}
+
+// PostString sends a POST request with |body| of |contentType| to |url|.
+func (c *Client) PostString(url string, contentType string, body string) (*Response, error) {
+	return c.Post(url, contentType, strings.NewReader(body))
+}
+
+// Do sends |request| and reads the response body. Responses with any status
+// code are returned without error.
+func (c *Client) Do(request *http.Request) (*Response, error) {
+	if c.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(request.Context(), c.Timeout)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
+	httpResponse, err := c.transport().RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	var reader io.Reader = httpResponse.Body
+	if c.MaxBodySize > 0 {
+		reader = io.LimitReader(reader, c.MaxBodySize+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBodySize > 0 && int64(len(body)) > c.MaxBodySize {
+		return nil, ErrResponseTooLarge
+	}
+	return &Response{
+		Status:     httpResponse.Status,
+		StatusCode: httpResponse.StatusCode,
+		Header:     httpResponse.Header,
+		Body:       body,
+		Request:    httpResponse.Request,
+	}, nil
+}
@@ -0,0 +1,281 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultMaxConcurrentStreams matches the limit most HTTP/2 and HTTP/3
+// servers advertise.
+const defaultMaxConcurrentStreams = 100
+
+var ErrClientConnUnusable = errors.New("cronet: client conn is closed or closing")
+
+// ClientConnState describes the state of a ClientConn, like
+// golang.org/x/net/http2.ClientConnState.
+type ClientConnState struct {
+	Closed               bool
+	Closing              bool
+	StreamsActive        int
+	StreamsReserved      int
+	StreamsPending       int
+	MaxConcurrentStreams uint32
+	// LastIdle is when the ClientConn last had no active streams, or zero if
+	// it is in use.
+	LastIdle time.Time
+}
+
+// ClientConn sends requests to a single origin with the stream accounting of
+// golang.org/x/net/http2.ClientConn, for code migrating from its low-level API.
+//
+// Cronet owns the sockets and pools requests of an origin onto its HTTP/2 or
+// HTTP/3 connection itself, so a ClientConn is a view of that connection
+// rather than a socket: stream limits are enforced here, and Ping sends a
+// request as there is no frame-level control such as PING.
+type ClientConn struct {
+	transport            *RoundTripper
+	origin               *url.URL
+	maxConcurrentStreams uint32
+	slots                chan struct{}
+
+	access   sync.Mutex
+	closed   bool
+	closing  bool
+	active   map[*clientConnStream]struct{}
+	reserved int
+	pending  int
+	lastIdle time.Time
+	idle     chan struct{}
+}
+
+type clientConnStream struct {
+	cancel context.CancelFunc
+}
+
+// NewClientConn returns a ClientConn for |origin|, e.g. "https://example.com".
+// At most |maxConcurrentStreams| requests are in flight at the same time,
+// further requests wait; zero means 100.
+func (t *RoundTripper) NewClientConn(origin string, maxConcurrentStreams uint32) (*ClientConn, error) {
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+	if originURL.Scheme != "https" && originURL.Scheme != "http" || originURL.Host == "" {
+		return nil, fmt.Errorf("cronet: invalid origin %q", origin)
+	}
+	if maxConcurrentStreams == 0 {
+		maxConcurrentStreams = defaultMaxConcurrentStreams
+	}
+	return &ClientConn{
+		transport:            t,
+		origin:               &url.URL{Scheme: originURL.Scheme, Host: originURL.Host},
+		maxConcurrentStreams: maxConcurrentStreams,
+		slots:                make(chan struct{}, maxConcurrentStreams),
+		active:               make(map[*clientConnStream]struct{}),
+		lastIdle:             time.Now(),
+	}, nil
+}
+
+// RoundTrip sends |request|, which must be for the origin of the ClientConn.
+// It waits for a free stream unless one was reserved with ReserveNewRequest.
+func (c *ClientConn) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Scheme != c.origin.Scheme || request.URL.Host != c.origin.Host {
+		closeRequestBody(request)
+		return nil, fmt.Errorf("cronet: request for %s://%s sent to client conn of %s", request.URL.Scheme, request.URL.Host, c.origin)
+	}
+	stream, ctx, err := c.acquire(request.Context())
+	if err != nil {
+		closeRequestBody(request)
+		return nil, err
+	}
+	response, err := c.transport.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		c.release(stream)
+		return nil, err
+	}
+	response.Body = &clientConnBody{ReadCloser: response.Body, release: func() {
+		c.release(stream)
+	}}
+	return response, nil
+}
+
+// Ping checks that the origin answers, like
+// golang.org/x/net/http2.ClientConn.Ping. Cronet does not expose PING frames,
+// so Ping sends a HEAD request for "/" on a stream of the ClientConn instead;
+// any response counts as an answer.
+func (c *ClientConn) Ping(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, c.origin.String()+"/", nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.RoundTrip(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// ReserveNewRequest reserves a stream for a subsequent RoundTrip call and
+// reports whether one was available.
+func (c *ClientConn) ReserveNewRequest() bool {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.closed || c.closing {
+		return false
+	}
+	select {
+	case c.slots <- struct{}{}:
+		c.reserved++
+		return true
+	default:
+		return false
+	}
+}
+
+// CanTakeNewRequest reports whether RoundTrip would start a request without waiting.
+func (c *ClientConn) CanTakeNewRequest() bool {
+	c.access.Lock()
+	defer c.access.Unlock()
+	return !c.closed && !c.closing && (c.reserved > 0 || len(c.slots) < cap(c.slots))
+}
+
+// State returns a snapshot of the stream accounting.
+func (c *ClientConn) State() ClientConnState {
+	c.access.Lock()
+	defer c.access.Unlock()
+	state := ClientConnState{
+		Closed:               c.closed,
+		Closing:              c.closing,
+		StreamsActive:        len(c.active),
+		StreamsReserved:      c.reserved,
+		StreamsPending:       c.pending,
+		MaxConcurrentStreams: c.maxConcurrentStreams,
+	}
+	if len(c.active) == 0 {
+		state.LastIdle = c.lastIdle
+	}
+	return state
+}
+
+// Shutdown rejects new requests and waits for active ones to finish or for
+// |ctx| to be done.
+func (c *ClientConn) Shutdown(ctx context.Context) error {
+	c.access.Lock()
+	if c.closed {
+		c.access.Unlock()
+		return nil
+	}
+	c.closing = true
+	if len(c.active) == 0 {
+		c.closed = true
+		c.access.Unlock()
+		return nil
+	}
+	if c.idle == nil {
+		c.idle = make(chan struct{})
+	}
+	idle := c.idle
+	c.access.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close cancels all active requests and rejects new ones.
+func (c *ClientConn) Close() error {
+	c.access.Lock()
+	c.closed = true
+	streams := make([]*clientConnStream, 0, len(c.active))
+	for stream := range c.active {
+		streams = append(streams, stream)
+	}
+	c.access.Unlock()
+	for _, stream := range streams {
+		stream.cancel()
+	}
+	return nil
+}
+
+func (c *ClientConn) acquire(ctx context.Context) (*clientConnStream, context.Context, error) {
+	c.access.Lock()
+	if c.closed || c.closing {
+		c.access.Unlock()
+		return nil, nil, ErrClientConnUnusable
+	}
+	if c.reserved > 0 {
+		c.reserved--
+	} else {
+		c.pending++
+		c.access.Unlock()
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			c.access.Lock()
+			c.pending--
+			c.access.Unlock()
+			return nil, nil, ctx.Err()
+		}
+		c.access.Lock()
+		c.pending--
+		if c.closed || c.closing {
+			c.access.Unlock()
+			<-c.slots
+			return nil, nil, ErrClientConnUnusable
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &clientConnStream{cancel}
+	c.active[stream] = struct{}{}
+	c.access.Unlock()
+	return stream, ctx, nil
+}
+
+func (c *ClientConn) release(stream *clientConnStream) {
+	stream.cancel()
+	c.access.Lock()
+	defer c.access.Unlock()
+	delete(c.active, stream)
+	<-c.slots
+	if len(c.active) == 0 {
+		c.lastIdle = time.Now()
+		if c.closing {
+			c.closed = true
+			if c.idle != nil {
+				close(c.idle)
+				c.idle = nil
+			}
+		}
+	}
+}
+
+// clientConnBody frees the stream once the body was read to the end or closed.
+type clientConnBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *clientConnBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return
+}
+
+func (b *clientConnBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
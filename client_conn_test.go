@@ -0,0 +1,224 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestClientConnStreams(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		if request.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-request.Context().Done():
+			}
+		}
+		io.WriteString(writer, "done")
+	}))
+	defer server.Close()
+
+	transport := &cronet.RoundTripper{Engine: newFirstByteEngine(t)}
+	if _, err := transport.NewClientConn("ftp://example.com", 1); err == nil {
+		t.Fatal("expected an invalid origin to be rejected")
+	}
+	conn, err := transport.NewClientConn(server.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := conn.State(); state.MaxConcurrentStreams != 1 || state.LastIdle.IsZero() {
+		t.Fatalf("unexpected initial state %+v", state)
+	}
+	other, _ := http.NewRequest(http.MethodGet, "http://other.example/", nil)
+	if _, err = conn.RoundTrip(other); err == nil {
+		t.Fatal("expected a request for another origin to be rejected")
+	}
+
+	// The only stream is taken until the body is finished
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	response, err := conn.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.CanTakeNewRequest() || conn.ReserveNewRequest() {
+		t.Fatal("expected no free stream")
+	}
+	if state := conn.State(); state.StreamsActive != 1 || !state.LastIdle.IsZero() {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	waiting := make(chan error, 1)
+	go func() {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+		response, err := conn.RoundTrip(request)
+		if err == nil {
+			_, err = io.ReadAll(response.Body)
+			response.Body.Close()
+		}
+		waiting <- err
+	}()
+	waitFor(t, func() bool { return conn.State().StreamsPending == 1 })
+	close(release)
+	if _, err = io.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-waiting:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("waiting request not started after the stream was freed")
+	}
+	response.Body.Close()
+
+	// A reserved stream is used by the next RoundTrip
+	if !conn.ReserveNewRequest() {
+		t.Fatal("expected a stream to be reserved")
+	}
+	if state := conn.State(); state.StreamsReserved != 1 || !conn.CanTakeNewRequest() {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	request, _ = http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	response, err = conn.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	if state := conn.State(); state.StreamsReserved != 0 || state.StreamsActive != 0 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// Waiting for a stream ends with the request context
+	request, _ = http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	response, err = conn.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request, _ = http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/fast", nil)
+	if _, err = conn.RoundTrip(request); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the deadline to end the wait, got", err)
+	}
+	response.Body.Close()
+	if state := conn.State(); state.StreamsPending != 0 || state.StreamsActive != 0 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestClientConnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-request.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	transport := &cronet.RoundTripper{Engine: newFirstByteEngine(t)}
+	conn, err := transport.NewClientConn(server.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := conn.State(); state.MaxConcurrentStreams != 100 {
+		t.Fatal("unexpected default stream limit", state.MaxConcurrentStreams)
+	}
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	response, err := conn.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shutdown waits for the active request and rejects new ones meanwhile
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = conn.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected Shutdown to wait for the active request, got", err)
+	}
+	if state := conn.State(); !state.Closing || state.Closed {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	body := &closeCountingBody{Reader: strings.NewReader("body")}
+	request, _ = http.NewRequest(http.MethodPost, server.URL, body)
+	if _, err = conn.RoundTrip(request); err != cronet.ErrClientConnUnusable {
+		t.Fatal("expected ErrClientConnUnusable, got", err)
+	}
+	if body.closed != 1 {
+		t.Fatalf("body of the rejected request closed %d times", body.closed)
+	}
+	if conn.ReserveNewRequest() || conn.CanTakeNewRequest() {
+		t.Fatal("expected a closing conn to take no requests")
+	}
+
+	// Close cancels the active request, which completes the shutdown
+	conn.Close()
+	if _, err = io.ReadAll(response.Body); err == nil {
+		t.Fatal("expected the canceled body to fail")
+	}
+	response.Body.Close()
+	if err = conn.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state := conn.State(); !state.Closed || state.StreamsActive != 0 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestClientConnPing(t *testing.T) {
+	var pings int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodHead && request.URL.Path == "/" {
+			atomic.AddInt32(&pings, 1)
+		}
+	}))
+	defer server.Close()
+
+	transport := &cronet.RoundTripper{Engine: newFirstByteEngine(t)}
+	conn, err := transport.NewClientConn(server.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&pings) != 1 {
+		t.Fatal("expected the ping to reach the origin")
+	}
+	// The stream of the ping is free again
+	if state := conn.State(); state.StreamsActive != 0 || !conn.CanTakeNewRequest() {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// Requests for another origin are rejected and their body closed
+	body := &closeCountingBody{Reader: strings.NewReader("body")}
+	request, _ := http.NewRequest(http.MethodPost, "https://other.example/", body)
+	if _, err = conn.RoundTrip(request); err == nil {
+		t.Fatal("expected a request for another origin to be rejected")
+	}
+	if body.closed != 1 {
+		t.Fatalf("body of the rejected request closed %d times", body.closed)
+	}
+
+	conn.Close()
+	if err = conn.Ping(context.Background()); err != cronet.ErrClientConnUnusable {
+		t.Fatal("expected ErrClientConnUnusable, got", err)
+	}
+}
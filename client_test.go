@@ -0,0 +1,37 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestClient(t *testing.T) {
+	var client cronet.Client
+	response, err := client.Get("https://cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 || !strings.Contains(string(response.Body), "h=") {
+		t.Fatal("bad response", response.Status, string(response.Body))
+	}
+	client.MaxBodySize = 1
+	_, err = client.Get("https://cloudflare.com/cdn-cgi/trace")
+	if err != cronet.ErrResponseTooLarge {
+		t.Fatal("expected ErrResponseTooLarge, got", err)
+	}
+}
+
+func TestClientHead(t *testing.T) {
+	var client cronet.Client
+	response, err := client.Head("https://cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 || len(response.Body) != 0 {
+		t.Fatal("bad response", response.Status, string(response.Body))
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// androidABIs maps GOARCH to the Android ABI directory names of jniLibs.
+var androidABIs = map[string]string{
+	"arm64": "arm64-v8a",
+	"arm":   "armeabi-v7a",
+	"amd64": "x86_64",
+	"386":   "x86",
+}
+
+// androidNDKTriples maps GOARCH to the NDK sysroot directory holding
+// libc++_shared.so.
+var androidNDKTriples = map[string]string{
+	"arm64": "aarch64-linux-android",
+	"arm":   "arm-linux-androideabi",
+	"amd64": "x86_64-linux-android",
+	"386":   "i686-linux-android",
+}
+
+// aarName is the AAR package -aar writes to lib/android/.
+const aarName = "cronet-go.aar"
+
+// aarManifest declares the permissions the network stack needs and, as %d,
+// the minimum API level of -android-min-sdk. The Android build merges it into
+// the app manifest.
+const aarManifest = `<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android"
+    package="com.github.sagernet.cronet">
+    <uses-sdk android:minSdkVersion="%d" />
+    <uses-permission android:name="android.permission.INTERNET" />
+    <uses-permission android:name="android.permission.ACCESS_NETWORK_STATE" />
+</manifest>
+`
+
+// aarProguardRules are the consumer rules of the AAR. The classes of gomobile
+// bind are only referenced from native code, so shrinking must keep them.
+const aarProguardRules = `-keep class go.** { *; }
+-keepclasseswithmembernames,includedescriptorclasses class * {
+    native <methods>;
+}
+`
+
+// checkAARTargets fails unless |targets| include an Android target.
+func checkAARTargets(targets []Target) {
+	for _, t := range targets {
+		if t.GOOS == "android" {
+			return
+		}
+	}
+	fatal("-aar needs an android target")
+}
+
+// packageAAR arranges the runtime libraries of the Android targets for apps
+// embedding a gomobile bind AAR. The static library is linked into the
+// gomobile library, but its CGO config links the NDK libc++ dynamically, so
+// every ABI needs libc++_shared.so. They are written as jniLibs to
+// lib/android/jniLibs/<ABI> and, with the manifest and consumer ProGuard
+// rules, as lib/android/cronet-go.aar.
+func packageAAR(targets []Target) {
+	ndkSysroot := androidNDKSysroot()
+	androidDir := filepath.Join(projectRoot, "lib", "android")
+	os.RemoveAll(androidDir)
+
+	files := make(map[string]string)
+	for _, t := range targets {
+		if t.GOOS != "android" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(projectRoot, "lib", t.libDir(), "libcronet.a")); err != nil {
+			log("Warning: library not found for %s, leaving it out of the AAR", t)
+			continue
+		}
+		abi := androidABIs[t.ARCH]
+		src := filepath.Join(ndkSysroot, "usr", "lib", androidNDKTriples[t.ARCH], "libc++_shared.so")
+		dst := filepath.Join(androidDir, "jniLibs", abi, "libc++_shared.so")
+		copyFile(src, dst)
+		files["jni/"+abi+"/libc++_shared.so"] = dst
+	}
+	if len(files) == 0 {
+		fatal("no Android library packaged for the AAR")
+	}
+
+	writeAAR(filepath.Join(androidDir, aarName), files)
+	log("Created lib/android/%s with %d ABI(s)", aarName, len(files))
+}
+
+// androidNDKSysroot returns the sysroot of the NDK of androidNDKRoot.
+func androidNDKSysroot() string {
+	ndk := androidNDKRoot()
+	matches, err := filepath.Glob(filepath.Join(ndk, "toolchains", "llvm", "prebuilt", "*", "sysroot"))
+	if err != nil || len(matches) == 0 {
+		fatal("no NDK found at %s, set ANDROID_NDK_HOME", ndk)
+	}
+	return matches[0]
+}
+
+// writeAAR writes an AAR holding the manifest, the ProGuard rules, an empty
+// classes.jar and |files|, which map entry names to files.
+func writeAAR(path string, files map[string]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		fatal("failed to create %s: %v", path, err)
+	}
+	defer file.Close()
+	zipWriter := zip.NewWriter(file)
+
+	writeEntry := func(name string, content []byte) {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			fatal("failed to write %s: %v", path, err)
+		}
+		if _, err := writer.Write(content); err != nil {
+			fatal("failed to write %s: %v", path, err)
+		}
+	}
+	writeEntry("AndroidManifest.xml", []byte(fmt.Sprintf(aarManifest, androidMinSDK)))
+	writeEntry("proguard.txt", []byte(aarProguardRules))
+	writeEntry("classes.jar", emptyJar())
+	writeEntry("R.txt", nil)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content, err := os.ReadFile(files[name])
+		if err != nil {
+			fatal("failed to read %s: %v", files[name], err)
+		}
+		writeEntry(name, content)
+	}
+	if err := zipWriter.Close(); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+}
+
+// emptyJar returns a jar with only a manifest, as an AAR must have a
+// classes.jar.
+func emptyJar() []byte {
+	var buffer bytes.Buffer
+	jarWriter := zip.NewWriter(&buffer)
+	writer, err := jarWriter.Create("META-INF/MANIFEST.MF")
+	if err == nil {
+		_, err = writer.Write([]byte("Manifest-Version: 1.0\r\n\r\n"))
+	}
+	if err == nil {
+		err = jarWriter.Close()
+	}
+	if err != nil {
+		fatal("failed to write classes.jar: %v", err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// changelogName is the changelog publish keeps on the go branch, newest
+// section first.
+const changelogName = "CHANGELOG.md"
+
+const changelogHeader = "# Changelog\n\n"
+
+// readBuildManifestAt returns the build manifest of |commit|, or nil if it
+// has none.
+func readBuildManifestAt(commit string) *BuildManifest {
+	content, err := gitOutput("show", commit+":"+buildManifestName)
+	if err != nil {
+		return nil
+	}
+	var manifest BuildManifest
+	if err := json.Unmarshal([]byte(content), &manifest); err != nil {
+		log("Warning: invalid %s in %s: %v", buildManifestName, commit[:8], err)
+		return nil
+	}
+	return &manifest
+}
+
+// parseSemver parses a vMAJOR.MINOR.PATCH tag.
+func parseSemver(tag string) ([3]int, bool) {
+	var version [3]int
+	parts := strings.Split(strings.TrimPrefix(tag, "v"), ".")
+	if !strings.HasPrefix(tag, "v") || len(parts) != 3 {
+		return version, false
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || strconv.Itoa(number) != part {
+			return version, false
+		}
+		version[i] = number
+	}
+	return version, true
+}
+
+func formatSemver(version [3]int) string {
+	return fmt.Sprintf("v%d.%d.%d", version[0], version[1], version[2])
+}
+
+// previousPublishTag returns the newest semver tag reachable from |commit|,
+// or an empty string if there is none.
+func previousPublishTag(commit string) string {
+	if commit == "" {
+		return ""
+	}
+	output, err := gitOutput("tag", "--merged", commit, "--list", "v*")
+	if err != nil {
+		return ""
+	}
+	var latest string
+	var latestVersion [3]int
+	for _, tag := range strings.Fields(output) {
+		version, ok := parseSemver(tag)
+		if !ok {
+			continue
+		}
+		if latest == "" || compareSemver(version, latestVersion) > 0 {
+			latest, latestVersion = tag, version
+		}
+	}
+	return latest
+}
+
+func compareSemver(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// nextPublishVersion returns the version after |previousTag|: a Chromium
+// update bumps the minor version, anything else the patch version. The major
+// version never changes, as v2 and later need a new module path. Versions
+// whose tag exists, e.g. on a rolled back commit, are skipped.
+func nextPublishVersion(previousTag string, previous *BuildManifest, current *BuildManifest) string {
+	version, ok := parseSemver(previousTag)
+	if !ok {
+		version = [3]int{0, 1, 0}
+	} else if previous == nil || current == nil || previous.ChromiumVersion != current.ChromiumVersion {
+		version = [3]int{version[0], version[1] + 1, 0}
+	} else {
+		version[2]++
+	}
+	for gitSucceeds("rev-parse", "--verify", "--quiet", "refs/tags/"+formatSemver(version)) {
+		version[2]++
+	}
+	return formatSemver(version)
+}
+
+// changelogSection describes the changes of |current| since |previous|, the
+// build manifest of the previous publish, as a changelog section of
+// |version|.
+func changelogSection(version string, mainCommit string, previous *BuildManifest, current *BuildManifest) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "## %s - %s\n\n", version, time.Now().UTC().Format("2006-01-02"))
+	fmt.Fprintf(&builder, "Built from %s.\n\n", mainCommit[:8])
+
+	var entries []string
+	if current == nil {
+		current = &BuildManifest{}
+	}
+	if previous == nil {
+		if current.ChromiumVersion != "" {
+			entries = append(entries, "Chromium "+current.ChromiumVersion)
+		}
+		previous = &BuildManifest{}
+	} else if previous.ChromiumVersion != current.ChromiumVersion {
+		entries = append(entries, fmt.Sprintf("Chromium %s → %s", previous.ChromiumVersion, current.ChromiumVersion))
+	}
+
+	previousLibraries := make(map[string]BuildLibrary)
+	for _, library := range previous.Libraries {
+		previousLibraries[library.Target] = library
+	}
+	currentTargets := make(map[string]bool)
+	for _, library := range current.Libraries {
+		currentTargets[library.Target] = true
+		previousLibrary, found := previousLibraries[library.Target]
+		if !found {
+			entries = append(entries, "Added "+library.Target)
+			continue
+		}
+		if changes := gnArgChanges(previousLibrary.GNArgs, library.GNArgs); len(changes) > 0 {
+			entries = append(entries, fmt.Sprintf("gn args of %s: %s", library.Target, strings.Join(changes, "; ")))
+		}
+	}
+	for _, library := range previous.Libraries {
+		if !currentTargets[library.Target] {
+			entries = append(entries, "Removed "+library.Target)
+		}
+	}
+
+	if len(entries) == 0 {
+		entries = append(entries, "No Chromium or gn arg changes")
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(&builder, "- %s\n", entry)
+	}
+	return builder.String()
+}
+
+// gnArgChanges compares two gn args stamps and describes the added, removed
+// and changed args.
+func gnArgChanges(previous string, current string) []string {
+	previousArgs := parseGNArgsStamp(previous)
+	currentArgs := parseGNArgsStamp(current)
+	var added, removed, changed []string
+	for name, value := range currentArgs {
+		previousValue, found := previousArgs[name]
+		if !found {
+			added = append(added, fmt.Sprintf("`%s=%s`", name, value))
+		} else if previousValue != value {
+			changed = append(changed, fmt.Sprintf("`%s` %s → %s", name, previousValue, value))
+		}
+	}
+	for name := range previousArgs {
+		if _, found := currentArgs[name]; !found {
+			removed = append(removed, "`"+name+"`")
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	var changes []string
+	if len(added) > 0 {
+		changes = append(changes, "added "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "removed "+strings.Join(removed, ", "))
+	}
+	if len(changed) > 0 {
+		changes = append(changes, "changed "+strings.Join(changed, ", "))
+	}
+	return changes
+}
+
+// parseGNArgsStamp splits the gn args of a stamp, as written by build, into
+// names and values.
+func parseGNArgsStamp(stamp string) map[string]string {
+	args := make(map[string]string)
+	for _, field := range strings.Fields(stamp) {
+		name, value, found := strings.Cut(field, "=")
+		if found {
+			args[name] = value
+		}
+	}
+	return args
+}
+
+// prependChangelog returns |changelog| with |section| as its newest section.
+func prependChangelog(changelog string, section string) string {
+	return changelogHeader + section + "\n" + strings.TrimPrefix(changelog, changelogHeader)
+}
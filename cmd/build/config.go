@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// buildConfigNames are the config files looked up in the project root
+// unless -config names one.
+var buildConfigNames = []string{"build.yaml", "build.yml", "build.json"}
+
+// BuildConfig is the checked-in build profile of build.yaml or build.json.
+// It sets defaults: flags on the command line and environment variables
+// take precedence over it. Relative paths are relative to the project root.
+//
+//	targets: [linux/amd64, android/arm64]
+//	gn_args: [use_thin_lto=false]
+//	target_gn_args:
+//	  android/arm64: [symbol_level=1]
+//	sdk:
+//	  android_ndk: /opt/android-ndk-r28
+//	cache:
+//	  downloads: .cache/downloads
+//	  wrapper: sccache
+type BuildConfig struct {
+	// Targets is the default of -targets.
+	Targets []string `json:"targets" yaml:"targets"`
+	// GNArgs are added to the gn args of every target, replacing those of
+	// the same name.
+	GNArgs []string `json:"gn_args" yaml:"gn_args"`
+	// TargetGNArgs are added to the gn args of single targets after GNArgs.
+	TargetGNArgs map[string][]string `json:"target_gn_args" yaml:"target_gn_args"`
+	SDK          BuildConfigSDK      `json:"sdk" yaml:"sdk"`
+	Cache        BuildConfigCache    `json:"cache" yaml:"cache"`
+}
+
+// BuildConfigSDK locates the SDKs of the targets.
+type BuildConfigSDK struct {
+	// AndroidNDK is the default of ANDROID_NDK_HOME.
+	AndroidNDK string `json:"android_ndk" yaml:"android_ndk"`
+	// AndroidSDK is the default of ANDROID_HOME, searched for NDKs.
+	AndroidSDK string `json:"android_sdk" yaml:"android_sdk"`
+	// Mac and IOS are the gn mac_sdk_path and ios_sdk_path, instead of the
+	// SDKs of the selected Xcode.
+	Mac string `json:"mac" yaml:"mac"`
+	IOS string `json:"ios" yaml:"ios"`
+}
+
+// BuildConfigCache locates the caches.
+type BuildConfigCache struct {
+	// Downloads is the default of -download-cache.
+	Downloads string `json:"downloads" yaml:"downloads"`
+	// Compiler is the default of CCACHE_DIR and SCCACHE_DIR.
+	Compiler string `json:"compiler" yaml:"compiler"`
+	// Wrapper is the default of -cc-wrapper.
+	Wrapper string `json:"wrapper" yaml:"wrapper"`
+}
+
+var (
+	// buildConfigPath names the config file, none to ignore the one in the
+	// project root.
+	buildConfigPath string
+	// buildConfig is the loaded config, empty without one.
+	buildConfig BuildConfig
+	// extraGNArgs are the gn args of -gn-args, added after those of the config.
+	extraGNArgs string
+)
+
+// loadBuildConfig reads the config of -config or the one in the project root
+// and applies its defaults to the flags not set on the command line.
+func loadBuildConfig(targetStr *string) {
+	path := buildConfigPath
+	switch path {
+	case "none":
+		return
+	case "":
+		var found []string
+		for _, name := range buildConfigNames {
+			if _, err := os.Stat(filepath.Join(projectRoot, name)); err == nil {
+				found = append(found, name)
+			}
+		}
+		if len(found) == 0 {
+			return
+		}
+		if len(found) > 1 {
+			fatal("several config files found (%s), keep one or pick one with -config", strings.Join(found, ", "))
+		}
+		path = filepath.Join(projectRoot, found[0])
+	default:
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectRoot, path)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fatal("failed to read config: %v", err)
+	}
+	config, err := parseBuildConfig(path, content)
+	if err != nil {
+		fatal("invalid config %s: %v", path, err)
+	}
+	validateBuildConfig(config)
+	buildConfig = config
+	log("Using config %s", filepath.Base(path))
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	if !explicit["targets"] && len(config.Targets) > 0 {
+		*targetStr = strings.Join(config.Targets, ",")
+	}
+	if !explicit["download-cache"] && config.Cache.Downloads != "" {
+		downloadCacheDir = configPath(config.Cache.Downloads)
+	}
+	if !explicit["cc-wrapper"] && config.Cache.Wrapper != "" {
+		ccWrapper = config.Cache.Wrapper
+	}
+	setDefaultEnv("ANDROID_NDK_HOME", config.SDK.AndroidNDK)
+	setDefaultEnv("ANDROID_HOME", config.SDK.AndroidSDK)
+	setDefaultEnv("CCACHE_DIR", config.Cache.Compiler)
+	setDefaultEnv("SCCACHE_DIR", config.Cache.Compiler)
+}
+
+// parseBuildConfig decodes |content| as JSON or, for other extensions, YAML,
+// rejecting unknown fields so misspelled keys do not go unnoticed.
+func parseBuildConfig(path string, content []byte) (BuildConfig, error) {
+	var config BuildConfig
+	if strings.HasSuffix(path, ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&config)
+		return config, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&config)
+	if err == io.EOF {
+		// An empty file
+		err = nil
+	}
+	return config, err
+}
+
+// validateBuildConfig fails on unknown targets and malformed gn args.
+func validateBuildConfig(config BuildConfig) {
+	if len(config.Targets) > 0 {
+		parseTargets(strings.Join(config.Targets, ","))
+	}
+	checkArgs := func(args []string) {
+		for _, arg := range args {
+			if name, _, found := strings.Cut(arg, "="); !found || strings.TrimSpace(name) == "" {
+				fatal("config: invalid gn arg %q, expected name=value", arg)
+			}
+		}
+	}
+	checkArgs(config.GNArgs)
+	for target, args := range config.TargetGNArgs {
+		parseTargets(target)
+		checkArgs(args)
+	}
+}
+
+// configPath resolves a path of the config against the project root.
+func configPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(projectRoot, path)
+}
+
+// setDefaultEnv sets the environment variable |name| to the config path
+// |value| unless it is set already.
+func setDefaultEnv(name string, value string) {
+	if value == "" || os.Getenv(name) != "" {
+		return
+	}
+	os.Setenv(name, configPath(value))
+}
+
+// configuredGNArgs returns the gn args of the config and -gn-args for |t|, in
+// the order they apply.
+func configuredGNArgs(t Target) []string {
+	var args []string
+	switch t.OS {
+	case "mac":
+		if buildConfig.SDK.Mac != "" {
+			args = append(args, fmt.Sprintf("mac_sdk_path=\"%s\"", filepath.ToSlash(configPath(buildConfig.SDK.Mac))))
+		}
+	case "ios":
+		if buildConfig.SDK.IOS != "" {
+			args = append(args, fmt.Sprintf("ios_sdk_path=\"%s\"", filepath.ToSlash(configPath(buildConfig.SDK.IOS))))
+		}
+	}
+	args = append(args, buildConfig.GNArgs...)
+	args = append(args, buildConfig.TargetGNArgs[t.String()]...)
+	args = append(args, strings.Fields(extraGNArgs)...)
+	return args
+}
+
+// overrideGNArgs returns |args| with |overrides| applied: an override replaces
+// the arg of the same name in place, or is appended if there is none, so
+// every arg is assigned once.
+func overrideGNArgs(args []string, overrides []string) []string {
+	result := append([]string(nil), args...)
+	for _, override := range overrides {
+		name, _, _ := strings.Cut(override, "=")
+		name = strings.TrimSpace(name)
+		replaced := false
+		for i, arg := range result {
+			if argName, _, _ := strings.Cut(arg, "="); strings.TrimSpace(argName) == name {
+				result[i] = override
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, override)
+		}
+	}
+	return result
+}
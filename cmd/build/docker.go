@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// dockerWorkdir is where the project is mounted in the build container. It is
+// the same on every host, so builds embed the same paths.
+const dockerWorkdir = "/cronet-go"
+
+var (
+	// dockerBuild runs the build of each target in a container.
+	dockerBuild bool
+	// dockerImage overrides the image built from cmd/build/docker/Dockerfile,
+	// e.g. with one pinned by digest.
+	dockerImage string
+)
+
+// checkDockerTargets fails for targets that cannot be built in a Linux
+// container: macOS and iOS need the Xcode SDK, Windows the Windows SDK,
+// neither of which may be redistributed in an image. FreeBSD targets
+// cross-compile on Linux.
+func checkDockerTargets(targets []Target) {
+	for _, t := range targets {
+		switch t.GOOS {
+		case "linux", "android", "freebsd":
+		default:
+			fatal("-docker is not supported for %s, build it on a %s host", t, t.GOOS)
+		}
+	}
+}
+
+// runTargetBuild builds |t| on the host or, with -docker, in a container.
+func runTargetBuild(t Target) {
+	if dockerBuild {
+		buildTargetInDocker(t)
+		return
+	}
+	buildTarget(t)
+}
+
+// buildTargetInDocker runs the build command of this tool for |t| in the
+// build container, with the project mounted at dockerWorkdir.
+func buildTargetInDocker(t Target) {
+	image := ensureDockerImage()
+	args := []string{
+		"run", "--rm",
+		"-v", projectRoot + ":" + dockerWorkdir,
+		"-w", dockerWorkdir,
+		"-e", "HOME=/tmp",
+	}
+	if runtime.GOOS == "linux" {
+		// Keeps the outputs owned by the calling user
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	args = append(args, image, "go", "run", "./cmd/build", "-targets", t.String())
+	if sharedLibrary {
+		args = append(args, "-shared")
+	}
+	if cleanBuild {
+		args = append(args, "-clean")
+	}
+	if t.GOOS == "android" {
+		args = append(args, fmt.Sprintf("-android-ndk=%d", androidNDKMajorVersion), fmt.Sprintf("-android-min-sdk=%d", androidMinSDK))
+	}
+	// The wrapper of the host is not in the image
+	if ccWrapper == "none" {
+		args = append(args, "-cc-wrapper=none")
+	}
+	// The SDK and cache paths of the config are those of the host, so only
+	// its gn args are passed on
+	args = append(args, "-config=none")
+	if gnArgs := configuredGNArgs(t); len(gnArgs) > 0 {
+		args = append(args, "-gn-args="+strings.Join(gnArgs, " "))
+	}
+	args = append(args, "build")
+	log("Running build of %s in %s", t, image)
+	runCmd(projectRoot, "docker", args...)
+}
+
+// ensureDockerImage returns the build image, building it from the Dockerfile
+// if needed. The tag is derived from the Dockerfile, so changing it builds a
+// new image.
+func ensureDockerImage() string {
+	if dockerImage != "" {
+		return dockerImage
+	}
+	contextDir := filepath.Join(projectRoot, "cmd", "build", "docker")
+	dockerfile, err := os.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+	if err != nil {
+		fatal("failed to read Dockerfile: %v", err)
+	}
+	hash := sha256.Sum256(dockerfile)
+	dockerImage = "cronet-go-build:" + hex.EncodeToString(hash[:])[:12]
+	if exec.Command("docker", "image", "inspect", dockerImage).Run() != nil {
+		log("Building image %s", dockerImage)
+		runCmd(contextDir, "docker", "build", "-t", dockerImage, ".")
+	}
+	return dockerImage
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// doctorDiskPerTarget is the free space doctor asks for per target: the
+// output directory of a build with the toolchains and sysroots it downloads.
+const doctorDiskPerTarget = 10 << 30
+
+type doctorStatus int
+
+const (
+	doctorOK doctorStatus = iota
+	doctorWarning
+	doctorFailure
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorOK:
+		return "ok"
+	case doctorWarning:
+		return "warning"
+	default:
+		return "FAILED"
+	}
+}
+
+type doctorResult struct {
+	check  string
+	status doctorStatus
+	detail string
+	fix    string
+}
+
+// doctorReport collects the results of the checks in the order they ran.
+type doctorReport struct {
+	results []doctorResult
+}
+
+func (r *doctorReport) ok(check string, detail string) {
+	r.results = append(r.results, doctorResult{check: check, status: doctorOK, detail: detail})
+}
+
+func (r *doctorReport) warn(check string, detail string, fix string) {
+	r.results = append(r.results, doctorResult{check: check, status: doctorWarning, detail: detail, fix: fix})
+}
+
+func (r *doctorReport) fail(check string, detail string, fix string) {
+	r.results = append(r.results, doctorResult{check: check, status: doctorFailure, detail: detail, fix: fix})
+}
+
+// cmdDoctor checks the tools, SDKs and disk space building |targets| needs
+// and prints how to fix what is missing, instead of letting gn or ninja fail
+// deep into a build.
+func cmdDoctor(targets []Target) {
+	report := &doctorReport{}
+
+	checkDoctorTools(report)
+	checkDoctorTree(report)
+	checkDoctorDisk(report, len(targets))
+	checked := make(map[string]bool)
+	for _, t := range targets {
+		// Targets of the same OS share their toolchain
+		if checked[t.OS] {
+			continue
+		}
+		checked[t.OS] = true
+		checkDoctorTarget(report, t)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHECK\tSTATUS\tDETAIL")
+	failed := false
+	for _, result := range report.results {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.check, result.status, result.detail)
+		failed = failed || result.status == doctorFailure
+	}
+	writer.Flush()
+
+	var fixes []string
+	for _, result := range report.results {
+		if result.fix != "" {
+			fixes = append(fixes, fmt.Sprintf("%s: %s", result.check, result.fix))
+		}
+	}
+	if len(fixes) > 0 {
+		fmt.Println()
+		fmt.Println("Fixes:")
+		for i, fix := range fixes {
+			fmt.Printf("  %d. %s\n", i+1, fix)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkDoctorTools checks the host tools every build runs. With -docker, the
+// image brings ninja and Python.
+func checkDoctorTools(report *doctorReport) {
+	if _, err := exec.LookPath("git"); err != nil {
+		report.fail("git", "not found", "install git")
+	} else {
+		report.ok("git", toolVersion("git", "--version"))
+	}
+	if dockerBuild {
+		if err := exec.Command("docker", "info").Run(); err != nil {
+			report.fail("docker", "daemon not reachable", "install Docker and start the daemon, or build without -docker")
+		} else {
+			report.ok("docker", toolVersion("docker", "--version"))
+		}
+		return
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		report.fail("bash", "not found", "install bash, get-clang.sh runs with it (Git Bash on Windows)")
+	} else {
+		report.ok("bash", "found")
+	}
+	checkDoctorVersion(report, "ninja", []string{"ninja", "--version"}, []int{1, 10},
+		"install ninja 1.10 or newer, e.g. apt install ninja-build, brew install ninja or choco install ninja")
+	python := "python3"
+	if runtime.GOOS == "windows" {
+		python = "python"
+	}
+	checkDoctorVersion(report, "python", []string{python, "--version"}, []int{3, 9},
+		"install Python 3.9 or newer as "+python+", gn and the Chromium build scripts run with it")
+}
+
+// checkDoctorVersion checks that |command| runs and prints a version of at
+// least |minimum|.
+func checkDoctorVersion(report *doctorReport, check string, command []string, minimum []int, fix string) {
+	if _, err := exec.LookPath(command[0]); err != nil {
+		report.fail(check, command[0]+" not found", fix)
+		return
+	}
+	version := toolVersion(command[0], command[1:]...)
+	numbers := parseVersionNumbers(version)
+	if numbers == nil {
+		report.warn(check, "unknown version: "+version, fix)
+		return
+	}
+	if compareVersionNumbers(numbers, minimum) < 0 {
+		report.fail(check, fmt.Sprintf("%s is older than %s", version, formatVersionNumbers(minimum)), fix)
+		return
+	}
+	report.ok(check, version)
+}
+
+// checkDoctorTree checks the naiveproxy tree and the toolchain get-clang.sh
+// downloads into it.
+func checkDoctorTree(report *doctorReport) {
+	chromiumVersion := readChromiumVersion()
+	if chromiumVersion == "" {
+		report.fail("naiveproxy", "no CHROMIUM_VERSION, the submodule is not checked out", "git submodule update --init --recursive")
+		return
+	}
+	report.ok("naiveproxy", "Chromium "+chromiumVersion)
+
+	if _, err := os.Stat(filepath.Join(srcRoot, "components", "cronet")); err != nil {
+		report.fail("components", "components/cronet not synced", "go run ./cmd/build sync")
+	} else {
+		report.ok("components", "components/cronet synced")
+	}
+
+	if _, err := os.Stat(gnBinary()); err != nil {
+		report.ok("gn", "not built yet, get-clang.sh builds it on the first build")
+	} else {
+		report.ok("gn", toolVersion(gnBinary(), "--version"))
+	}
+
+	if clang := clangVersion(); clang == "" {
+		report.ok("clang", "not downloaded yet, get-clang.sh downloads it on the first build")
+	} else {
+		report.ok("clang", clang)
+	}
+}
+
+// checkDoctorDisk checks the free space of the file system of the source
+// tree.
+func checkDoctorDisk(report *doctorReport, targetCount int) {
+	dir := srcRoot
+	if _, err := os.Stat(dir); err != nil {
+		dir = projectRoot
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		report.warn("disk", fmt.Sprintf("free space unknown: %v", err), "")
+		return
+	}
+	needed := uint64(doctorDiskPerTarget) * uint64(targetCount)
+	detail := fmt.Sprintf("%s free, about %s needed for %d target(s)", formatSize(int64(free)), formatSize(int64(needed)), targetCount)
+	if free < needed {
+		report.warn("disk", detail, "free space on the file system of naiveproxy/src, or remove stale out/cronet-* directories")
+		return
+	}
+	report.ok("disk", detail)
+}
+
+// checkDoctorTarget checks the SDKs and host requirements of the targets of
+// the OS of |t|.
+func checkDoctorTarget(report *doctorReport, t Target) {
+	switch t.OS {
+	case "linux", "openwrt":
+		report.ok(t.OS, "sysroot downloaded by get-clang.sh")
+	case "freebsd":
+		if runtime.GOOS != "linux" && !dockerBuild {
+			report.fail(t.OS, "FreeBSD targets cross-compile on Linux only", "build "+t.String()+" on a Linux host or with -docker")
+			return
+		}
+		if !freebsdSupported() {
+			report.fail(t.OS, "the gn build of naiveproxy knows no FreeBSD",
+				"add the patches of the FreeBSD chromium port to "+patchesDir+"/ with patch update and run patch apply")
+			return
+		}
+		report.ok(t.OS, "FreeBSD "+freebsdRelease+" sysroot downloaded on the first build")
+	case "android":
+		if dockerBuild {
+			report.ok("ndk", "resolved in the build container")
+			return
+		}
+		// findAndroidNDK fails on an ANDROID_NDK_HOME of another version
+		if ndk := os.Getenv("ANDROID_NDK_HOME"); ndk != "" {
+			if major := ndkMajorVersion(ndk); major != androidNDKMajorVersion {
+				report.fail("ndk", fmt.Sprintf("ANDROID_NDK_HOME %s is NDK %d", ndk, major),
+					fmt.Sprintf("point ANDROID_NDK_HOME to an NDK r%d or pass -android-ndk=%d", androidNDKMajorVersion, major))
+				return
+			}
+		}
+		ndk, found := findAndroidNDK()
+		switch {
+		case found:
+			report.ok("ndk", fmt.Sprintf("%s (%s)", ndkRevision(ndk), ndk))
+		case downloadNDK:
+			report.ok("ndk", fmt.Sprintf("no NDK %d installed, -download-ndk downloads it", androidNDKMajorVersion))
+		default:
+			report.fail("ndk", fmt.Sprintf("no NDK %d found", androidNDKMajorVersion),
+				fmt.Sprintf("set ANDROID_NDK_HOME to an NDK r%d, install it with sdkmanager, or pass -download-ndk", androidNDKMajorVersion))
+		}
+	case "mac", "ios":
+		if runtime.GOOS != "darwin" {
+			report.fail(t.OS, "Apple targets build on macOS only", "build "+t.String()+" on a macOS host")
+			return
+		}
+		if err := exec.Command("xcode-select", "-p").Run(); err != nil {
+			report.fail("xcode", "no developer directory selected", "install Xcode and run sudo xcode-select -s /Applications/Xcode.app")
+			return
+		}
+		report.ok("xcode", toolVersion("xcodebuild", "-version"))
+		sdk, configured := "macosx", buildConfig.SDK.Mac
+		if t.OS == "ios" {
+			sdk, configured = "iphoneos", buildConfig.SDK.IOS
+		}
+		if configured != "" {
+			if _, err := os.Stat(configPath(configured)); err != nil {
+				report.fail(sdk+" sdk", "configured SDK "+configured+" not found", "fix the sdk path in the config")
+			} else {
+				report.ok(sdk+" sdk", configPath(configured))
+			}
+			return
+		}
+		output, err := exec.Command("xcrun", "--sdk", sdk, "--show-sdk-path").Output()
+		if err != nil {
+			report.fail(sdk+" sdk", "not installed", "install the "+sdk+" platform in Xcode's settings")
+		} else {
+			report.ok(sdk+" sdk", strings.TrimSpace(string(output)))
+		}
+	case "win":
+		if runtime.GOOS != "windows" {
+			report.fail(t.OS, "Windows targets build on Windows only", "build "+t.String()+" on a Windows host")
+			return
+		}
+		vswhere := filepath.Join(os.Getenv("ProgramFiles(x86)"), "Microsoft Visual Studio", "Installer", "vswhere.exe")
+		output, err := exec.Command(vswhere, "-latest", "-requires", "Microsoft.VisualStudio.Component.VC.Tools.x86.x64", "-property", "installationVersion").Output()
+		if version := strings.TrimSpace(string(output)); err != nil || version == "" {
+			report.fail("visual studio", "no Visual Studio with the C++ tools found", "install Visual Studio 2022 with the Desktop development with C++ workload")
+		} else {
+			report.ok("visual studio", version)
+		}
+		// Go links cgo programs for Windows with a MinGW gcc
+		cc := strings.Fields(strings.TrimSpace(toolVersion("go", "env", "CC")))
+		if len(cc) == 0 {
+			cc = []string{"gcc"}
+		}
+		if _, err := exec.LookPath(cc[0]); err != nil {
+			report.fail("mingw", cc[0]+" not found, cgo cannot link the library", "install MinGW-w64, e.g. with MSYS2, and put its gcc on PATH")
+		} else {
+			report.ok("mingw", toolVersion(cc[0], "--version"))
+		}
+	}
+}
+
+// toolVersion returns the first line of the output of |name| |args|, or the
+// error running it.
+func toolVersion(name string, args ...string) string {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return err.Error()
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line)
+}
+
+var versionNumberPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersionNumbers returns the numbers of the first version in |text|,
+// e.g. [3 11 4] of "Python 3.11.4".
+func parseVersionNumbers(text string) []int {
+	match := versionNumberPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+	var numbers []int
+	for _, part := range match[1:] {
+		if part == "" {
+			continue
+		}
+		number, _ := strconv.Atoi(part)
+		numbers = append(numbers, number)
+	}
+	return numbers
+}
+
+func compareVersionNumbers(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func formatVersionNumbers(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(parts, ".")
+}
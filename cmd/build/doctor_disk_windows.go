@@ -0,0 +1,17 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the bytes available to the user on the volume of
+// |path|.
+func freeDiskSpace(path string) (uint64, error) {
+	pathPointer, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPointer, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
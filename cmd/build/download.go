@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// downloadCacheDir keeps completed downloads by SHA-256 and the partial
+	// ones to resume.
+	downloadCacheDir string
+	// downloadMirrors rewrite download URLs; the mirrors are tried in order
+	// before the original URL.
+	downloadMirrors []downloadMirror
+)
+
+// downloadAttempts is the number of rounds over the mirrors and the original
+// URL before a download fails, with a backoff doubling from a second.
+const downloadAttempts = 5
+
+// downloadMirror serves the URLs starting with prefix under replacement.
+type downloadMirror struct {
+	prefix      string
+	replacement string
+}
+
+// parseDownloadMirrors parses comma-separated prefix=replacement pairs, e.g.
+// https://chromium.googlesource.com/=https://mirror.example.com/chromium/.
+func parseDownloadMirrors(value string) []downloadMirror {
+	var mirrors []downloadMirror
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		prefix, replacement, found := strings.Cut(pair, "=")
+		if !found || prefix == "" || replacement == "" {
+			fatal("invalid mirror %q, expected prefix=replacement", pair)
+		}
+		mirrors = append(mirrors, downloadMirror{prefix: prefix, replacement: replacement})
+	}
+	return mirrors
+}
+
+// defaultDownloadCacheDir returns the download cache in the user cache
+// directory, e.g. ~/.cache/cronet-go/downloads.
+func defaultDownloadCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "cronet-go", "downloads")
+}
+
+// downloadURLs returns the URLs to try for |url|: its mirrors, then itself.
+func downloadURLs(url string) []string {
+	var urls []string
+	for _, mirror := range downloadMirrors {
+		if strings.HasPrefix(url, mirror.prefix) {
+			urls = append(urls, mirror.replacement+url[len(mirror.prefix):])
+		}
+	}
+	return append(urls, url)
+}
+
+// downloadStatusError is an unexpected HTTP status of a download.
+type downloadStatusError struct {
+	status string
+	code   int
+}
+
+func (e *downloadStatusError) Error() string {
+	return "HTTP " + e.status
+}
+
+// temporary reports whether a retry may succeed.
+func (e *downloadStatusError) temporary() bool {
+	return e.code >= 500 || e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests
+}
+
+// downloadFile downloads |url| into the download cache and returns the path
+// of the cached file, which callers must not modify.
+//
+// With |expectedSHA256|, a cached file of that hash is used without
+// downloading and a download of other content fails. Without, the last
+// download of the same URL is reused, which suits URLs of immutable content
+// such as archives of a tag. An interrupted download resumes with a Range
+// request on the next attempt or run.
+func downloadFile(url string, expectedSHA256 string) (string, error) {
+	blobDir := filepath.Join(downloadCacheDir, "sha256")
+	indexPath := filepath.Join(downloadCacheDir, "urls", hashString(url))
+	partialPath := filepath.Join(downloadCacheDir, "partial", hashString(url))
+	for _, dir := range []string{blobDir, filepath.Dir(indexPath), filepath.Dir(partialPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	cachedSHA256 := expectedSHA256
+	if cachedSHA256 == "" {
+		if index, err := os.ReadFile(indexPath); err == nil {
+			cachedSHA256 = strings.TrimSpace(string(index))
+		}
+	}
+	if cachedSHA256 != "" {
+		blobPath := filepath.Join(blobDir, cachedSHA256)
+		if _, err := os.Stat(blobPath); err == nil {
+			log("Using cached %s", url)
+			return blobPath, nil
+		}
+	}
+
+	var sum string
+	err := tryDownloadURLs(url, func(candidate string) error {
+		var err error
+		sum, err = downloadPartial(candidate, partialPath, expectedSHA256)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	blobPath := filepath.Join(blobDir, sum)
+	if err := os.Rename(partialPath, blobPath); err != nil {
+		return "", err
+	}
+	os.Remove(partialPath + ".source")
+	if err := os.WriteFile(indexPath, []byte(sum+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return blobPath, nil
+}
+
+// tryDownloadURLs calls |try| with the mirrors of |url| and |url| itself until
+// it succeeds, for up to downloadAttempts rounds while a failure may be
+// temporary.
+func tryDownloadURLs(url string, try func(candidate string) error) error {
+	var lastErr error
+	for attempt := 0; attempt < downloadAttempts; attempt++ {
+		if attempt > 0 {
+			delay := time.Second << (attempt - 1)
+			log("Download failed: %v, retrying in %s", lastErr, delay)
+			time.Sleep(delay)
+		}
+		temporary := false
+		for _, candidate := range downloadURLs(url) {
+			err := try(candidate)
+			if err == nil {
+				return nil
+			}
+			lastErr = fmt.Errorf("%s: %w", candidate, err)
+			var statusErr *downloadStatusError
+			if !errors.As(err, &statusErr) || statusErr.temporary() {
+				temporary = true
+			}
+		}
+		if !temporary {
+			break
+		}
+	}
+	return lastErr
+}
+
+// downloadPartial continues the download of |url| into |partialPath| and
+// returns the SHA-256 of the completed file. The partial file is kept on
+// network errors and removed if its content does not match |expectedSHA256|.
+//
+// A partial file is only resumed from the URL it was started from, with
+// If-Range so a changed file is downloaded afresh, and only if the server
+// continues at its end. Otherwise the download restarts from zero.
+func downloadPartial(url string, partialPath string, expectedSHA256 string) (string, error) {
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	sourcePath := partialPath + ".source"
+	source, _ := readPartialSource(sourcePath)
+	if offset > 0 && source.url != url {
+		// Mirrors may serve other builds of a file; never mix their bytes
+		if offset, err = restartPartial(file, sourcePath); err != nil {
+			return "", err
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if source.validator != "" {
+			request.Header.Set("If-Range", source.validator)
+		}
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	size := int64(-1)
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, err := parseContentRange(response.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			restartPartial(file, sourcePath)
+			return "", fmt.Errorf("unexpected Content-Range %q resuming at %d bytes", response.Header.Get("Content-Range"), offset)
+		}
+		log("Resuming %s at %d bytes", url, offset)
+		size = total
+	case response.StatusCode == http.StatusOK:
+		// No range support, a changed file, or nothing to resume
+		if _, err := restartPartial(file, sourcePath); err != nil {
+			return "", err
+		}
+		if err := writePartialSource(sourcePath, url, response.Header); err != nil {
+			return "", err
+		}
+		size = response.ContentLength
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous attempt got the whole file if the size matches
+		_, total, err := parseContentRange(response.Header.Get("Content-Range"))
+		if err != nil || total != offset {
+			restartPartial(file, sourcePath)
+			return "", fmt.Errorf("range at %d bytes not satisfiable, restarting", offset)
+		}
+	default:
+		return "", &downloadStatusError{status: response.Status, code: response.StatusCode}
+	}
+	if response.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if _, err := io.Copy(file, response.Body); err != nil {
+			return "", err
+		}
+	}
+	if size >= 0 {
+		if written, err := file.Seek(0, io.SeekCurrent); err != nil || written != size {
+			restartPartial(file, sourcePath)
+			return "", fmt.Errorf("downloaded %d bytes, expected %d", written, size)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+
+	sum, _ := hashFile(partialPath)
+	if expectedSHA256 != "" && sum != expectedSHA256 {
+		os.Remove(partialPath)
+		os.Remove(sourcePath)
+		return "", fmt.Errorf("SHA-256 %s does not match %s", sum, expectedSHA256)
+	}
+	return sum, nil
+}
+
+// partialSource is the response a partial download was started from.
+type partialSource struct {
+	url string
+	// validator is a strong ETag or the Last-Modified date, for If-Range.
+	validator string
+}
+
+func readPartialSource(path string) (partialSource, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return partialSource{}, err
+	}
+	url, validator, _ := strings.Cut(strings.TrimSuffix(string(content), "\n"), "\n")
+	return partialSource{url: url, validator: validator}, nil
+}
+
+func writePartialSource(path string, url string, header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		// If-Range does not accept weak ETags
+		validator = header.Get("Last-Modified")
+	}
+	return os.WriteFile(path, []byte(url+"\n"+validator+"\n"), 0644)
+}
+
+// restartPartial empties the partial download |file| and forgets its source.
+func restartPartial(file *os.File, sourcePath string) (int64, error) {
+	os.Remove(sourcePath)
+	if err := file.Truncate(0); err != nil {
+		return 0, err
+	}
+	return file.Seek(0, io.SeekStart)
+}
+
+// parseContentRange parses a Content-Range header of a 206 response,
+// "bytes start-end/total", or of a 416 response, "bytes */total". The start
+// is -1 for the latter and the total is -1 if unknown.
+func parseContentRange(value string) (start int64, total int64, err error) {
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	byteRange, totalSpec, found := strings.Cut(value[len("bytes "):], "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	total = -1
+	if totalSpec != "*" {
+		if total, err = strconv.ParseInt(totalSpec, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+		}
+	}
+	if byteRange == "*" {
+		return -1, total, nil
+	}
+	startSpec, _, found := strings.Cut(byteRange, "-")
+	if start, err = strconv.ParseInt(startSpec, 10, 64); !found || err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+	return start, total, nil
+}
+
+// downloadBytes fetches small, changing resources such as release manifests,
+// retrying and trying the mirrors but bypassing the cache.
+func downloadBytes(url string) ([]byte, error) {
+	var content []byte
+	err := tryDownloadURLs(url, func(candidate string) error {
+		var err error
+		content, err = getBytes(candidate)
+		return err
+	})
+	return content, err
+}
+
+func getBytes(url string) ([]byte, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &downloadStatusError{status: response.Status, code: response.StatusCode}
+	}
+	return io.ReadAll(response.Body)
+}
+
+func hashString(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadPartial(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	var access sync.Mutex
+	etag := `"v1"`
+	var ranges []string
+	var contentRange string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		access.Lock()
+		defer access.Unlock()
+		ranges = append(ranges, request.Header.Get("Range"))
+		if contentRange != "" {
+			writer.Header().Set("Content-Range", contentRange)
+			writer.WriteHeader(http.StatusPartialContent)
+			writer.Write(content[10:])
+			return
+		}
+		writer.Header().Set("ETag", etag)
+		http.ServeContent(writer, request, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	url := server.URL + "/file"
+	sum := hashString(string(content))
+
+	partialPath := filepath.Join(t.TempDir(), "partial")
+	resume := func(prefix int, sourceURL string) (string, error) {
+		t.Helper()
+		if err := os.WriteFile(partialPath, content[:prefix], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if sourceURL != "" {
+			if err := os.WriteFile(partialPath+".source", []byte(sourceURL+"\n"+`"v1"`+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			os.Remove(partialPath + ".source")
+		}
+		access.Lock()
+		ranges = nil
+		access.Unlock()
+		return downloadPartial(url, partialPath, sum)
+	}
+	lastRange := func() string {
+		access.Lock()
+		defer access.Unlock()
+		return ranges[len(ranges)-1]
+	}
+
+	// A fresh download records its source for resuming
+	if got, err := resume(0, ""); err != nil || got != sum {
+		t.Fatal(got, err)
+	}
+	if source, err := readPartialSource(partialPath + ".source"); err != nil || source.url != url || source.validator != `"v1"` {
+		t.Fatalf("unexpected source %+v, %v", source, err)
+	}
+
+	// A download from the same URL resumes at the end of the file
+	if got, err := resume(400, url); err != nil || got != sum || lastRange() != "bytes=400-" {
+		t.Fatal(got, err, lastRange())
+	}
+	// A download from another mirror, or of unknown source, restarts
+	if got, err := resume(400, "https://mirror.example/file"); err != nil || got != sum || lastRange() != "" {
+		t.Fatal(got, err, lastRange())
+	}
+	if got, err := resume(400, ""); err != nil || got != sum || lastRange() != "" {
+		t.Fatal(got, err, lastRange())
+	}
+	// A changed file fails If-Range and is downloaded in full
+	access.Lock()
+	etag = `"v2"`
+	access.Unlock()
+	if got, err := resume(400, url); err != nil || got != sum {
+		t.Fatal(got, err)
+	}
+	access.Lock()
+	etag = `"v1"`
+	access.Unlock()
+
+	// The whole file was downloaded before if the size matches the 416
+	if got, err := resume(len(content), url); err != nil || got != sum {
+		t.Fatal(got, err)
+	}
+	if _, err := resume(len(content)+5, url); err == nil {
+		t.Fatal("expected a larger partial file to restart")
+	}
+	if info, err := os.Stat(partialPath); err != nil || info.Size() != 0 {
+		t.Fatal("expected the partial file to be emptied", err)
+	}
+
+	// A range not starting at the end of the partial file is not appended
+	access.Lock()
+	contentRange = "bytes 10-999/1000"
+	access.Unlock()
+	if _, err := resume(400, url); err == nil {
+		t.Fatal("expected a mismatched Content-Range to fail")
+	}
+	if info, err := os.Stat(partialPath); err != nil || info.Size() != 0 {
+		t.Fatal("expected the partial file to be emptied", err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, testCase := range []struct {
+		value string
+		start int64
+		total int64
+	}{
+		{"bytes 0-99/100", 0, 100},
+		{"bytes 50-99/*", 50, -1},
+		{"bytes */100", -1, 100},
+	} {
+		start, total, err := parseContentRange(testCase.value)
+		if err != nil || start != testCase.start || total != testCase.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", testCase.value, start, total, err)
+		}
+	}
+	for _, value := range []string{"", "bytes 0-99", "items 0-99/100", "bytes x-99/100", "bytes 0-99/x"} {
+		if _, _, err := parseContentRange(value); err == nil {
+			t.Errorf("parseContentRange(%q): expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// extractArchive extracts the tar archive at |archivePath|, compressed with
+// gzip or xz or not at all, into |destDir|. Members and links leaving
+// |destDir|, by name or through the symlinks extracted before them, fail the
+// extraction, so a hostile archive cannot write elsewhere.
+func extractArchive(archivePath string, destDir string) error {
+	return extractArchiveMembers(archivePath, destDir, nil)
+}
+
+// extractArchiveMembers extracts the members of the tar archive at
+// |archivePath| for which |keep| returns true, or all with a nil |keep|, into
+// |destDir| like extractArchive.
+func extractArchiveMembers(archivePath string, destDir string, keep func(name string) bool) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := decompressArchive(file)
+	if err != nil {
+		return err
+	}
+	realDest, err := resolveDestDir(destDir)
+	if err != nil {
+		return err
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if keep != nil && !keep(header.Name) {
+			continue
+		}
+		target, err := archiveMemberPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = writeArchiveDir(realDest, target)
+		case tar.TypeReg:
+			err = writeArchiveFile(realDest, target, tarReader, os.FileMode(header.Mode))
+		case tar.TypeSymlink:
+			err = writeArchiveSymlink(destDir, realDest, target, header)
+		case tar.TypeLink:
+			err = writeArchiveLink(destDir, realDest, target, header.Linkname)
+		default:
+			// Devices, FIFOs and pax headers have no place in a source tree
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+}
+
+// extractZipArchive extracts the zip archive at |archivePath| into |destDir|
+// with the same checks as extractArchive.
+func extractZipArchive(archivePath string, destDir string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	realDest, err := resolveDestDir(destDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		target, err := archiveMemberPath(destDir, file.Name)
+		if err != nil {
+			return err
+		}
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			err = writeArchiveDir(realDest, target)
+		case mode&os.ModeSymlink != 0:
+			// The content of a symlink entry is its target
+			var linkname []byte
+			linkname, err = readZipEntry(file)
+			if err == nil {
+				err = writeArchiveSymlink(destDir, realDest, target, &tar.Header{Name: file.Name, Linkname: string(linkname)})
+			}
+		default:
+			var entry io.ReadCloser
+			entry, err = file.Open()
+			if err == nil {
+				err = writeArchiveFile(realDest, target, entry, mode)
+				entry.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+func readZipEntry(file *zip.File) ([]byte, error) {
+	entry, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+	return io.ReadAll(entry)
+}
+
+// decompressArchive detects the compression of |reader| from its magic.
+func decompressArchive(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	magic, _ := buffered.Peek(len(xzMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, xzMagic):
+		return xz.NewReader(buffered)
+	default:
+		return buffered, nil
+	}
+}
+
+// archiveMemberPath returns where the member |name| goes in |destDir|, or an
+// error if it is absolute or leaves |destDir|.
+func archiveMemberPath(destDir string, name string) (string, error) {
+	// Archives use slashes; backslashes and drive letters only appear in
+	// names meant to escape on Windows
+	cleanName := path.Clean(name)
+	if path.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, "../") ||
+		strings.ContainsAny(cleanName, `\:`) {
+		return "", fmt.Errorf("archive member %q leaves the destination", name)
+	}
+	return filepath.Join(destDir, filepath.FromSlash(cleanName)), nil
+}
+
+// resolveDestDir creates |destDir| and returns it with symlinks resolved, to
+// compare the resolved paths of members with.
+func resolveDestDir(destDir string) (string, error) {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(destDir)
+}
+
+// resolveExisting resolves the symlinks of the longest existing prefix of
+// |name| and appends the rest. Unlike filepath.Clean, a ".." after a symlink
+// leaves the directory the symlink points to, as the kernel resolves it.
+func resolveExisting(name string) (string, error) {
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(name)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if _, lstatErr := os.Lstat(name); lstatErr == nil || !errors.Is(err, fs.ErrNotExist) {
+			// A dangling symlink may point anywhere once its target exists
+			return "", err
+		}
+		parent := filepath.Dir(name)
+		if parent == name {
+			return "", err
+		}
+		rest = append([]string{filepath.Base(name)}, rest...)
+		name = parent
+	}
+}
+
+// checkArchivePath fails if |name| resolves to a path outside |realDest|,
+// which the lexical checks of archiveMemberPath cannot see: with the members
+// x -> . and l -> x/.., the member l/escaped is written next to the
+// destination.
+func checkArchivePath(realDest string, name string) error {
+	resolved, err := resolveExisting(name)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(realDest, resolved)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s leaves the destination through a symlink", name)
+	}
+	return nil
+}
+
+func writeArchiveDir(realDest string, target string) error {
+	if err := checkArchivePath(realDest, target); err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+func writeArchiveFile(realDest string, target string, reader io.Reader, mode os.FileMode) error {
+	if err := checkArchivePath(realDest, filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	// Keeps the executable bits of scripts; O_EXCL never follows a symlink
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeArchiveSymlink creates the symlink |target| after checking it points
+// into |destDir|, by name and through the symlinks extracted so far.
+func writeArchiveSymlink(destDir string, realDest string, target string, header *tar.Header) error {
+	linkname := header.Linkname
+	if path.IsAbs(linkname) || filepath.IsAbs(linkname) {
+		return fmt.Errorf("symlink to absolute path %q", linkname)
+	}
+	memberDir := path.Dir(path.Clean(header.Name))
+	if _, err := archiveMemberPath(destDir, path.Join(memberDir, linkname)); err != nil {
+		return fmt.Errorf("symlink to %q leaves the destination", linkname)
+	}
+	if err := checkArchivePath(realDest, filepath.Dir(target)); err != nil {
+		return err
+	}
+	// Not joined, which would clean a ".." after a symlink away
+	if err := checkArchivePath(realDest, filepath.Dir(target)+string(filepath.Separator)+filepath.FromSlash(linkname)); err != nil {
+		return fmt.Errorf("symlink to %q leaves the destination", linkname)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	return os.Symlink(filepath.FromSlash(linkname), target)
+}
+
+// writeArchiveLink creates the hard link |target| to the member |linkname|.
+func writeArchiveLink(destDir string, realDest string, target string, linkname string) error {
+	source, err := archiveMemberPath(destDir, linkname)
+	if err != nil {
+		return err
+	}
+	if err := checkArchivePath(realDest, source); err != nil {
+		return err
+	}
+	if err := checkArchivePath(realDest, filepath.Dir(target)); err != nil {
+		return err
+	}
+	os.Remove(target)
+	return os.Link(source, target)
+}
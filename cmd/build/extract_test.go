@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testArchiveMember is a tar member; a non-empty link makes it a symlink, or
+// a hard link with hard set.
+type testArchiveMember struct {
+	name    string
+	content string
+	link    string
+	hard    bool
+	dir     bool
+}
+
+func writeTestArchive(t *testing.T, members []testArchiveMember) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := tar.NewWriter(&buffer)
+	for _, member := range members {
+		header := &tar.Header{Name: member.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(member.content))}
+		switch {
+		case member.dir:
+			header.Typeflag, header.Mode = tar.TypeDir, 0755
+		case member.hard:
+			header.Typeflag, header.Linkname = tar.TypeLink, member.link
+		case member.link != "":
+			header.Typeflag, header.Linkname = tar.TypeSymlink, member.link
+		}
+		if header.Typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(member.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(t.TempDir(), "archive.tar")
+	if err := os.WriteFile(archivePath, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestExtractArchive(t *testing.T) {
+	destDir := filepath.Join(t.TempDir(), "dest")
+	err := extractArchive(writeTestArchive(t, []testArchiveMember{
+		{name: "src", dir: true},
+		{name: "src/main.c", content: "int main;"},
+		{name: "src/current", link: "."},
+		{name: "include", link: "src/current/../src"},
+		{name: "src/copy.c", link: "src/main.c", hard: true},
+		{name: "include/through.h", content: "through"},
+		{name: "dangling", link: "missing/file"},
+	}), destDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"src/main.c":    "int main;",
+		"src/copy.c":    "int main;",
+		"src/through.h": "through",
+	} {
+		if content, err := os.ReadFile(filepath.Join(destDir, filepath.FromSlash(name))); err != nil || string(content) != want {
+			t.Errorf("%s: unexpected content %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestExtractArchiveEscapes(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		members []testArchiveMember
+	}{
+		{"parent", []testArchiveMember{{name: "../escaped", content: "x"}}},
+		{"nested parent", []testArchiveMember{{name: "a/../../escaped", content: "x"}}},
+		{"absolute", []testArchiveMember{{name: "/tmp/escaped", content: "x"}}},
+		{"backslash", []testArchiveMember{{name: `a\..\..\escaped`, content: "x"}}},
+		{"drive", []testArchiveMember{{name: "C:/escaped", content: "x"}}},
+		{"absolute symlink", []testArchiveMember{{name: "l", link: "/tmp"}}},
+		{"parent symlink", []testArchiveMember{{name: "l", link: "../"}}},
+		{"hard link", []testArchiveMember{{name: "l", link: "../escaped", hard: true}}},
+		// Each link stays inside by name, but l resolves to the parent
+		{"symlink chain", []testArchiveMember{
+			{name: "x", link: "."},
+			{name: "l", link: "x/.."},
+			{name: "l/escaped", content: "x"},
+		}},
+		{"symlink chain in subdirectory", []testArchiveMember{
+			{name: "a/x", link: "."},
+			{name: "a/l", link: "x/../.."},
+			{name: "a/l/escaped", content: "x"},
+		}},
+	} {
+		parent := t.TempDir()
+		destDir := filepath.Join(parent, "dest")
+		if err := extractArchive(writeTestArchive(t, testCase.members), destDir); err == nil {
+			t.Errorf("%s: expected the extraction to fail", testCase.name)
+		}
+		if _, err := os.Lstat(filepath.Join(parent, "escaped")); err == nil {
+			t.Errorf("%s: wrote outside the destination", testCase.name)
+		}
+	}
+}
+
+func TestExtractArchiveThroughExistingSymlink(t *testing.T) {
+	parent := t.TempDir()
+	destDir := filepath.Join(parent, "dest")
+	outside := filepath.Join(parent, "outside")
+	for _, dir := range []string{destDir, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(destDir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range []testArchiveMember{
+		{name: "out/escaped", content: "x"},
+		{name: "out/dir/escaped", content: "x"},
+		{name: "out/escaped", link: "../dest"},
+	} {
+		if err := extractArchive(writeTestArchive(t, []testArchiveMember{member}), destDir); err == nil {
+			t.Errorf("%s: expected writing through the symlink to fail", member.name)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatal("wrote outside the destination", entries)
+	}
+}
+
+func TestExtractZipArchiveEscapes(t *testing.T) {
+	for _, name := range []string{"../escaped", `..\escaped`, "/escaped"} {
+		var buffer bytes.Buffer
+		writer := zip.NewWriter(&buffer)
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte("x"))
+		writer.Close()
+		parent := t.TempDir()
+		archivePath := filepath.Join(parent, "archive.zip")
+		if err = os.WriteFile(archivePath, buffer.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = extractZipArchive(archivePath, filepath.Join(parent, "dest")); err == nil {
+			t.Errorf("%s: expected the extraction to fail", name)
+		}
+	}
+}
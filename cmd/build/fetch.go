@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// cmdFetch downloads the prebuilt libraries of a release into the project
+// instead of building them. go generate in the project root runs it for the
+// host.
+func cmdFetch(targets []Target, args []string) {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	version := flags.String("version", "latest", "Release version to download, e.g. v1.2.3")
+	repo := flags.String("repo", defaultReleaseRepo, "GitHub repository of the release")
+	baseURL := flags.String("url", "", "Base download URL of the release (default: GitHub release of -version)")
+	flags.Parse(args)
+
+	if *baseURL == "" {
+		*baseURL = releaseDownloadURL(*repo, *version)
+	}
+
+	manifestURL := strings.TrimSuffix(*baseURL, "/") + "/" + releaseManifestName
+	log("Fetching %s", manifestURL)
+	manifestData, err := downloadBytes(manifestURL)
+	if err != nil {
+		fatal("failed to download release manifest: %v", err)
+	}
+	var manifest ReleaseManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		fatal("invalid release manifest: %v", err)
+	}
+	// The manifest names the release "latest" resolved to; one without a base
+	// URL is served next to its artifacts
+	if manifest.BaseURL == "" {
+		manifest.BaseURL = *baseURL
+	}
+	log("Release %s", manifest.Version)
+
+	for _, t := range targets {
+		var artifact *ReleaseArtifact
+		for i := range manifest.Artifacts {
+			candidate := manifest.Artifacts[i]
+			if candidate.GOOS == t.GOOS && candidate.ARCH == t.ARCH && candidate.Libc == t.Libc {
+				artifact = &manifest.Artifacts[i]
+				break
+			}
+		}
+		if artifact == nil {
+			fatal("release %s has no library for %s", manifest.Version, t)
+		}
+		fetchArtifact(&manifest, *artifact, t)
+	}
+	updateLibRequirements()
+
+	log("Fetch complete!")
+}
+
+// fetchArtifact downloads |artifact| into the download cache, checks its size
+// and hash and replaces the library and CGO config of |t| with its content.
+func fetchArtifact(manifest *ReleaseManifest, artifact ReleaseArtifact, t Target) {
+	url := artifact.URL(manifest)
+	log("Downloading %s...", url)
+	path, err := downloadFile(url, artifact.SHA256)
+	if err != nil {
+		fatal("failed to download %s: %v", artifact.File, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fatal("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		fatal("failed to stat %s: %v", path, err)
+	}
+	size := info.Size()
+	if size != artifact.Size {
+		fatal("%s has %d bytes, the manifest lists %d", artifact.File, size, artifact.Size)
+	}
+
+	// Drop the library of another kind or version
+	os.RemoveAll(filepath.Join(projectRoot, "lib", t.libDir()))
+	updateLibRequirements()
+	if strings.HasSuffix(artifact.File, ".zip") {
+		err = extractReleaseZip(file, size, t)
+	} else {
+		err = extractReleaseTarGz(file, t)
+	}
+	if err != nil {
+		fatal("failed to extract %s: %v", artifact.File, err)
+	}
+	log("Installed %s from %s", t, artifact.File)
+}
+
+func extractReleaseTarGz(reader io.Reader, t Target) error {
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = writeReleaseEntry(header.Name, tarReader, t)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractReleaseZip(reader io.ReaderAt, size int64, t Target) error {
+	zipReader, err := zip.NewReader(reader, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeReleaseEntry(file.Name, entry, t)
+		entry.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReleaseEntry writes an archive entry into the project, accepting only
+// the headers, the library directory and the CGO config of |t|.
+func writeReleaseEntry(name string, reader io.Reader, t Target) error {
+	cleanName := path.Clean(name)
+	libPrefix := "lib/" + t.libDir() + "/"
+	configName := t.configName()
+	valid := cleanName == configName ||
+		strings.HasPrefix(cleanName, "include/") && !strings.Contains(cleanName[len("include/"):], "/") ||
+		strings.HasPrefix(cleanName, libPrefix) && !strings.Contains(cleanName[len(libPrefix):], "/")
+	if !valid || cleanName != name {
+		return fmt.Errorf("unexpected entry %s", name)
+	}
+	target := filepath.Join(projectRoot, filepath.FromSlash(cleanName))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
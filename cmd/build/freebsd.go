@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// freebsdRelease is the FreeBSD release whose base system the FreeBSD targets
+// are built against. Binaries run on it and on later releases, which keep the
+// libraries of earlier ones. Releases past their end of life move to
+// ftp-archive.freebsd.org, which -mirror can point to.
+const freebsdRelease = "14.3-RELEASE"
+
+// freebsdArchs maps gn target_cpu to the FreeBSD architecture of the sysroot.
+var freebsdArchs = map[string]string{
+	"x64": "amd64",
+}
+
+// freebsdSysrootDirs are the directories of the base system the sysroot
+// keeps: headers and the libraries to link against.
+var freebsdSysrootDirs = []string{"lib", "usr/include", "usr/lib"}
+
+// freebsdSysroot returns the sysroot of |cpu| relative to the source root.
+func freebsdSysroot(cpu string) string {
+	return fmt.Sprintf("out/sysroot-build/freebsd/%s/%s", freebsdRelease, freebsdArchs[cpu])
+}
+
+// freebsdTriple returns the clang target of |cpu|, e.g.
+// x86_64-unknown-freebsd14.3.
+func freebsdTriple(cpu string) string {
+	arch := map[string]string{"x64": "x86_64"}[cpu]
+	version, _, _ := strings.Cut(freebsdRelease, "-")
+	return arch + "-unknown-freebsd" + version
+}
+
+// checkFreeBSDBuild fails unless |t| can be built here. Chromium builds for
+// the BSDs only with the patches of their ports, which the gn build of a
+// patched tree detects as is_freebsd, and the toolchain is the Linux one of
+// get-clang.sh.
+func checkFreeBSDBuild(t Target) {
+	if runtime.GOOS != "linux" {
+		fatal("%s cross-compiles on Linux only, build it on a Linux host or with -docker", t)
+	}
+	if !freebsdSupported() {
+		fatal("naiveproxy has no FreeBSD support in its gn build: add the patches of the FreeBSD chromium port to %s/ with patch update and run patch apply", patchesDir)
+	}
+}
+
+// freebsdSupported reports whether the gn build of the naiveproxy tree knows
+// FreeBSD.
+func freebsdSupported() bool {
+	content, err := os.ReadFile(filepath.Join(srcRoot, "build", "config", "BUILDCONFIG.gn"))
+	return err == nil && strings.Contains(string(content), "is_freebsd")
+}
+
+// prepareFreeBSDSysroot extracts the headers and libraries of the FreeBSD
+// base system into the sysroot of |t|, unless it is there already. The
+// download is verified against the MANIFEST of the release.
+func prepareFreeBSDSysroot(t Target) {
+	sysroot := filepath.Join(srcRoot, filepath.FromSlash(freebsdSysroot(t.CPU)))
+	if _, err := os.Stat(filepath.Join(sysroot, "usr", "include", "stdio.h")); err == nil {
+		return
+	}
+	releaseURL := fmt.Sprintf("https://download.freebsd.org/releases/%s/%s/", freebsdArchs[t.CPU], freebsdRelease)
+	manifest, err := downloadBytes(releaseURL + "MANIFEST")
+	if err != nil {
+		fatal("failed to download the FreeBSD %s manifest: %v", freebsdRelease, err)
+	}
+	expectedSHA256 := ""
+	for _, line := range strings.Split(string(manifest), "\n") {
+		// base.txz	<sha256>	<files>	base	"Base system"	on
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "base.txz" {
+			expectedSHA256 = fields[1]
+			break
+		}
+	}
+	if expectedSHA256 == "" {
+		fatal("no base.txz in the FreeBSD %s manifest", freebsdRelease)
+	}
+
+	log("Downloading FreeBSD %s base system for the sysroot...", freebsdRelease)
+	archive, err := downloadFile(releaseURL+"base.txz", expectedSHA256)
+	if err != nil {
+		fatal("failed to download FreeBSD base system: %v", err)
+	}
+	// Extracts next to the sysroot and renames, so an interrupted extraction
+	// is not mistaken for a complete sysroot
+	partial := sysroot + ".partial"
+	os.RemoveAll(partial)
+	err = extractArchiveMembers(archive, partial, func(name string) bool {
+		name = path.Clean(name)
+		for _, dir := range freebsdSysrootDirs {
+			if name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		fatal("failed to extract FreeBSD base system: %v", err)
+	}
+	os.RemoveAll(sysroot)
+	if err := os.Rename(partial, sysroot); err != nil {
+		fatal("failed to move FreeBSD sysroot into place: %v", err)
+	}
+	log("FreeBSD sysroot ready at %s", freebsdSysroot(t.CPU))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// gnArgDeclaration is an entry of gn args --list --json.
+type gnArgDeclaration struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment"`
+	Default struct {
+		Value string `json:"value"`
+	} `json:"default"`
+}
+
+// gnArgPrefixes are stripped from arg names when looking for the new name of
+// a removed arg, as renames often flip between them.
+var gnArgPrefixes = []string{"enable_", "disable_", "use_", "is_", "include_"}
+
+// cmdGNCheck compares the gn args build passes for each target with the args
+// the synced Chromium declares. An arg Chromium no longer declares is silently
+// ignored by gn gen, so a rename on upgrade turns a feature back on without
+// a build failure; gn-check fails instead, naming likely new names. Args
+// declared deprecated and args matching their default are reported too.
+func cmdGNCheck(targets []Target, args []string) {
+	flags := flag.NewFlagSet("gn-check", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "Also fail on deprecated args")
+	flags.Parse(args)
+
+	log("Checking gn args of %d target(s) against Chromium %s", len(targets), readChromiumVersion())
+	failed := false
+	for _, t := range targets {
+		if !skipGetClang {
+			runGetClang(t)
+		}
+		declarations := listGNArgs(t)
+		var removed, deprecated, redundant []string
+		for _, arg := range targetGNArgs(t) {
+			name, value, _ := strings.Cut(arg, "=")
+			declaration, found := declarations[name]
+			switch {
+			case !found:
+				message := name
+				if candidates := gnArgCandidates(name, declarations); len(candidates) > 0 {
+					message += " (renamed to " + strings.Join(candidates, " or ") + "?)"
+				}
+				removed = append(removed, message)
+			case strings.Contains(strings.ToLower(declaration.Comment), "deprecated"):
+				deprecated = append(deprecated, name)
+			case declaration.Default.Value == value:
+				redundant = append(redundant, name+"="+value)
+			}
+		}
+		for _, name := range removed {
+			log("%s: removed arg %s", t, name)
+		}
+		for _, name := range deprecated {
+			log("%s: deprecated arg %s", t, name)
+		}
+		for _, arg := range redundant {
+			log("%s: arg %s matches the default", t, arg)
+		}
+		if len(removed) > 0 || *strict && len(deprecated) > 0 {
+			failed = true
+		} else {
+			log("%s: ok", t)
+		}
+	}
+	if failed {
+		fatal("gn args are out of date with Chromium %s", readChromiumVersion())
+	}
+	log("gn-check complete!")
+}
+
+// listGNArgs returns the args Chromium declares for |t|, by name. The args
+// are listed from a scratch output directory, leaving the build untouched.
+func listGNArgs(t Target) map[string]gnArgDeclaration {
+	outDir := fmt.Sprintf("out/cronet-go-gn-check-%s-%s", t.OS, t.CPU)
+	outPath := filepath.Join(srcRoot, filepath.FromSlash(outDir))
+	os.RemoveAll(outPath)
+	defer os.RemoveAll(outPath)
+	if err := os.MkdirAll(outPath, 0755); err != nil {
+		fatal("failed to create %s: %v", outDir, err)
+	}
+	gnArgs := strings.Join(targetGNArgs(t), "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(outPath, "args.gn"), []byte(gnArgs), 0644); err != nil {
+		fatal("failed to write %s/args.gn: %v", outDir, err)
+	}
+
+	cmd := exec.Command(gnBinary(), "args", outDir, "--list", "--json")
+	cmd.Dir = srcRoot
+	cmd.Stderr = os.Stderr
+	if runtime.GOOS == "windows" {
+		cmd.Env = append(os.Environ(), "DEPOT_TOOLS_WIN_TOOLCHAIN=0")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		fatal("gn args --list failed for %s: %v", t, err)
+	}
+	var list []gnArgDeclaration
+	if err := json.Unmarshal(output, &list); err != nil {
+		fatal("invalid output of gn args --list for %s: %v", t, err)
+	}
+	declarations := make(map[string]gnArgDeclaration, len(list))
+	for _, declaration := range list {
+		declarations[declaration.Name] = declaration
+	}
+	return declarations
+}
+
+// gnArgCandidates returns the declared args that may be the new name of
+// |name|: those sharing the most words with it, ignoring the enable_/use_/...
+// prefix and plurals, if they share more than half of its words.
+func gnArgCandidates(name string, declarations map[string]gnArgDeclaration) []string {
+	words := gnArgWords(name)
+	var (
+		candidates []string
+		best       int
+	)
+	for declared := range declarations {
+		shared := 0
+		declaredWords := gnArgWords(declared)
+		for word := range words {
+			if declaredWords[word] {
+				shared++
+			}
+		}
+		if shared*2 <= len(words) || shared < best {
+			continue
+		}
+		if shared > best {
+			candidates, best = nil, shared
+		}
+		candidates = append(candidates, declared)
+	}
+	sort.Strings(candidates)
+	if len(candidates) > 3 {
+		candidates = candidates[:3]
+	}
+	return candidates
+}
+
+func gnArgWords(name string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Split(trimGNArgPrefix(name), "_") {
+		if word != "" {
+			words[strings.TrimSuffix(word, "s")] = true
+		}
+	}
+	return words
+}
+
+func trimGNArgPrefix(name string) string {
+	for _, prefix := range gnArgPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
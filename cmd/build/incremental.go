@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+var (
+	// cleanBuild removes the output directory of each target before building.
+	cleanBuild bool
+	// ccWrapper is the compiler cache wrapping the compiler: empty to detect
+	// sccache or ccache, "none" to disable it, or a command.
+	ccWrapper string
+)
+
+// gnArgsStamp is written to the output directory after gn gen with the args
+// it ran with. A later build with the same args skips gn gen and reuses the
+// directory; ninja still reruns gn itself when a BUILD.gn file changes.
+const gnArgsStamp = "cronet-go-gn-args"
+
+// resolveCCWrapper returns the compiler cache to build with, or an empty
+// string for none. ccache does not handle clang-cl, so only sccache is
+// detected on Windows.
+func resolveCCWrapper() string {
+	switch ccWrapper {
+	case "none":
+		return ""
+	case "":
+	default:
+		return ccWrapper
+	}
+	candidates := []string{"sccache", "ccache"}
+	if runtime.GOOS == "windows" {
+		candidates = candidates[:1]
+	}
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return filepath.ToSlash(path)
+		}
+	}
+	return ""
+}
+
+// ccWrapperEnv returns the environment of ninja for |wrapper|. ccache would
+// miss on every build of another checkout or with a changed __DATE__
+// otherwise.
+func ccWrapperEnv(wrapper string) []string {
+	env := os.Environ()
+	if wrapper == "" {
+		return env
+	}
+	if name := filepath.Base(wrapper); name == "ccache" || name == "ccache.exe" {
+		env = append(env,
+			"CCACHE_BASEDIR="+srcRoot,
+			"CCACHE_CPP2=yes",
+			"CCACHE_SLOPPINESS=time_macros,include_file_mtime,include_file_ctime",
+		)
+	}
+	return env
+}
+
+// prepareOutDir removes |outDir| for -clean and reports whether gn gen has to
+// run for |gnArgs|.
+func prepareOutDir(outDir string, gnArgs string) bool {
+	outPath := filepath.Join(srcRoot, outDir)
+	if cleanBuild {
+		log("Removing %s for a clean build", outDir)
+		if err := os.RemoveAll(outPath); err != nil {
+			fatal("failed to remove %s: %v", outDir, err)
+		}
+		return true
+	}
+	if _, err := os.Stat(filepath.Join(outPath, "build.ninja")); err != nil {
+		return true
+	}
+	stamp, err := os.ReadFile(filepath.Join(outPath, gnArgsStamp))
+	if err != nil || string(stamp) != gnArgs {
+		return true
+	}
+	log("Reusing %s, gn args unchanged", outDir)
+	return false
+}
+
+// writeGNArgsStamp records |gnArgs| after a successful gn gen.
+func writeGNArgsStamp(outDir string, gnArgs string) {
+	path := filepath.Join(srcRoot, outDir, gnArgsStamp)
+	if err := os.WriteFile(path, []byte(gnArgs), 0644); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+}
@@ -6,9 +6,21 @@
 //
 // Commands:
 //
-//	build    Build cronet_static for specified targets
-//	package  Package libraries and generate CGO config files
-//	publish  Commit to go branch and push
+//	sync     Download the Chromium components cronet needs (-version, -components)
+//	patch    Apply patches/ on top of the synced components (apply) or export local changes to it (update)
+//	build    Build cronet_static, or with -shared libcronet, for specified targets
+//	package  Package libraries as per-target modules and generate CGO config files (-xcframework, -aar, -thin)
+//	release  Pack release archives with Nix and Homebrew definitions (-upload to GitHub)
+//	fetch    Download prebuilt libraries of a release instead of building them
+//	doctor   Check the tools, SDKs and disk space the targets need
+//	gn-check Check the gn args against those the synced Chromium declares
+//	verify   Link and run a smoke test against the packaged libraries
+//	size     Break the packaged libraries down by section and object
+//	publish  Commit to go branch, tag and push (-dry-run, -version, -rollback)
+//	release-pipeline  Run sync, build, package, verify and publish with checkpoints
+//
+// Default targets, gn args, SDK paths and cache directories can be checked in
+// as build.yaml or build.json in the project root; see BuildConfig.
 package main
 
 import (
@@ -16,29 +28,77 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // Target represents a build target platform
 type Target struct {
-	OS   string // gn target_os: linux, mac, win, android, ios
-	CPU  string // gn target_cpu: x64, arm64, x86, arm
+	OS   string // gn target_os: linux, mac, win, android, ios, openwrt, freebsd
+	CPU  string // gn target_cpu: x64, arm64, x86, arm, riscv64, loong64
 	GOOS string // Go GOOS
 	ARCH string // Go GOARCH
+	Libc string // musl for targets selected by the musl build tag, empty for the platform libc
+}
+
+// String returns the name of the target in -targets, e.g. linux/amd64-musl.
+func (t Target) String() string {
+	if t.Libc != "" {
+		return t.GOOS + "/" + t.ARCH + "-" + t.Libc
+	}
+	return t.GOOS + "/" + t.ARCH
+}
+
+// libDir returns the directory of the library under lib/, e.g. linux_amd64_musl.
+func (t Target) libDir() string {
+	if t.Libc != "" {
+		return t.GOOS + "_" + t.ARCH + "_" + t.Libc
+	}
+	return t.GOOS + "_" + t.ARCH
+}
+
+// configName returns the name of the CGO config file of the target.
+func (t Target) configName() string {
+	return "cgo_" + t.libDir() + ".go"
+}
+
+// buildConstraint returns the build constraint of the CGO config. Targets with
+// a musl variant exclude the musl build tag.
+func (t Target) buildConstraint() string {
+	constraint := t.GOOS + " && " + t.ARCH
+	if t.Libc != "" {
+		return constraint + " && " + t.Libc
+	}
+	for _, other := range allTargets {
+		if other.Libc != "" && other.GOOS == t.GOOS && other.ARCH == t.ARCH {
+			return constraint + " && !" + other.Libc
+		}
+	}
+	return constraint
 }
 
 var allTargets = []Target{
 	{OS: "linux", CPU: "x64", GOOS: "linux", ARCH: "amd64"},
 	{OS: "linux", CPU: "arm64", GOOS: "linux", ARCH: "arm64"},
+	{OS: "linux", CPU: "riscv64", GOOS: "linux", ARCH: "riscv64"},
+	{OS: "linux", CPU: "loong64", GOOS: "linux", ARCH: "loong64"},
+	{OS: "linux", CPU: "x86", GOOS: "linux", ARCH: "386"},
+	{OS: "openwrt", CPU: "x64", GOOS: "linux", ARCH: "amd64", Libc: "musl"},
+	{OS: "openwrt", CPU: "arm64", GOOS: "linux", ARCH: "arm64", Libc: "musl"},
+	// Chromium builds for FreeBSD with the patches of its port only, see
+	// checkFreeBSDBuild. OpenBSD is left out: its libc has no stable ABI, so a
+	// library would only load on the release it was built against.
+	{OS: "freebsd", CPU: "x64", GOOS: "freebsd", ARCH: "amd64"},
 	{OS: "mac", CPU: "x64", GOOS: "darwin", ARCH: "amd64"},
 	{OS: "mac", CPU: "arm64", GOOS: "darwin", ARCH: "arm64"},
 	{OS: "win", CPU: "x64", GOOS: "windows", ARCH: "amd64"},
 	{OS: "win", CPU: "arm64", GOOS: "windows", ARCH: "arm64"},
+	{OS: "win", CPU: "x86", GOOS: "windows", ARCH: "386"},
 	{OS: "ios", CPU: "arm64", GOOS: "ios", ARCH: "arm64"},
 	{OS: "android", CPU: "arm64", GOOS: "android", ARCH: "arm64"},
 	{OS: "android", CPU: "x64", GOOS: "android", ARCH: "amd64"},
@@ -77,16 +137,43 @@ func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command>\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Commands:\n")
-		fmt.Fprintf(os.Stderr, "  sync      Download Chromium cronet components\n")
-		fmt.Fprintf(os.Stderr, "  build     Build cronet_static for specified targets\n")
-		fmt.Fprintf(os.Stderr, "  package   Package libraries and generate CGO config files\n")
-		fmt.Fprintf(os.Stderr, "  publish   Commit to go branch and push\n")
+		fmt.Fprintf(os.Stderr, "  sync      Download Chromium cronet components (sync [-version X.Y.Z.W] [-components a,b])\n")
+		fmt.Fprintf(os.Stderr, "  patch     Apply patches/ on top of the synced components or export the local changes to it (patch apply, patch update [-new subject])\n")
+		fmt.Fprintf(os.Stderr, "  build     Build cronet_static, or with -shared libcronet, for specified targets\n")
+		fmt.Fprintf(os.Stderr, "  package   Package libraries as per-target modules and generate CGO config files (package [-xcframework] [-aar] [-thin])\n")
+		fmt.Fprintf(os.Stderr, "  release   Pack release archives with Nix and Homebrew definitions (release -version vX.Y.Z [-upload])\n")
+		fmt.Fprintf(os.Stderr, "  fetch     Download prebuilt libraries of a release (fetch [-version vX.Y.Z])\n")
+		fmt.Fprintf(os.Stderr, "  doctor    Check the tools, SDKs and disk space the targets need and print fixes\n")
+		fmt.Fprintf(os.Stderr, "  gn-check  Check the gn args against those the synced Chromium declares (gn-check [-strict])\n")
+		fmt.Fprintf(os.Stderr, "  size      Break the packaged libraries down by section and object (size [-top N] [-json])\n")
+		fmt.Fprintf(os.Stderr, "  verify    Link and run a smoke test against the packaged libraries (verify [-qemu] [-adb] [-h3-url URL])\n")
+		fmt.Fprintf(os.Stderr, "  publish   Commit to go branch with a changelog, tag the next version and push (publish [-dry-run] [-tag=false] [-version vX.Y.Z] [-rollback])\n")
+		fmt.Fprintf(os.Stderr, "  release-pipeline  Run sync, build, package, verify and publish, resuming after the last completed stage\n")
 		fmt.Fprintf(os.Stderr, "\nFlags:\n")
 		flag.PrintDefaults()
 	}
 
 	var targetStr string
-	flag.StringVar(&targetStr, "targets", "", "Comma-separated list of targets (e.g., linux/amd64,darwin/arm64). Empty means host only.")
+	flag.StringVar(&targetStr, "targets", "", "Comma-separated list of targets (e.g., linux/amd64,darwin/arm64,linux/amd64-musl). Empty means host only.")
+	flag.BoolVar(&sharedLibrary, "shared", false, "Build and package the shared library libcronet instead of cronet_static")
+	flag.BoolVar(&dockerBuild, "docker", false, "Build each target in a container with a pinned toolchain (Linux and Android targets)")
+	flag.StringVar(&dockerImage, "docker-image", "", "Image for -docker (default: built from cmd/build/docker/Dockerfile)")
+	flag.IntVar(&buildJobs, "j", 1, "Number of targets to build concurrently")
+	flag.IntVar(&ninjaLoad, "load", 0, "Do not start compile jobs above this load average (ninja -l; default with -j: number of CPUs)")
+	flag.BoolVar(&skipGetClang, "skip-get-clang", false, "Skip get-clang.sh, for toolchains already prepared")
+	flag.BoolVar(&cleanBuild, "clean", false, "Remove the output directories and rebuild from scratch")
+	flag.StringVar(&ccWrapper, "cc-wrapper", "", "Compiler cache, e.g. ccache (default: sccache or ccache if installed, none to disable)")
+	flag.IntVar(&symbolLevel, "symbol-level", 0, "gn symbol_level: 0 for no debug info, 1 for line tables, 2 for full")
+	flag.StringVar(&thinLTO, "lto", "", "Thin LTO, on or off (default: Chromium's choice)")
+	flag.StringVar(&icf, "icf", "", "Identical code folding of shared libraries, on or off (default: Chromium's choice)")
+	flag.StringVar(&stripMode, "strip", "", "Strip packaged libraries: debug or unneeded (default: none)")
+	flag.IntVar(&androidNDKMajorVersion, "android-ndk", 28, "Major version of the NDK Android targets build with")
+	flag.IntVar(&androidMinSDK, "android-min-sdk", 24, "Minimum API level of Android targets")
+	flag.BoolVar(&downloadNDK, "download-ndk", false, "Download the Android NDK from Google if none is installed")
+	flag.StringVar(&downloadCacheDir, "download-cache", defaultDownloadCacheDir(), "Directory keeping downloads to reuse and resume")
+	flag.StringVar(&buildConfigPath, "config", "", "Config file with default targets, gn args, SDK paths and caches (default: build.yaml or build.json in the project root, none to ignore it)")
+	flag.StringVar(&extraGNArgs, "gn-args", "", "Space-separated gn args added to those of every target, replacing args of the same name")
+	mirrors := flag.String("mirror", os.Getenv("CRONET_GO_MIRRORS"), "Comma-separated prefix=replacement URL rewrites tried before the original URLs")
 
 	flag.Parse()
 
@@ -96,18 +183,42 @@ func main() {
 	}
 
 	cmd := flag.Arg(0)
+	downloadMirrors = parseDownloadMirrors(*mirrors)
+	loadBuildConfig(&targetStr)
 
 	targets := parseTargets(targetStr)
+	if sharedLibrary {
+		checkSharedTargets(targets)
+	}
+	if dockerBuild {
+		checkDockerTargets(targets)
+	}
 
 	switch cmd {
 	case "sync":
-		cmdSync()
+		cmdSync(flag.Args()[1:])
 	case "build":
 		cmdBuild(targets)
 	case "package":
-		cmdPackage(targets)
+		cmdPackage(targets, flag.Args()[1:])
+	case "release":
+		cmdRelease(targets, flag.Args()[1:])
+	case "fetch":
+		cmdFetch(targets, flag.Args()[1:])
+	case "patch":
+		cmdPatch(flag.Args()[1:])
+	case "doctor":
+		cmdDoctor(targets)
+	case "gn-check":
+		cmdGNCheck(targets, flag.Args()[1:])
+	case "size":
+		cmdSize(targets, flag.Args()[1:])
+	case "verify":
+		cmdVerify(targets, flag.Args()[1:])
 	case "publish":
-		cmdPublish()
+		cmdPublish(flag.Args()[1:])
+	case "release-pipeline":
+		cmdReleasePipeline(targets, flag.Args()[1:])
 	default:
 		fatal("unknown command: %s", cmd)
 	}
@@ -119,7 +230,7 @@ func parseTargets(s string) []Target {
 		hostOS := runtime.GOOS
 		hostArch := runtime.GOARCH
 		for _, t := range allTargets {
-			if t.GOOS == hostOS && t.ARCH == hostArch {
+			if t.GOOS == hostOS && t.ARCH == hostArch && t.Libc == "" {
 				return []Target{t}
 			}
 		}
@@ -137,33 +248,97 @@ func parseTargets(s string) []Target {
 		if len(parts) != 2 {
 			fatal("invalid target format: %s (expected os/arch)", part)
 		}
-		goos, goarch := parts[0], parts[1]
 		found := false
 		for _, t := range allTargets {
-			if t.GOOS == goos && t.ARCH == goarch {
+			if t.String() == part {
 				targets = append(targets, t)
 				found = true
 				break
 			}
 		}
 		if !found {
-			fatal("unsupported target: %s/%s", goos, goarch)
+			fatal("unsupported target: %s", part)
 		}
 	}
 	return targets
 }
 
 func cmdBuild(targets []Target) {
-	log("Building cronet_static for %d target(s)", len(targets))
+	log("Building %s for %d target(s)", ninjaTarget(), len(targets))
 
+	if buildJobs > 1 && len(targets) > 1 {
+		buildParallel(targets)
+		log("Build complete!")
+		return
+	}
 	for _, t := range targets {
-		log("Building %s/%s...", t.GOOS, t.ARCH)
-		buildTarget(t)
+		log("Building %s...", t)
+		runTargetBuild(t)
 	}
 
 	log("Build complete!")
 }
 
+// openwrtSDK is the OpenWrt SDK get-clang.sh takes the musl sysroot of a
+// musl target from.
+type openwrtSDK struct {
+	Arch       string
+	Release    string
+	GCCVersion string
+	Target     string
+	Subtarget  string
+}
+
+// openwrtSDKs maps gn target_cpu to the SDK of the musl targets.
+var openwrtSDKs = map[string]openwrtSDK{
+	"x64":   {Arch: "x86_64", Release: "23.05.5", GCCVersion: "12.3.0", Target: "x86", Subtarget: "64"},
+	"arm64": {Arch: "aarch64_generic", Release: "23.05.5", GCCVersion: "12.3.0", Target: "armsr", Subtarget: "armv8"},
+}
+
+// flags returns the OPENWRT_FLAGS get-clang.sh reads.
+func (s openwrtSDK) flags() string {
+	return fmt.Sprintf("arch=%s release=%s gcc_ver=%s target=%s subtarget=%s", s.Arch, s.Release, s.GCCVersion, s.Target, s.Subtarget)
+}
+
+// sysroot returns the sysroot get-clang.sh extracts the SDK to.
+func (s openwrtSDK) sysroot() string {
+	return fmt.Sprintf("out/sysroot-build/openwrt/%s/%s", s.Release, s.Arch)
+}
+
+// debianArchs maps gn target_cpu to the Debian architecture of the Linux
+// sysroot.
+var debianArchs = map[string]string{
+	"x64":     "amd64",
+	"arm64":   "arm64",
+	"riscv64": "riscv64",
+	"loong64": "loong64",
+	"x86":     "i386",
+}
+
+// linuxSysroot returns the sysroot get-clang.sh built for |cpu|, relative to
+// the source root. riscv64 and loong64 are not ported to the Debian release
+// of the other sysroots, so the release is taken from the directory name,
+// e.g. out/sysroot-build/bullseye/bullseye_amd64_staging.
+func linuxSysroot(cpu string) string {
+	pattern := fmt.Sprintf("out/sysroot-build/*/*_%s_staging", debianArchs[cpu])
+	matches, err := filepath.Glob(filepath.Join(srcRoot, filepath.FromSlash(pattern)))
+	if err != nil {
+		fatal("failed to search sysroot: %v", err)
+	}
+	switch len(matches) {
+	case 0:
+		fatal("no sysroot for %s found at %s", cpu, pattern)
+	case 1:
+	default:
+		fatal("several sysroots for %s found, remove the stale ones: %s", cpu, strings.Join(matches, ", "))
+	}
+	relative, err := filepath.Rel(srcRoot, matches[0])
+	if err != nil {
+		fatal("failed to resolve sysroot: %v", err)
+	}
+	return filepath.ToSlash(relative)
+}
+
 // getExtraFlags returns the EXTRA_FLAGS for a target
 func getExtraFlags(t Target) string {
 	flags := []string{
@@ -179,7 +354,9 @@ func runGetClang(t Target) {
 	// because GN needs host sysroot in addition to target sysroot
 	hostOS := runtime.GOOS
 	hostCPU := hostToCPU(runtime.GOARCH)
-	if hostOS == "linux" && (t.OS == "linux" || t.OS == "android") && t.CPU != hostCPU {
+	// The musl and FreeBSD sysroots never serve the host
+	crossSysroot := t.CPU != hostCPU || t.OS == "openwrt" || t.OS == "freebsd"
+	if hostOS == "linux" && (t.OS == "linux" || t.OS == "android" || t.OS == "openwrt" || t.OS == "freebsd") && crossSysroot {
 		// Run get-clang.sh with host target to ensure host sysroot is downloaded
 		hostFlags := fmt.Sprintf(`target_os="linux" target_cpu="%s"`, hostCPU)
 		log("Running get-clang.sh for host sysroot with EXTRA_FLAGS=%s", hostFlags)
@@ -203,12 +380,22 @@ func runGetClang(t Target) {
 		}
 	}
 
+	if t.OS == "freebsd" {
+		// get-clang.sh knows no FreeBSD sysroot; the run for the host above
+		// fetched clang, and the sysroot comes from the FreeBSD base system
+		prepareFreeBSDSysroot(t)
+		return
+	}
+
 	extraFlags := getExtraFlags(t)
 	log("Running get-clang.sh with EXTRA_FLAGS=%s", extraFlags)
 
 	cmd := exec.Command("bash", "./get-clang.sh")
 	cmd.Dir = srcRoot
 	cmd.Env = append(os.Environ(), "EXTRA_FLAGS="+extraFlags)
+	if t.OS == "openwrt" {
+		cmd.Env = append(cmd.Env, "OPENWRT_FLAGS="+openwrtSDKs[t.CPU].flags())
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -227,18 +414,17 @@ func hostToCPU(goarch string) string {
 		return "x86"
 	case "arm":
 		return "arm"
+	case "riscv64":
+		return "riscv64"
+	case "loong64":
+		return "loong64"
 	default:
 		return goarch
 	}
 }
 
-func buildTarget(t Target) {
-	// Run get-clang.sh to ensure toolchain is available
-	runGetClang(t)
-
-	outDir := fmt.Sprintf("out/cronet-%s-%s", t.OS, t.CPU)
-
-	// Prepare GN args
+// targetGNArgs returns the gn args of |t|, without the compiler cache.
+func targetGNArgs(t Target) []string {
 	args := []string{
 		"is_official_build=true",
 		"is_debug=false",
@@ -268,33 +454,55 @@ func buildTarget(t Target) {
 		"enable_dangling_raw_ptr_checks=false",
 		"exclude_unwind_tables=true",
 		"enable_resource_allowlist_generation=false",
-		"symbol_level=0",
 		"enable_dsyms=false",
 		fmt.Sprintf("target_os=\"%s\"", t.OS),
 		fmt.Sprintf("target_cpu=\"%s\"", t.CPU),
 	}
 
+	args = append(args, sizeGNArgs()...)
+
 	// Platform-specific args
 	switch t.OS {
 	case "mac":
 		args = append(args, "use_sysroot=false")
 	case "linux":
 		// Sysroot is handled by get-clang.sh, use the naiveproxy path
-		sysrootArch := map[string]string{"x64": "amd64", "arm64": "arm64"}[t.CPU]
-		sysrootDir := fmt.Sprintf("out/sysroot-build/bullseye/bullseye_%s_staging", sysrootArch)
-		args = append(args, "use_sysroot=true", fmt.Sprintf("target_sysroot=\"//%s\"", sysrootDir))
+		args = append(args, "use_sysroot=true", fmt.Sprintf("target_sysroot=\"//%s\"", linuxSysroot(t.CPU)))
+		if t.CPU == "x64" {
+			args = append(args, "use_cfi_icall=false")
+		}
+	case "openwrt":
+		// musl has no glibc malloc hooks for the allocator shim
+		args = append(args,
+			"use_sysroot=true",
+			fmt.Sprintf("target_sysroot=\"//%s\"", openwrtSDKs[t.CPU].sysroot()),
+			"use_allocator_shim=false",
+			"use_partition_alloc_as_malloc=false",
+		)
 		if t.CPU == "x64" {
 			args = append(args, "use_cfi_icall=false")
 		}
+	case "freebsd":
+		// The port builds without the allocator shim, which hooks glibc
+		args = append(args,
+			"use_sysroot=true",
+			fmt.Sprintf("target_sysroot=\"//%s\"", freebsdSysroot(t.CPU)),
+			"use_allocator_shim=false",
+			"use_partition_alloc_as_malloc=false",
+			"use_cfi_icall=false",
+		)
 	case "win":
 		args = append(args, "use_sysroot=false")
 	case "android":
 		args = append(args,
 			"use_sysroot=false",
-			"default_min_sdk_version=24",
+			fmt.Sprintf("default_min_sdk_version=%d", androidMinSDK),
 			"is_high_end_android=true",
-			"android_ndk_major_version=28",
+			fmt.Sprintf("android_ndk_major_version=%d", androidNDKMajorVersion),
 		)
+		if ndk := androidNDKRoot(); ndk != chromiumNDK() {
+			args = append(args, fmt.Sprintf("android_ndk_root=\"%s\"", filepath.ToSlash(ndk)))
+		}
 	case "ios":
 		args = append(args,
 			"use_sysroot=false",
@@ -304,34 +512,90 @@ func buildTarget(t Target) {
 		)
 	}
 
-	gnArgs := strings.Join(args, " ")
+	return overrideGNArgs(args, configuredGNArgs(t))
+}
 
-	// Determine GN path
+// gnBinary returns the gn naiveproxy builds into the source tree.
+func gnBinary() string {
 	gnPath := filepath.Join(srcRoot, "gn", "out", "gn")
 	if runtime.GOOS == "windows" {
 		gnPath += ".exe"
 	}
+	return gnPath
+}
 
-	// Run gn gen
-	log("Running: gn gen %s", outDir)
-	gnCmd := exec.Command(gnPath, "gen", outDir, "--args="+gnArgs)
-	gnCmd.Dir = srcRoot
-	gnCmd.Stdout = os.Stdout
-	gnCmd.Stderr = os.Stderr
-	// On Windows, use system Visual Studio instead of depot_tools
-	if runtime.GOOS == "windows" {
-		gnCmd.Env = append(os.Environ(), "DEPOT_TOOLS_WIN_TOOLCHAIN=0")
+func buildTarget(t Target) {
+	if t.OS == "freebsd" {
+		checkFreeBSDBuild(t)
 	}
-	if err := gnCmd.Run(); err != nil {
-		fatal("gn gen failed: %v", err)
+	// Run get-clang.sh to ensure toolchain is available
+	if !skipGetClang {
+		runGetClang(t)
+	}
+
+	outDir := fmt.Sprintf("out/cronet-%s-%s", t.OS, t.CPU)
+
+	if t.GOOS == "android" {
+		checkAndroidVersions()
+	}
+	args := targetGNArgs(t)
+	wrapper := resolveCCWrapper()
+	if wrapper != "" {
+		log("Using compiler cache %s", wrapper)
+		args = append(args, fmt.Sprintf("cc_wrapper=\"%s\"", wrapper))
+	}
+
+	gnArgs := strings.Join(args, " ")
+
+	// Run gn gen
+	if prepareOutDir(outDir, gnArgs) {
+		log("Running: gn gen %s", outDir)
+		gnCmd := exec.Command(gnBinary(), "gen", outDir, "--args="+gnArgs)
+		gnCmd.Dir = srcRoot
+		gnCmd.Stdout = os.Stdout
+		gnCmd.Stderr = os.Stderr
+		// On Windows, use system Visual Studio instead of depot_tools
+		if runtime.GOOS == "windows" {
+			gnCmd.Env = append(os.Environ(), "DEPOT_TOOLS_WIN_TOOLCHAIN=0")
+		}
+		if err := gnCmd.Run(); err != nil {
+			fatal("gn gen failed: %v", err)
+		}
+		writeGNArgsStamp(outDir, gnArgs)
 	}
 
 	// Run ninja
-	log("Running: ninja -C %s cronet_static", outDir)
-	runCmd(srcRoot, "ninja", "-C", outDir, "cronet_static")
+	log("Running: ninja -C %s %s", outDir, ninjaTarget())
+	ninjaArgs := []string{"-C", outDir, ninjaTarget()}
+	if ninjaLoad > 0 {
+		ninjaArgs = append(ninjaArgs, "-l", strconv.Itoa(ninjaLoad))
+	}
+	ninjaCmd := exec.Command("ninja", ninjaArgs...)
+	ninjaCmd.Dir = srcRoot
+	ninjaCmd.Env = ccWrapperEnv(wrapper)
+	ninjaCmd.Stdout = os.Stdout
+	ninjaCmd.Stderr = os.Stderr
+	if err := ninjaCmd.Run(); err != nil {
+		fatal("ninja failed: %v", err)
+	}
 }
 
-func cmdPackage(targets []Target) {
+func cmdPackage(targets []Target, args []string) {
+	flags := flag.NewFlagSet("package", flag.ExitOnError)
+	xcframework := flags.Bool("xcframework", false, "Also wrap the macOS and iOS libraries into lib/Cronet.xcframework")
+	aar := flags.Bool("aar", false, "Also arrange the Android runtime libraries for gomobile bind in lib/android")
+	thin := flags.Bool("thin", false, "Drop the objects of the static library the cronet C API does not reach")
+	flags.Parse(args)
+	if *thin && sharedLibrary {
+		fatal("-thin only applies to the static library")
+	}
+	if *xcframework {
+		checkXCFrameworkTargets(targets)
+	}
+	if *aar {
+		checkAARTargets(targets)
+	}
+
 	log("Packaging libraries for %d target(s)", len(targets))
 
 	// Create lib directories
@@ -341,6 +605,7 @@ func cmdPackage(targets []Target) {
 	os.RemoveAll(libDir)
 	os.RemoveAll(includeDir)
 	os.MkdirAll(includeDir, 0755)
+	updateLibRequirements()
 
 	// Copy headers
 	headers := []struct {
@@ -360,154 +625,145 @@ func cmdPackage(targets []Target) {
 
 	// Copy libraries for each target
 	for _, t := range targets {
-		targetDir := filepath.Join(libDir, fmt.Sprintf("%s_%s", t.GOOS, t.ARCH))
+		targetDir := filepath.Join(libDir, t.libDir())
 		os.MkdirAll(targetDir, 0755)
 
+		if sharedLibrary {
+			if !packageSharedLibrary(t, targetDir) {
+				log("Warning: shared library not found for %s, skipping", t)
+				continue
+			}
+			log("Copied shared library for %s", t)
+			continue
+		}
+
 		srcLib := filepath.Join(srcRoot, fmt.Sprintf("out/cronet-%s-%s/obj/components/cronet/libcronet_static.a", t.OS, t.CPU))
 		dstLib := filepath.Join(targetDir, "libcronet.a")
 
 		if _, err := os.Stat(srcLib); os.IsNotExist(err) {
-			log("Warning: library not found for %s/%s, skipping", t.GOOS, t.ARCH)
+			log("Warning: library not found for %s, skipping", t)
 			continue
 		}
 
 		copyFile(srcLib, dstLib)
-		log("Copied library for %s/%s", t.GOOS, t.ARCH)
+		if *thin {
+			thinArchive(dstLib, t)
+		}
+		stripLibrary(dstLib)
+		log("Copied library for %s", t)
 	}
 
 	// Generate CGO config files
 	generateCGOConfigs(targets)
 
+	writeBuildManifest(targets)
+
+	if *xcframework {
+		packageXCFramework(targets)
+	}
+	if *aar {
+		packageAAR(targets)
+	}
+
 	log("Package complete!")
 }
 
+// generateCGOConfigs writes the library module of each target and the CGO
+// config in the project root, which imports it.
 func generateCGOConfigs(targets []Target) {
+	prefix := libModulePrefix()
 	for _, t := range targets {
-		filename := fmt.Sprintf("cgo_%s_%s.go", t.GOOS, t.ARCH)
+		filename := t.configName()
 		filepath := filepath.Join(projectRoot, filename)
 
 		var ldflags []string
-
-		// Common flags
-		ldflags = append(ldflags, "-L${SRCDIR}/lib/"+t.GOOS+"_"+t.ARCH)
-		ldflags = append(ldflags, "-lcronet")
-		ldflags = append(ldflags, "-lc++")
-
-		// Platform-specific flags
-		switch t.GOOS {
-		case "linux":
-			ldflags = append(ldflags, "-ldl", "-lpthread", "-lm", "-lresolv")
-		case "darwin":
-			ldflags = append(ldflags,
-				"-framework Security",
-				"-framework CoreFoundation",
-				"-framework SystemConfiguration",
-				"-framework Network",
-				"-framework AppKit",
-				"-framework CFNetwork",
-				"-framework UniformTypeIdentifiers",
-			)
-		case "windows":
-			ldflags = append(ldflags,
-				"-lws2_32",
-				"-lcrypt32",
-				"-lsecur32",
-				"-ladvapi32",
-				"-lwinhttp",
-			)
-		case "android":
-			ldflags = append(ldflags, "-ldl", "-llog", "-landroid")
-		case "ios":
-			ldflags = append(ldflags,
-				"-framework Security",
-				"-framework CoreFoundation",
-				"-framework SystemConfiguration",
-				"-framework Network",
-				"-framework UIKit",
-			)
+		var comment string
+		if sharedLibrary {
+			var name string
+			var found bool
+			ldflags, name, found = sharedLDFlags(t)
+			if !found {
+				log("Warning: no shared library packaged for %s, skipping %s", t, filename)
+				continue
+			}
+			comment = sharedConfigComment(t, name)
+		} else {
+			ldflags = staticLDFlags(t)
 		}
+		writeLibModule(t, comment, ldflags)
 
-		content := fmt.Sprintf(`//go:build %s && %s
+		// Builds with the cronet_nolib tag link no library
+		content := fmt.Sprintf(`//go:build %s && !cronet_nolib
 
 package cronet
 
 // #cgo CFLAGS: -I${SRCDIR}/include
-// #cgo LDFLAGS: %s
 import "C"
-`, t.GOOS, t.ARCH, strings.Join(ldflags, " "))
+
+import _ "%s%s"
+`, t.buildConstraint(), prefix, t.libDir())
 
 		if err := os.WriteFile(filepath, []byte(content), 0644); err != nil {
 			fatal("failed to write %s: %v", filename, err)
 		}
 		log("Generated %s", filename)
 	}
+	updateLibRequirements()
 }
 
-func cmdPublish() {
-	log("Publishing to go branch...")
-
-	// Check for uncommitted changes
-	output := runCmdOutput(projectRoot, "git", "status", "--porcelain")
-	if strings.TrimSpace(output) != "" {
-		fatal("uncommitted changes in working directory")
-	}
-
-	// Get current branch
-	currentBranch := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "--abbrev-ref", "HEAD"))
-	if currentBranch != "main" {
-		fatal("must be on main branch to publish (current: %s)", currentBranch)
-	}
-
-	// Get current commit
-	mainCommit := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "HEAD"))
-
-	// Check if go branch exists
-	goBranchExists := true
-	if err := exec.Command("git", "-C", projectRoot, "rev-parse", "--verify", "go").Run(); err != nil {
-		goBranchExists = false
-	}
-
-	// Create or checkout go branch
-	if goBranchExists {
-		runCmd(projectRoot, "git", "checkout", "go")
-	} else {
-		runCmd(projectRoot, "git", "checkout", "--orphan", "go")
-		runCmd(projectRoot, "git", "reset", "--hard")
-	}
-
-	// Copy files from main branch
-	filesToCopy := []string{
-		"*.go",
-		"go.mod",
-		"go.sum",
-		"include/",
-		"lib/",
-		"naive/",
-		"LICENSE",
-		"README.md",
-	}
+// staticLDFlags returns the linker flags of the static library of |t|,
+// relative to its module.
+func staticLDFlags(t Target) []string {
+	var ldflags []string
 
-	// Clean current state
-	runCmd(projectRoot, "git", "rm", "-rf", "--ignore-unmatch", ".")
+	// Common flags
+	ldflags = append(ldflags, "-L${SRCDIR}")
+	ldflags = append(ldflags, "-lcronet")
+	ldflags = append(ldflags, "-lc++")
 
-	// Checkout files from main
-	for _, pattern := range filesToCopy {
-		exec.Command("git", "-C", projectRoot, "checkout", mainCommit, "--", pattern).Run()
+	// Platform-specific flags
+	switch t.GOOS {
+	case "linux":
+		if t.Libc == "musl" {
+			// musl has libdl, libpthread, libm and libresolv built in. Linking
+			// statically keeps the binary free of the Alpine libc++ packages.
+			ldflags = append(ldflags, "-lc++abi", "-lunwind", "-static")
+			break
+		}
+		ldflags = append(ldflags, "-ldl", "-lpthread", "-lm", "-lresolv")
+	case "freebsd":
+		// backtrace() is in libexecinfo, the resolver in libc
+		ldflags = append(ldflags, "-lpthread", "-lm", "-lexecinfo")
+	case "darwin":
+		ldflags = append(ldflags,
+			"-framework Security",
+			"-framework CoreFoundation",
+			"-framework SystemConfiguration",
+			"-framework Network",
+			"-framework AppKit",
+			"-framework CFNetwork",
+			"-framework UniformTypeIdentifiers",
+		)
+	case "windows":
+		ldflags = append(ldflags,
+			"-lws2_32",
+			"-lcrypt32",
+			"-lsecur32",
+			"-ladvapi32",
+			"-lwinhttp",
+		)
+	case "android":
+		ldflags = append(ldflags, "-ldl", "-llog", "-landroid")
+	case "ios":
+		ldflags = append(ldflags,
+			"-framework Security",
+			"-framework CoreFoundation",
+			"-framework SystemConfiguration",
+			"-framework Network",
+			"-framework UIKit",
+		)
 	}
-
-	// Stage and commit
-	runCmd(projectRoot, "git", "add", "-A")
-
-	commitMsg := fmt.Sprintf("Build from %s", mainCommit[:8])
-	runCmd(projectRoot, "git", "commit", "-m", commitMsg, "--allow-empty")
-
-	// Force push
-	runCmd(projectRoot, "git", "push", "-f", "origin", "go")
-
-	// Switch back to main
-	runCmd(projectRoot, "git", "checkout", "main")
-
-	log("Published to go branch!")
+	return ldflags
 }
 
 // Helper functions
@@ -565,7 +821,15 @@ func copyFile(src, dst string) {
 	}
 }
 
-func cmdSync() {
+func cmdSync(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	version := flags.String("version", "", "Chromium version to download the components of (default: naiveproxy's CHROMIUM_VERSION)")
+	componentList := flags.String("components", strings.Join(defaultSyncComponents, ","), "Comma-separated components to download")
+	resolveDeps := flags.Bool("deps", true, "Also download the components the downloaded ones include or depend on")
+	flags.Parse(args)
+	explicit := false
+	flags.Visit(func(*flag.Flag) { explicit = true })
+
 	log("Syncing Chromium cronet components...")
 
 	// Read CHROMIUM_VERSION
@@ -574,29 +838,49 @@ func cmdSync() {
 	if err != nil {
 		fatal("failed to read CHROMIUM_VERSION: %v", err)
 	}
-	version := strings.TrimSpace(string(versionData))
-	log("Chromium version: %s", version)
+	treeVersion := strings.TrimSpace(string(versionData))
+	if *version == "" {
+		*version = treeVersion
+	} else if *version != treeVersion {
+		log("Warning: naiveproxy is at Chromium %s, components of %s may not build against it", treeVersion, *version)
+	}
+	log("Chromium version: %s", *version)
 
 	// Check if components exist and are committed
 	cronetDir := filepath.Join(srcRoot, "components", "cronet")
-	if _, err := os.Stat(cronetDir); err == nil {
+	if _, err := os.Stat(cronetDir); err == nil && !explicit {
 		// Directory exists, check if it's committed
 		status := runCmdOutput(naiveRoot, "git", "status", "--porcelain", "src/components/cronet")
 		if strings.TrimSpace(status) == "" {
 			log("Components already up to date")
+			applyPatches()
 			return
 		}
 	}
 
-	// Components to download
-	components := []string{"cronet", "grpc_support", "prefs"}
+	var components []string
+	for _, name := range strings.Split(*componentList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			components = append(components, name)
+		}
+	}
+	if len(components) == 0 {
+		fatal("no components to sync")
+	}
 
-	for _, name := range components {
+	synced := make(map[string]bool)
+	for len(components) > 0 {
+		name := components[0]
+		components = components[1:]
+		if synced[name] {
+			continue
+		}
+		synced[name] = true
 		log("Downloading %s...", name)
 
 		url := fmt.Sprintf(
 			"https://chromium.googlesource.com/chromium/src/+archive/refs/tags/%s/components/%s.tar.gz",
-			version, name)
+			*version, name)
 
 		destDir := filepath.Join(srcRoot, "components", name)
 
@@ -612,48 +896,59 @@ func cmdSync() {
 		}
 
 		log("Downloaded %s", name)
+
+		if *resolveDeps {
+			for _, dependency := range componentDependencies(name) {
+				if synced[dependency] {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(srcRoot, "components", dependency)); err == nil {
+					continue
+				}
+				log("%s needs %s", name, dependency)
+				components = append(components, dependency)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(synced))
+	for name := range synced {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
 	// Git add and commit
 	log("Creating git commit...")
-	runCmd(naiveRoot, "git", "add",
-		"src/components/cronet",
-		"src/components/grpc_support",
-		"src/components/prefs")
+	addArgs := []string{"add"}
+	var componentLines []string
+	for _, name := range names {
+		addArgs = append(addArgs, "src/components/"+name)
+		componentLines = append(componentLines, "- components/"+name+"/")
+	}
+	runCmd(naiveRoot, "git", addArgs...)
 
 	commitMsg := fmt.Sprintf(`Add Chromium cronet components (v%s)
 
 Downloaded from Chromium source:
-- components/cronet/
-- components/grpc_support/
-- components/prefs/
+%s
 
-Use 'go run ./cmd/build sync' to re-download.`, version)
+Use 'go run ./cmd/build sync' to re-download.`, *version, strings.Join(componentLines, "\n"))
 
 	runCmd(naiveRoot, "git", "commit", "-m", commitMsg)
 
+	applyPatches()
+
 	log("Sync complete!")
 }
 
 func downloadAndExtract(url, destDir string) error {
-	resp, err := http.Get(url)
+	path, err := downloadFile(url, "")
 	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return err
 	}
 
-	// Use tar command to extract (simpler than using archive/tar with gzip)
-	cmd := exec.Command("tar", "-xzf", "-", "-C", destDir)
-	cmd.Stdin = resp.Body
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("tar extraction failed: %w", err)
+	if err := extractArchive(path, destDir); err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildManifestName is the provenance file package writes to the project
+// root. The package embeds it and reports it from cronet.BuildInfo, whose
+// types mirror BuildManifest and BuildLibrary.
+const buildManifestName = "BUILD_MANIFEST.json"
+
+// BuildManifest records how the packaged libraries were built.
+type BuildManifest struct {
+	ChromiumVersion   string         `json:"chromium_version"`
+	NaiveProxyCommit  string         `json:"naiveproxy_commit"`
+	NaiveProxyVersion string         `json:"naiveproxy_version"`
+	Packaged          string         `json:"packaged"`
+	Libraries         []BuildLibrary `json:"libraries"`
+}
+
+// BuildLibrary is the packaged library of one target.
+type BuildLibrary struct {
+	Target string `json:"target"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Shared bool   `json:"shared,omitempty"`
+	GNArgs string `json:"gn_args"`
+	Clang  string `json:"clang"`
+	NDK    string `json:"ndk,omitempty"`
+}
+
+// writeBuildManifest records the packaged libraries of |targets| with the
+// gn args their output directories were generated with.
+func writeBuildManifest(targets []Target) {
+	manifest := BuildManifest{
+		ChromiumVersion:   readChromiumVersion(),
+		NaiveProxyCommit:  strings.TrimSpace(runCmdOutput(naiveRoot, "git", "rev-parse", "HEAD")),
+		NaiveProxyVersion: strings.TrimSpace(runCmdOutput(naiveRoot, "git", "describe", "--tags", "--always")),
+		Packaged:          time.Now().UTC().Format(time.RFC3339),
+		Libraries:         []BuildLibrary{},
+	}
+	clang := clangVersion()
+	for _, t := range targets {
+		files, shared := releaseLibraryFiles(t)
+		if len(files) == 0 {
+			continue
+		}
+		path := filepath.Join(projectRoot, filepath.FromSlash(files[0]))
+		sum, size := hashFile(path)
+		library := BuildLibrary{
+			Target: t.String(),
+			File:   files[0],
+			SHA256: sum,
+			Size:   size,
+			Shared: shared,
+			Clang:  clang,
+		}
+		gnArgs, err := os.ReadFile(filepath.Join(srcRoot, "out", "cronet-"+t.OS+"-"+t.CPU, gnArgsStamp))
+		if err == nil {
+			library.GNArgs = string(gnArgs)
+		}
+		if t.GOOS == "android" {
+			if ndk, found := findAndroidNDK(); found {
+				library.NDK = ndkRevision(ndk)
+			}
+		}
+		manifest.Libraries = append(manifest.Libraries, library)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fatal("failed to encode build manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectRoot, buildManifestName), append(data, '\n'), 0644); err != nil {
+		fatal("failed to write %s: %v", buildManifestName, err)
+	}
+	log("Generated %s", buildManifestName)
+}
+
+func hashFile(path string) (string, int64) {
+	file, err := os.Open(path)
+	if err != nil {
+		fatal("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		fatal("failed to read %s: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size
+}
+
+// clangVersion returns the first line of clang --version of the toolchain
+// get-clang.sh downloaded, or an empty string if there is none.
+func clangVersion() string {
+	clang := filepath.Join(srcRoot, "third_party", "llvm-build", "Release+Asserts", "bin", "clang")
+	output, err := exec.Command(clang, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
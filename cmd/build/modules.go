@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// libModuleFile is the Go file of a library module. Its package carries the
+// linker flags of the library, so importing it links the library.
+const libModuleFile = "cronet.go"
+
+// goModFile is the part of go mod edit -json this tool reads.
+type goModFile struct {
+	Module struct {
+		Path string
+	}
+	Require []struct {
+		Path    string
+		Version string
+	}
+	Replace []struct {
+		Old struct {
+			Path string
+		}
+		New struct {
+			Path string
+		}
+	}
+}
+
+// readGoMod parses the go.mod at |path|.
+func readGoMod(path string) goModFile {
+	var modFile goModFile
+	output := runCmdOutput(projectRoot, "go", "mod", "edit", "-json", path)
+	if err := json.Unmarshal([]byte(output), &modFile); err != nil {
+		fatal("failed to parse %s: %v", path, err)
+	}
+	return modFile
+}
+
+// libModulePrefix returns the prefix of the module paths of the libraries,
+// e.g. github.com/sagernet/cronet-go/lib/.
+func libModulePrefix() string {
+	return readGoMod(filepath.Join(projectRoot, "go.mod")).Module.Path + "/lib/"
+}
+
+// writeLibModule makes lib/<libDir> of |t| a module of its own, whose package
+// links the library with |ldflags|. The module is left out of the zip of the
+// root module, so users download only the libraries of the targets they build.
+func writeLibModule(t Target, comment string, ldflags []string) {
+	dir := filepath.Join(projectRoot, "lib", t.libDir())
+	prefix := libModulePrefix()
+	modulePath := prefix + t.libDir()
+
+	goMod := fmt.Sprintf("module %s\n\ngo 1.18\n", modulePath)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		fatal("failed to write lib/%s/go.mod: %v", t.libDir(), err)
+	}
+
+	content := fmt.Sprintf(`//go:build %s
+
+// Package %s links the cronet library of %s into
+// %s, which imports it on that target.
+package %s
+
+%s// #cgo LDFLAGS: %s
+import "C"
+`, t.buildConstraint(), t.libDir(), t, strings.TrimSuffix(prefix, "/lib/"), t.libDir(), comment, strings.Join(ldflags, " "))
+	if err := os.WriteFile(filepath.Join(dir, libModuleFile), []byte(content), 0644); err != nil {
+		fatal("failed to write lib/%s/%s: %v", t.libDir(), libModuleFile, err)
+	}
+}
+
+// libModuleFiles returns the module files of the library of |t| relative to
+// the project root, or nil if it was packaged without them.
+func libModuleFiles(t Target) []string {
+	libDir := "lib/" + t.libDir()
+	var files []string
+	for _, name := range []string{"go.mod", libModuleFile} {
+		if _, err := os.Stat(filepath.Join(projectRoot, filepath.FromSlash(libDir), name)); err == nil {
+			files = append(files, libDir+"/"+name)
+		}
+	}
+	return files
+}
+
+// updateLibRequirements makes the root go.mod require the library modules
+// found under lib/ and replace them with their directories, and drops those
+// of libraries no longer there. The go command fails on a replacement
+// directory without go.mod, so this runs whenever lib/ changes.
+//
+// Consumers ignore the replacements and download the version publish pins.
+func updateLibRequirements() {
+	prefix := libModulePrefix()
+	modFile := readGoMod(filepath.Join(projectRoot, "go.mod"))
+
+	var args []string
+	for _, replace := range modFile.Replace {
+		if strings.HasPrefix(replace.Old.Path, prefix) {
+			args = append(args, "-dropreplace="+replace.Old.Path)
+		}
+	}
+	for _, require := range modFile.Require {
+		if strings.HasPrefix(require.Path, prefix) {
+			args = append(args, "-droprequire="+require.Path)
+		}
+	}
+	goMods, _ := filepath.Glob(filepath.Join(projectRoot, "lib", "*", "go.mod"))
+	sort.Strings(goMods)
+	for _, goMod := range goMods {
+		name := filepath.Base(filepath.Dir(goMod))
+		modulePath := prefix + name
+		args = append(args,
+			"-require="+modulePath+"@v0.0.0",
+			"-replace="+modulePath+"=./lib/"+name,
+		)
+	}
+	if len(args) == 0 {
+		return
+	}
+	runCmd(projectRoot, "go", append([]string{"mod", "edit"}, args...)...)
+	log("Updated go.mod for %d library module(s)", len(goMods))
+}
+
+// pinLibModules replaces the placeholder versions of the library modules in
+// go.mod with pseudo-versions of |commit|, which holds the modules. A module
+// whose directory is unchanged since |previous|, the go branch commit the
+// publish builds on, keeps the version it had there, so users only download
+// the libraries that changed. It reports whether go.mod changed.
+func pinLibModules(commit string, previous string) bool {
+	prefix := libModulePrefix()
+	modFile := readGoMod(filepath.Join(projectRoot, "go.mod"))
+	previousVersions := make(map[string]string)
+	if previous != "" {
+		for path, version := range goModRequirementsAt(previous) {
+			if strings.HasPrefix(path, prefix) {
+				previousVersions[path] = version
+			}
+		}
+	}
+
+	commitVersion := pseudoVersion(commit)
+	var args []string
+	for _, require := range modFile.Require {
+		if !strings.HasPrefix(require.Path, prefix) {
+			continue
+		}
+		libDir := "lib/" + strings.TrimPrefix(require.Path, prefix)
+		version := commitVersion
+		if previousVersion := previousVersions[require.Path]; previousVersion != "" {
+			previousCommit := pseudoVersionCommit(previousVersion)
+			tree := gitTree(commit, libDir)
+			if previousCommit != "" && tree != "" && gitTree(previousCommit, libDir) == tree {
+				version = previousVersion
+			}
+		}
+		log("Pinned %s to %s", require.Path, version)
+		if version != require.Version {
+			args = append(args, "-require="+require.Path+"@"+version)
+		}
+	}
+	if len(args) == 0 {
+		return false
+	}
+	runCmd(projectRoot, "go", append([]string{"mod", "edit"}, args...)...)
+	return true
+}
+
+// goModRequirementsAt returns the module versions go.mod of |commit| requires.
+func goModRequirementsAt(commit string) map[string]string {
+	content, err := gitOutput("show", commit+":go.mod")
+	if err != nil {
+		return nil
+	}
+	file, err := os.CreateTemp("", "cronet-go-*.mod")
+	if err != nil {
+		fatal("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fatal("failed to write %s: %v", file.Name(), err)
+	}
+	requirements := make(map[string]string)
+	for _, require := range readGoMod(file.Name()).Require {
+		requirements[require.Path] = require.Version
+	}
+	return requirements
+}
+
+// pseudoVersion returns the version the go command resolves |commit| to in a
+// module without tags, e.g. v0.0.0-20240102150405-0123456789ab.
+func pseudoVersion(commit string) string {
+	output := strings.TrimSpace(runCmdOutput(projectRoot, "git", "show", "-s", "--format=%H %ct", commit))
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		fatal("unexpected output of git show for %s: %s", commit, output)
+	}
+	seconds, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		fatal("invalid commit time of %s: %v", commit, err)
+	}
+	return fmt.Sprintf("v0.0.0-%s-%s", time.Unix(seconds, 0).UTC().Format("20060102150405"), fields[0][:12])
+}
+
+// pseudoVersionCommit returns the abbreviated commit of |version|, or an
+// empty string if it is not a pseudo-version.
+func pseudoVersionCommit(version string) string {
+	index := strings.LastIndex(version, "-")
+	if index < 0 || len(version)-index-1 != 12 {
+		return ""
+	}
+	return version[index+1:]
+}
+
+// gitTree returns the tree object of |path| at |commit|, or an empty string if
+// it does not exist there.
+func gitTree(commit string, path string) string {
+	output, err := gitOutput("rev-parse", "--verify", "--quiet", commit+":"+path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(output)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// androidNDKMajorVersion is the NDK release Android targets build with,
+	// passed to gn as android_ndk_major_version.
+	androidNDKMajorVersion int
+	// androidMinSDK is the API level Android targets support down to, passed
+	// to gn as default_min_sdk_version.
+	androidMinSDK int
+)
+
+// androidNDKMinAPI is the lowest API level the supported NDKs target.
+const androidNDKMinAPI = 21
+
+// androidRepositoryURL serves the SDK repository manifest listing the NDK
+// archives with their checksums, and the archives themselves.
+const androidRepositoryURL = "https://dl.google.com/android/repository/"
+
+// downloadNDK downloads the NDK from Google if none is installed.
+var downloadNDK bool
+
+// checkAndroidVersions validates -android-ndk and -android-min-sdk against the
+// defaults of the synced Chromium, which are what it is tested with: an older
+// NDK lacks what the sources need, and a lower API level relies on
+// naiveproxy's patches rather than Chromium's support.
+func checkAndroidVersions() {
+	if androidMinSDK < androidNDKMinAPI {
+		fatal("-android-min-sdk %d is below API level %d, the lowest NDK %d supports", androidMinSDK, androidNDKMinAPI, androidNDKMajorVersion)
+	}
+	requiredNDK, chromiumMinSDK, found := chromiumAndroidDefaults()
+	if !found {
+		return
+	}
+	switch {
+	case androidNDKMajorVersion < requiredNDK:
+		fatal("Chromium %s requires NDK %d, -android-ndk is %d", readChromiumVersion(), requiredNDK, androidNDKMajorVersion)
+	case androidNDKMajorVersion > requiredNDK:
+		log("Warning: Chromium %s is tested with NDK %d, building with NDK %d", readChromiumVersion(), requiredNDK, androidNDKMajorVersion)
+	}
+	if androidMinSDK < chromiumMinSDK {
+		log("Warning: Chromium %s supports API level %d and up, building for %d", readChromiumVersion(), chromiumMinSDK, androidMinSDK)
+	}
+}
+
+// chromiumAndroidDefaults returns the defaults of android_ndk_major_version
+// and default_min_sdk_version the synced Chromium declares.
+func chromiumAndroidDefaults() (int, int, bool) {
+	configPath := filepath.Join(srcRoot, "build", "config", "android", "config.gni")
+	ndkVersion := gniIntDefault(configPath, "android_ndk_major_version")
+	minSDK := gniIntDefault(configPath, "default_min_sdk_version")
+	return ndkVersion, minSDK, ndkVersion > 0 && minSDK > 0
+}
+
+// gniIntDefault returns the first integer assigned to |name| in the .gni file
+// at |path|, or 0.
+func gniIntDefault(path string, name string) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found || strings.TrimSpace(key) != name {
+			continue
+		}
+		if number, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return number
+		}
+	}
+	return 0
+}
+
+// chromiumNDK returns the NDK get-clang.sh installs into the source tree,
+// which gn uses by default.
+func chromiumNDK() string {
+	return filepath.Join(srcRoot, "third_party", "android_toolchain", "ndk")
+}
+
+// androidNDKRoot returns the NDK Android targets build and link with, see
+// findAndroidNDK, downloading it with -download-ndk if none is installed.
+func androidNDKRoot() string {
+	if ndk, found := findAndroidNDK(); found {
+		return ndk
+	}
+	if downloadNDK {
+		return downloadAndroidNDK()
+	}
+	fatal("no NDK %d found, set ANDROID_NDK_HOME or ANDROID_HOME, or pass -download-ndk", androidNDKMajorVersion)
+	return ""
+}
+
+// findAndroidNDK returns ANDROID_NDK_HOME, or the first NDK of
+// androidNDKMajorVersion of Chromium's, the SDKs of ANDROID_HOME,
+// ANDROID_SDK_ROOT and the default SDK location of the host, and the one
+// -download-ndk downloaded.
+func findAndroidNDK() (string, bool) {
+	if ndk := os.Getenv("ANDROID_NDK_HOME"); ndk != "" {
+		if major := ndkMajorVersion(ndk); major != androidNDKMajorVersion {
+			fatal("ANDROID_NDK_HOME %s is NDK %d, Chromium requires NDK %d", ndk, major, androidNDKMajorVersion)
+		}
+		return ndk, true
+	}
+	candidates := []string{chromiumNDK()}
+	for _, sdk := range androidSDKRoots() {
+		matches, _ := filepath.Glob(filepath.Join(sdk, "ndk", fmt.Sprintf("%d.*", androidNDKMajorVersion)))
+		// Newest first
+		sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+		candidates = append(candidates, matches...)
+	}
+	downloaded, _ := filepath.Glob(filepath.Join(downloadCacheDir, "ndk", fmt.Sprintf("android-ndk-r%d*", androidNDKMajorVersion)))
+	candidates = append(candidates, downloaded...)
+	for _, ndk := range candidates {
+		if ndkMajorVersion(ndk) == androidNDKMajorVersion {
+			return ndk, true
+		}
+	}
+	return "", false
+}
+
+// androidSDKRoots returns the Android SDKs to look for side-by-side NDKs in.
+func androidSDKRoots() []string {
+	var roots []string
+	for _, env := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		if root := os.Getenv(env); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return roots
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		roots = append(roots, filepath.Join(home, "Library", "Android", "sdk"))
+	case "windows":
+		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+			roots = append(roots, filepath.Join(localAppData, "Android", "Sdk"))
+		}
+	default:
+		roots = append(roots, filepath.Join(home, "Android", "Sdk"))
+	}
+	return roots
+}
+
+// ndkRevision returns Pkg.Revision of |ndk|, e.g. 28.0.13004108, or an empty
+// string if it is not an NDK.
+func ndkRevision(ndk string) string {
+	file, err := os.Open(filepath.Join(ndk, "source.properties"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if found && strings.TrimSpace(key) == "Pkg.Revision" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+func ndkMajorVersion(ndk string) int {
+	major, _, _ := strings.Cut(ndkRevision(ndk), ".")
+	version, _ := strconv.Atoi(major)
+	return version
+}
+
+// androidRepository is the part of the SDK repository manifest listing the
+// archives of each package.
+type androidRepository struct {
+	Packages []struct {
+		Path    string `xml:"path,attr"`
+		Channel struct {
+			Ref string `xml:"ref,attr"`
+		} `xml:"channelRef"`
+		Revision struct {
+			Major int `xml:"major"`
+			Minor int `xml:"minor"`
+			Micro int `xml:"micro"`
+		} `xml:"revision"`
+		Archives []struct {
+			Size     int64  `xml:"complete>size"`
+			Checksum string `xml:"complete>checksum"`
+			URL      string `xml:"complete>url"`
+			HostOS   string `xml:"host-os"`
+		} `xml:"archives>archive"`
+	} `xml:"remotePackage"`
+}
+
+// downloadAndroidNDK downloads the newest stable NDK of androidNDKMajorVersion
+// for the host from the SDK repository, checks it against the size and SHA-1
+// the repository lists and extracts it into the download cache.
+func downloadAndroidNDK() string {
+	hostOS := map[string]string{"linux": "linux", "darwin": "macosx", "windows": "windows"}[runtime.GOOS]
+	if hostOS == "" || runtime.GOOS == "linux" && runtime.GOARCH != "amd64" {
+		fatal("the NDK is not available for %s/%s hosts", runtime.GOOS, runtime.GOARCH)
+	}
+	manifestData, err := downloadBytes(androidRepositoryURL + "repository2-3.xml")
+	if err != nil {
+		fatal("failed to download the Android SDK repository: %v", err)
+	}
+	var repository androidRepository
+	if err := xml.Unmarshal(manifestData, &repository); err != nil {
+		fatal("invalid Android SDK repository: %v", err)
+	}
+
+	var (
+		url, checksum, revision string
+		size                    int64
+		newest                  [3]int
+	)
+	for _, pkg := range repository.Packages {
+		if !strings.HasPrefix(pkg.Path, "ndk;") || pkg.Channel.Ref != "channel-0" || pkg.Revision.Major != androidNDKMajorVersion {
+			continue
+		}
+		version := [3]int{pkg.Revision.Major, pkg.Revision.Minor, pkg.Revision.Micro}
+		if url != "" && !versionLess(newest, version) {
+			continue
+		}
+		for _, archive := range pkg.Archives {
+			if archive.HostOS == hostOS {
+				url, checksum, size = androidRepositoryURL+archive.URL, archive.Checksum, archive.Size
+				revision, newest = strings.TrimPrefix(pkg.Path, "ndk;"), version
+			}
+		}
+	}
+	if url == "" {
+		fatal("the Android SDK repository has no NDK %d for %s", androidNDKMajorVersion, hostOS)
+	}
+
+	log("Downloading NDK %s...", revision)
+	path, err := downloadFile(url, "")
+	if err != nil {
+		fatal("failed to download NDK %s: %v", revision, err)
+	}
+	if err := checkSHA1(path, checksum, size); err != nil {
+		os.Remove(path)
+		fatal("NDK %s: %v", revision, err)
+	}
+
+	// Extracted next to the final location and moved, so an interrupted
+	// extraction is never taken for an NDK
+	ndkDir := filepath.Join(downloadCacheDir, "ndk")
+	if err := os.MkdirAll(ndkDir, 0755); err != nil {
+		fatal("failed to create %s: %v", ndkDir, err)
+	}
+	tempDir, err := os.MkdirTemp(ndkDir, ".extract-*")
+	if err != nil {
+		fatal("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err := extractZipArchive(path, tempDir); err != nil {
+		fatal("failed to extract NDK %s: %v", revision, err)
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		fatal("unexpected layout of NDK %s", revision)
+	}
+	ndk := filepath.Join(ndkDir, entries[0].Name())
+	os.RemoveAll(ndk)
+	if err := os.Rename(filepath.Join(tempDir, entries[0].Name()), ndk); err != nil {
+		fatal("failed to install NDK %s: %v", revision, err)
+	}
+	log("Installed NDK %s to %s", revision, ndk)
+	return ndk
+}
+
+func versionLess(a [3]int, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func checkSHA1(path string, expected string, expectedSize int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha1.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	if size != expectedSize {
+		return fmt.Errorf("%d bytes, the repository lists %d", size, expectedSize)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != strings.ToLower(expected) {
+		return fmt.Errorf("SHA-1 %s, the repository lists %s", sum, expected)
+	}
+	return nil
+}
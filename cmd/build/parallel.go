@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// buildJobs is the number of targets built concurrently.
+	buildJobs int
+	// ninjaLoad keeps ninja from starting jobs above this load average, so
+	// concurrent target builds share the CPUs.
+	ninjaLoad int
+	// skipGetClang skips get-clang.sh in build, for builds started by
+	// buildParallel after it prepared the toolchains.
+	skipGetClang bool
+)
+
+// buildFailureLines is the number of output lines of a failed target repeated
+// in the failure report.
+const buildFailureLines = 20
+
+// targetBuildResult is the outcome of the build of one target.
+type targetBuildResult struct {
+	target   Target
+	err      error
+	duration time.Duration
+	tail     []string
+}
+
+// buildParallel builds |targets| with up to buildJobs builds at once, each in
+// a child process of this tool whose output lines are prefixed with the
+// target. get-clang.sh shares the toolchain and sysroot directories between
+// targets, so it runs for all targets before the builds start.
+func buildParallel(targets []Target) {
+	if dockerBuild {
+		fatal("-j is not supported with -docker, the containers would prepare the toolchain concurrently")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		fatal("failed to locate the build command: %v", err)
+	}
+	for _, t := range targets {
+		if !skipGetClang {
+			log("Preparing toolchain for %s...", t)
+			runGetClang(t)
+		}
+	}
+
+	if ninjaLoad == 0 {
+		ninjaLoad = runtime.NumCPU()
+	}
+	log("Building %d target(s) with %d jobs", len(targets), buildJobs)
+	var (
+		outputAccess sync.Mutex
+		wg           sync.WaitGroup
+	)
+	results := make([]*targetBuildResult, len(targets))
+	slots := make(chan struct{}, buildJobs)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			output := &prefixWriter{access: &outputAccess, output: os.Stdout, prefix: "[" + t.String() + "] "}
+			cmd := exec.Command(executable, childBuildArgs(t)...)
+			cmd.Dir = projectRoot
+			cmd.Stdout = output
+			cmd.Stderr = output
+			started := time.Now()
+			err := cmd.Run()
+			output.Flush()
+			results[i] = &targetBuildResult{target: t, err: err, duration: time.Since(started), tail: output.tail}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var failed []*targetBuildResult
+	for _, result := range results {
+		if result.err != nil {
+			failed = append(failed, result)
+		}
+	}
+	for _, result := range failed {
+		fmt.Fprintf(os.Stderr, "\n[build] %s failed: %v, last output:\n", result.target, result.err)
+		for _, line := range result.tail {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
+	}
+	printBuildSummary(results)
+	if len(failed) > 0 {
+		fatal("%d of %d target(s) failed", len(failed), len(targets))
+	}
+}
+
+// childBuildArgs returns the arguments building only |t|, passing on the
+// global flags set for this process.
+func childBuildArgs(t Target) []string {
+	args := []string{"-targets", t.String(), "-skip-get-clang", "-load", strconv.Itoa(ninjaLoad)}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "targets", "j", "skip-get-clang", "load":
+		default:
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return append(args, "build")
+}
+
+func printBuildSummary(results []*targetBuildResult) {
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tRESULT\tDURATION")
+	for _, result := range results {
+		status := "ok"
+		if result.err != nil {
+			status = "failed"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.target, status, result.duration.Round(time.Second))
+	}
+	writer.Flush()
+}
+
+// prefixWriter writes whole lines prefixed with |prefix| to |output|,
+// serialized by |access| with the other writers, and keeps the last lines.
+type prefixWriter struct {
+	access *sync.Mutex
+	output io.Writer
+	prefix string
+	buffer []byte
+	tail   []string
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		index := bytes.IndexByte(w.buffer, '\n')
+		if index < 0 {
+			break
+		}
+		w.writeLine(string(w.buffer[:index]))
+		w.buffer = w.buffer[index+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes an unterminated last line.
+func (w *prefixWriter) Flush() {
+	if len(w.buffer) > 0 {
+		w.writeLine(string(w.buffer))
+		w.buffer = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	w.access.Lock()
+	io.WriteString(w.output, w.prefix+line+"\n")
+	w.access.Unlock()
+	w.tail = append(w.tail, line)
+	if len(w.tail) > buildFailureLines {
+		w.tail = w.tail[len(w.tail)-buildFailureLines:]
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// patchesDir holds the local modifications of the naiveproxy tree as
+// git format-patch files, applied in the order of patchSeriesName on top of
+// the commit sync creates.
+const (
+	patchesDir      = "patches"
+	patchSeriesName = "series"
+)
+
+// syncCommitSubject starts the subject of the commits sync creates in
+// naiveproxy. Patches are the commits after the last of them.
+const syncCommitSubject = "Add Chromium cronet components"
+
+func cmdPatch(args []string) {
+	if len(args) == 0 {
+		fatal("patch: expected apply or update")
+	}
+	switch args[0] {
+	case "apply":
+		flags := flag.NewFlagSet("patch apply", flag.ExitOnError)
+		flags.Parse(args[1:])
+		applyPatches()
+	case "update":
+		flags := flag.NewFlagSet("patch update", flag.ExitOnError)
+		newPatch := flags.String("new", "", "Record the uncommitted changes as a new patch with this subject instead of refreshing the top patch")
+		flags.Parse(args[1:])
+		updatePatches(*newPatch)
+	default:
+		fatal("patch: unknown subcommand %s, expected apply or update", args[0])
+	}
+}
+
+// applyPatches applies the patches of the series not applied yet as commits
+// on top of the sync commit. git am falls back to a 3-way merge with the
+// blobs a patch was made against, which the earlier sync commits hold, so
+// patches survive Chromium version bumps unless they really conflict.
+func applyPatches() {
+	series := readPatchSeries()
+	if len(series) == 0 {
+		return
+	}
+	base := syncBaseCommit()
+	if strings.TrimSpace(runCmdOutput(naiveRoot, "git", "status", "--porcelain")) != "" {
+		fatal("naiveproxy has uncommitted changes, record them with patch update first")
+	}
+
+	applied := appliedPatchSubjects(base)
+	if len(applied) > len(series) {
+		fatal("naiveproxy has %d commit(s) after the sync commit but the series has %d patch(es), export them with patch update", len(applied), len(series))
+	}
+	for i, subject := range applied {
+		if expected := patchSubject(series[i]); subject != expected {
+			fatal("commit %d after the sync commit is %q but patch %s is %q, export the commits with patch update or reset naiveproxy to %s",
+				i+1, subject, series[i], expected, base[:8])
+		}
+	}
+	if len(applied) == len(series) {
+		log("All %d patch(es) already applied", len(series))
+		return
+	}
+
+	for _, name := range series[len(applied):] {
+		log("Applying %s", name)
+		cmd := exec.Command("git", "am", "--3way", "--keep-cr", filepath.Join(projectRoot, patchesDir, name))
+		cmd.Dir = naiveRoot
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fatal("%s does not apply: resolve the conflicts in naiveproxy, run git am --continue, then patch apply to continue and patch update to save the resolution", name)
+		}
+	}
+	log("Applied %d patch(es)", len(series)-len(applied))
+}
+
+// updatePatches records the uncommitted changes of naiveproxy, as a new patch
+// named |newPatch| or into the top patch, and exports the commits after the
+// sync commit to patches/, replacing the series.
+func updatePatches(newPatch string) {
+	base := syncBaseCommit()
+
+	if strings.TrimSpace(runCmdOutput(naiveRoot, "git", "status", "--porcelain")) != "" {
+		// New files outside the components would mostly be build outputs
+		runCmd(naiveRoot, "git", "add", "-u")
+		runCmd(naiveRoot, "git", "add", "-A", "--", "src/components")
+		head := strings.TrimSpace(runCmdOutput(naiveRoot, "git", "rev-parse", "HEAD"))
+		switch {
+		case newPatch != "":
+			runCmd(naiveRoot, "git", "commit", "-q", "-m", newPatch)
+			log("Recorded the changes as patch %q", newPatch)
+		case head == base:
+			fatal("no patch to refresh, name a new one with -new")
+		default:
+			runCmd(naiveRoot, "git", "commit", "-q", "--amend", "--no-edit")
+			log("Refreshed the top patch")
+		}
+	} else if newPatch != "" {
+		fatal("no uncommitted changes for patch %q", newPatch)
+	}
+
+	dir := filepath.Join(projectRoot, patchesDir)
+	oldPatches, _ := filepath.Glob(filepath.Join(dir, "*.patch"))
+	for _, path := range oldPatches {
+		os.Remove(path)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fatal("failed to create %s: %v", dir, err)
+	}
+
+	// Stable output: no commit hashes, numbering or git version, which would
+	// change every patch on each export
+	output := runCmdOutput(naiveRoot, "git", "format-patch", "--zero-commit", "--no-numbered",
+		"--no-signature", "--no-stat", "-o", dir, base+"..HEAD")
+	var series []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line != "" {
+			series = append(series, filepath.Base(line))
+		}
+	}
+	content := ""
+	if len(series) > 0 {
+		content = strings.Join(series, "\n") + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(dir, patchSeriesName), []byte(content), 0644); err != nil {
+		fatal("failed to write %s/%s: %v", patchesDir, patchSeriesName, err)
+	}
+	log("Exported %d patch(es) to %s/", len(series), patchesDir)
+}
+
+// syncBaseCommit returns the last commit sync created in naiveproxy.
+func syncBaseCommit() string {
+	base := strings.TrimSpace(runCmdOutput(naiveRoot, "git", "log", "-1", "--format=%H",
+		"--fixed-strings", "--grep="+syncCommitSubject))
+	if base == "" {
+		fatal("no sync commit found in naiveproxy, run sync first")
+	}
+	return base
+}
+
+// appliedPatchSubjects returns the subjects of the commits after |base|,
+// oldest first.
+func appliedPatchSubjects(base string) []string {
+	output := strings.TrimSpace(runCmdOutput(naiveRoot, "git", "log", "--reverse", "--format=%s", base+"..HEAD"))
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// readPatchSeries returns the patch files of the series, skipping blank and
+// comment lines as quilt does.
+func readPatchSeries() []string {
+	content, err := os.ReadFile(filepath.Join(projectRoot, patchesDir, patchSeriesName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		fatal("failed to read %s/%s: %v", patchesDir, patchSeriesName, err)
+	}
+	var series []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		series = append(series, line)
+	}
+	return series
+}
+
+// patchSubject returns the commit subject git am creates from the patch
+// |name|, unfolding and decoding the Subject header and dropping its [PATCH]
+// prefix.
+func patchSubject(name string) string {
+	path := filepath.Join(projectRoot, patchesDir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		fatal("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var subject string
+	inSubject := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inSubject {
+			if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				break
+			}
+			subject += " " + strings.TrimSpace(line)
+			continue
+		}
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Subject: ") {
+			subject = strings.TrimPrefix(line, "Subject: ")
+			inSubject = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fatal("failed to read %s: %v", path, err)
+	}
+	// format-patch encodes subjects that are not ASCII
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	subject = strings.TrimSpace(subject)
+	if strings.HasPrefix(subject, "[PATCH]") {
+		subject = strings.TrimSpace(strings.TrimPrefix(subject, "[PATCH]"))
+	}
+	if subject == "" {
+		fatal("%s has no subject", path)
+	}
+	return subject
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Pipeline stages in execution order. Each completed stage is recorded in the
+// state file, so a rerun resumes after the last completed one.
+const (
+	stageSync    = "sync"
+	stageBuild   = "build"
+	stagePackage = "package"
+	stageVerify  = "verify"
+	stagePublish = "publish"
+)
+
+var pipelineStages = []string{stageSync, stageBuild, stagePackage, stageVerify, stagePublish}
+
+// PipelineState is the checkpoint file of release-pipeline. It lives in the git
+// directory so it never makes the working tree dirty for publish.
+type PipelineState struct {
+	ChromiumVersion string            `json:"chromium_version"`
+	Targets         []string          `json:"targets"`
+	Shared          bool              `json:"shared,omitempty"`
+	Started         string            `json:"started"`
+	Completed       map[string]string `json:"completed"`
+	// BuiltTargets checkpoints the build stage per target, as a full build
+	// takes hours.
+	BuiltTargets map[string]string `json:"built_targets"`
+}
+
+func cmdReleasePipeline(targets []Target, args []string) {
+	flags := flag.NewFlagSet("release-pipeline", flag.ExitOnError)
+	restart := flags.Bool("restart", false, "Discard checkpoints and run all stages")
+	status := flags.Bool("status", false, "Print the checkpoint state and exit")
+	flags.Parse(args)
+
+	statePath := pipelineStatePath()
+	if *status {
+		printPipelineState(statePath)
+		return
+	}
+	if *restart {
+		os.Remove(statePath)
+	}
+
+	var targetNames []string
+	for _, t := range targets {
+		targetNames = append(targetNames, t.String())
+	}
+	state := loadPipelineState(statePath)
+	if state != nil && strings.Join(state.Targets, ",") != strings.Join(targetNames, ",") {
+		fatal("checkpoint is for targets %s, rerun with the same -targets or with -restart", strings.Join(state.Targets, ","))
+	}
+	if state != nil && state.Shared != sharedLibrary {
+		fatal("checkpoint is for shared=%v, rerun with the same -shared or with -restart", state.Shared)
+	}
+	if state != nil && state.ChromiumVersion != "" && state.ChromiumVersion != readChromiumVersion() {
+		fatal("checkpoint is for Chromium %s but the tree has %s, rerun with -restart", state.ChromiumVersion, readChromiumVersion())
+	}
+	if state == nil {
+		state = &PipelineState{
+			Targets:      targetNames,
+			Shared:       sharedLibrary,
+			Started:      time.Now().UTC().Format(time.RFC3339),
+			Completed:    make(map[string]string),
+			BuiltTargets: make(map[string]string),
+		}
+		savePipelineState(statePath, state)
+	} else {
+		log("Resuming pipeline started at %s", state.Started)
+	}
+
+	for _, stage := range pipelineStages {
+		// Verify always runs, so publish never ships libraries changed after the
+		// last check.
+		if state.Completed[stage] != "" && stage != stageVerify {
+			log("Stage %s already completed at %s, skipping", stage, state.Completed[stage])
+			continue
+		}
+		log("=== Stage %s ===", stage)
+		switch stage {
+		case stageSync:
+			cmdSync(nil)
+		case stageBuild:
+			for _, t := range targets {
+				name := t.String()
+				if state.BuiltTargets[name] != "" {
+					log("%s already built, skipping", name)
+					continue
+				}
+				log("Building %s...", name)
+				runTargetBuild(t)
+				state.BuiltTargets[name] = time.Now().UTC().Format(time.RFC3339)
+				savePipelineState(statePath, state)
+			}
+		case stagePackage:
+			cmdPackage(targets, nil)
+		case stageVerify:
+			problems := verifyPackage(targets)
+			if len(problems) > 0 {
+				for _, problem := range problems {
+					log("verify: %s", problem)
+				}
+				// Packaging has to run again before verify can pass
+				delete(state.Completed, stagePackage)
+				delete(state.Completed, stageVerify)
+				savePipelineState(statePath, state)
+				fatal("verification failed with %d problem(s)", len(problems))
+			}
+		case stagePublish:
+			output := runCmdOutput(projectRoot, "git", "status", "--porcelain")
+			if strings.TrimSpace(output) != "" {
+				fatal("packaged files are not committed: commit and push them to main, then rerun release-pipeline to publish")
+			}
+			cmdPublish(nil)
+		}
+		if stage == stageSync {
+			state.ChromiumVersion = readChromiumVersion()
+		}
+		state.Completed[stage] = time.Now().UTC().Format(time.RFC3339)
+		savePipelineState(statePath, state)
+	}
+
+	os.Remove(statePath)
+	log("Pipeline complete!")
+}
+
+// verifyPackage checks that headers, libraries and CGO configs of all targets
+// are in place, and returns the problems found.
+func verifyPackage(targets []Target) []string {
+	var problems []string
+	for _, header := range []string{"cronet_c.h", "cronet_export.h", "cronet.idl_c.h", "bidirectional_stream_c.h"} {
+		if _, err := os.Stat(filepath.Join(projectRoot, "include", header)); err != nil {
+			problems = append(problems, fmt.Sprintf("missing header include/%s", header))
+		}
+	}
+	for _, t := range targets {
+		libDir := filepath.Join(projectRoot, "lib", t.libDir())
+		if sharedLibrary {
+			if _, found := findSharedLibrary(libDir, t); !found {
+				problems = append(problems, fmt.Sprintf("missing shared library for %s", t))
+			}
+		} else if file, err := os.Open(filepath.Join(libDir, "libcronet.a")); err != nil {
+			problems = append(problems, fmt.Sprintf("missing library for %s", t))
+		} else {
+			magic := make([]byte, 8)
+			_, err = file.Read(magic)
+			file.Close()
+			if err != nil || !bytes.Equal(magic, []byte("!<arch>\n")) {
+				problems = append(problems, fmt.Sprintf("library for %s is not a static archive", t))
+			}
+		}
+		if _, err := os.Stat(filepath.Join(libDir, "go.mod")); err != nil {
+			problems = append(problems, fmt.Sprintf("missing module lib/%s/go.mod", t.libDir()))
+		}
+		configName := t.configName()
+		if _, err := os.Stat(filepath.Join(projectRoot, configName)); err != nil {
+			problems = append(problems, fmt.Sprintf("missing CGO config %s", configName))
+		}
+	}
+	return problems
+}
+
+func readChromiumVersion() string {
+	versionData, err := os.ReadFile(filepath.Join(naiveRoot, "CHROMIUM_VERSION"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(versionData))
+}
+
+func pipelineStatePath() string {
+	gitDir := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "--absolute-git-dir"))
+	return filepath.Join(gitDir, "cronet-build", "release-pipeline.json")
+}
+
+func loadPipelineState(path string) *PipelineState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		fatal("failed to read %s: %v", path, err)
+	}
+	var state PipelineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		fatal("corrupt checkpoint %s, rerun with -restart: %v", path, err)
+	}
+	if state.Completed == nil {
+		state.Completed = make(map[string]string)
+	}
+	if state.BuiltTargets == nil {
+		state.BuiltTargets = make(map[string]string)
+	}
+	return &state
+}
+
+// savePipelineState writes the state through a temporary file, so an
+// interrupted write never leaves a truncated checkpoint behind.
+func savePipelineState(path string, state *PipelineState) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		fatal("failed to encode pipeline state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fatal("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		fatal("failed to write %s: %v", tempPath, err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+}
+
+func printPipelineState(path string) {
+	state := loadPipelineState(path)
+	if state == nil {
+		log("No pipeline in progress")
+		return
+	}
+	log("Pipeline started at %s for %s", state.Started, strings.Join(state.Targets, ","))
+	if state.ChromiumVersion != "" {
+		log("Chromium version: %s", state.ChromiumVersion)
+	}
+	for _, stage := range pipelineStages {
+		completed := state.Completed[stage]
+		if completed == "" {
+			completed = "pending"
+		}
+		log("  %-8s %s", stage, completed)
+		if stage == stageBuild && state.Completed[stage] == "" {
+			for _, name := range state.Targets {
+				if built := state.BuiltTargets[name]; built != "" {
+					log("    %s built at %s", name, built)
+				}
+			}
+		}
+	}
+}
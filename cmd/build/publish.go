@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// publishManifestName is the file recorded in every go branch commit
+	// created by publish. Commits without it were not produced by this tool.
+	publishManifestName = "publish.json"
+
+	// publishBackupPrefix holds the go branch tips saved before each push,
+	// locally and on origin.
+	publishBackupPrefix = "refs/backup/go/"
+)
+
+// PublishManifest records which main commit a go branch commit was built from.
+type PublishManifest struct {
+	Source string `json:"source"`
+	Time   string `json:"time"`
+}
+
+func cmdPublish(args []string) {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	rollback := flags.Bool("rollback", false, "Restore the go branch to its state before the last publish, from the backups kept on origin")
+	dryRun := flags.Bool("dry-run", false, "Create the go branch commits locally and print them, the tag and the changelog without pushing")
+	tag := flags.Bool("tag", true, "Tag the published commit with the next semver version")
+	version := flags.String("version", "", "Version to tag instead of the next one, e.g. v0.3.0")
+	flags.Parse(args)
+	if *version != "" {
+		if _, ok := parseSemver(*version); !ok {
+			fatal("invalid version %s, expected vMAJOR.MINOR.PATCH", *version)
+		}
+		if gitSucceeds("rev-parse", "--verify", "--quiet", "refs/tags/"+*version) {
+			fatal("tag %s already exists", *version)
+		}
+	}
+
+	if *rollback {
+		publishRollback()
+		return
+	}
+
+	if *dryRun {
+		log("Publishing to go branch (dry run)...")
+	} else {
+		log("Publishing to go branch...")
+	}
+
+	// Check for uncommitted changes
+	output := runCmdOutput(projectRoot, "git", "status", "--porcelain")
+	if strings.TrimSpace(output) != "" {
+		fatal("uncommitted changes in working directory")
+	}
+
+	// Get current branch
+	currentBranch := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "--abbrev-ref", "HEAD"))
+	if currentBranch != "main" {
+		fatal("must be on main branch to publish (current: %s)", currentBranch)
+	}
+
+	// Get current commit
+	mainCommit := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "HEAD"))
+
+	// Refuse to publish commits that are not on the protected remote branch
+	runCmd(projectRoot, "git", "fetch", "--tags", "origin")
+	if !gitSucceeds("merge-base", "--is-ancestor", mainCommit, "origin/main") {
+		fatal("main commit %s is not on origin/main, push it before publishing", mainCommit[:8])
+	}
+	if gitSucceeds("rev-parse", "--verify", "--quiet", "refs/tags/go") {
+		fatal("a tag named go exists and makes the go branch ambiguous, delete it first")
+	}
+
+	remoteCommit := remoteGoCommit()
+
+	// Check if go branch exists
+	goBranchExists := gitSucceeds("rev-parse", "--verify", "--quiet", "refs/heads/go")
+	var localCommit string
+	if goBranchExists {
+		localCommit = strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "refs/heads/go"))
+	}
+
+	// Describe the changes since the previous publish
+	var previousManifest *BuildManifest
+	var changelog string
+	if remoteCommit != "" {
+		previousManifest = readBuildManifestAt(remoteCommit)
+		changelog, _ = gitOutput("show", remoteCommit+":"+changelogName)
+	}
+	currentManifest := readBuildManifestAt(mainCommit)
+	if *version == "" {
+		*version = nextPublishVersion(previousPublishTag(remoteCommit), previousManifest, currentManifest)
+	}
+	section := changelogSection(*version, mainCommit, previousManifest, currentManifest)
+
+	if remoteCommit != "" {
+		// Start from the remote history instead of an orphan branch
+		if !goBranchExists {
+			runCmd(projectRoot, "git", "branch", "go", remoteCommit)
+			goBranchExists = true
+		}
+		checkDiscardedCommits(remoteCommit)
+	}
+
+	// Create or checkout go branch
+	if goBranchExists {
+		runCmd(projectRoot, "git", "checkout", "go")
+	} else {
+		runCmd(projectRoot, "git", "checkout", "--orphan", "go")
+		runCmd(projectRoot, "git", "reset", "--hard")
+	}
+
+	// Copy files from main branch
+	filesToCopy := []string{
+		"*.go",
+		"go.mod",
+		"go.sum",
+		"BUILD_MANIFEST.json",
+		"include/",
+		"lib/",
+		"naive/",
+		"LICENSE",
+		"README.md",
+	}
+
+	// Clean current state
+	runCmd(projectRoot, "git", "rm", "-rf", "--ignore-unmatch", ".")
+
+	// Checkout files from main
+	for _, pattern := range filesToCopy {
+		exec.Command("git", "-C", projectRoot, "checkout", mainCommit, "--", pattern).Run()
+	}
+
+	if err := os.WriteFile(filepath.Join(projectRoot, changelogName), []byte(prependChangelog(changelog, section)), 0644); err != nil {
+		fatal("failed to write %s: %v", changelogName, err)
+	}
+
+	// Record the source of this commit so later publishes can verify it
+	writePublishManifest(PublishManifest{
+		Source: mainCommit,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	})
+
+	// Stage and commit
+	runCmd(projectRoot, "git", "add", "-A")
+
+	commitMsg := fmt.Sprintf("Build from %s", mainCommit[:8])
+	runCmd(projectRoot, "git", "commit", "-m", commitMsg, "--allow-empty")
+
+	// The library modules are required by pseudo-versions of the commit that
+	// holds them, so the requirements go into a second commit
+	libCommit := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "HEAD"))
+	if pinLibModules(libCommit, remoteCommit) {
+		runCmd(projectRoot, "git", "add", "go.mod")
+		runCmd(projectRoot, "git", "commit", "-m", "Pin library modules")
+	}
+
+	if *dryRun {
+		publishDryRunReport(remoteCommit, *tag, *version, section)
+		// Drop the commits again, leaving the go branch as it was
+		runCmd(projectRoot, "git", "checkout", "main")
+		if localCommit != "" {
+			runCmd(projectRoot, "git", "branch", "-f", "go", localCommit)
+		} else {
+			runCmd(projectRoot, "git", "branch", "-D", "go")
+		}
+		log("Dry run complete, nothing was pushed")
+		return
+	}
+
+	pushRefs := []string{"go"}
+	if *tag {
+		runCmd(projectRoot, "git", "tag", "-a", "--cleanup=verbatim", *version, "-m", section)
+		pushRefs = append(pushRefs, "refs/tags/"+*version)
+	}
+
+	// Save the remote state so it can be restored with -rollback, also from
+	// another clone
+	if remoteCommit != "" {
+		backupRef := fmt.Sprintf("%s%d", publishBackupPrefix, time.Now().Unix())
+		runCmd(projectRoot, "git", "update-ref", backupRef, remoteCommit)
+		pushRefs = append(pushRefs, backupRef)
+		log("Saved previous go branch %s as %s", remoteCommit[:8], backupRef)
+	}
+
+	// Force push, failing if the remote changed since it was checked. The tag
+	// and the backup are pushed atomically with the branch, so the tag never
+	// points to a commit the branch does not have.
+	pushArgs := append([]string{"push", "--atomic", "--force-with-lease=go:" + remoteCommit, "origin"}, pushRefs...)
+	runCmd(projectRoot, "git", pushArgs...)
+
+	// Switch back to main
+	runCmd(projectRoot, "git", "checkout", "main")
+
+	if *tag {
+		log("Published to go branch as %s!", *version)
+	} else {
+		log("Published to go branch!")
+	}
+}
+
+// publishDryRunReport prints what a publish would push: the new go branch
+// commits, the files they change since |remoteCommit| and the tag with its
+// changelog section.
+func publishDryRunReport(remoteCommit string, tag bool, version string, section string) {
+	if remoteCommit != "" {
+		log("Commits to push:")
+		runCmd(projectRoot, "git", "log", "--oneline", remoteCommit+"..HEAD")
+		log("Changes since origin/go:")
+		runCmd(projectRoot, "git", "diff", "--stat", remoteCommit, "HEAD")
+	} else {
+		log("Commits to push (new go branch):")
+		runCmd(projectRoot, "git", "log", "--oneline", "HEAD")
+	}
+	if tag {
+		log("Tag: %s", version)
+	} else {
+		log("Tag: none (-tag=false)")
+	}
+	log("Changelog:\n%s", section)
+}
+
+// publishRollback force-pushes the most recent backup ref to the go branch and
+// drops it, so repeated rollbacks walk further back. The backups of origin are
+// fetched first, so any clone can roll back a publish.
+func publishRollback() {
+	runCmd(projectRoot, "git", "fetch", "origin", "+"+publishBackupPrefix+"*:"+publishBackupPrefix+"*")
+	refs := strings.Fields(runCmdOutput(projectRoot, "git", "for-each-ref",
+		"--sort=-refname", "--format=%(refname)", publishBackupPrefix))
+	if len(refs) == 0 {
+		fatal("no go branch backup found")
+	}
+	backupRef := refs[0]
+	backupCommit := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", backupRef))
+
+	currentBranch := strings.TrimSpace(runCmdOutput(projectRoot, "git", "rev-parse", "--abbrev-ref", "HEAD"))
+	if currentBranch == "go" {
+		fatal("cannot roll back while the go branch is checked out")
+	}
+
+	runCmd(projectRoot, "git", "fetch", "origin")
+	remoteCommit := remoteGoCommit()
+
+	log("Rolling back go branch to %s (%s)", backupCommit[:8], backupRef)
+	runCmd(projectRoot, "git", "push", "--atomic", "--force-with-lease=go:"+remoteCommit, "origin", backupCommit+":refs/heads/go", ":"+backupRef)
+	runCmd(projectRoot, "git", "branch", "-f", "go", backupCommit)
+	runCmd(projectRoot, "git", "update-ref", "-d", backupRef)
+
+	log("Rollback complete!")
+}
+
+// remoteGoCommit returns the commit of origin/go, or an empty string if the
+// remote branch does not exist.
+func remoteGoCommit() string {
+	output, err := exec.Command("git", "-C", projectRoot, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/go").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// checkDiscardedCommits refuses to continue if the force push would drop
+// remote go branch commits that were not created by publish or are tagged.
+func checkDiscardedCommits(remoteCommit string) {
+	commits := strings.Fields(runCmdOutput(projectRoot, "git", "rev-list", "go.."+remoteCommit))
+	for _, commit := range commits {
+		manifest, err := readPublishManifest(commit)
+		if err != nil {
+			fatal("remote go branch commit %s has no valid %s (%v), refusing to overwrite it", commit[:8], publishManifestName, err)
+		}
+		if !gitSucceeds("merge-base", "--is-ancestor", manifest.Source, "origin/main") {
+			fatal("remote go branch commit %s was built from %s which is not on origin/main, refusing to overwrite it", commit[:8], manifest.Source)
+		}
+		tags := strings.TrimSpace(runCmdOutput(projectRoot, "git", "tag", "--points-at", commit))
+		if tags != "" {
+			fatal("remote go branch commit %s is tagged (%s), refusing to overwrite it", commit[:8], strings.Join(strings.Fields(tags), ", "))
+		}
+	}
+}
+
+func readPublishManifest(commit string) (*PublishManifest, error) {
+	content, err := exec.Command("git", "-C", projectRoot, "show", commit+":"+publishManifestName).Output()
+	if err != nil {
+		return nil, fmt.Errorf("missing manifest")
+	}
+	var manifest PublishManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Source == "" {
+		return nil, fmt.Errorf("empty source commit")
+	}
+	return &manifest, nil
+}
+
+func writePublishManifest(manifest PublishManifest) {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fatal("failed to encode %s: %v", publishManifestName, err)
+	}
+	content = append(content, '\n')
+	if err := os.WriteFile(filepath.Join(projectRoot, publishManifestName), content, 0644); err != nil {
+		fatal("failed to write %s: %v", publishManifestName, err)
+	}
+}
+
+// gitSucceeds runs a git command in the project root and reports whether it
+// exited successfully.
+func gitSucceeds(args ...string) bool {
+	return exec.Command("git", append([]string{"-C", projectRoot}, args...)...).Run() == nil
+}
+
+// gitOutput runs a git command in the project root and returns its output.
+func gitOutput(args ...string) (string, error) {
+	output, err := exec.Command("git", append([]string{"-C", projectRoot}, args...)...).Output()
+	return string(output), err
+}
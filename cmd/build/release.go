@@ -0,0 +1,426 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// releaseManifestName is the file in the dist directory listing every
+// release artifact with its hash. Packaging definitions are generated from it.
+const releaseManifestName = "release.json"
+
+// ReleaseManifest describes the prebuilt artifacts of a release.
+type ReleaseManifest struct {
+	Version   string            `json:"version"`
+	BaseURL   string            `json:"base_url"`
+	Artifacts []ReleaseArtifact `json:"artifacts"`
+}
+
+// ReleaseArtifact is an archive holding include/, lib/<GOOS>_<ARCH>[_<libc>]/
+// with the static or shared library and the CGO config of one target.
+// Windows artifacts are zip files, all others tar.gz.
+type ReleaseArtifact struct {
+	GOOS   string `json:"goos"`
+	ARCH   string `json:"arch"`
+	Libc   string `json:"libc,omitempty"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Shared bool   `json:"shared,omitempty"`
+}
+
+// URL returns the download URL of the artifact.
+func (a ReleaseArtifact) URL(manifest *ReleaseManifest) string {
+	return strings.TrimSuffix(manifest.BaseURL, "/") + "/" + a.File
+}
+
+// defaultReleaseRepo is the GitHub repository releases are uploaded to and
+// fetched from.
+const defaultReleaseRepo = "sagernet/cronet-go"
+
+// releaseDownloadURL returns the base download URL of the GitHub release
+// |version| of |repo|. The version "latest" resolves to the latest release.
+func releaseDownloadURL(repo string, version string) string {
+	if version == "latest" {
+		return "https://github.com/" + repo + "/releases/latest/download"
+	}
+	return "https://github.com/" + repo + "/releases/download/" + version
+}
+
+func cmdRelease(targets []Target, args []string) {
+	flags := flag.NewFlagSet("release", flag.ExitOnError)
+	version := flags.String("version", "", "Release version, e.g. v1.2.3 (required)")
+	repo := flags.String("repo", defaultReleaseRepo, "GitHub repository of the release")
+	baseURL := flags.String("url", "", "Base download URL of the artifacts (default: GitHub release of -version)")
+	distDir := flags.String("dist", filepath.Join(projectRoot, "dist"), "Output directory")
+	upload := flags.Bool("upload", false, "Upload the artifacts to the GitHub release of -version with the gh CLI")
+	flags.Parse(args)
+
+	if *version == "" || *version == "latest" {
+		fatal("release: -version is required")
+	}
+	if *baseURL == "" {
+		*baseURL = releaseDownloadURL(*repo, *version)
+	}
+
+	log("Creating release %s for %d target(s)", *version, len(targets))
+	os.RemoveAll(*distDir)
+	if err := os.MkdirAll(*distDir, 0755); err != nil {
+		fatal("failed to create %s: %v", *distDir, err)
+	}
+
+	manifest := &ReleaseManifest{
+		Version: *version,
+		BaseURL: *baseURL,
+	}
+	for _, t := range targets {
+		libFiles, shared := releaseLibraryFiles(t)
+		if len(libFiles) == 0 {
+			log("Warning: library not found for %s, run package first; skipping", t)
+			continue
+		}
+		artifact := writeReleaseArchive(*distDir, *version, t, libFiles)
+		artifact.Shared = shared
+		manifest.Artifacts = append(manifest.Artifacts, artifact)
+		log("Packed %s (%s)", artifact.File, artifact.SHA256[:12])
+	}
+	if len(manifest.Artifacts) == 0 {
+		fatal("release: no libraries packaged")
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fatal("failed to encode release manifest: %v", err)
+	}
+	manifestPath := filepath.Join(*distDir, releaseManifestName)
+	if err := os.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		fatal("failed to write %s: %v", manifestPath, err)
+	}
+	log("Generated %s", releaseManifestName)
+
+	writePackagingDefinitions(*distDir, manifest)
+
+	if *upload {
+		uploadRelease(*repo, *version, *distDir)
+	}
+
+	log("Release complete!")
+}
+
+// releaseLibraryFiles returns the packaged library files of |t| relative to
+// the project root, and whether they are a shared library.
+func releaseLibraryFiles(t Target) ([]string, bool) {
+	libDir := "lib/" + t.libDir()
+	if _, err := os.Stat(filepath.Join(projectRoot, filepath.FromSlash(libDir), "libcronet.a")); err == nil {
+		return []string{libDir + "/libcronet.a"}, false
+	}
+	if libPath, found := findSharedLibrary(filepath.Join(projectRoot, filepath.FromSlash(libDir)), t); found {
+		return []string{libDir + "/" + filepath.Base(libPath)}, true
+	}
+	return nil, false
+}
+
+// writeReleaseArchive packs the headers, |libFiles|, the library module and the
+// CGO config of |t|
+// into a reproducible archive: entries are sorted and carry no timestamps or
+// owners.
+func writeReleaseArchive(distDir string, version string, t Target, libFiles []string) ReleaseArtifact {
+	extension := ".tar.gz"
+	if t.GOOS == "windows" {
+		extension = ".zip"
+	}
+	name := fmt.Sprintf("cronet-go-%s-%s%s", version, t.libDir(), extension)
+	path := filepath.Join(distDir, name)
+
+	var files []string
+	includeEntries, err := os.ReadDir(filepath.Join(projectRoot, "include"))
+	if err != nil {
+		fatal("failed to read include/, run package first: %v", err)
+	}
+	for _, entry := range includeEntries {
+		if !entry.IsDir() {
+			files = append(files, "include/"+entry.Name())
+		}
+	}
+	files = append(files, libFiles...)
+	files = append(files, libModuleFiles(t)...)
+	configName := t.configName()
+	if _, err := os.Stat(filepath.Join(projectRoot, configName)); err == nil {
+		files = append(files, configName)
+	}
+	sort.Strings(files)
+
+	file, err := os.Create(path)
+	if err != nil {
+		fatal("failed to create %s: %v", path, err)
+	}
+	hash := sha256.New()
+	output := io.MultiWriter(file, hash)
+	if t.GOOS == "windows" {
+		err = writeReleaseZip(output, files)
+	} else {
+		err = writeReleaseTarGz(output, files)
+	}
+	if err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fatal("failed to stat %s: %v", path, err)
+	}
+	return ReleaseArtifact{
+		GOOS:   t.GOOS,
+		ARCH:   t.ARCH,
+		Libc:   t.Libc,
+		File:   name,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Size:   info.Size(),
+	}
+}
+
+func writeReleaseTarGz(output io.Writer, files []string) error {
+	gzipWriter := gzip.NewWriter(output)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, name := range files {
+		addReleaseFile(tarWriter, name)
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func writeReleaseZip(output io.Writer, files []string) error {
+	zipWriter := zip.NewWriter(output)
+	for _, name := range files {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   name,
+			Method: zip.Deflate,
+		})
+		if err != nil {
+			return err
+		}
+		copyReleaseFile(writer, name)
+	}
+	return zipWriter.Close()
+}
+
+func addReleaseFile(tarWriter *tar.Writer, name string) {
+	info, err := os.Stat(filepath.Join(projectRoot, filepath.FromSlash(name)))
+	if err != nil {
+		fatal("failed to stat %s: %v", name, err)
+	}
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     info.Size(),
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		fatal("failed to write %s: %v", name, err)
+	}
+	copyReleaseFile(tarWriter, name)
+}
+
+func copyReleaseFile(writer io.Writer, name string) {
+	file, err := os.Open(filepath.Join(projectRoot, filepath.FromSlash(name)))
+	if err != nil {
+		fatal("failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(writer, file); err != nil {
+		fatal("failed to write %s: %v", name, err)
+	}
+}
+
+// uploadRelease uploads every file of |distDir| to the GitHub release
+// |version| of |repo|, creating the release if needed and replacing assets
+// of the same name.
+func uploadRelease(repo string, version string, distDir string) {
+	entries, err := os.ReadDir(distDir)
+	if err != nil {
+		fatal("failed to read %s: %v", distDir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(distDir, entry.Name()))
+		}
+	}
+	if _, err := exec.LookPath("gh"); err != nil {
+		fatal("uploading requires the GitHub CLI gh: %v", err)
+	}
+	view := exec.Command("gh", "release", "view", version, "--repo", repo)
+	view.Dir = projectRoot
+	if view.Run() != nil {
+		log("Creating GitHub release %s in %s", version, repo)
+		args := append([]string{"release", "create", version, "--repo", repo, "--title", version, "--notes", "Prebuilt Cronet libraries for cronet-go " + version}, files...)
+		runCmd(projectRoot, "gh", args...)
+	} else {
+		log("Uploading %d file(s) to GitHub release %s in %s", len(files), version, repo)
+		args := append([]string{"release", "upload", version, "--repo", repo, "--clobber"}, files...)
+		runCmd(projectRoot, "gh", args...)
+	}
+}
+
+// nixSystems maps GOOS/GOARCH to Nix system doubles.
+var nixSystems = map[string]string{
+	"linux/amd64":  "x86_64-linux",
+	"linux/arm64":  "aarch64-linux",
+	"darwin/amd64": "x86_64-darwin",
+	"darwin/arm64": "aarch64-darwin",
+}
+
+type packagingSource struct {
+	System string
+	URL    string
+	SHA256 string
+}
+
+var nixTemplate = template.Must(template.New("nix").Parse(`# Generated by go run ./cmd/build release. Do not edit.
+{ lib, stdenvNoCC, fetchurl }:
+
+let
+  version = "{{.Version}}";
+  sources = {
+{{- range .Sources}}
+    "{{.System}}" = fetchurl {
+      url = "{{.URL}}";
+      sha256 = "{{.SHA256}}";
+    };
+{{- end}}
+  };
+in
+stdenvNoCC.mkDerivation {
+  pname = "cronet-go";
+  inherit version;
+
+  src = sources.${stdenvNoCC.hostPlatform.system}
+    or (throw "cronet-go: unsupported system ${stdenvNoCC.hostPlatform.system}");
+  sourceRoot = ".";
+
+  installPhase = ''
+    runHook preInstall
+    mkdir -p $out/lib $out/include
+    cp include/* $out/include/
+    cp lib/*/libcronet.a $out/lib/
+    runHook postInstall
+  '';
+
+  meta = {
+    description = "Prebuilt Cronet static library for cronet-go";
+    homepage = "https://github.com/sagernet/cronet-go";
+    license = lib.licenses.gpl3Plus;
+    platforms = builtins.attrNames sources;
+  };
+}
+`))
+
+var homebrewTemplate = template.Must(template.New("homebrew").Parse(`# Generated by go run ./cmd/build release. Do not edit.
+class CronetGo < Formula
+  desc "Prebuilt Cronet static library for cronet-go"
+  homepage "https://github.com/sagernet/cronet-go"
+  version "{{.Version}}"
+  license "GPL-3.0-or-later"
+{{range .Platforms}}
+  on_{{.Name}} do
+{{- range .Sources}}
+    on_{{.System}} do
+      url "{{.URL}}"
+      sha256 "{{.SHA256}}"
+    end
+{{- end}}
+  end
+{{end}}
+  def install
+    include.install Dir["include/*"]
+    lib.install Dir["lib/*/libcronet.a"]
+  end
+
+  test do
+    assert_predicate lib/"libcronet.a", :exist?
+  end
+end
+`))
+
+type homebrewPlatform struct {
+	Name    string
+	Sources []packagingSource
+}
+
+// writePackagingDefinitions emits a Nix derivation and a Homebrew formula
+// pinned to the hashes in |manifest|. Only static Linux and macOS artifacts
+// of the platform libc are used.
+func writePackagingDefinitions(distDir string, manifest *ReleaseManifest) {
+	var nixSources []packagingSource
+	platforms := []*homebrewPlatform{{Name: "macos"}, {Name: "linux"}}
+	for _, artifact := range manifest.Artifacts {
+		system, supported := nixSystems[artifact.GOOS+"/"+artifact.ARCH]
+		if !supported || artifact.Shared || artifact.Libc != "" {
+			continue
+		}
+		source := packagingSource{System: system, URL: artifact.URL(manifest), SHA256: artifact.SHA256}
+		nixSources = append(nixSources, source)
+
+		platform := platforms[1]
+		if artifact.GOOS == "darwin" {
+			platform = platforms[0]
+		}
+		homebrewArch := "intel"
+		if artifact.ARCH == "arm64" {
+			homebrewArch = "arm"
+		}
+		platform.Sources = append(platform.Sources, packagingSource{System: homebrewArch, URL: source.URL, SHA256: source.SHA256})
+	}
+	if len(nixSources) == 0 {
+		log("No Linux or macOS artifacts, skipping Nix and Homebrew definitions")
+		return
+	}
+	sort.Slice(nixSources, func(i, j int) bool { return nixSources[i].System < nixSources[j].System })
+
+	var homebrewPlatforms []*homebrewPlatform
+	for _, platform := range platforms {
+		if len(platform.Sources) > 0 {
+			homebrewPlatforms = append(homebrewPlatforms, platform)
+		}
+	}
+
+	writeTemplate(filepath.Join(distDir, "cronet-go.nix"), nixTemplate, map[string]any{
+		"Version": strings.TrimPrefix(manifest.Version, "v"),
+		"Sources": nixSources,
+	})
+	writeTemplate(filepath.Join(distDir, "cronet-go.rb"), homebrewTemplate, map[string]any{
+		"Version":   strings.TrimPrefix(manifest.Version, "v"),
+		"Platforms": homebrewPlatforms,
+	})
+}
+
+func writeTemplate(path string, tmpl *template.Template, data any) {
+	file, err := os.Create(path)
+	if err != nil {
+		fatal("failed to create %s: %v", path, err)
+	}
+	defer file.Close()
+	if err := tmpl.Execute(file, data); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+	log("Generated %s", filepath.Base(path))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sharedLibrary makes build and package produce the cronet shared library
+// instead of cronet_static. Go binaries then link dynamically against it,
+// which makes them much smaller and faster to link, but the library has to
+// be shipped next to them.
+var sharedLibrary bool
+
+// checkSharedTargets fails for targets without a usable shared library: the
+// Android library is initialized from Java, iOS apps ship frameworks and
+// musl targets exist for static binaries.
+func checkSharedTargets(targets []Target) {
+	for _, t := range targets {
+		switch {
+		case t.Libc != "":
+			fatal("-shared is not supported for %s, which is meant for static binaries", t)
+		case t.GOOS == "linux", t.GOOS == "darwin", t.GOOS == "windows":
+		default:
+			fatal("-shared is not supported for %s, use the static library", t)
+		}
+	}
+}
+
+// ninjaTarget returns the ninja target building the library of the selected
+// kind.
+func ninjaTarget() string {
+	if sharedLibrary {
+		return "components/cronet:cronet"
+	}
+	return "cronet_static"
+}
+
+// sharedLibraryPattern returns the glob of the shared library of |t|. The
+// library is named after the Chromium version, e.g. libcronet.143.0.7499.109.so,
+// and that name is what binaries linked against it load at runtime.
+func sharedLibraryPattern(t Target) string {
+	switch t.GOOS {
+	case "darwin":
+		return "libcronet.*.dylib"
+	case "windows":
+		return "cronet.*.dll"
+	default:
+		return "libcronet.*.so"
+	}
+}
+
+// findSharedLibrary returns the newest shared library of |t| in |dir|, as an
+// output directory keeps the libraries of earlier Chromium versions.
+func findSharedLibrary(dir string, t Target) (string, bool) {
+	matches, err := filepath.Glob(filepath.Join(dir, sharedLibraryPattern(t)))
+	if err != nil {
+		fatal("failed to search %s: %v", dir, err)
+	}
+	var (
+		newest     string
+		newestTime int64
+	)
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if modTime := info.ModTime().UnixNano(); newest == "" || modTime > newestTime {
+			newest, newestTime = match, modTime
+		}
+	}
+	return newest, newest != ""
+}
+
+// packageSharedLibrary copies the shared library of |t| from its output
+// directory to |targetDir|, keeping its versioned name.
+func packageSharedLibrary(t Target, targetDir string) bool {
+	outDir := filepath.Join(srcRoot, fmt.Sprintf("out/cronet-%s-%s", t.OS, t.CPU))
+	srcLib, found := findSharedLibrary(outDir, t)
+	if !found {
+		return false
+	}
+	dstLib := filepath.Join(targetDir, filepath.Base(srcLib))
+	copyFile(srcLib, dstLib)
+	stripLibrary(dstLib)
+	return true
+}
+
+// sharedLDFlags returns the linker flags of the library module of |t| and the
+// name of the packaged shared library they link, or false if it is missing.
+func sharedLDFlags(t Target) ([]string, string, bool) {
+	libPath, found := findSharedLibrary(filepath.Join(projectRoot, "lib", t.libDir()), t)
+	if !found {
+		return nil, "", false
+	}
+	name := filepath.Base(libPath)
+	ldflags := []string{"${SRCDIR}/" + name}
+	if t.GOOS == "linux" {
+		// Loads the library from the directory of the binary
+		ldflags = append(ldflags, "-Wl,-rpath,$ORIGIN")
+	}
+	return ldflags, name, true
+}
+
+// sharedConfigComment documents in the CGO config of |t| how to ship the
+// shared library |name|.
+func sharedConfigComment(t Target, name string) string {
+	lines := []string{
+		"// Links the shared library " + name + ", which has to be shipped in the",
+		"// directory of the binary.",
+	}
+	if t.GOOS == "darwin" {
+		// cgo rejects rpaths starting with @, so the binary has to add it
+		lines = append(lines,
+			"// The library is loaded from @rpath; build with",
+			"//",
+			`//	go build -ldflags="-extldflags=-Wl,-rpath,@executable_path"`,
+		)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
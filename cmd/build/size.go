@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	// symbolLevel is gn's symbol_level: 0 for no debug info, 1 for line
+	// tables, 2 for full debug info.
+	symbolLevel int
+	// thinLTO and icf override gn's use_thin_lto and use_icf when "on" or
+	// "off", and leave Chromium's defaults when empty.
+	thinLTO string
+	icf     string
+	// stripMode strips the packaged library with llvm-strip: "debug" removes
+	// debug info, "unneeded" also the symbols no relocation needs.
+	stripMode string
+)
+
+// sizeCategories are the section categories of the size report, in order.
+var sizeCategories = []string{"code", "rodata", "data", "unwind", "debug", "bitcode", "other"}
+
+// objectSize is the size of an object of a library, by section category.
+type objectSize struct {
+	Name     string           `json:"name"`
+	Size     int64            `json:"size"`
+	Sections map[string]int64 `json:"sections"`
+}
+
+// librarySize is the size report of the packaged library of one target.
+type librarySize struct {
+	Target   string           `json:"target"`
+	File     string           `json:"file"`
+	Size     int64            `json:"size"`
+	Sections map[string]int64 `json:"sections"`
+	Objects  []objectSize     `json:"objects"`
+}
+
+// sizeGNArgs returns the gn args of the size flags.
+func sizeGNArgs() []string {
+	args := []string{fmt.Sprintf("symbol_level=%d", symbolLevel)}
+	for _, option := range []struct{ name, value string }{{"use_thin_lto", thinLTO}, {"use_icf", icf}} {
+		switch option.value {
+		case "":
+		case "on":
+			args = append(args, option.name+"=true")
+		case "off":
+			args = append(args, option.name+"=false")
+		default:
+			fatal("invalid value %q for %s, expected on or off", option.value, option.name)
+		}
+	}
+	return args
+}
+
+// stripLibrary strips the packaged library at |path| as selected by -strip.
+func stripLibrary(path string) {
+	var stripFlag string
+	switch stripMode {
+	case "":
+		return
+	case "debug":
+		stripFlag = "--strip-debug"
+	case "unneeded":
+		stripFlag = "--strip-unneeded"
+	default:
+		fatal("invalid -strip %q, expected debug or unneeded", stripMode)
+	}
+	tool := findLLVMTool("llvm-strip", "llvm-objcopy")
+	before, _ := os.Stat(path)
+	runCmd(projectRoot, tool, stripFlag, path)
+	after, _ := os.Stat(path)
+	if before != nil && after != nil {
+		log("Stripped %s from %s to %s", filepath.Base(path), formatSize(before.Size()), formatSize(after.Size()))
+	}
+}
+
+// findLLVMTool returns the first of |names| in Chromium's toolchain or PATH.
+func findLLVMTool(names ...string) string {
+	binDir := filepath.Join(srcRoot, "third_party", "llvm-build", "Release+Asserts", "bin")
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(binDir, name)); err == nil {
+			return filepath.Join(binDir, name)
+		}
+	}
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	fatal("none of %s found, run build first", strings.Join(names, ", "))
+	return ""
+}
+
+// cmdSize reports the size of the packaged library of each target, by
+// section category and by object, to track where the footprint comes from.
+func cmdSize(targets []Target, args []string) {
+	flags := flag.NewFlagSet("size", flag.ExitOnError)
+	top := flags.Int("top", 20, "Number of largest objects to list per target")
+	jsonOutput := flags.Bool("json", false, "Print the full report as JSON")
+	flags.Parse(args)
+
+	var reports []librarySize
+	for _, t := range targets {
+		files, _ := releaseLibraryFiles(t)
+		if len(files) == 0 {
+			log("Warning: no packaged library for %s, skipping", t)
+			continue
+		}
+		report, err := measureLibrary(filepath.Join(projectRoot, filepath.FromSlash(files[0])))
+		if err != nil {
+			fatal("failed to read %s: %v", files[0], err)
+		}
+		report.Target = t.String()
+		report.File = files[0]
+		reports = append(reports, report)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			fatal("failed to encode size report: %v", err)
+		}
+		return
+	}
+	for _, report := range reports {
+		printLibrarySize(report, *top)
+	}
+}
+
+func printLibrarySize(report librarySize, top int) {
+	fmt.Printf("\n%s: %s, %s in %d object(s)\n\n", report.Target, report.File, formatSize(report.Size), len(report.Objects))
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "SECTIONS\tSIZE\tSHARE\t")
+	for _, category := range sizeCategories {
+		if size := report.Sections[category]; size > 0 {
+			fmt.Fprintf(writer, "%s\t%s\t%.1f%%\t\n", category, formatSize(size), float64(size)*100/float64(report.Size))
+		}
+	}
+	writer.Flush()
+
+	if len(report.Objects) <= 1 {
+		return
+	}
+	fmt.Println()
+	writer = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "OBJECT\tSIZE\tCODE\tRODATA\tDATA\tDEBUG\t")
+	for i, object := range report.Objects {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t\n", object.Name, formatSize(object.Size),
+			formatSize(object.Sections["code"]), formatSize(object.Sections["rodata"]),
+			formatSize(object.Sections["data"]), formatSize(object.Sections["debug"]))
+	}
+	writer.Flush()
+}
+
+// measureLibrary reads the static archive or shared library at |path|. The
+// objects of a report are sorted largest first.
+func measureLibrary(path string) (librarySize, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return librarySize{}, err
+	}
+	report := librarySize{Size: int64(len(content)), Sections: make(map[string]int64)}
+	switch {
+	case bytes.HasPrefix(content, []byte("!<thin>\n")):
+		return report, errors.New("thin archives reference their objects instead of holding them")
+	case bytes.HasPrefix(content, []byte("!<arch>\n")):
+		err = readArchive(content, func(member archiveMember) {
+			if !member.special {
+				report.Objects = append(report.Objects, measureObject(member.name, member.data))
+			}
+		})
+		if err != nil {
+			return report, err
+		}
+	default:
+		report.Objects = []objectSize{measureObject(filepath.Base(path), content)}
+	}
+	for _, object := range report.Objects {
+		for category, size := range object.Sections {
+			report.Sections[category] += size
+		}
+	}
+	sort.Slice(report.Objects, func(i, j int) bool {
+		return report.Objects[i].Size > report.Objects[j].Size
+	})
+	return report, nil
+}
+
+// archiveMember is a member of an ar archive.
+type archiveMember struct {
+	name string
+	data []byte
+	// raw is the header and content as stored in the archive.
+	raw []byte
+	// special marks the symbol and long name tables.
+	special bool
+}
+
+// readArchive calls |member| with the members of the ar archive |content|,
+// in the GNU format of ELF and COFF toolchains or the BSD format of Apple's.
+func readArchive(content []byte, member func(member archiveMember)) error {
+	var longNames []byte
+	offset := len("!<arch>\n")
+	for offset+60 <= len(content) {
+		header := content[offset : offset+60]
+		offset += 60
+		name := strings.TrimRight(string(header[:16]), " ")
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || size < 0 || offset+size > len(content) {
+			return fmt.Errorf("invalid archive member header at %d", offset-60)
+		}
+		data := content[offset : offset+size]
+		start := offset - 60
+		// Members are 2-byte aligned
+		offset += size + size%2
+		if offset > len(content) {
+			offset = len(content)
+		}
+		raw := content[start:offset]
+
+		switch {
+		case name == "/" || name == "/SYM64/" || strings.HasPrefix(name, "__.SYMDEF"):
+			// Symbol table
+			member(archiveMember{name: name, raw: raw, special: true})
+			continue
+		case name == "//":
+			longNames = data
+			member(archiveMember{name: name, raw: raw, special: true})
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD: the name precedes the data
+			length, err := strconv.Atoi(name[3:])
+			if err != nil || length > len(data) {
+				return fmt.Errorf("invalid archive member name %q", name)
+			}
+			name = strings.TrimRight(string(data[:length]), "\x00")
+			if strings.HasPrefix(name, "__.SYMDEF") {
+				member(archiveMember{name: name, raw: raw, special: true})
+				continue
+			}
+			data = data[length:]
+		case strings.HasPrefix(name, "/"):
+			// GNU: offset into the long name table
+			start, err := strconv.Atoi(name[1:])
+			if err != nil || start > len(longNames) {
+				return fmt.Errorf("invalid archive member name %q", name)
+			}
+			name = string(longNames[start:])
+			if end := strings.Index(name, "/\n"); end >= 0 {
+				name = name[:end]
+			}
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		member(archiveMember{name: name, data: data, raw: raw})
+	}
+	return nil
+}
+
+// measureObject splits an ELF, Mach-O or COFF object into section categories.
+// The remainder of headers, symbol and relocation tables counts as other.
+func measureObject(name string, data []byte) objectSize {
+	object := objectSize{Name: name, Size: int64(len(data)), Sections: make(map[string]int64)}
+	var sectionTotal int64
+	add := func(section string, size int64) {
+		if size == 0 {
+			return
+		}
+		object.Sections[sectionCategory(section)] += size
+		sectionTotal += size
+	}
+	reader := bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("BC\xc0\xde")):
+		// LLVM bitcode of LTO builds
+		add("bitcode", int64(len(data)))
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		if file, err := elf.NewFile(reader); err == nil {
+			for _, section := range file.Sections {
+				if section.Type != elf.SHT_NOBITS && section.Type != elf.SHT_NULL {
+					add(section.Name, int64(section.FileSize))
+				}
+			}
+		}
+	default:
+		if file, err := macho.NewFile(reader); err == nil {
+			for _, section := range file.Sections {
+				if section.Flags&0xff != 0x1 && section.Flags&0xff != 0xc {
+					// Not S_ZEROFILL or S_GB_ZEROFILL
+					add(section.Name, int64(section.Size))
+				}
+			}
+		} else if file, err := pe.NewFile(reader); err == nil {
+			for _, section := range file.Sections {
+				add(section.Name, int64(section.Size))
+			}
+		}
+	}
+	if other := object.Size - sectionTotal; other > 0 {
+		object.Sections["other"] += other
+	}
+	return object
+}
+
+// sectionCategory maps a section name of any object format to a category of
+// sizeCategories.
+func sectionCategory(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case name == "bitcode":
+		return "bitcode"
+	case strings.Contains(name, "debug"), strings.HasPrefix(name, ".gdb_index"):
+		return "debug"
+	case strings.Contains(name, "eh_frame"), strings.Contains(name, "unwind"),
+		strings.HasPrefix(name, ".pdata"), strings.HasPrefix(name, ".xdata"), name == ".arm.exidx":
+		return "unwind"
+	case strings.HasPrefix(name, ".text"), name == "__text", name == "__stubs", name == "__stub_helper":
+		return "code"
+	case strings.HasPrefix(name, ".rodata"), strings.HasPrefix(name, ".rdata"), name == "__const",
+		name == "__cstring", name == "__literal4", name == "__literal8", name == "__literal16":
+		return "rodata"
+	case strings.HasPrefix(name, ".data"), name == "__data", strings.HasPrefix(name, ".init_array"),
+		strings.HasPrefix(name, ".fini_array"), name == "__mod_init_func":
+		return "data"
+	default:
+		return "other"
+	}
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
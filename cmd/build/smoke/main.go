@@ -0,0 +1,123 @@
+//go:build !cronet_nolib
+
+// Command smoke is the smoke test go run ./cmd/build verify links against the
+// packaged library of each target. It requests each URL it is given over the
+// expected protocol and exits with status 1 if any request fails.
+//
+// Usage:
+//
+//	smoke -ca ca.pem -h1 https://127.0.0.1:1234/ -h2 https://127.0.0.1:5678/ [-h3 https://example.com/]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// smokeBody is the body the verify test server answers with.
+const smokeBody = "cronet-go verify"
+
+func main() {
+	caFile := flag.String("ca", "", "PEM file of the root certificate of the test server")
+	h1URL := flag.String("h1", "", "URL to request over HTTP/1.1")
+	h2URL := flag.String("h2", "", "URL to request over HTTP/2")
+	h3URL := flag.String("h3", "", "URL to request over HTTP/3, answered with any body")
+	flag.Parse()
+
+	fmt.Println(cronet.Version())
+	failed := false
+	for _, check := range []struct {
+		protocol cronet.Protocol
+		url      string
+	}{
+		{cronet.ProtocolHTTP11, *h1URL},
+		{cronet.ProtocolHTTP2, *h2URL},
+		{cronet.ProtocolHTTP3, *h3URL},
+	} {
+		if check.url == "" {
+			continue
+		}
+		if err := request(check.protocol, check.url, *caFile); err != nil {
+			fmt.Printf("%s: %v\n", check.protocol, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok\n", check.protocol)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// request fetches |target| with a new engine, which only trusts the
+// certificate in |caFile| if one is given, and fails unless it is answered
+// over |protocol|.
+func request(protocol cronet.Protocol, target string, caFile string) error {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	engine := cronet.NewEngine()
+	defer engine.Destroy()
+	if caFile != "" {
+		certificate, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		if !engine.SetTrustedRootCertificates(string(certificate)) {
+			return fmt.Errorf("invalid certificate in %s", caFile)
+		}
+	}
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(protocol == cronet.ProtocolHTTP2)
+	if protocol == cronet.ProtocolHTTP3 {
+		port := 443
+		if parsed.Port() != "" {
+			port, _ = strconv.Atoi(parsed.Port())
+		}
+		params.SetEnableQuic(true)
+		hint := cronet.NewQuicHint()
+		hint.SetHost(parsed.Hostname())
+		hint.SetPort(int32(port))
+		hint.SetAlternatePort(int32(port))
+		params.AddQuicHint(hint)
+		hint.Destroy()
+	}
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = cronet.WithRequestOptions(ctx, cronet.RequestOptions{Protocols: []cronet.Protocol{protocol}})
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &cronet.RoundTripper{Engine: engine}}
+	response, err := client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s", response.Status)
+	}
+	if protocol != cronet.ProtocolHTTP3 && string(content) != smokeBody {
+		return fmt.Errorf("unexpected body %q", content)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultSyncComponents are the components sync downloads unless -components
+// is given, which naiveproxy's trimmed tree does not carry.
+var defaultSyncComponents = []string{"cronet", "grpc_support", "prefs"}
+
+var (
+	// componentIncludePattern matches includes of component headers in sources.
+	componentIncludePattern = regexp.MustCompile(`#include\s+"components/([a-z0-9_]+)/`)
+	// componentDepPattern matches component labels in BUILD.gn files.
+	componentDepPattern = regexp.MustCompile(`"//components/([a-z0-9_]+)[/:"]`)
+)
+
+// componentSkippedDirs hold code the native library does not build, whose
+// dependencies would pull most of Chromium's components in.
+var componentSkippedDirs = map[string]bool{
+	"android":   true,
+	"ios":       true,
+	"test":      true,
+	"testing":   true,
+	"tools":     true,
+	"fuzzers":   true,
+	"testdata":  true,
+	"unittests": true,
+}
+
+// componentDependencies returns the other components the synced component
+// |name| includes headers of or depends on in its BUILD.gn files, skipping
+// platform, test and tool directories.
+func componentDependencies(name string) []string {
+	root := filepath.Join(srcRoot, "components", name)
+	found := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && componentSkippedDirs[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fileName := entry.Name()
+		var pattern *regexp.Regexp
+		switch {
+		case fileName == "BUILD.gn":
+			pattern = componentDepPattern
+		case strings.HasSuffix(fileName, "_test.cc"), strings.HasSuffix(fileName, "_unittest.cc"):
+			return nil
+		case strings.HasSuffix(fileName, ".h"), strings.HasSuffix(fileName, ".cc"):
+			pattern = componentIncludePattern
+		default:
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range pattern.FindAllSubmatch(content, -1) {
+			found[string(match[1])] = true
+		}
+		return nil
+	})
+	if err != nil {
+		fatal("failed to scan components/%s: %v", name, err)
+	}
+	delete(found, name)
+
+	dependencies := make([]string, 0, len(found))
+	for dependency := range found {
+		dependencies = append(dependencies, dependency)
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"os"
+	"strings"
+)
+
+// cronetAPIPrefixes name the exported C API the Go package links against,
+// the roots of thinArchive.
+var cronetAPIPrefixes = []string{"Cronet_", "bidirectional_stream_"}
+
+// objectSymbols are the external symbols an object defines and references.
+type objectSymbols struct {
+	defined    []string
+	undefined  []string
+	unreadable bool
+}
+
+// thinArchive rewrites the static archive at |path| of |t| to the objects a
+// program calling the C API links. It resolves symbols the way the linker
+// selects archive members: starting from the members defining the API, each
+// undefined symbol pulls in the first member defining it. Objects nothing
+// reaches would never make it into a binary, but every go get downloads them.
+func thinArchive(path string, t Target) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fatal("failed to read %s: %v", path, err)
+	}
+	if !bytes.HasPrefix(content, []byte("!<arch>\n")) {
+		fatal("%s is not a static archive", path)
+	}
+	var members []archiveMember
+	if err := readArchive(content, func(member archiveMember) {
+		members = append(members, member)
+	}); err != nil {
+		fatal("failed to read %s: %v", path, err)
+	}
+
+	symbols := make([]objectSymbols, len(members))
+	definers := make(map[string]int)
+	for i, member := range members {
+		if member.special {
+			continue
+		}
+		symbols[i] = readObjectSymbols(member.data)
+		for _, symbol := range symbols[i].defined {
+			if _, found := definers[symbol]; !found {
+				definers[symbol] = i
+			}
+		}
+	}
+
+	keep := make([]bool, len(members))
+	var queue []int
+	reach := func(i int) {
+		if !keep[i] {
+			keep[i] = true
+			queue = append(queue, i)
+		}
+	}
+	unreadable := 0
+	for i, member := range members {
+		if member.special {
+			continue
+		}
+		if symbols[i].unreadable {
+			// Bitcode or unknown formats are kept rather than guessed about
+			unreadable++
+			reach(i)
+			continue
+		}
+		for _, symbol := range symbols[i].defined {
+			if isCronetAPISymbol(symbol) {
+				reach(i)
+				break
+			}
+		}
+	}
+	if len(queue) == unreadable {
+		fatal("no object of %s defines the cronet API", path)
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, symbol := range symbols[i].undefined {
+			if definer, found := definers[symbol]; found {
+				reach(definer)
+			}
+		}
+	}
+
+	var (
+		output bytes.Buffer
+		kept   int
+	)
+	output.WriteString("!<arch>\n")
+	for i, member := range members {
+		// The symbol table is regenerated below, the long name table kept as
+		// the GNU names of the kept members point into it
+		if member.special && member.name == "//" || !member.special && keep[i] {
+			output.Write(member.raw)
+			if !member.special {
+				kept++
+			}
+		}
+	}
+	if err := os.WriteFile(path, output.Bytes(), 0644); err != nil {
+		fatal("failed to write %s: %v", path, err)
+	}
+	format := "gnu"
+	switch t.GOOS {
+	case "darwin", "ios":
+		format = "darwin"
+	case "windows":
+		format = "coff"
+	}
+	runCmd(projectRoot, findLLVMTool("llvm-ar"), "--format="+format, "s", path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		fatal("failed to stat %s: %v", path, err)
+	}
+	objects := 0
+	for _, member := range members {
+		if !member.special {
+			objects++
+		}
+	}
+	log("Thinned library for %s to %d of %d objects, %s to %s", t, kept, objects, formatSize(int64(len(content))), formatSize(info.Size()))
+	if unreadable > 0 {
+		log("Warning: kept %d objects of unknown format, e.g. LTO bitcode", unreadable)
+	}
+}
+
+func isCronetAPISymbol(symbol string) bool {
+	for _, prefix := range cronetAPIPrefixes {
+		// Mach-O prefixes C symbols with an underscore
+		if strings.HasPrefix(symbol, prefix) || strings.HasPrefix(symbol, "_"+prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readObjectSymbols reads the external symbols of an ELF, Mach-O or COFF
+// object. Weak references are left out, as they do not pull in members.
+func readObjectSymbols(data []byte) objectSymbols {
+	var symbols objectSymbols
+	reader := bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		file, err := elf.NewFile(reader)
+		if err != nil {
+			break
+		}
+		elfSymbols, err := file.Symbols()
+		if err != nil && err != elf.ErrNoSymbols {
+			break
+		}
+		for _, symbol := range elfSymbols {
+			bind := elf.ST_BIND(symbol.Info)
+			switch {
+			case bind != elf.STB_GLOBAL && bind != elf.STB_WEAK:
+			case symbol.Section == elf.SHN_UNDEF:
+				if bind == elf.STB_GLOBAL {
+					symbols.undefined = append(symbols.undefined, symbol.Name)
+				}
+			default:
+				symbols.defined = append(symbols.defined, symbol.Name)
+			}
+		}
+		return symbols
+	default:
+		if file, err := macho.NewFile(reader); err == nil {
+			if file.Symtab == nil {
+				return symbols
+			}
+			const (
+				machoExternal  = 0x01
+				machoTypeMask  = 0x0e
+				machoUndefined = 0x0
+				machoWeakRef   = 0x40
+			)
+			for _, symbol := range file.Symtab.Syms {
+				if symbol.Type&machoExternal == 0 {
+					continue
+				}
+				// Common symbols are undefined with a size as value
+				if symbol.Type&machoTypeMask == machoUndefined && symbol.Value == 0 {
+					if symbol.Desc&machoWeakRef == 0 {
+						symbols.undefined = append(symbols.undefined, symbol.Name)
+					}
+				} else {
+					symbols.defined = append(symbols.defined, symbol.Name)
+				}
+			}
+			return symbols
+		}
+		if file, err := pe.NewFile(reader); err == nil {
+			const (
+				coffExternal     = 2
+				coffWeakExternal = 105
+			)
+			for _, symbol := range file.Symbols {
+				switch {
+				case symbol.StorageClass != coffExternal && symbol.StorageClass != coffWeakExternal:
+				case symbol.SectionNumber == 0 && symbol.Value == 0:
+					if symbol.StorageClass == coffExternal {
+						symbols.undefined = append(symbols.undefined, symbol.Name)
+					}
+				default:
+					symbols.defined = append(symbols.defined, symbol.Name)
+				}
+			}
+			return symbols
+		}
+	}
+	symbols.unreadable = true
+	return symbols
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// verifyBody is the body of the verify test server, checked by the smoke
+// test in cmd/build/smoke.
+const verifyBody = "cronet-go verify"
+
+// verifyTriples maps gn target_cpu to the clang target of Linux targets.
+var verifyTriples = map[string]string{
+	"x64":     "x86_64-linux-gnu",
+	"arm64":   "aarch64-linux-gnu",
+	"riscv64": "riscv64-linux-gnu",
+	"loong64": "loongarch64-linux-gnu",
+	"x86":     "i686-linux-gnu",
+}
+
+// verifyQEMU maps gn target_cpu to the qemu-user emulator of Linux targets.
+var verifyQEMU = map[string]string{
+	"x64":     "qemu-x86_64",
+	"arm64":   "qemu-aarch64",
+	"riscv64": "qemu-riscv64",
+	"loong64": "qemu-loongarch64",
+	"x86":     "qemu-i386",
+}
+
+// verifyResult is the outcome of the smoke test of one target.
+type verifyResult struct {
+	target Target
+	// status is ok, linked (built but not run), skipped or failed.
+	status string
+	detail string
+}
+
+// cmdVerify links the smoke test of cmd/build/smoke against the packaged
+// library of each target and runs it where the host can: natively, with
+// qemu-user for Linux targets of other architectures or on an Android device
+// through adb. The smoke test requests a local test server over HTTP/1.1 and
+// HTTP/2, and with -h3-url an HTTP/3 server, as Go has no QUIC server.
+func cmdVerify(targets []Target, args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	useQEMU := flags.Bool("qemu", false, "Run Linux targets of other architectures with qemu-user")
+	useADB := flags.Bool("adb", false, "Run Android targets on the device adb is connected to")
+	h3URL := flags.String("h3-url", "", "HTTPS URL of a public HTTP/3 server to request over QUIC, e.g. https://cloudflare-quic.com/")
+	flags.Parse(args)
+
+	workDir, err := os.MkdirTemp("", "cronet-go-verify-*")
+	if err != nil {
+		fatal("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	caFile := filepath.Join(workDir, "ca.pem")
+	h1URL, h2URL, stop := startVerifyServers(caFile)
+	defer stop()
+	smokeArgs := []string{"-h1", h1URL, "-h2", h2URL}
+	if *h3URL != "" {
+		smokeArgs = append(smokeArgs, "-h3", *h3URL)
+	}
+
+	var results []verifyResult
+	for _, t := range targets {
+		log("Verifying %s...", t)
+		result := verifyTarget(t, workDir, caFile, smokeArgs, *useQEMU, *useADB)
+		log("%s: %s %s", t, result.status, result.detail)
+		results = append(results, result)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TARGET\tRESULT\tDETAIL")
+	failed := 0
+	for _, result := range results {
+		if result.status == "failed" {
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.target, result.status, result.detail)
+	}
+	writer.Flush()
+	if failed > 0 {
+		fatal("%d of %d target(s) failed verification", failed, len(results))
+	}
+	log("Verify complete!")
+}
+
+func verifyTarget(t Target, workDir string, caFile string, smokeArgs []string, useQEMU bool, useADB bool) verifyResult {
+	libFiles, shared := releaseLibraryFiles(t)
+	if len(libFiles) == 0 {
+		return verifyResult{t, "failed", "no packaged library, run package first"}
+	}
+	cc, err := verifyCC(t)
+	if err != nil {
+		return verifyResult{t, "skipped", err.Error()}
+	}
+
+	binDir := filepath.Join(workDir, t.libDir())
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		fatal("failed to create %s: %v", binDir, err)
+	}
+	binary := filepath.Join(binDir, "smoke")
+	if t.GOOS == "windows" {
+		binary += ".exe"
+	}
+	buildArgs := []string{"build", "-o", binary}
+	if t.Libc != "" {
+		buildArgs = append(buildArgs, "-tags", t.Libc)
+	}
+	if shared && t.GOOS == "darwin" {
+		buildArgs = append(buildArgs, "-ldflags=-extldflags=-Wl,-rpath,@executable_path")
+	}
+	buildArgs = append(buildArgs, "./cmd/build/smoke")
+	cmd := exec.Command("go", buildArgs...)
+	cmd.Dir = projectRoot
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=1", "GOOS="+t.GOOS, "GOARCH="+t.ARCH, "CC="+cc)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Stdout.Write(output)
+		return verifyResult{t, "failed", "link failed: " + err.Error()}
+	}
+	if shared {
+		// Loaded from the directory of the binary
+		copyFile(filepath.Join(projectRoot, filepath.FromSlash(libFiles[0])), filepath.Join(binDir, filepath.Base(libFiles[0])))
+	}
+
+	var run *exec.Cmd
+	hostArgs := append([]string{"-ca", caFile}, smokeArgs...)
+	switch {
+	case t.GOOS == runtime.GOOS && t.ARCH == runtime.GOARCH:
+		run = exec.Command(binary, hostArgs...)
+	case t.GOOS == "linux" && useQEMU:
+		qemu, err := exec.LookPath(verifyQEMU[t.CPU])
+		if err != nil {
+			return verifyResult{t, "linked", verifyQEMU[t.CPU] + " not found"}
+		}
+		qemuArgs := []string{}
+		if t.Libc == "" {
+			// The dynamic loader and libc of the target
+			qemuArgs = append(qemuArgs, "-L", filepath.Join(srcRoot, filepath.FromSlash(linuxSysroot(t.CPU))))
+		}
+		run = exec.Command(qemu, append(append(qemuArgs, binary), hostArgs...)...)
+	case t.GOOS == "android" && useADB:
+		return runVerifyADB(t, binDir, caFile, smokeArgs)
+	default:
+		return verifyResult{t, "linked", "not runnable on this host"}
+	}
+	run.Dir = binDir
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	if err := run.Run(); err != nil {
+		return verifyResult{t, "failed", err.Error()}
+	}
+	return verifyResult{t, "ok", ""}
+}
+
+// runVerifyADB runs the smoke test in |binDir| on the device adb is connected
+// to, which reaches the test servers on the host through adb reverse.
+func runVerifyADB(t Target, binDir string, caFile string, smokeArgs []string) verifyResult {
+	const deviceDir = "/data/local/tmp/cronet-go-verify"
+	adbArgs := [][]string{
+		{"shell", "rm -rf " + deviceDir + " && mkdir -p " + deviceDir},
+		{"push", binDir + "/.", deviceDir},
+		{"push", caFile, deviceDir + "/ca.pem"},
+	}
+	for _, arg := range smokeArgs {
+		if strings.HasPrefix(arg, "https://127.0.0.1:") {
+			port := strings.TrimSuffix(strings.TrimPrefix(arg, "https://127.0.0.1:"), "/")
+			adbArgs = append(adbArgs, []string{"reverse", "tcp:" + port, "tcp:" + port})
+		}
+	}
+	adbArgs = append(adbArgs, []string{"shell", "cd " + deviceDir + " && ./smoke -ca ca.pem " + strings.Join(smokeArgs, " ")})
+	for _, args := range adbArgs {
+		cmd := exec.Command("adb", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return verifyResult{t, "failed", fmt.Sprintf("adb %s: %v", args[0], err)}
+		}
+	}
+	return verifyResult{t, "ok", "on device"}
+}
+
+// verifyCC returns the C compiler linking the smoke test of |t|: Chromium's
+// clang with the target sysroot for Linux and FreeBSD, the NDK clang for
+// Android and Xcode's clang for Apple targets. Windows targets link with the
+// default compiler of a Windows host, or the 32-bit MinGW gcc for 386.
+func verifyCC(t Target) (string, error) {
+	clang := filepath.Join(srcRoot, "third_party", "llvm-build", "Release+Asserts", "bin", "clang")
+	switch t.GOOS {
+	case "linux":
+		if _, err := os.Stat(clang); err != nil {
+			return "", errors.New("Chromium clang not found, run build first")
+		}
+		if t.Libc == "musl" {
+			sdk := openwrtSDKs[t.CPU]
+			sysroot := filepath.Join(srcRoot, filepath.FromSlash(sdk.sysroot()))
+			if _, err := os.Stat(sysroot); err != nil {
+				return "", fmt.Errorf("OpenWrt sysroot not found at %s", sdk.sysroot())
+			}
+			triple := strings.Replace(verifyTriples[t.CPU], "-linux-gnu", "-openwrt-linux-musl", 1)
+			return fmt.Sprintf("%s --target=%s --sysroot=%s", clang, triple, sysroot), nil
+		}
+		pattern := fmt.Sprintf("out/sysroot-build/*/*_%s_staging", debianArchs[t.CPU])
+		if matches, _ := filepath.Glob(filepath.Join(srcRoot, filepath.FromSlash(pattern))); len(matches) == 0 {
+			return "", fmt.Errorf("no sysroot found at %s", pattern)
+		}
+		sysroot := filepath.Join(srcRoot, filepath.FromSlash(linuxSysroot(t.CPU)))
+		return fmt.Sprintf("%s --target=%s --sysroot=%s", clang, verifyTriples[t.CPU], sysroot), nil
+	case "freebsd":
+		if _, err := os.Stat(clang); err != nil {
+			return "", errors.New("Chromium clang not found, run build first")
+		}
+		sysroot := filepath.Join(srcRoot, filepath.FromSlash(freebsdSysroot(t.CPU)))
+		if _, err := os.Stat(sysroot); err != nil {
+			return "", fmt.Errorf("FreeBSD sysroot not found at %s", freebsdSysroot(t.CPU))
+		}
+		return fmt.Sprintf("%s --target=%s --sysroot=%s", clang, freebsdTriple(t.CPU), sysroot), nil
+	case "android":
+		ndk, found := findAndroidNDK()
+		if !found {
+			return "", errors.New("no NDK found, set ANDROID_NDK_HOME")
+		}
+		matches, _ := filepath.Glob(filepath.Join(ndk, "toolchains", "llvm", "prebuilt", "*", "bin", "clang"))
+		if len(matches) == 0 {
+			return "", fmt.Errorf("no clang found in NDK %s", ndk)
+		}
+		triple := map[string]string{
+			"arm64": "aarch64-linux-android",
+			"x64":   "x86_64-linux-android",
+			"arm":   "armv7a-linux-androideabi",
+			"x86":   "i686-linux-android",
+		}[t.CPU]
+		return fmt.Sprintf("%s --target=%s%d", matches[0], triple, androidMinSDK), nil
+	case "darwin", "ios":
+		if runtime.GOOS != "darwin" {
+			return "", errors.New("Apple targets link on macOS only")
+		}
+		sdk, arch := "macosx", "arm64"
+		if t.GOOS == "ios" {
+			sdk = "iphoneos"
+		}
+		if t.ARCH == "amd64" {
+			arch = "x86_64"
+		}
+		clangPath := strings.TrimSpace(runCmdOutput(projectRoot, "xcrun", "--sdk", sdk, "--find", "clang"))
+		sysroot := strings.TrimSpace(runCmdOutput(projectRoot, "xcrun", "--sdk", sdk, "--show-sdk-path"))
+		return fmt.Sprintf("%s -arch %s -isysroot %s", clangPath, arch, sysroot), nil
+	case "windows":
+		if runtime.GOOS != "windows" {
+			return "", errors.New("Windows targets link on Windows only")
+		}
+		if t.ARCH == "386" {
+			// The default MinGW gcc of a 64-bit host emits 64-bit objects
+			if _, err := exec.LookPath("i686-w64-mingw32-gcc"); err == nil {
+				return "i686-w64-mingw32-gcc", nil
+			}
+		}
+		return strings.TrimSpace(runCmdOutput(projectRoot, "go", "env", "CC")), nil
+	}
+	return "", fmt.Errorf("no toolchain for %s", t)
+}
+
+// startVerifyServers starts the HTTP/1.1 and HTTP/2 test servers on the
+// loopback interface with a new self-signed certificate, written to |caFile|
+// for the smoke test to trust.
+func startVerifyServers(caFile string) (string, string, func()) {
+	certificate := newVerifyCertificate(caFile)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(verifyBody))
+	})
+	var servers []*http.Server
+	var urls []string
+	for _, protocols := range [][]string{{"http/1.1"}, {"h2", "http/1.1"}} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fatal("failed to start test server: %v", err)
+		}
+		server := &http.Server{Handler: handler}
+		if protocols[0] == "http/1.1" {
+			// Without h2 in TLSNextProto the server only speaks HTTP/1.1
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, NextProtos: protocols}
+		go server.ServeTLS(listener, "", "")
+		servers = append(servers, server)
+		urls = append(urls, "https://"+listener.Addr().String()+"/")
+	}
+	return urls[0], urls[1], func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+func newVerifyCertificate(caFile string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		fatal("failed to generate test key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cronet-go verify"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		fatal("failed to create test certificate: %v", err)
+	}
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(caFile, certificatePEM, 0644); err != nil {
+		fatal("failed to write %s: %v", caFile, err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
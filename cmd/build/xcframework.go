@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// xcframeworkName is the XCFramework package -xcframework writes to lib/.
+const xcframeworkName = "Cronet.xcframework"
+
+// xcframeworkModuleMap exposes the C API as the Clang module Cronet, so Swift
+// can import it.
+const xcframeworkModuleMap = `module Cronet {
+    header "cronet_c.h"
+    header "bidirectional_stream_c.h"
+    export *
+}
+`
+
+// checkXCFrameworkTargets fails unless an XCFramework can be created for
+// |targets|: it needs xcodebuild and wraps static Apple libraries only.
+func checkXCFrameworkTargets(targets []Target) {
+	if runtime.GOOS != "darwin" {
+		fatal("-xcframework needs xcodebuild, run it on macOS")
+	}
+	if sharedLibrary {
+		fatal("-xcframework wraps the static libraries, remove -shared")
+	}
+	for _, t := range targets {
+		if t.GOOS == "darwin" || t.GOOS == "ios" {
+			return
+		}
+	}
+	fatal("-xcframework needs a darwin or ios target")
+}
+
+// packageXCFramework merges the packaged macOS libraries of |targets| into a
+// universal library with lipo and wraps it, the iOS library and the headers
+// into lib/Cronet.xcframework.
+func packageXCFramework(targets []Target) {
+	var macLibs, iosLibs []string
+	for _, t := range targets {
+		libPath := filepath.Join(projectRoot, "lib", t.libDir(), "libcronet.a")
+		if _, err := os.Stat(libPath); err != nil {
+			continue
+		}
+		switch t.GOOS {
+		case "darwin":
+			macLibs = append(macLibs, libPath)
+		case "ios":
+			iosLibs = append(iosLibs, libPath)
+		}
+	}
+	if len(macLibs) == 0 && len(iosLibs) == 0 {
+		fatal("no macOS or iOS library packaged for the XCFramework")
+	}
+
+	workDir, err := os.MkdirTemp("", "cronet-xcframework-")
+	if err != nil {
+		fatal("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	headersDir := filepath.Join(workDir, "Headers")
+	entries, err := os.ReadDir(filepath.Join(projectRoot, "include"))
+	if err != nil {
+		fatal("failed to read include/: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".h") {
+			copyFile(filepath.Join(projectRoot, "include", entry.Name()), filepath.Join(headersDir, entry.Name()))
+		}
+	}
+	if err := os.WriteFile(filepath.Join(headersDir, "module.modulemap"), []byte(xcframeworkModuleMap), 0644); err != nil {
+		fatal("failed to write module map: %v", err)
+	}
+
+	args := []string{"-create-xcframework"}
+	if len(macLibs) > 0 {
+		macLib := macLibs[0]
+		if len(macLibs) > 1 {
+			macLib = filepath.Join(workDir, "macos", "libcronet.a")
+			if err := os.MkdirAll(filepath.Dir(macLib), 0755); err != nil {
+				fatal("failed to create %s: %v", filepath.Dir(macLib), err)
+			}
+			log("Merging %d macOS libraries with lipo", len(macLibs))
+			runCmd(projectRoot, "lipo", append([]string{"-create", "-output", macLib}, macLibs...)...)
+		}
+		args = append(args, "-library", macLib, "-headers", headersDir)
+	}
+	// xcodebuild takes one library per platform variant; the iOS targets
+	// are device builds of arm64 only
+	for _, iosLib := range iosLibs {
+		args = append(args, "-library", iosLib, "-headers", headersDir)
+	}
+
+	output := filepath.Join(projectRoot, "lib", xcframeworkName)
+	os.RemoveAll(output)
+	args = append(args, "-output", output)
+	runCmd(projectRoot, "xcodebuild", args...)
+	log("Created lib/%s", xcframeworkName)
+}
@@ -0,0 +1,170 @@
+// Command cronet-top shows the in-flight requests of a process using
+// cronet.ProgressMonitor, refreshed live in the terminal.
+//
+// The monitored process serves the monitor over HTTP:
+//
+//	monitor := cronet.NewProgressMonitor()
+//	transport := &cronet.RoundTripper{Progress: monitor}
+//	http.Handle("/debug/cronet/progress", monitor)
+//
+// Usage:
+//
+//	go run ./cmd/cronet-top -url http://127.0.0.1:6060/debug/cronet/progress
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The sample types mirror cronet.ProgressSample, so this command does not
+// link the native library.
+
+type requestProgress struct {
+	ID            uint64    `json:"id"`
+	Method        string    `json:"method"`
+	URL           string    `json:"url"`
+	Started       time.Time `json:"started"`
+	StatusCode    int       `json:"status_code"`
+	Protocol      string    `json:"protocol"`
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"`
+}
+
+type originProgress struct {
+	Origin        string  `json:"origin"`
+	Active        int     `json:"active"`
+	Completed     int64   `json:"completed"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	SendRate      float64 `json:"send_rate"`
+	ReceiveRate   float64 `json:"receive_rate"`
+}
+
+type progressSample struct {
+	Time     time.Time         `json:"time"`
+	Requests []requestProgress `json:"requests"`
+	Origins  []originProgress  `json:"origins"`
+}
+
+func main() {
+	endpoint := flag.String("url", "http://127.0.0.1:6060/debug/cronet/progress", "Progress endpoint of the monitored process")
+	rate := flag.Int("rate", 2, "Samples per second")
+	limit := flag.Int("n", 20, "Maximum number of requests shown")
+	flag.Parse()
+
+	streamURL, err := url.Parse(*endpoint)
+	if err != nil {
+		fatal("invalid url: %v", err)
+	}
+	query := streamURL.Query()
+	query.Set("rate", strconv.Itoa(*rate))
+	streamURL.RawQuery = query.Encode()
+
+	response, err := http.Get(streamURL.String())
+	if err != nil {
+		fatal("%v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		fatal("%s: %s", streamURL, response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var sample progressSample
+		err = json.Unmarshal(scanner.Bytes(), &sample)
+		if err != nil {
+			fatal("decode sample: %v", err)
+		}
+		render(sample, *limit)
+	}
+	if err = scanner.Err(); err != nil {
+		fatal("%v", err)
+	}
+}
+
+func render(sample progressSample, limit int) {
+	var builder strings.Builder
+	// Move to the top left and clear the screen
+	builder.WriteString("\x1b[H\x1b[2J")
+
+	active := 0
+	var sendRate, receiveRate float64
+	for _, origin := range sample.Origins {
+		active += origin.Active
+		sendRate += origin.SendRate
+		receiveRate += origin.ReceiveRate
+	}
+	fmt.Fprintf(&builder, "cronet-top  %s  active %d  up %s/s  down %s/s\n\n",
+		sample.Time.Format("15:04:05"), active, formatBytes(sendRate), formatBytes(receiveRate))
+
+	origins := sample.Origins
+	sort.SliceStable(origins, func(i, j int) bool {
+		return origins[i].ReceiveRate+origins[i].SendRate > origins[j].ReceiveRate+origins[j].SendRate
+	})
+	fmt.Fprintf(&builder, "%-40s %6s %9s %10s %10s %10s %10s\n", "ORIGIN", "ACTIVE", "COMPLETED", "UP/S", "DOWN/S", "SENT", "RECEIVED")
+	for _, origin := range origins {
+		fmt.Fprintf(&builder, "%-40s %6d %9d %10s %10s %10s %10s\n",
+			truncate(origin.Origin, 40), origin.Active, origin.Completed,
+			formatBytes(origin.SendRate), formatBytes(origin.ReceiveRate),
+			formatBytes(float64(origin.BytesSent)), formatBytes(float64(origin.BytesReceived)))
+	}
+
+	fmt.Fprintf(&builder, "\n%-8s %-7s %-8s %6s %8s %10s %10s  %s\n", "ID", "METHOD", "PROTO", "STATUS", "AGE", "SENT", "RECEIVED", "URL")
+	for i, request := range sample.Requests {
+		if i == limit {
+			fmt.Fprintf(&builder, "... %d more\n", len(sample.Requests)-limit)
+			break
+		}
+		status := "-"
+		if request.StatusCode != 0 {
+			status = strconv.Itoa(request.StatusCode)
+		}
+		protocol := request.Protocol
+		if protocol == "" {
+			protocol = "-"
+		}
+		fmt.Fprintf(&builder, "%-8d %-7s %-8s %6s %8s %10s %10s  %s\n",
+			request.ID, request.Method, truncate(protocol, 8), status,
+			sample.Time.Sub(request.Started).Truncate(100*time.Millisecond),
+			formatBytes(float64(request.BytesSent)), formatBytes(float64(request.BytesReceived)),
+			truncate(request.URL, 80))
+	}
+	os.Stdout.WriteString(builder.String())
+}
+
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f%s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", bytes, units[unit])
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length-1] + "~"
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "cronet-top: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatBytes(t *testing.T) {
+	for bytes, want := range map[float64]string{
+		0:               "0B",
+		1023:            "1023B",
+		1024:            "1.0KiB",
+		1536:            "1.5KiB",
+		5 * 1024 * 1024: "5.0MiB",
+		1 << 50:         "1024.0TiB",
+	} {
+		if got := formatBytes(bytes); got != want {
+			t.Errorf("formatBytes(%v) = %q, want %q", bytes, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("short", 8); got != "short" {
+		t.Error("unexpected", got)
+	}
+	if got := truncate("https://example.com/long", 10); got != "https://e~" {
+		t.Error("unexpected", got)
+	}
+}
+
+func TestDecodeSample(t *testing.T) {
+	// The field names of cronet.ProgressSample
+	line := `{"time":"2024-01-02T03:04:05Z","requests":[{"id":7,"method":"GET","url":"https://example.com/","origin":"https://example.com","started":"2024-01-02T03:04:04Z","status_code":200,"protocol":"h2","bytes_sent":1,"bytes_received":2}],"origins":[{"origin":"https://example.com","active":1,"completed":3,"bytes_sent":4,"bytes_received":5,"send_rate":6,"receive_rate":7}]}`
+	var sample progressSample
+	if err := json.Unmarshal([]byte(line), &sample); err != nil {
+		t.Fatal(err)
+	}
+	request := sample.Requests[0]
+	if request.ID != 7 || request.StatusCode != 200 || request.Protocol != "h2" || request.BytesSent != 1 || request.BytesReceived != 2 {
+		t.Fatalf("unexpected request %+v", request)
+	}
+	origin := sample.Origins[0]
+	if origin.Active != 1 || origin.Completed != 3 || origin.BytesSent != 4 || origin.BytesReceived != 5 || origin.SendRate != 6 || origin.ReceiveRate != 7 {
+		t.Fatalf("unexpected origin %+v", origin)
+	}
+}
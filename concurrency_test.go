@@ -0,0 +1,173 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// parallelRequests is the number of requests in flight at once in the
+// concurrency tests, meant to be run with -race.
+const parallelRequests = 10000
+
+func TestParallelRequests(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.Copy(io.Discard, request.Body)
+		writer.Write([]byte(request.URL.Query().Get("n")))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	engine := cronet.NewEngine()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if !engine.SetTrustedRootCertificates(string(certificate)) {
+		t.Fatal("failed to trust test certificate")
+	}
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer func() {
+		engine.Shutdown()
+		engine.Destroy()
+	}()
+	transport := &cronet.RoundTripper{Engine: engine}
+	initialHandles := cronet.CountNativeHandles()
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < parallelRequests; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			<-start
+			target := server.URL + "/?n=" + strconv.Itoa(n)
+			var request *http.Request
+			if n%2 == 0 {
+				request, _ = http.NewRequest(http.MethodGet, target, nil)
+			} else {
+				request, _ = http.NewRequest(http.MethodPost, target, http.NoBody)
+			}
+			response, err := transport.RoundTrip(request)
+			if err != nil {
+				t.Error(n, err)
+				return
+			}
+			content, err := io.ReadAll(response.Body)
+			response.Body.Close()
+			if err != nil || string(content) != strconv.Itoa(n) {
+				t.Error(n, "bad response", string(content), err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for cronet.CountNativeHandles() != initialHandles && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if handles := cronet.CountNativeHandles(); handles != initialHandles {
+		t.Fatalf("native handles left: %+v, started with %+v", handles, initialHandles)
+	}
+}
+
+func TestParallelExecutors(t *testing.T) {
+	initialHandles := cronet.CountNativeHandles()
+	var wg sync.WaitGroup
+	for i := 0; i < parallelRequests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {})
+			listener := cronet.NewURLRequestStatusListener(func(self cronet.URLRequestStatusListener, status cronet.URLRequestStatusListenerStatus) {})
+			listener.Destroy()
+			executor.Destroy()
+		}()
+	}
+	wg.Wait()
+	if handles := cronet.CountNativeHandles(); handles != initialHandles {
+		t.Fatalf("native handles left: %+v, started with %+v", handles, initialHandles)
+	}
+}
+
+// The registries of the native objects are hit by every callback; these
+// benchmarks are meant to be run with -cpu to compare contention, e.g.
+//
+//	go test -run '^$' -bench Registry -cpu 1,8,32 .
+
+func BenchmarkRegistryURLRequestCallback(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			callback := cronet.NewURLRequestCallback(nil)
+			callback.Destroy()
+		}
+	})
+}
+
+func BenchmarkRegistryExecutor(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {})
+			listener := cronet.NewURLRequestStatusListener(func(self cronet.URLRequestStatusListener, status cronet.URLRequestStatusListenerStatus) {})
+			listener.Destroy()
+			executor.Destroy()
+		}
+	})
+}
+
+// BenchmarkRegistryRequests sends requests over a single HTTP/2 connection,
+// each dispatching callbacks of its executor, request callback and upload
+// provider through the registries.
+func BenchmarkRegistryRequests(b *testing.B) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.Copy(io.Discard, request.Body)
+		writer.Write([]byte("ok"))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	engine := cronet.NewEngine()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if !engine.SetTrustedRootCertificates(string(certificate)) {
+		b.Fatal("failed to trust test certificate")
+	}
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer func() {
+		engine.Shutdown()
+		engine.Destroy()
+	}()
+	transport := &cronet.RoundTripper{Engine: engine}
+
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			request, _ := http.NewRequest(http.MethodPost, server.URL+"/", http.NoBody)
+			response, err := transport.RoundTrip(request)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+	})
+}
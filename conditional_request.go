@@ -0,0 +1,271 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// defaultValidatorMaxBodySize is the largest body stored for conditional
+// requests unless RoundTripper.ValidatorMaxBodySize is set.
+const defaultValidatorMaxBodySize = 1 << 20
+
+// ValidatedResponse is a response stored for conditional requests.
+type ValidatedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Vary holds the request header values the response was selected by,
+	// keyed by the header names listed in its Vary header.
+	Vary map[string]string
+}
+
+// ETag returns the entity tag of the stored response.
+func (r *ValidatedResponse) ETag() string {
+	return r.Header.Get("ETag")
+}
+
+// LastModified returns the Last-Modified header of the stored response.
+func (r *ValidatedResponse) LastModified() string {
+	return r.Header.Get("Last-Modified")
+}
+
+// ValidatorStore stores responses for conditional requests, keyed by URL.
+// Implementations must be safe for concurrent use.
+type ValidatorStore interface {
+	Get(key string) (*ValidatedResponse, bool)
+	Put(key string, response *ValidatedResponse)
+	Delete(key string)
+}
+
+// MemoryValidatorStore is an in-memory ValidatorStore evicting the least
+// recently used entries.
+type MemoryValidatorStore struct {
+	maxEntries int
+
+	access  sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryValidatorEntry struct {
+	key      string
+	response *ValidatedResponse
+}
+
+// NewMemoryValidatorStore creates a MemoryValidatorStore holding at most
+// |maxEntries| responses. Zero means unlimited.
+func NewMemoryValidatorStore(maxEntries int) *MemoryValidatorStore {
+	return &MemoryValidatorStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *MemoryValidatorStore) Get(key string) (*ValidatedResponse, bool) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	element := s.entries[key]
+	if element == nil {
+		return nil, false
+	}
+	s.lru.MoveToFront(element)
+	return element.Value.(*memoryValidatorEntry).response, true
+}
+
+func (s *MemoryValidatorStore) Put(key string, response *ValidatedResponse) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	element := s.entries[key]
+	if element != nil {
+		element.Value.(*memoryValidatorEntry).response = response
+		s.lru.MoveToFront(element)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryValidatorEntry{key, response})
+	if s.maxEntries > 0 {
+		for s.lru.Len() > s.maxEntries {
+			oldest := s.lru.Back()
+			s.lru.Remove(oldest)
+			delete(s.entries, oldest.Value.(*memoryValidatorEntry).key)
+		}
+	}
+}
+
+func (s *MemoryValidatorStore) Delete(key string) {
+	s.access.Lock()
+	defer s.access.Unlock()
+	element := s.entries[key]
+	if element != nil {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+}
+
+// Len returns the number of stored responses.
+func (s *MemoryValidatorStore) Len() int {
+	s.access.Lock()
+	defer s.access.Unlock()
+	return s.lru.Len()
+}
+
+// roundTripConditional sends GET requests with the validators of a stored
+// response and answers 304 Not Modified with the stored body.
+func (t *RoundTripper) roundTripConditional(request *http.Request) (*http.Response, error) {
+	if request.Method != "" && request.Method != http.MethodGet || isConditionalRequest(request.Header) {
+		return t.roundTrip(request, nil)
+	}
+	key := request.URL.String()
+	stored, found := t.Validators.Get(key)
+	if found && !stored.matches(request.Header) {
+		found = false
+	}
+	if found {
+		request = request.Clone(request.Context())
+		if etag := stored.ETag(); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := stored.LastModified(); lastModified != "" {
+			request.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	response, err := t.roundTrip(request, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case found && response.StatusCode == http.StatusNotModified:
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		return stored.toResponse(response.Request, response.Header), nil
+	case response.StatusCode == http.StatusOK:
+		if !isValidatable(response.Header) {
+			if found {
+				t.Validators.Delete(key)
+			}
+			return response, nil
+		}
+		maxBodySize := t.ValidatorMaxBodySize
+		if maxBodySize == 0 {
+			maxBodySize = defaultValidatorMaxBodySize
+		}
+		if response.ContentLength > maxBodySize {
+			return response, nil
+		}
+		response.Body = &validatingBody{
+			ReadCloser:  response.Body,
+			maxBodySize: maxBodySize,
+			store: func(body []byte) {
+				t.Validators.Put(key, &ValidatedResponse{
+					StatusCode: response.StatusCode,
+					Header:     response.Header.Clone(),
+					Body:       body,
+					Vary:       varyValues(response.Header, request.Header),
+				})
+			},
+		}
+	}
+	return response, nil
+}
+
+func isConditionalRequest(header http.Header) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidatable(header http.Header) bool {
+	if header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return false
+	}
+	if ParseCacheControl(header).NoStore {
+		return false
+	}
+	return strings.TrimSpace(header.Get("Vary")) != "*"
+}
+
+func varyValues(responseHeader http.Header, requestHeader http.Header) map[string]string {
+	var values map[string]string
+	for _, vary := range responseHeader.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = requestHeader.Get(name)
+		}
+	}
+	return values
+}
+
+func (r *ValidatedResponse) matches(header http.Header) bool {
+	for name, value := range r.Vary {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// toResponse builds the response for a 304, with the stored headers updated
+// by those of the 304 as described in RFC 9111 section 4.3.4.
+func (r *ValidatedResponse) toResponse(request *http.Request, notModifiedHeader http.Header) *http.Response {
+	header := r.Header.Clone()
+	for name, values := range notModifiedHeader {
+		if name == "Content-Length" {
+			continue
+		}
+		header[name] = values
+	}
+	return &http.Response{
+		Status:        http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         request.Proto,
+		ProtoMajor:    request.ProtoMajor,
+		ProtoMinor:    request.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       request,
+	}
+}
+
+// validatingBody stores the response body once it has been read completely.
+type validatingBody struct {
+	io.ReadCloser
+	maxBodySize int64
+	buffer      bytes.Buffer
+	overflow    bool
+	store       func(body []byte)
+}
+
+func (b *validatingBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buffer.Len()+n) > b.maxBodySize {
+			b.overflow = true
+			b.buffer = bytes.Buffer{}
+		} else {
+			b.buffer.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow {
+		b.overflow = true
+		b.store(b.buffer.Bytes())
+	}
+	return
+}
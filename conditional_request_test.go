@@ -0,0 +1,29 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestMemoryValidatorStore(t *testing.T) {
+	store := cronet.NewMemoryValidatorStore(2)
+	store.Put("a", &cronet.ValidatedResponse{StatusCode: 200})
+	store.Put("b", &cronet.ValidatedResponse{StatusCode: 200})
+	if _, found := store.Get("a"); !found {
+		t.Fatal("missing a")
+	}
+	store.Put("c", &cronet.ValidatedResponse{StatusCode: 200})
+	if _, found := store.Get("b"); found {
+		t.Fatal("least recently used entry not evicted")
+	}
+	if store.Len() != 2 {
+		t.Fatal("bad length", store.Len())
+	}
+	store.Delete("a")
+	if _, found := store.Get("a"); found {
+		t.Fatal("deleted entry found")
+	}
+}
@@ -0,0 +1,251 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// connectionMonitorPollInterval is how often a ConnectionMonitor checks the
+// NetLog for new events.
+const connectionMonitorPollInterval = 100 * time.Millisecond
+
+const (
+	ConnectionProtocolQUIC = "quic"
+	ConnectionProtocolTCP  = "tcp"
+)
+
+// ConnectionCloseEvent is a QUIC or TCP connection that was closed with an
+// error or failed to connect.
+type ConnectionCloseEvent struct {
+	Time time.Time
+	// Protocol is ConnectionProtocolQUIC or ConnectionProtocolTCP.
+	Protocol string
+	// Remote is the server host of a QUIC session, or the address of a TCP
+	// connection if it was logged.
+	Remote string
+	// ErrorCode is the QUIC error code of a QUIC session, e.g. 25 for
+	// QUIC_NETWORK_IDLE_TIMEOUT, or the network error of a TCP connection,
+	// e.g. -101 for ERR_CONNECTION_RESET.
+	ErrorCode int
+	// Reason is the reason phrase of a QUIC session, or the name of the
+	// network error of a TCP connection.
+	Reason string
+	// FromPeer is true if the server closed or reset the connection.
+	FromPeer bool
+}
+
+// ConnectionMonitor reports connection errors of all engines to a listener,
+// independent of individual requests.
+type ConnectionMonitor struct {
+	engine   Engine
+	done     chan struct{}
+	finished chan struct{}
+	err      error
+	close    sync.Once
+}
+
+// MonitorConnections starts a NetLog at |netLogPath| and calls |listener| for
+// every connection closed with an error, on a goroutine of the monitor. QUIC
+// sessions closed without error are not reported.
+//
+// The C API has no connection events, so they are read from the NetLog while
+// it is written. The NetLog is written in batches, so events are reported
+// with a delay while there is little traffic. Only one NetLog runs per engine
+// at a time: Engine.StopNetLog ends the monitor, and Engine.LookupHost fails
+// with ErrNetLogActive while it runs.
+func (e Engine) MonitorConnections(netLogPath string, listener func(event ConnectionCloseEvent)) (*ConnectionMonitor, error) {
+	// The file is replaced asynchronously; a previous log must not be read
+	err := os.Remove(netLogPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if !e.StartNetLogToFile(netLogPath, false) {
+		return nil, errors.New("cronet: failed to start NetLog for connection monitor")
+	}
+	monitor := &ConnectionMonitor{
+		engine:   e,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go monitor.loop(netLogPath, listener)
+	return monitor, nil
+}
+
+func (m *ConnectionMonitor) loop(netLogPath string, listener func(event ConnectionCloseEvent)) {
+	defer close(m.finished)
+	reader := &netLogTailReader{path: netLogPath, done: m.done}
+	defer reader.Close()
+	m.err = readNetLog(reader, newConnectionEventHandler(listener))
+}
+
+// Close stops the NetLog and returns once the events logged until then were
+// reported. The NetLog file is left in place.
+func (m *ConnectionMonitor) Close() error {
+	m.close.Do(func() {
+		m.engine.StopNetLog()
+		close(m.done)
+	})
+	<-m.finished
+	if errors.Is(m.err, io.EOF) {
+		// Closed before the NetLog was written
+		return nil
+	}
+	return m.err
+}
+
+// ReadConnectionEvents reads the NetLog file at |path| and calls |handler|
+// for every connection closed with an error, as MonitorConnections does.
+func ReadConnectionEvents(path string, handler func(event ConnectionCloseEvent)) error {
+	return ReadNetLog(path, newConnectionEventHandler(handler))
+}
+
+// newConnectionEventHandler returns a NetLog event handler converting the
+// events of QUIC sessions and TCP sockets to ConnectionCloseEvents.
+func newConnectionEventHandler(listener func(event ConnectionCloseEvent)) func(event NetLogEvent) error {
+	remotes := make(map[int64]string)
+	return func(event NetLogEvent) error {
+		switch event.Type {
+		case "QUIC_SESSION", "QUIC_SESSION_CLOSED", "TCP_CONNECT", "TCP_CONNECT_ATTEMPT",
+			"SOCKET_CLOSED", "SOCKET_READ_ERROR", "SOCKET_WRITE_ERROR":
+		default:
+			return nil
+		}
+		var params struct {
+			Host        string   `json:"host"`
+			Address     string   `json:"address"`
+			AddressList []string `json:"address_list"`
+			QUICError   *int     `json:"quic_error"`
+			Details     string   `json:"details"`
+			FromPeer    bool     `json:"from_peer"`
+			NetError    int      `json:"net_error"`
+		}
+		if len(event.Params) > 0 {
+			// Params of other versions may not match; the fields that do are used
+			json.Unmarshal(event.Params, &params)
+		}
+		switch event.Type {
+		case "QUIC_SESSION":
+			if event.Phase == NetLogPhaseBegin && params.Host != "" {
+				remotes[event.SourceID] = params.Host
+			} else if event.Phase == NetLogPhaseEnd {
+				delete(remotes, event.SourceID)
+			}
+		case "TCP_CONNECT", "TCP_CONNECT_ATTEMPT":
+			if event.Phase == NetLogPhaseBegin {
+				if params.Address != "" {
+					remotes[event.SourceID] = params.Address
+				} else if len(params.AddressList) > 0 {
+					remotes[event.SourceID] = params.AddressList[0]
+				}
+			} else if event.Type == "TCP_CONNECT" && event.Phase == NetLogPhaseEnd && params.NetError != 0 {
+				listener(newTCPCloseEvent(event, remotes[event.SourceID], params.NetError))
+			}
+		case "SOCKET_CLOSED":
+			delete(remotes, event.SourceID)
+		case "QUIC_SESSION_CLOSED":
+			if params.QUICError == nil || *params.QUICError == 0 {
+				return nil
+			}
+			listener(ConnectionCloseEvent{
+				Time:      event.Time,
+				Protocol:  ConnectionProtocolQUIC,
+				Remote:    remotes[event.SourceID],
+				ErrorCode: *params.QUICError,
+				Reason:    params.Details,
+				FromPeer:  params.FromPeer,
+			})
+		case "SOCKET_READ_ERROR", "SOCKET_WRITE_ERROR":
+			if params.NetError != 0 {
+				listener(newTCPCloseEvent(event, remotes[event.SourceID], params.NetError))
+			}
+		}
+		return nil
+	}
+}
+
+func newTCPCloseEvent(event NetLogEvent, remote string, netError int) ConnectionCloseEvent {
+	reason, loaded := connectionNetErrors[netError]
+	if !loaded {
+		reason = "net error " + strconv.Itoa(netError)
+	}
+	return ConnectionCloseEvent{
+		Time:      event.Time,
+		Protocol:  ConnectionProtocolTCP,
+		Remote:    remote,
+		ErrorCode: netError,
+		Reason:    reason,
+		// A reset, close or refused connection is initiated by the server
+		FromPeer: netError == -100 || netError == -101 || netError == -102,
+	}
+}
+
+// connectionNetErrors are the names of the network errors of failing connections.
+var connectionNetErrors = map[int]string{
+	-7:   "ERR_TIMED_OUT",
+	-15:  "ERR_SOCKET_NOT_CONNECTED",
+	-21:  "ERR_NETWORK_CHANGED",
+	-100: "ERR_CONNECTION_CLOSED",
+	-101: "ERR_CONNECTION_RESET",
+	-102: "ERR_CONNECTION_REFUSED",
+	-103: "ERR_CONNECTION_ABORTED",
+	-104: "ERR_CONNECTION_FAILED",
+	-106: "ERR_INTERNET_DISCONNECTED",
+	-109: "ERR_ADDRESS_UNREACHABLE",
+	-118: "ERR_CONNECTION_TIMED_OUT",
+}
+
+// netLogTailReader reads a NetLog file while it is written. At the end of
+// the file it waits for more data until |done| is closed.
+type netLogTailReader struct {
+	path string
+	done chan struct{}
+	file *os.File
+}
+
+func (r *netLogTailReader) Read(p []byte) (int, error) {
+	for {
+		if r.file == nil {
+			// The file is created by the network thread after the NetLog started
+			file, err := os.Open(r.path)
+			if err == nil {
+				r.file = file
+				continue
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return 0, err
+			}
+		} else {
+			n, err := r.file.Read(p)
+			if n > 0 || err != io.EOF {
+				return n, err
+			}
+		}
+		select {
+		case <-r.done:
+			if r.file == nil {
+				return 0, io.EOF
+			}
+			// Read what was flushed when the NetLog stopped
+			n, err := r.file.Read(p)
+			if n > 0 || err != nil {
+				return n, err
+			}
+			return 0, io.EOF
+		case <-time.After(connectionMonitorPollInterval):
+		}
+	}
+}
+
+func (r *netLogTailReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,52 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadConnectionEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"QUIC_SESSION":1,"QUIC_SESSION_CLOSED":2,"TCP_CONNECT":3,"SOCKET_READ_ERROR":4},`+
+		`"logSourceType":{"QUIC_SESSION":1,"SOCKET":2},"timeTickOffset":"1700000000000"},"events":[`+
+		`{"type":1,"phase":1,"time":"1","source":{"id":1,"type":1},"params":{"host":"example.com","port":443}},`+
+		`{"type":2,"phase":0,"time":"2","source":{"id":1,"type":1},"params":{"quic_error":25,"details":"No recent network activity.","from_peer":false}},`+
+		`{"type":1,"phase":1,"time":"3","source":{"id":2,"type":1},"params":{"host":"example.org","port":443}},`+
+		`{"type":2,"phase":0,"time":"4","source":{"id":2,"type":1},"params":{"quic_error":0,"details":"","from_peer":true}},`+
+		`{"type":3,"phase":1,"time":"5","source":{"id":3,"type":2},"params":{"address_list":["192.0.2.1:443"]}},`+
+		`{"type":3,"phase":2,"time":"6","source":{"id":3,"type":2}},`+
+		`{"type":4,"phase":0,"time":"7","source":{"id":3,"type":2},"params":{"net_error":-101,"os_error":104}},`+
+		`{"type":3,"phase":1,"time":"8","source":{"id":4,"type":2},"params":{"address_list":["192.0.2.2:443"]}},`+
+		`{"type":3,"phase":2,"time":"9","source":{"id":4,"type":2},"params":{"net_error":-118}}`+
+		`]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []cronet.ConnectionCloseEvent
+	err = cronet.ReadConnectionEvents(path, func(event cronet.ConnectionCloseEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatal("bad events", events)
+	}
+	if events[0].Protocol != cronet.ConnectionProtocolQUIC || events[0].Remote != "example.com" || events[0].ErrorCode != 25 || events[0].FromPeer {
+		t.Fatal("bad QUIC event", events[0])
+	}
+	if events[1].Protocol != cronet.ConnectionProtocolTCP || events[1].Remote != "192.0.2.1:443" || events[1].Reason != "ERR_CONNECTION_RESET" || !events[1].FromPeer {
+		t.Fatal("bad TCP event", events[1])
+	}
+	if events[2].ErrorCode != -118 || events[2].Remote != "192.0.2.2:443" || events[2].FromPeer {
+		t.Fatal("bad connect event", events[2])
+	}
+	if events[2].Time.UnixMilli() != 1700000000009 {
+		t.Fatal("bad time", events[2].Time)
+	}
+}
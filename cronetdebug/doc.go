@@ -0,0 +1,20 @@
+// Package cronetdebug serves debug pages for an engine, a small
+// chrome://net-internals for servers embedding cronet-go:
+//
+//	debug := &cronetdebug.Handler{Engine: engine, StoragePath: storagePath, NetLogPath: "/tmp/netlog.json"}
+//	mux.Handle("/debug/cronet/", http.StripPrefix("/debug/cronet", debug))
+//
+// The pages show the engine stats, the active requests, the Alt-Svc and host
+// caches persisted in the storage path, and start and stop a NetLog. Every
+// page is served as JSON with the "format=json" query parameter.
+//
+// The pages expose the URLs of requests, and the actions cancel requests and
+// write files, so the handler belongs behind the authentication of an admin
+// endpoint. Actions are POST requests only. They are refused when a browser
+// sends them from another origin, as told by the Sec-Fetch-Site and Origin
+// headers, so a reverse proxy in front of the handler must keep the Host
+// header.
+//
+// The handler needs the native library and is left out of builds with the
+// cronet_nolib tag.
+package cronetdebug
@@ -0,0 +1,277 @@
+//go:build !cronet_nolib
+
+package cronetdebug
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// Handler is an http.Handler serving the debug pages of Engine. Its paths
+// are relative to where it is mounted with http.StripPrefix.
+type Handler struct {
+	Engine cronet.Engine
+	// StoragePath is the path the engine was started with, see
+	// EngineParams.SetStoragePath, to read the persisted caches from. The
+	// cache pages are empty without it.
+	StoragePath string
+	// NetLogPath is the file the NetLog is written to. Without it the NetLog
+	// cannot be started.
+	NetLogPath string
+	// NetLogAll logs the bytes transferred and cookies as well, see
+	// Engine.StartNetLogToFile.
+	NetLogAll bool
+	// AllowCancel enables canceling active requests.
+	AllowCancel bool
+
+	access        sync.Mutex
+	netLogStarted time.Time
+}
+
+type page struct {
+	Title  string
+	Path   string
+	Data   any
+	Config *Handler
+	Error  string
+}
+
+// netLogState is the state of the NetLog shown on its page.
+type netLogState struct {
+	Path    string `json:"path"`
+	Running bool   `json:"running"`
+	Started string `json:"started,omitempty"`
+	Size    int64  `json:"size"`
+}
+
+func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "no-store")
+	route := path.Clean("/" + request.URL.Path)
+	if request.Method == http.MethodPost {
+		h.serveAction(writer, request, route)
+		return
+	}
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var err error
+	current := page{Path: route, Config: h}
+	switch route {
+	case "/":
+		current.Title = "Overview"
+		current.Data = h.Engine.Stats()
+	case "/requests":
+		current.Title = "Active requests"
+		current.Data = h.Engine.ActiveRequests()
+	case "/altsvc":
+		current.Title = "Alt-Svc cache"
+		if h.StoragePath != "" {
+			current.Data, err = cronet.ReadAltSvcCache(h.StoragePath)
+		}
+	case "/dns":
+		current.Title = "Host cache"
+		if h.StoragePath != "" {
+			current.Data, err = cronet.ReadHostCache(h.StoragePath)
+		}
+	case "/netlog":
+		current.Title = "NetLog"
+		current.Data = h.netLogState()
+	case "/netlog/download":
+		h.serveNetLog(writer, request)
+		return
+	default:
+		http.NotFound(writer, request)
+		return
+	}
+	if err != nil {
+		current.Error = err.Error()
+	}
+	if request.URL.Query().Get("format") == "json" {
+		writer.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(current.Data)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	pageTemplate.Execute(writer, current)
+}
+
+// serveAction serves the POST requests changing state, redirecting back to
+// the page of the action.
+func (h *Handler) serveAction(writer http.ResponseWriter, request *http.Request, route string) {
+	if crossOrigin(request) {
+		http.Error(writer, "cross-origin request refused", http.StatusForbidden)
+		return
+	}
+	var back string
+	switch route {
+	case "/requests/cancel":
+		if !h.AllowCancel {
+			http.Error(writer, "canceling requests is not allowed", http.StatusForbidden)
+			return
+		}
+		id, err := strconv.ParseUint(request.FormValue("id"), 10, 64)
+		if err != nil {
+			http.Error(writer, "invalid request ID", http.StatusBadRequest)
+			return
+		}
+		if !h.Engine.CancelRequest(cronet.RequestID(id)) {
+			http.Error(writer, "request not active", http.StatusNotFound)
+			return
+		}
+		back = "../requests"
+	case "/netlog/start":
+		if h.NetLogPath == "" {
+			http.Error(writer, "no NetLog path configured", http.StatusForbidden)
+			return
+		}
+		h.access.Lock()
+		started := h.Engine.StartNetLogToFile(h.NetLogPath, h.NetLogAll)
+		if started && h.netLogStarted.IsZero() {
+			h.netLogStarted = time.Now()
+		}
+		h.access.Unlock()
+		if !started {
+			http.Error(writer, "failed to start NetLog", http.StatusInternalServerError)
+			return
+		}
+		back = "../netlog"
+	case "/netlog/stop":
+		h.access.Lock()
+		h.Engine.StopNetLog()
+		h.netLogStarted = time.Time{}
+		h.access.Unlock()
+		back = "../netlog"
+	default:
+		http.NotFound(writer, request)
+		return
+	}
+	http.Redirect(writer, request, back, http.StatusSeeOther)
+}
+
+// crossOrigin reports whether a browser sent |request| from another site,
+// from its Sec-Fetch-Site header or else its Origin header. Requests with
+// neither, e.g. from curl, are not cross-origin.
+func crossOrigin(request *http.Request) bool {
+	switch request.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return false
+	case "":
+	default:
+		return true
+	}
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	parsed, err := url.Parse(origin)
+	return err != nil || parsed.Host != request.Host
+}
+
+func (h *Handler) netLogState() netLogState {
+	h.access.Lock()
+	state := netLogState{Path: h.NetLogPath, Running: !h.netLogStarted.IsZero()}
+	if state.Running {
+		state.Started = h.netLogStarted.Format(time.RFC3339)
+	}
+	h.access.Unlock()
+	if info, err := os.Stat(h.NetLogPath); h.NetLogPath != "" && err == nil {
+		state.Size = info.Size()
+	}
+	return state
+}
+
+// serveNetLog serves the NetLog file once it is stopped, when it is
+// complete JSON.
+func (h *Handler) serveNetLog(writer http.ResponseWriter, request *http.Request) {
+	if h.NetLogPath == "" {
+		http.NotFound(writer, request)
+		return
+	}
+	h.access.Lock()
+	running := !h.netLogStarted.IsZero()
+	h.access.Unlock()
+	if running {
+		http.Error(writer, "stop the NetLog first", http.StatusConflict)
+		return
+	}
+	writer.Header().Set("Content-Disposition", `attachment; filename="netlog.json"`)
+	http.ServeFile(writer, request, h.NetLogPath)
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"percent": func(ratio float64) string {
+		return strconv.FormatFloat(ratio*100, 'f', 1, 64) + "%"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>cronet: {{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; margin-top: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<nav><a href="./">Overview</a><a href="requests">Active requests</a><a href="altsvc">Alt-Svc cache</a><a href="dns">Host cache</a><a href="netlog">NetLog</a></nav>
+<h1>{{.Title}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if eq .Path "/"}}{{with .Data}}
+<table>
+<tr><th>Active requests</th><td>{{.ActiveRequests}}</td></tr>
+<tr><th>Succeeded</th><td>{{.SucceededRequests}}</td></tr>
+<tr><th>Failed</th><td>{{.FailedRequests}}</td></tr>
+<tr><th>Canceled</th><td>{{.CanceledRequests}}</td></tr>
+<tr><th>Responses</th><td>{{.Responses}}</td></tr>
+<tr><th>Cache hit ratio</th><td>{{percent .CacheHitRatio}}</td></tr>
+{{range $protocol, $count := .ResponsesByProtocol}}<tr><th>Responses over {{$protocol}}</th><td>{{$count}}</td></tr>
+{{end}}<tr><th>Bytes received</th><td>{{.BytesReceived}}</td></tr>
+</table>
+{{end}}{{else if eq .Path "/requests"}}
+<table>
+<tr><th>ID</th><th>Method</th><th>URL</th><th>Elapsed</th><th>Bytes received</th>{{if $.Config.AllowCancel}}<th></th>{{end}}</tr>
+{{range .Data}}<tr><td>{{.ID}}</td><td>{{.Method}}</td><td>{{.URL}}</td><td>{{duration .Elapsed}}</td><td>{{.BytesReceived}}</td>{{if $.Config.AllowCancel}}<td><form method="post" action="requests/cancel"><input type="hidden" name="id" value="{{.ID}}"><button>Cancel</button></form></td>{{end}}</tr>
+{{end}}</table>
+{{else if eq .Path "/altsvc"}}{{if not .Config.StoragePath}}<p>No storage path configured.</p>{{end}}
+<table>
+<tr><th>Origin</th><th>Protocol</th><th>Host</th><th>Port</th><th>Expiration</th></tr>
+{{range .Data}}<tr><td>{{.Origin}}</td><td>{{.Protocol}}</td><td>{{.Host}}</td><td>{{.Port}}</td><td>{{.Expiration}}</td></tr>
+{{end}}</table>
+{{else if eq .Path "/dns"}}{{if not .Config.StoragePath}}<p>No storage path configured.</p>{{end}}
+<table>
+<tr><th>Host</th><th>Query type</th><th>Addresses</th><th>Error</th><th>Expiration</th></tr>
+{{range .Data}}<tr><td>{{.Hostname}}</td><td>{{.QueryType}}</td><td>{{range .Addresses}}{{.}} {{end}}</td><td>{{if .NetError}}{{.NetError}}{{end}}</td><td>{{.Expiration}}</td></tr>
+{{end}}</table>
+{{else if eq .Path "/netlog"}}{{with .Data}}
+{{if not .Path}}<p>No NetLog path configured.</p>{{else}}
+<p>{{.Path}}: {{if .Running}}running since {{.Started}}{{else}}stopped{{end}}, {{.Size}} bytes</p>
+{{if .Running}}<form method="post" action="netlog/stop"><button>Stop</button></form>
+{{else}}<form method="post" action="netlog/start"><button>Start</button></form>{{if .Size}}<p><a href="netlog/download">Download</a></p>{{end}}
+{{end}}{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,109 @@
+//go:build !cronet_nolib
+
+package cronetdebug_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronetdebug"
+)
+
+func TestHandler(t *testing.T) {
+	storagePath := t.TempDir()
+	params := cronet.NewEngineParams()
+	params.SetStoragePath(storagePath)
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	netLogPath := filepath.Join(t.TempDir(), "netlog.json")
+	mux := http.NewServeMux()
+	mux.Handle("/debug/cronet/", http.StripPrefix("/debug/cronet", &cronetdebug.Handler{
+		Engine:      engine,
+		StoragePath: storagePath,
+		NetLogPath:  netLogPath,
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		response, err := http.Get(server.URL + "/debug/cronet" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		return response.StatusCode, string(body)
+	}
+	for _, path := range []string{"/", "/requests", "/altsvc", "/dns", "/netlog"} {
+		status, body := get(path)
+		if status != http.StatusOK || !strings.Contains(body, "</html>") {
+			t.Errorf("%s: unexpected page %d %q", path, status, body)
+		}
+	}
+	if status, _ := get("/missing"); status != http.StatusNotFound {
+		t.Error("unexpected status of a missing page", status)
+	}
+
+	status, body := get("/?format=json")
+	var stats cronet.EngineStats
+	if err := json.Unmarshal([]byte(body), &stats); status != http.StatusOK || err != nil {
+		t.Errorf("unexpected stats %d %q: %v", status, body, err)
+	}
+
+	post := func(path string) int {
+		response, err := http.Post(server.URL+"/debug/cronet"+path, "application/x-www-form-urlencoded", strings.NewReader("id=1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	crossOriginPost := func(path string, header string, value string) int {
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/debug/cronet"+path, nil)
+		request.Header.Set(header, value)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	if status := crossOriginPost("/netlog/start", "Sec-Fetch-Site", "cross-site"); status != http.StatusForbidden {
+		t.Error("cross-site action allowed", status)
+	}
+	if status := crossOriginPost("/netlog/start", "Origin", "https://attacker.example"); status != http.StatusForbidden {
+		t.Error("cross-origin action allowed", status)
+	}
+	if status := crossOriginPost("/netlog/stop", "Origin", server.URL); status != http.StatusOK {
+		t.Error("same-origin action refused", status)
+	}
+	if status := post("/requests/cancel"); status != http.StatusForbidden {
+		t.Error("cancel allowed without AllowCancel", status)
+	}
+	if status := post("/netlog/start"); status != http.StatusOK {
+		t.Fatal("failed to start NetLog", status)
+	}
+	if status, _ := get("/netlog/download"); status != http.StatusConflict {
+		t.Error("running NetLog downloaded", status)
+	}
+	if status := post("/netlog/stop"); status != http.StatusOK {
+		t.Fatal("failed to stop NetLog", status)
+	}
+	if _, err := os.Stat(netLogPath); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get("/netlog/download"); status != http.StatusOK || !strings.Contains(body, "constants") {
+		t.Errorf("unexpected NetLog %d %.100q", status, body)
+	}
+}
@@ -0,0 +1,138 @@
+// Package cronetgrpc runs gRPC calls over Cronet bidirectional streams, so
+// generated gRPC-Go clients use Cronet's HTTP/2, HTTP/3 and proxy support.
+//
+// Replace grpc.Dial with Dial and pass the returned ClientConn to the
+// generated client constructor:
+//
+//	conn, err := cronetgrpc.Dial(engine, "https://example.com")
+//	client := pb.NewGreeterClient(conn)
+//
+// Messages are encoded with protobuf.
+package cronetgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/sagernet/cronet-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ grpc.ClientConnInterface = (*ClientConn)(nil)
+
+var ErrClientConnClosed = errors.New("cronetgrpc: client connection closed")
+
+// ClientConn is a grpc.ClientConnInterface sending every call as a
+// bidirectional stream of the Cronet engine.
+type ClientConn struct {
+	engine    cronet.StreamEngine
+	target    string
+	userAgent string
+
+	access  sync.Mutex
+	closed  bool
+	streams map[*clientStream]struct{}
+}
+
+// DialOption configures a ClientConn.
+type DialOption func(conn *ClientConn)
+
+// WithUserAgent sets the user-agent sent with each call.
+func WithUserAgent(userAgent string) DialOption {
+	return func(conn *ClientConn) {
+		conn.userAgent = userAgent
+	}
+}
+
+// Dial creates a ClientConn for |target|, an https URL of the gRPC server such
+// as "https://example.com:443". No connection is made until the first call.
+// The engine must be started and outlive the ClientConn.
+func Dial(engine cronet.Engine, target string, options ...DialOption) (*ClientConn, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetURL.Scheme != "https" || targetURL.Host == "" {
+		return nil, errors.New("cronetgrpc: target must be an https URL")
+	}
+	conn := &ClientConn{
+		engine:    engine.StreamEngine(),
+		target:    strings.TrimSuffix(target, "/"),
+		userAgent: "grpc-go-cronet",
+		streams:   make(map[*clientStream]struct{}),
+	}
+	for _, option := range options {
+		option(conn)
+	}
+	return conn, nil
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (c *ClientConn) Invoke(ctx context.Context, method string, args any, reply any, opts ...grpc.CallOption) error {
+	stream, err := c.newStream(ctx, method, opts)
+	if err != nil {
+		return err
+	}
+	err = stream.SendMsg(args)
+	if err != nil {
+		return stream.finish(err)
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return stream.finish(err)
+	}
+	err = stream.RecvMsg(reply)
+	if err == io.EOF {
+		return status.Error(codes.Internal, "cronetgrpc: no response message")
+	}
+	if err != nil {
+		return err
+	}
+	return stream.finish(stream.recvEnd())
+}
+
+// NewStream implements grpc.ClientConnInterface.
+func (c *ClientConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.newStream(ctx, method, opts)
+}
+
+// Close cancels all active calls. The engine is not shut down.
+func (c *ClientConn) Close() error {
+	c.access.Lock()
+	if c.closed {
+		c.access.Unlock()
+		return ErrClientConnClosed
+	}
+	c.closed = true
+	streams := c.streams
+	c.streams = nil
+	c.access.Unlock()
+	for stream := range streams {
+		stream.conn.Close()
+	}
+	return nil
+}
+
+func (c *ClientConn) register(stream *clientStream) bool {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.closed {
+		return false
+	}
+	c.streams[stream] = struct{}{}
+	return true
+}
+
+func (c *ClientConn) unregister(stream *clientStream) {
+	c.access.Lock()
+	defer c.access.Unlock()
+	if c.streams != nil {
+		delete(c.streams, stream)
+	}
+}
@@ -0,0 +1,362 @@
+package cronetgrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultMaxRecvMsgSize = 4 * 1024 * 1024
+	messagePrefixSize     = 5
+)
+
+type clientStream struct {
+	ctx    context.Context
+	client *ClientConn
+	conn   *cronet.BidirectionalConn
+
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	headerAddrs    []*metadata.MD
+	trailerAddrs   []*metadata.MD
+
+	headerOnce sync.Once
+	header     metadata.MD
+	headerErr  error
+
+	finishOnce sync.Once
+	trailer    metadata.MD
+}
+
+func (c *ClientConn) newStream(ctx context.Context, method string, opts []grpc.CallOption) (*clientStream, error) {
+	if ctx.Err() != nil {
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	stream := &clientStream{
+		ctx:            ctx,
+		client:         c,
+		maxRecvMsgSize: defaultMaxRecvMsgSize,
+		maxSendMsgSize: -1,
+	}
+	for _, opt := range opts {
+		switch option := opt.(type) {
+		case grpc.HeaderCallOption:
+			stream.headerAddrs = append(stream.headerAddrs, option.HeaderAddr)
+		case grpc.TrailerCallOption:
+			stream.trailerAddrs = append(stream.trailerAddrs, option.TrailerAddr)
+		case grpc.MaxRecvMsgSizeCallOption:
+			stream.maxRecvMsgSize = option.MaxRecvMsgSize
+		case grpc.MaxSendMsgSizeCallOption:
+			stream.maxSendMsgSize = option.MaxSendMsgSize
+		}
+	}
+
+	headers := map[string]string{
+		"content-type": "application/grpc+proto",
+		"te":           "trailers",
+		"user-agent":   c.userAgent,
+	}
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		headers["grpc-timeout"] = encodeTimeout(time.Until(deadline))
+	}
+	outgoing, _ := metadata.FromOutgoingContext(ctx)
+	addMetadata(headers, outgoing)
+
+	stream.conn = c.engine.CreateConn(true, false)
+	if !c.register(stream) {
+		stream.conn.Close()
+		return nil, status.Error(codes.Canceled, ErrClientConnClosed.Error())
+	}
+	err := stream.conn.Start("POST", c.target+method, headers, 0, false)
+	if err != nil {
+		return nil, stream.finish(status.Error(codes.Unavailable, err.Error()))
+	}
+	go stream.monitorContext()
+	return stream, nil
+}
+
+func (s *clientStream) monitorContext() {
+	select {
+	case <-s.ctx.Done():
+		s.conn.Close()
+	case <-s.conn.Done():
+	}
+}
+
+// Header implements grpc.ClientStream.
+func (s *clientStream) Header() (metadata.MD, error) {
+	s.headerOnce.Do(func() {
+		headers, err := s.conn.WaitForHeaders()
+		if err != nil {
+			s.headerErr = s.transportError(err)
+			return
+		}
+		s.header = toMetadata(headers)
+	})
+	return s.header, s.headerErr
+}
+
+// Trailer implements grpc.ClientStream. It is only valid after RecvMsg
+// returned io.EOF or an error.
+func (s *clientStream) Trailer() metadata.MD {
+	return s.trailer
+}
+
+// CloseSend implements grpc.ClientStream.
+func (s *clientStream) CloseSend() error {
+	err := s.conn.CloseWrite()
+	if err != nil {
+		return s.transportError(err)
+	}
+	return nil
+}
+
+// Context implements grpc.ClientStream.
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+// SendMsg implements grpc.ClientStream.
+func (s *clientStream) SendMsg(m any) error {
+	message, isMessage := m.(proto.Message)
+	if !isMessage {
+		return status.Errorf(codes.Internal, "cronetgrpc: message %T is not a proto.Message", m)
+	}
+	payload, err := proto.Marshal(message)
+	if err != nil {
+		return status.Errorf(codes.Internal, "cronetgrpc: marshal: %v", err)
+	}
+	if s.maxSendMsgSize >= 0 && len(payload) > s.maxSendMsgSize {
+		return status.Errorf(codes.ResourceExhausted, "cronetgrpc: message larger than max (%d vs. %d)", len(payload), s.maxSendMsgSize)
+	}
+	frame := make([]byte, messagePrefixSize+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	copy(frame[messagePrefixSize:], payload)
+	_, err = s.conn.Write(frame)
+	if err != nil {
+		return s.transportError(err)
+	}
+	return nil
+}
+
+// RecvMsg implements grpc.ClientStream.
+func (s *clientStream) RecvMsg(m any) error {
+	message, isMessage := m.(proto.Message)
+	if !isMessage {
+		return s.finish(status.Errorf(codes.Internal, "cronetgrpc: message %T is not a proto.Message", m))
+	}
+	payload, err := s.readMessage()
+	if err != nil {
+		return s.finish(err)
+	}
+	err = proto.Unmarshal(payload, message)
+	if err != nil {
+		return s.finish(status.Errorf(codes.Internal, "cronetgrpc: unmarshal: %v", err))
+	}
+	return nil
+}
+
+// recvEnd reads the end of a unary response, which must not contain
+// another message.
+func (s *clientStream) recvEnd() error {
+	_, err := s.readMessage()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return status.Error(codes.Internal, "cronetgrpc: too many response messages")
+}
+
+// readMessage returns the next message payload, io.EOF if the call finished
+// with an OK status, or the status error of the call.
+func (s *clientStream) readMessage() ([]byte, error) {
+	_, err := s.Header()
+	if err != nil {
+		return nil, err
+	}
+	var prefix [messagePrefixSize]byte
+	n, err := io.ReadFull(s.conn, prefix[:])
+	if err != nil {
+		if n == 0 && s.conn.Err() == io.EOF {
+			return nil, s.callStatus()
+		}
+		return nil, s.transportError(err)
+	}
+	if prefix[0] != 0 {
+		return nil, status.Error(codes.Internal, "cronetgrpc: compressed messages are not supported")
+	}
+	length := int(binary.BigEndian.Uint32(prefix[1:]))
+	if length > s.maxRecvMsgSize {
+		return nil, status.Errorf(codes.ResourceExhausted, "cronetgrpc: received message larger than max (%d vs. %d)", length, s.maxRecvMsgSize)
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(s.conn, payload)
+	if err != nil {
+		return nil, s.transportError(err)
+	}
+	return payload, nil
+}
+
+// callStatus returns the status sent in the trailers, or in the headers for
+// trailers-only responses.
+func (s *clientStream) callStatus() error {
+	trailers := s.conn.Trailers()
+	var headers map[string]string
+	if trailers == nil {
+		headers, _ = s.conn.WaitForHeaders()
+	}
+	trailer, err := parseCallStatus(headers, trailers)
+	if trailer != nil {
+		s.trailer = trailer
+	}
+	return err
+}
+
+// parseCallStatus returns the trailer metadata and the status of a call from
+// its |trailers|, or from its |headers| if it had none. The status is io.EOF
+// for OK.
+func parseCallStatus(headers, trailers map[string]string) (metadata.MD, error) {
+	if trailers == nil {
+		if _, hasStatus := headers["grpc-status"]; hasStatus {
+			trailers = headers
+		} else if httpStatus := headers[":status"]; httpStatus != "" && httpStatus != "200" {
+			return nil, status.Errorf(codes.Unknown, "cronetgrpc: unexpected HTTP status %s", httpStatus)
+		}
+	}
+	trailer := toMetadata(trailers)
+	code, err := strconv.Atoi(trailers["grpc-status"])
+	if err != nil {
+		return trailer, status.Error(codes.Internal, "cronetgrpc: missing grpc-status")
+	}
+	if codes.Code(code) == codes.OK {
+		return trailer, io.EOF
+	}
+	message, err := url.PathUnescape(trailers["grpc-message"])
+	if err != nil {
+		message = trailers["grpc-message"]
+	}
+	return trailer, status.Error(codes.Code(code), message)
+}
+
+func (s *clientStream) transportError(err error) error {
+	return transportStatus(s.ctx, err, s.callStatus)
+}
+
+// transportStatus maps an error of the stream to a status error: the error of
+// |ctx| once it is done, the status of the call if the stream ended before it
+// was expected to, and Unavailable otherwise.
+func transportStatus(ctx context.Context, err error, callStatus func() error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if _, isStatus := status.FromError(err); isStatus {
+		return err
+	}
+	if errors.Is(err, io.EOF) {
+		if statusErr := callStatus(); statusErr != io.EOF {
+			return statusErr
+		}
+	}
+	return status.Error(codes.Unavailable, err.Error())
+}
+
+// finish releases the stream once it completed and stores the metadata
+// requested by call options. It returns err unchanged.
+func (s *clientStream) finish(err error) error {
+	s.finishOnce.Do(func() {
+		s.client.unregister(s)
+		if err != nil && err != io.EOF {
+			s.conn.Close()
+		}
+		for _, addr := range s.headerAddrs {
+			*addr = s.header
+		}
+		for _, addr := range s.trailerAddrs {
+			*addr = s.trailer
+		}
+	})
+	return err
+}
+
+// addMetadata adds the outgoing metadata |md| to |headers|, base64-encoding
+// the values of binary keys. Pseudo-headers are not sent.
+func addMetadata(headers map[string]string, md metadata.MD) {
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || len(values) == 0 {
+			continue
+		}
+		if strings.HasSuffix(key, "-bin") {
+			encoded := make([]string, len(values))
+			for i, value := range values {
+				encoded[i] = base64.RawStdEncoding.EncodeToString([]byte(value))
+			}
+			values = encoded
+		}
+		headers[key] = strings.Join(values, ",")
+	}
+}
+
+func toMetadata(headers map[string]string) metadata.MD {
+	md := make(metadata.MD, len(headers))
+	for key, value := range headers {
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		key = strings.ToLower(key)
+		if strings.HasSuffix(key, "-bin") {
+			decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+			if err == nil {
+				value = string(decoded)
+			}
+		}
+		md[key] = append(md[key], value)
+	}
+	return md
+}
+
+// encodeTimeout formats a grpc-timeout header value, which allows at most
+// eight digits.
+func encodeTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "1n"
+	}
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"n", time.Nanosecond},
+		{"u", time.Microsecond},
+		{"m", time.Millisecond},
+		{"S", time.Second},
+		{"M", time.Minute},
+		{"H", time.Hour},
+	}
+	for _, unit := range units {
+		value := timeout / unit.unit
+		if timeout%unit.unit != 0 {
+			value++
+		}
+		if value <= 99999999 {
+			return fmt.Sprintf("%d%s", value, unit.suffix)
+		}
+	}
+	return "99999999H"
+}
@@ -0,0 +1,173 @@
+package cronetgrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestEncodeTimeout(t *testing.T) {
+	for _, testCase := range []struct {
+		timeout time.Duration
+		encoded string
+	}{
+		{0, "1n"},
+		{time.Nanosecond, "1n"},
+		{99999999 * time.Nanosecond, "99999999n"},
+		{100 * time.Millisecond, "100000u"},
+		{time.Hour, "3600000m"},
+		{1000 * time.Hour, "3600000S"},
+	} {
+		encoded := encodeTimeout(testCase.timeout)
+		if encoded != testCase.encoded {
+			t.Errorf("encodeTimeout(%v) = %s, want %s", testCase.timeout, encoded, testCase.encoded)
+		}
+	}
+}
+
+func TestParseCallStatus(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		headers  map[string]string
+		trailers map[string]string
+		code     codes.Code
+		message  string
+		trailer  metadata.MD
+	}{
+		{
+			name:     "ok",
+			headers:  map[string]string{":status": "200"},
+			trailers: map[string]string{"grpc-status": "0", "x-trace": "1"},
+			code:     codes.OK,
+			trailer:  metadata.MD{"grpc-status": {"0"}, "x-trace": {"1"}},
+		},
+		{
+			name:     "error with escaped message",
+			trailers: map[string]string{"grpc-status": "5", "grpc-message": "not%20found%3A%20a%2Fb"},
+			code:     codes.NotFound,
+			message:  "not found: a/b",
+			trailer:  metadata.MD{"grpc-status": {"5"}, "grpc-message": {"not%20found%3A%20a%2Fb"}},
+		},
+		{
+			name:     "message not percent-encoded",
+			trailers: map[string]string{"grpc-status": "13", "grpc-message": "100%"},
+			code:     codes.Internal,
+			message:  "100%",
+			trailer:  metadata.MD{"grpc-status": {"13"}, "grpc-message": {"100%"}},
+		},
+		{
+			name:    "trailers-only",
+			headers: map[string]string{":status": "200", "grpc-status": "7", "grpc-message": "denied"},
+			code:    codes.PermissionDenied,
+			message: "denied",
+			trailer: metadata.MD{"grpc-status": {"7"}, "grpc-message": {"denied"}},
+		},
+		{
+			name:    "HTTP error",
+			headers: map[string]string{":status": "503"},
+			code:    codes.Unknown,
+			message: "cronetgrpc: unexpected HTTP status 503",
+		},
+		{
+			name:    "missing status",
+			headers: map[string]string{":status": "200"},
+			code:    codes.Internal,
+			message: "cronetgrpc: missing grpc-status",
+			trailer: metadata.MD{},
+		},
+		{
+			name:     "invalid status",
+			trailers: map[string]string{"grpc-status": "ok"},
+			code:     codes.Internal,
+			message:  "cronetgrpc: missing grpc-status",
+			trailer:  metadata.MD{"grpc-status": {"ok"}},
+		},
+	} {
+		trailer, err := parseCallStatus(testCase.headers, testCase.trailers)
+		if testCase.code == codes.OK {
+			if err != io.EOF {
+				t.Errorf("%s: expected io.EOF, got %v", testCase.name, err)
+			}
+		} else if callStatus, isStatus := status.FromError(err); !isStatus || callStatus.Code() != testCase.code || callStatus.Message() != testCase.message {
+			t.Errorf("%s: unexpected status %v", testCase.name, err)
+		}
+		if !reflect.DeepEqual(trailer, testCase.trailer) {
+			t.Errorf("%s: unexpected trailer %v", testCase.name, trailer)
+		}
+	}
+}
+
+func TestMetadataEncoding(t *testing.T) {
+	headers := make(map[string]string)
+	addMetadata(headers, metadata.MD{
+		"x-values":  {"a", "b"},
+		"x-key-bin": {"\x00\xff binary"},
+		"x-empty":   {},
+		":path":     {"/other"},
+	})
+	expected := map[string]string{
+		"x-values":  "a,b",
+		"x-key-bin": base64.RawStdEncoding.EncodeToString([]byte("\x00\xff binary")),
+	}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	for _, testCase := range []struct {
+		headers map[string]string
+		md      metadata.MD
+	}{
+		{map[string]string{":status": "200", "Content-Type": "application/grpc"}, metadata.MD{"content-type": {"application/grpc"}}},
+		{map[string]string{"x-key-bin": headers["x-key-bin"]}, metadata.MD{"x-key-bin": {"\x00\xff binary"}}},
+		// Padded values are accepted too
+		{map[string]string{"x-key-bin": base64.StdEncoding.EncodeToString([]byte("ab"))}, metadata.MD{"x-key-bin": {"ab"}}},
+		// Values that are not base64 are kept as sent
+		{map[string]string{"x-key-bin": "not base64!"}, metadata.MD{"x-key-bin": {"not base64!"}}},
+	} {
+		md := toMetadata(testCase.headers)
+		if !reflect.DeepEqual(md, testCase.md) {
+			t.Errorf("toMetadata(%v) = %v, want %v", testCase.headers, md, testCase.md)
+		}
+	}
+}
+
+func TestTransportStatus(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	notFound := status.Error(codes.NotFound, "not found")
+	callStatus := func(err error) func() error {
+		return func() error {
+			return err
+		}
+	}
+	for _, testCase := range []struct {
+		name       string
+		ctx        context.Context
+		err        error
+		callStatus error
+		code       codes.Code
+	}{
+		{"canceled", canceled, errors.New("stream closed"), nil, codes.Canceled},
+		{"deadline", expired, errors.New("stream closed"), nil, codes.DeadlineExceeded},
+		{"status", context.Background(), notFound, nil, codes.NotFound},
+		{"truncated", context.Background(), io.ErrUnexpectedEOF, notFound, codes.Unavailable},
+		{"ended early", context.Background(), io.EOF, notFound, codes.NotFound},
+		{"ended early with OK", context.Background(), io.EOF, io.EOF, codes.Unavailable},
+		{"network error", context.Background(), errors.New("connection reset"), nil, codes.Unavailable},
+	} {
+		err := transportStatus(testCase.ctx, testCase.err, callStatus(testCase.callStatus))
+		if code := status.Code(err); code != testCase.code {
+			t.Errorf("%s: got %v, want code %v", testCase.name, err, testCase.code)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package cronettest answers the requests of a cronet.RoundTripper with
+// canned responses, so tests of code built on cronet-go run without network
+// access and without starting an engine:
+//
+//	interceptor := cronettest.NewInterceptor()
+//	interceptor.On(http.MethodGet, "https://example.com/api").
+//		WithHeader("Authorization", "Bearer token").
+//		RespondString(http.StatusOK, `{"ok":true}`)
+//	transport := &cronet.RoundTripper{Interceptor: interceptor}
+//
+// Rules match in the order they were added. Requests no rule matches fail
+// with an error wrapping ErrNoMatch, so a test cannot reach the network by
+// accident.
+//
+// A Recorder answers requests with the responses a real RoundTripper
+// returned when they were recorded instead.
+package cronettest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var ErrNoMatch = errors.New("cronettest: no rule matches the request")
+
+// Request is a request the interceptor received, with its body read.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+	// Rule is the rule that answered the request, nil if none matched.
+	Rule *Rule
+}
+
+// Interceptor is an http.RoundTripper answering requests by its rules. It
+// is safe for concurrent use.
+type Interceptor struct {
+	access   sync.Mutex
+	rules    []*Rule
+	requests []Request
+}
+
+func NewInterceptor() *Interceptor {
+	return &Interceptor{}
+}
+
+// On adds a rule matching requests with |method| to |rawURL|. An empty
+// method matches every method. The scheme, host and path of the URL have to
+// be equal; its query, if any, has to be equal as well, in any order.
+func (i *Interceptor) On(method string, rawURL string) *Rule {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		panic(fmt.Sprintf("cronettest: invalid URL %q: %v", rawURL, err))
+	}
+	return i.OnMatch(func(request *http.Request) bool {
+		if method != "" && request.Method != method {
+			return false
+		}
+		return matchURL(target, request.URL)
+	})
+}
+
+// OnMatch adds a rule matching the requests for which |match| returns true.
+// |match| runs with the interceptor locked and must not call it.
+func (i *Interceptor) OnMatch(match func(request *http.Request) bool) *Rule {
+	rule := &Rule{interceptor: i, match: match, times: -1}
+	i.access.Lock()
+	i.rules = append(i.rules, rule)
+	i.access.Unlock()
+	return rule
+}
+
+// Requests returns the requests received so far, oldest first.
+func (i *Interceptor) Requests() []Request {
+	i.access.Lock()
+	defer i.access.Unlock()
+	return append([]Request(nil), i.requests...)
+}
+
+// Unmatched returns the requests no rule matched.
+func (i *Interceptor) Unmatched() []Request {
+	var unmatched []Request
+	for _, request := range i.Requests() {
+		if request.Rule == nil {
+			unmatched = append(unmatched, request)
+		}
+	}
+	return unmatched
+}
+
+// Pending returns the rules limited with Times that were used fewer times
+// than expected.
+func (i *Interceptor) Pending() []*Rule {
+	i.access.Lock()
+	defer i.access.Unlock()
+	var pending []*Rule
+	for _, rule := range i.rules {
+		if rule.times > 0 && rule.used < rule.times {
+			pending = append(pending, rule)
+		}
+	}
+	return pending
+}
+
+// Reset removes the rules and the recorded requests.
+func (i *Interceptor) Reset() {
+	i.access.Lock()
+	i.rules = nil
+	i.requests = nil
+	i.access.Unlock()
+}
+
+func (i *Interceptor) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Matchers may read the body as well
+	request = request.Clone(request.Context())
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	i.access.Lock()
+	var rule *Rule
+	for _, candidate := range i.rules {
+		if candidate.times >= 0 && candidate.used >= candidate.times {
+			continue
+		}
+		if candidate.matches(request, body) {
+			rule = candidate
+			rule.used++
+			break
+		}
+	}
+	i.requests = append(i.requests, Request{
+		Method: request.Method,
+		URL:    request.URL,
+		Header: request.Header.Clone(),
+		Body:   body,
+		Rule:   rule,
+	})
+	i.access.Unlock()
+
+	if rule == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, request.Method, request.URL)
+	}
+	if err := request.Context().Err(); err != nil {
+		return nil, err
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	return rule.respond(request)
+}
+
+// matchURL reports whether |actual| is the URL |target| describes.
+func matchURL(target *url.URL, actual *url.URL) bool {
+	if !strings.EqualFold(target.Scheme, actual.Scheme) || !strings.EqualFold(target.Host, actual.Host) {
+		return false
+	}
+	targetPath, actualPath := target.EscapedPath(), actual.EscapedPath()
+	if targetPath == "" {
+		targetPath = "/"
+	}
+	if actualPath == "" {
+		actualPath = "/"
+	}
+	if targetPath != actualPath {
+		return false
+	}
+	if target.RawQuery == "" {
+		return true
+	}
+	return target.Query().Encode() == actual.Query().Encode()
+}
@@ -0,0 +1,77 @@
+package cronettest_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestInterceptor(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	once := interceptor.On(http.MethodGet, "https://example.com/api?b=2&a=1").
+		Times(1).
+		RespondString(http.StatusCreated, "first")
+	interceptor.On(http.MethodGet, "https://example.com/api").
+		WithHeader("Authorization", "Bearer token").
+		Respond(http.StatusOK, http.Header{"Content-Type": {"application/json"}}, []byte(`{"ok":true}`))
+	interceptor.On(http.MethodPost, "https://example.com/upload").
+		WithBody(func(body []byte) bool { return bytes.Equal(body, []byte("data")) }).
+		RespondWith(func(request *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(request.Body)
+			return &http.Response{StatusCode: http.StatusAccepted, Body: io.NopCloser(bytes.NewReader(body)), Request: request}, nil
+		})
+	interceptor.On("", "https://example.com/down").RespondError(io.ErrUnexpectedEOF)
+	client := &http.Client{Transport: interceptor}
+
+	response, err := client.Get("https://example.com/api?a=1&b=2")
+	if err != nil || response.StatusCode != http.StatusCreated {
+		t.Fatal("expected the first rule", response, err)
+	}
+	response.Body.Close()
+	if once.Used() != 1 || len(interceptor.Pending()) != 0 {
+		t.Error("rule not used once", once.Used())
+	}
+
+	// The first rule is used up, and the second needs the header
+	if _, err := client.Get("https://example.com/api?a=1&b=2"); !errors.Is(err, cronettest.ErrNoMatch) {
+		t.Error("expected ErrNoMatch, got", err)
+	}
+	request, _ := http.NewRequest(http.MethodGet, "https://example.com/api", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	response, err = client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.Header.Get("Content-Type") != "application/json" || string(body) != `{"ok":true}` {
+		t.Error("unexpected response", response.Header, string(body))
+	}
+
+	response, err = client.Post("https://example.com/upload", "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusAccepted || string(body) != "data" {
+		t.Error("handler did not see the body", response.StatusCode, string(body))
+	}
+
+	if _, err := client.Get("https://example.com/down"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expected the rule error, got", err)
+	}
+
+	requests := interceptor.Requests()
+	if len(requests) != 5 || string(requests[3].Body) != "data" {
+		t.Fatal("unexpected requests", requests)
+	}
+	if unmatched := interceptor.Unmatched(); len(unmatched) != 1 || unmatched[0].URL.RawQuery != "a=1&b=2" {
+		t.Error("unexpected unmatched requests", unmatched)
+	}
+}
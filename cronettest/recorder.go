@@ -0,0 +1,337 @@
+package cronettest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// RecorderMode selects whether a Recorder sends requests or replays them.
+type RecorderMode int
+
+const (
+	// ModeReplay answers requests from the cassette only. Requests without an
+	// unused recording fail with an error wrapping ErrNoMatch.
+	ModeReplay RecorderMode = iota
+	// ModeRecord sends every request and records it, replacing the cassette.
+	ModeRecord
+	// ModeReplayOrRecord replays the recorded requests and sends and records
+	// the others, e.g. while adding requests to a test.
+	ModeReplayOrRecord
+)
+
+// redactedValue replaces redacted header values in cassettes.
+const redactedValue = "REDACTED"
+
+// DefaultRedactedHeaders are the headers whose values a Recorder without
+// RedactHeaders leaves out of cassettes.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Cassette is a recording of requests and their responses, stored as JSON.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request with its response, or the error sending
+// it failed with.
+type Interaction struct {
+	Request  RecordedRequest   `json:"request"`
+	Response *RecordedResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// RecordedRequest is a request as stored in a cassette.
+type RecordedRequest struct {
+	Method string       `json:"method"`
+	URL    string       `json:"url"`
+	Header http.Header  `json:"header,omitempty"`
+	Body   RecordedBody `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response as stored in a cassette.
+type RecordedResponse struct {
+	StatusCode int          `json:"status_code"`
+	Header     http.Header  `json:"header,omitempty"`
+	Body       RecordedBody `json:"body,omitempty"`
+	// Protocol is the negotiated protocol of the response as reported by
+	// the TLS state of the RoundTripper, "h3", "h2" or "http/1.1", or empty
+	// if unknown, e.g. for plain HTTP.
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// RecordedBody is a body, stored as text if it is valid UTF-8 and as base64
+// otherwise.
+type RecordedBody []byte
+
+type recordedBodyJSON struct {
+	Text   string `json:"text,omitempty"`
+	Base64 string `json:"base64,omitempty"`
+}
+
+func (b RecordedBody) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(recordedBodyJSON{Text: string(b)})
+	}
+	return json.Marshal(recordedBodyJSON{Base64: base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *RecordedBody) UnmarshalJSON(content []byte) error {
+	var body recordedBodyJSON
+	if err := json.Unmarshal(content, &body); err != nil {
+		return err
+	}
+	if body.Base64 == "" {
+		*b = RecordedBody(body.Text)
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body.Base64)
+	*b = decoded
+	return err
+}
+
+// Recorder records the requests sent with its transport and their responses
+// to a cassette file and replays them, so tests of code built on cronet-go
+// run against real server responses without the network. Unlike responses
+// recorded with net/http, those of a cronet.RoundTripper keep the protocol
+// Cronet negotiated, which replayed responses report in their TLS state.
+//
+//	recorder, err := cronettest.NewRecorder("testdata/api.json", cronettest.ModeReplay, &cronet.RoundTripper{})
+//	client := &http.Client{Transport: recorder}
+//	...
+//	err = recorder.Save()
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	// RedactHeaders are the request and response headers whose values are
+	// replaced in the cassette. Nil means DefaultRedactedHeaders.
+	RedactHeaders []string
+	// Redact, if set, removes secrets from an interaction before it is
+	// stored, e.g. tokens in URLs or bodies. Set Match as well if it changes
+	// what the default matching compares.
+	Redact func(interaction *Interaction)
+	// Match reports whether |request| with |body| is the recorded request.
+	// Nil compares the method, the URL and the body.
+	Match func(request *http.Request, body []byte, recorded RecordedRequest) bool
+
+	path      string
+	mode      RecorderMode
+	transport http.RoundTripper
+
+	access   sync.Mutex
+	cassette Cassette
+	used     []bool
+	changed  bool
+}
+
+// NewRecorder returns a recorder of the cassette at |path| in |mode|, which
+// sends requests with |transport| when recording. In ModeReplay, the
+// cassette has to exist.
+func NewRecorder(path string, mode RecorderMode, transport http.RoundTripper) (*Recorder, error) {
+	recorder := &Recorder{path: path, mode: mode, transport: transport}
+	if mode == ModeRecord {
+		return recorder, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if mode == ModeReplayOrRecord && os.IsNotExist(err) {
+			return recorder, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &recorder.cassette); err != nil {
+		return nil, fmt.Errorf("cronettest: invalid cassette %s: %w", path, err)
+	}
+	recorder.used = make([]bool, len(recorder.cassette.Interactions))
+	return recorder, nil
+}
+
+func (r *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mode != ModeRecord {
+		if interaction, found := r.replay(request, body); found {
+			return replayResponse(request, interaction)
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s not recorded in %s", ErrNoMatch, request.Method, request.URL, r.path)
+		}
+	}
+	if r.transport == nil {
+		return nil, errors.New("cronettest: recording without a transport")
+	}
+	return r.record(request, body)
+}
+
+// replay returns the first unused recording of |request| and marks it used.
+func (r *Recorder) replay(request *http.Request, body []byte) (*Interaction, bool) {
+	r.access.Lock()
+	defer r.access.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !r.matches(request, body, interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+		return interaction, true
+	}
+	return nil, false
+}
+
+func (r *Recorder) matches(request *http.Request, body []byte, recorded RecordedRequest) bool {
+	if r.Match != nil {
+		return r.Match(request, body, recorded)
+	}
+	return request.Method == recorded.Method && request.URL.String() == recorded.URL && bytes.Equal(body, recorded.Body)
+}
+
+// record sends |request| and adds it and its response to the cassette.
+func (r *Recorder) record(request *http.Request, body []byte) (*http.Response, error) {
+	outgoing := request.Clone(request.Context())
+	if request.Body != nil {
+		outgoing.Body = io.NopCloser(bytes.NewReader(body))
+		outgoing.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: request.Method,
+			URL:    request.URL.String(),
+			Header: request.Header.Clone(),
+			Body:   body,
+		},
+	}
+	response, err := r.transport.RoundTrip(outgoing)
+	if err == nil {
+		var responseBody []byte
+		responseBody, err = io.ReadAll(response.Body)
+		response.Body.Close()
+		response.Body = io.NopCloser(bytes.NewReader(responseBody))
+		interaction.Response = &RecordedResponse{
+			StatusCode: response.StatusCode,
+			Header:     response.Header.Clone(),
+			Body:       responseBody,
+		}
+		if state := cronet.ResponseTLSState(response); state != nil {
+			interaction.Response.Protocol = state.NegotiatedProtocol
+		}
+	}
+	if err != nil {
+		interaction.Response = nil
+		interaction.Error = err.Error()
+	}
+	r.redact(interaction)
+
+	r.access.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.used = append(r.used, true)
+	r.changed = true
+	r.access.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// redact removes the secrets from |interaction|.
+func (r *Recorder) redact(interaction *Interaction) {
+	headers := r.RedactHeaders
+	if headers == nil {
+		headers = DefaultRedactedHeaders
+	}
+	redactHeader := func(header http.Header) {
+		for _, name := range headers {
+			if values := header.Values(name); len(values) > 0 {
+				redacted := make([]string, len(values))
+				for i := range redacted {
+					redacted[i] = redactedValue
+				}
+				header[http.CanonicalHeaderKey(name)] = redacted
+			}
+		}
+	}
+	redactHeader(interaction.Request.Header)
+	if interaction.Response != nil {
+		redactHeader(interaction.Response.Header)
+	}
+	if r.Redact != nil {
+		r.Redact(interaction)
+	}
+}
+
+// Save writes the cassette if requests were recorded since it was loaded.
+func (r *Recorder) Save() error {
+	r.access.Lock()
+	defer r.access.Unlock()
+	if !r.changed {
+		return nil
+	}
+	content, err := json.MarshalIndent(&r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	r.changed = false
+	return nil
+}
+
+// replayResponse returns the response of |interaction| to |request|.
+func replayResponse(request *http.Request, interaction *Interaction) (*http.Response, error) {
+	if interaction.Response == nil {
+		return nil, errors.New(interaction.Error)
+	}
+	recorded := interaction.Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	response := &http.Response{
+		Status:        strconv.Itoa(recorded.StatusCode) + " " + http.StatusText(recorded.StatusCode),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       request,
+	}
+	switch recorded.Protocol {
+	case "h2":
+		response.Proto, response.ProtoMajor, response.ProtoMinor = "HTTP/2.0", 2, 0
+	case "h3":
+		response.Proto, response.ProtoMajor, response.ProtoMinor = "HTTP/3.0", 3, 0
+	}
+	if request.URL.Scheme == "https" {
+		response.TLS = &tls.ConnectionState{
+			HandshakeComplete:  true,
+			ServerName:         request.URL.Hostname(),
+			NegotiatedProtocol: recorded.Protocol,
+		}
+		if recorded.Protocol == "h3" {
+			// QUIC always uses TLS 1.3
+			response.TLS.Version = tls.VersionTLS13
+		}
+	}
+	return response, nil
+}
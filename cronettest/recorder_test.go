@@ -0,0 +1,86 @@
+package cronettest_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		writer.Header().Set("Set-Cookie", "session=secret")
+		writer.Header().Set("Content-Type", "application/octet-stream")
+		writer.Write(append([]byte{0xff, 0x00}, body...))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := cronettest.NewRecorder(cassette, cronettest.ModeRecord, server.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: recorder}
+	send := func(client *http.Client) (*http.Response, []byte, error) {
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/echo", strings.NewReader("hello"))
+		request.Header.Set("Authorization", "Bearer token")
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		return response, body, err
+	}
+	recorded, recordedBody, err := send(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.TLS == nil || recorded.TLS.NegotiatedProtocol != "h2" {
+		t.Fatal("expected HTTP/2 from the server", recorded.TLS)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret") || strings.Contains(string(content), "Bearer") {
+		t.Error("secrets not redacted:", string(content))
+	}
+
+	server.Close()
+	replayer, err := cronettest.NewRecorder(cassette, cronettest.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &http.Client{Transport: replayer}
+	response, body, err := send(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != recorded.StatusCode || string(body) != string(recordedBody) {
+		t.Error("unexpected replayed response", response.StatusCode, body)
+	}
+	if response.TLS == nil || response.TLS.NegotiatedProtocol != "h2" || response.ProtoMajor != 2 {
+		t.Error("protocol not replayed", response.Proto, response.TLS)
+	}
+	if response.Header.Get("Set-Cookie") != "REDACTED" || response.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Error("unexpected replayed header", response.Header)
+	}
+
+	// Each recording replays once
+	if _, _, err := send(client); !errors.Is(err, cronettest.ErrNoMatch) {
+		t.Error("expected ErrNoMatch, got", err)
+	}
+}
@@ -0,0 +1,136 @@
+package cronettest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Rule matches requests and answers them. Its methods configure it and
+// return it for chaining; configure a rule before requests are sent.
+type Rule struct {
+	interceptor *Interceptor
+
+	match   func(request *http.Request) bool
+	headers http.Header
+	body    func(body []byte) bool
+
+	// times is the number of requests the rule answers, -1 for any.
+	times int
+	used  int
+
+	status         int
+	responseHeader http.Header
+	responseBody   []byte
+	err            error
+	handler        func(request *http.Request) (*http.Response, error)
+}
+
+// WithHeader additionally requires the request header |name| to have
+// |value| among its values.
+func (r *Rule) WithHeader(name string, value string) *Rule {
+	if r.headers == nil {
+		r.headers = make(http.Header)
+	}
+	r.headers.Add(name, value)
+	return r
+}
+
+// WithBody additionally requires the request body to satisfy |match|.
+func (r *Rule) WithBody(match func(body []byte) bool) *Rule {
+	r.body = match
+	return r
+}
+
+// Times limits the rule to the next |count| matching requests. Later ones
+// fall through to the following rules.
+func (r *Rule) Times(count int) *Rule {
+	r.times = count
+	return r
+}
+
+// Respond answers with |status|, |header| and |body|.
+func (r *Rule) Respond(status int, header http.Header, body []byte) *Rule {
+	r.status = status
+	r.responseHeader = header.Clone()
+	r.responseBody = body
+	return r
+}
+
+// RespondString answers with |status| and the text |body|.
+func (r *Rule) RespondString(status int, body string) *Rule {
+	return r.Respond(status, nil, []byte(body))
+}
+
+// RespondError fails the requests with |err|, as a network error would.
+func (r *Rule) RespondError(err error) *Rule {
+	r.err = err
+	return r
+}
+
+// RespondWith answers with |handler|, e.g. to build the response from the
+// request. The request body can be read again.
+func (r *Rule) RespondWith(handler func(request *http.Request) (*http.Response, error)) *Rule {
+	r.handler = handler
+	return r
+}
+
+// Used returns the number of requests the rule answered.
+func (r *Rule) Used() int {
+	r.interceptor.access.Lock()
+	defer r.interceptor.access.Unlock()
+	return r.used
+}
+
+func (r *Rule) matches(request *http.Request, body []byte) bool {
+	if !r.match(request) {
+		return false
+	}
+	for name, values := range r.headers {
+		for _, value := range values {
+			if !containsValue(request.Header.Values(name), value) {
+				return false
+			}
+		}
+	}
+	return r.body == nil || r.body(body)
+}
+
+func (r *Rule) respond(request *http.Request) (*http.Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.handler != nil {
+		return r.handler(request)
+	}
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := r.responseHeader.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.responseBody)),
+		ContentLength: int64(len(r.responseBody)),
+		Request:       request,
+	}, nil
+}
+
+func containsValue(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.TrimSpace(candidate) == value {
+			return true
+		}
+	}
+	return false
+}
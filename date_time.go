@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -29,3 +31,12 @@ func (t DateTime) SetValue(value time.Time) {
 func (t DateTime) Value() time.Time {
 	return time.UnixMilli(int64(C.Cronet_DateTime_value_get(t.ptr)))
 }
+
+// value returns the time of |t|, or the zero time if |t| is null, as metrics
+// that were not recorded are.
+func (t DateTime) value() time.Time {
+	if t.ptr == nil {
+		return time.Time{}
+	}
+	return t.Value()
+}
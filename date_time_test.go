@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet_test
 
 import (
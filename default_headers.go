@@ -0,0 +1,98 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"net/http"
+	"strings"
+	"unsafe"
+)
+
+// The C API has no request headers of an engine besides the User-Agent and
+// Accept-Language, so default headers are kept on the Go side and added to
+// the parameters of each request in URLRequest.InitWithParams.
+var (
+	engineParamsDefaultHeaders  handleRegistry[http.Header]
+	engineDefaultHeaders        handleRegistry[http.Header]
+	requestParamsRemovedHeaders handleRegistry[[]string]
+)
+
+// SetDefaultHeaders sets headers added to every request of the engine
+// started with these parameters, e.g. Authorization or telemetry headers.
+// A header of the same name set on a request replaces the default, and
+// URLRequestParams.RemoveDefaultHeader leaves it out. With RoundTripper, a
+// header present in http.Request.Header without values leaves it out, as
+// with the User-Agent of net/http. A nil or empty |header| clears the
+// defaults.
+func (p EngineParams) SetDefaultHeaders(header http.Header) {
+	key := uintptr(unsafe.Pointer(p.ptr))
+	if len(header) == 0 {
+		engineParamsDefaultHeaders.delete(key)
+		return
+	}
+	engineParamsDefaultHeaders.store(key, header.Clone())
+}
+
+// DefaultHeaders returns a copy of the headers set with SetDefaultHeaders.
+func (p EngineParams) DefaultHeaders() http.Header {
+	header, _ := engineParamsDefaultHeaders.load(uintptr(unsafe.Pointer(p.ptr)))
+	return header.Clone()
+}
+
+// DefaultHeaders returns a copy of the default headers the engine was
+// started with.
+func (e Engine) DefaultHeaders() http.Header {
+	header, _ := engineDefaultHeaders.load(uintptr(unsafe.Pointer(e.ptr)))
+	return header.Clone()
+}
+
+// RemoveDefaultHeader leaves the default header |name| of the engine out of
+// the request.
+func (p URLRequestParams) RemoveDefaultHeader(name string) {
+	key := uintptr(unsafe.Pointer(p.ptr))
+	removed, _ := requestParamsRemovedHeaders.load(key)
+	requestParamsRemovedHeaders.store(key, append(removed[:len(removed):len(removed)], name))
+}
+
+// startDefaultHeaders gives |engine| the default headers of |params| it was
+// started with.
+func startDefaultHeaders(engine Engine, params EngineParams) {
+	if header, loaded := engineParamsDefaultHeaders.load(uintptr(unsafe.Pointer(params.ptr))); loaded {
+		engineDefaultHeaders.store(uintptr(unsafe.Pointer(engine.ptr)), header)
+	}
+}
+
+// cloneRemovedHeaders gives |clone| the removed default headers of |params|.
+func cloneRemovedHeaders(params URLRequestParams, clone URLRequestParams) {
+	if removed, loaded := requestParamsRemovedHeaders.load(uintptr(unsafe.Pointer(params.ptr))); loaded {
+		requestParamsRemovedHeaders.store(uintptr(unsafe.Pointer(clone.ptr)), removed)
+	}
+}
+
+// addDefaultHeaders adds the default headers of |engine| to |params|, except
+// those |params| sets or removes.
+func addDefaultHeaders(engine Engine, params URLRequestParams) {
+	defaults, loaded := engineDefaultHeaders.load(uintptr(unsafe.Pointer(engine.ptr)))
+	if !loaded {
+		return
+	}
+	skip := make(map[string]bool)
+	removed, _ := requestParamsRemovedHeaders.load(uintptr(unsafe.Pointer(params.ptr)))
+	for _, name := range removed {
+		skip[strings.ToLower(name)] = true
+	}
+	headerLen := params.HeaderSize()
+	for i := 0; i < headerLen; i++ {
+		skip[strings.ToLower(params.HeaderAt(i).Name())] = true
+	}
+	var headers packedHeaders
+	for name, values := range defaults {
+		if skip[strings.ToLower(name)] {
+			continue
+		}
+		for _, value := range values {
+			headers.add(name, value)
+		}
+	}
+	params.addPackedHeaders(&headers)
+}
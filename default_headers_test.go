@@ -0,0 +1,60 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestDefaultHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Authorization", request.Header.Get("Authorization"))
+		writer.Header().Set("X-Telemetry", request.Header.Get("X-Telemetry"))
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	params.SetDefaultHeaders(http.Header{
+		"Authorization": {"Bearer default"},
+		"X-Telemetry":   {"on"},
+	})
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+	if engine.DefaultHeaders().Get("X-Telemetry") != "on" {
+		t.Fatal("engine lost the default headers", engine.DefaultHeaders())
+	}
+
+	client := &http.Client{Transport: &cronet.RoundTripper{Engine: engine}}
+	send := func(header http.Header) http.Header {
+		request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		return response.Header
+	}
+
+	header := send(nil)
+	if header.Get("X-Authorization") != "Bearer default" || header.Get("X-Telemetry") != "on" {
+		t.Error("defaults not sent", header)
+	}
+	header = send(http.Header{"Authorization": {"Bearer request"}})
+	if header.Get("X-Authorization") != "Bearer request" || header.Get("X-Telemetry") != "on" {
+		t.Error("default not overridden", header)
+	}
+	header = send(http.Header{"X-Telemetry": nil})
+	if header.Get("X-Authorization") != "Bearer default" || header.Get("X-Telemetry") != "" {
+		t.Error("default not removed", header)
+	}
+}
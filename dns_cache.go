@@ -0,0 +1,141 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// StaleDNSOptions configures the use of expired host cache entries. The time
+// an entry is fresh is the TTL of its DNS records; Cronet has no setting to
+// override it.
+type StaleDNSOptions struct {
+	// Delay is how long a request waits for a fresh resolution before it
+	// uses a stale address. Zero uses stale addresses immediately.
+	Delay time.Duration
+	// MaxExpiredTime is how long after expiry an entry may still be used.
+	// Zero means no limit.
+	MaxExpiredTime time.Duration
+	// MaxStaleUses is how often an expired entry may be used. Zero means no limit.
+	MaxStaleUses int
+	// AllowOtherNetwork allows entries resolved on another network.
+	AllowOtherNetwork bool
+	// UseStaleOnNameNotResolved falls back to a stale entry when the fresh
+	// resolution fails.
+	UseStaleOnNameNotResolved bool
+	// PersistToDisk stores the host cache in the storage path, so it survives
+	// restarts and can be read with ReadHostCache. Requires
+	// EngineParams.SetStoragePath.
+	PersistToDisk bool
+	// PersistDelay is the minimum time between writes of the host cache.
+	// Zero uses the Cronet default of one minute.
+	PersistDelay time.Duration
+}
+
+// SetStaleDNS enables the use of stale host cache entries with |options|, or
+// disables it if |options| is nil.
+func (p EngineParams) SetStaleDNS(options *StaleDNSOptions) error {
+	if options == nil {
+		return p.SetExperimentalOption("StaleDNS", nil)
+	}
+	staleDNS := map[string]any{
+		"enable":                         true,
+		"delay_ms":                       options.Delay.Milliseconds(),
+		"max_expired_time_ms":            options.MaxExpiredTime.Milliseconds(),
+		"max_stale_uses":                 options.MaxStaleUses,
+		"allow_other_network":            options.AllowOtherNetwork,
+		"use_stale_on_name_not_resolved": options.UseStaleOnNameNotResolved,
+		"persist_to_disk":                options.PersistToDisk,
+	}
+	if options.PersistDelay > 0 {
+		staleDNS["persist_delay_ms"] = options.PersistDelay.Milliseconds()
+	}
+	return p.SetExperimentalOption("StaleDNS", staleDNS)
+}
+
+// HostCacheEntry is a host resolution persisted by an engine with
+// StaleDNSOptions.PersistToDisk.
+type HostCacheEntry struct {
+	Hostname string
+	// QueryType is the DNS query type, e.g. 0 for unspecified (A and AAAA)
+	// or 1 for A.
+	QueryType int
+	// Addresses are the resolved addresses, empty if the resolution failed.
+	Addresses []string
+	// NetError is the network error of a failed resolution, e.g. -105 for
+	// ERR_NAME_NOT_RESOLVED, otherwise zero.
+	NetError   int
+	Expiration time.Time
+}
+
+// ReadHostCache returns the host cache the engine persisted in |storagePath|,
+// for debugging resolution issues. The cache is written at most every
+// StaleDNSOptions.PersistDelay, so recent resolutions may be missing.
+//
+// The C API has no access to the in-memory cache of a running engine, nor a
+// way to flush it; ClearHostCache only removes the persisted copy, and
+// ReloadableTransport.FlushDNSCache replaces the engine to empty both.
+func ReadHostCache(storagePath string) ([]HostCacheEntry, error) {
+	prefs, err := readLocalPrefs(storagePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	netPrefs, _ := prefs["net"].(map[string]any)
+	rawEntries, _ := netPrefs["host_cache"].([]any)
+	var entries []HostCacheEntry
+	for _, rawEntry := range rawEntries {
+		fields, isObject := rawEntry.(map[string]any)
+		if !isObject {
+			continue
+		}
+		var entry HostCacheEntry
+		entry.Hostname, _ = fields["hostname"].(string)
+		entry.QueryType = prefsInt(fields["dns_query_type"])
+		entry.NetError = prefsInt(fields["net_error"])
+		expiration, _ := fields["expiration"].(string)
+		if microseconds, err := strconv.ParseInt(expiration, 10, 64); err == nil {
+			entry.Expiration = time.UnixMicro(microseconds - windowsEpochOffset)
+		}
+		// Current versions store IP endpoints, older ones plain addresses
+		endpoints, _ := fields["ip_endpoints"].([]any)
+		for _, rawEndpoint := range endpoints {
+			endpoint, _ := rawEndpoint.(map[string]any)
+			if address, _ := endpoint["address"].(string); address != "" {
+				entry.Addresses = append(entry.Addresses, address)
+			}
+		}
+		addresses, _ := fields["addresses"].([]any)
+		for _, rawAddress := range addresses {
+			if address, _ := rawAddress.(string); address != "" {
+				entry.Addresses = append(entry.Addresses, address)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ClearHostCache removes the persisted host cache from |storagePath|, so the
+// next engine started on it resolves all hosts afresh. The engine must not be
+// running on |storagePath|.
+func ClearHostCache(storagePath string) error {
+	prefs, err := readLocalPrefs(storagePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	netPrefs, _ := prefs["net"].(map[string]any)
+	if _, loaded := netPrefs["host_cache"]; !loaded {
+		return nil
+	}
+	delete(netPrefs, "host_cache")
+	return writeLocalPrefs(storagePath, prefs)
+}
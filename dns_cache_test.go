@@ -0,0 +1,97 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestHostCache(t *testing.T) {
+	storagePath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(storagePath, "prefs"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(storagePath, "prefs", "local_prefs.json"), []byte(`{"net":{"host_cache":[`+
+		`{"hostname":"example.com","dns_query_type":0,"expiration":"13370000000000000","ip_endpoints":[{"address":"192.0.2.1","port":0},{"address":"2001:db8::1","port":0}]},`+
+		`{"hostname":"missing.example","dns_query_type":1,"net_error":-105,"expiration":"13370000000000000"}`+
+		`],"http_server_properties":{"servers":[],"version":5}}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := cronet.ReadHostCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("bad entries", entries)
+	}
+	if entries[0].Hostname != "example.com" || len(entries[0].Addresses) != 2 || entries[0].Addresses[1] != "2001:db8::1" {
+		t.Fatal("bad entry", entries[0])
+	}
+	if entries[0].Expiration.Year() != 2024 {
+		t.Fatal("bad expiration", entries[0].Expiration)
+	}
+	if entries[1].NetError != -105 || entries[1].QueryType != 1 || len(entries[1].Addresses) != 0 {
+		t.Fatal("bad entry", entries[1])
+	}
+	err = cronet.ClearHostCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = cronet.ReadHostCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatal("entries left after clear", entries)
+	}
+	altSvcEntries, err := cronet.ReadAltSvcCache(storagePath)
+	if err != nil || altSvcEntries != nil {
+		t.Fatal("other prefs changed", altSvcEntries, err)
+	}
+}
+
+func TestReloadableTransportFlushDNSCache(t *testing.T) {
+	storagePath := t.TempDir()
+	err := os.MkdirAll(filepath.Join(storagePath, "prefs"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(storagePath, "prefs", "local_prefs.json"), []byte(`{"net":{"host_cache":[`+
+		`{"hostname":"example.com","dns_query_type":0,"expiration":"99999999999999999","ip_endpoints":[{"address":"192.0.2.1","port":0}]}]}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := cronet.NewEngineParams()
+	defer params.Destroy()
+	params.SetStoragePath(storagePath)
+	if err = params.SetStaleDNS(&cronet.StaleDNSOptions{PersistToDisk: true}); err != nil {
+		t.Fatal(err)
+	}
+	transport, err := cronet.NewReloadableTransport(params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	previous := transport.Engine()
+
+	// The running engine keeps the cache, so the flush replaces it first
+	if err = transport.FlushDNSCache(params); err != nil {
+		t.Fatal(err)
+	}
+	if transport.Engine() == previous {
+		t.Fatal("expected a new engine")
+	}
+	entries, err := cronet.ReadHostCache(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatal("entries left after flush", entries)
+	}
+}
@@ -0,0 +1,194 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// dnsPrefetchPollInterval is how often PrefetchDNS checks whether a host is
+// still being resolved.
+const dnsPrefetchPollInterval = 5 * time.Millisecond
+
+// DNSPrefetchResult is the outcome of prefetching one host with Engine.PrefetchDNS.
+type DNSPrefetchResult struct {
+	Host string
+	// Err is nil if the host was resolved and is in the host cache of the
+	// engine, an *ErrorGo if resolution failed, or the context error.
+	Err error
+}
+
+// PrefetchDNS resolves |hosts| in the native resolver, so the addresses are
+// cached by the time a burst of requests to them starts. The returned channel
+// receives one result per host and is closed once all of them completed or
+// |ctx| is done.
+//
+// The C API has no resolver access, so each host is resolved by starting a
+// HEAD request to https://host/ that is canceled as soon as it leaves the
+// host resolution state. The request is sent to the server if connecting
+// completes before it is canceled, so do not prefetch hosts that must not
+// see it; it carries none of the engine default headers set with
+// EngineParams.SetDefaultHeaders. The connection it started may complete in
+// the background and be reused by a later request.
+func (e Engine) PrefetchDNS(ctx context.Context, hosts []string) <-chan DNSPrefetchResult {
+	results := make(chan DNSPrefetchResult, len(hosts))
+	executor := newGoroutineExecutor()
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			results <- DNSPrefetchResult{Host: host, Err: e.prefetchHost(ctx, executor, host)}
+		}(host)
+	}
+	go func() {
+		wg.Wait()
+		executor.Destroy()
+		close(results)
+	}()
+	return results
+}
+
+// newGoroutineExecutor returns an executor running each command on a new goroutine.
+func newGoroutineExecutor() Executor {
+	return NewExecutor(func(executor Executor, command Runnable) {
+		go func() {
+			command.Run()
+			command.Destroy()
+		}()
+	})
+}
+
+func (e Engine) prefetchHost(ctx context.Context, executor Executor, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		return nil
+	}
+	handler := &dnsPrefetchHandler{done: make(chan struct{})}
+	callback := NewURLRequestCallback(handler)
+	defer callback.Destroy()
+	params := NewURLRequestParams()
+	params.SetMethod("HEAD")
+	// Credentials in the default headers must not go to an arbitrary host
+	for name := range e.DefaultHeaders() {
+		params.RemoveDefaultHeader(name)
+	}
+	request := NewURLRequest()
+	handler.request = request
+	target := url.URL{Scheme: "https", Host: host, Path: "/"}
+	result := request.InitWithParams(e, target.String(), params, callback, executor)
+	params.Destroy()
+	if result != ResultSuccess {
+		request.Destroy()
+		return initResultError(result)
+	}
+	request.Start()
+
+	ticker := time.NewTicker(dnsPrefetchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-handler.done:
+			return handler.err
+		case <-ctx.Done():
+			handler.cancel(ctx.Err())
+			<-handler.done
+			return handler.err
+		case <-ticker.C:
+			handler.pollStatus()
+		}
+	}
+}
+
+type dnsPrefetchHandler struct {
+	access   sync.Mutex
+	request  URLRequest
+	finished bool
+	resolved bool
+	err      error
+	done     chan struct{}
+}
+
+func (h *dnsPrefetchHandler) pollStatus() {
+	h.access.Lock()
+	defer h.access.Unlock()
+	if h.finished {
+		return
+	}
+	h.request.GetStatus(NewURLRequestStatusListener(func(self URLRequestStatusListener, status URLRequestStatusListenerStatus) {
+		self.Destroy()
+		if status >= URLRequestStatusListenerStatusConnecting {
+			h.markResolved()
+			h.cancel(nil)
+		}
+	}))
+}
+
+func (h *dnsPrefetchHandler) markResolved() {
+	h.access.Lock()
+	h.resolved = true
+	h.access.Unlock()
+}
+
+// cancel stops the request, which finishes with |err|.
+func (h *dnsPrefetchHandler) cancel(err error) {
+	h.access.Lock()
+	defer h.access.Unlock()
+	if h.finished {
+		return
+	}
+	if h.err == nil {
+		h.err = err
+	}
+	h.request.Cancel()
+}
+
+func (h *dnsPrefetchHandler) finish(request URLRequest, err error) {
+	h.access.Lock()
+	defer h.access.Unlock()
+	if h.finished {
+		return
+	}
+	h.finished = true
+	if h.err == nil && !h.resolved {
+		h.err = err
+	}
+	request.Destroy()
+	close(h.done)
+}
+
+func (h *dnsPrefetchHandler) OnRedirectReceived(self URLRequestCallback, request URLRequest, info URLResponseInfo, newLocationUrl string) {
+	h.markResolved()
+	request.Cancel()
+}
+
+func (h *dnsPrefetchHandler) OnResponseStarted(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
+	h.markResolved()
+	request.Cancel()
+}
+
+func (h *dnsPrefetchHandler) OnReadCompleted(self URLRequestCallback, request URLRequest, info URLResponseInfo, buffer Buffer, bytesRead int64) {
+}
+
+func (h *dnsPrefetchHandler) OnSucceeded(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
+	h.finish(request, nil)
+}
+
+func (h *dnsPrefetchHandler) OnFailed(self URLRequestCallback, request URLRequest, info URLResponseInfo, error Error) {
+	err := ErrorFromError(error)
+	switch err.ErrorCode {
+	case ErrorCodeErrorConnectionClosed, ErrorCodeErrorConnectionRefused, ErrorCodeErrorConnectionReset,
+		ErrorCodeErrorConnectionTimedOut, ErrorCodeErrorAddressUnreachable:
+		// These fail the connection to an address the host resolved to
+		h.finish(request, nil)
+	default:
+		h.finish(request, err)
+	}
+}
+
+func (h *dnsPrefetchHandler) OnCanceled(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
+	h.finish(request, nil)
+}
@@ -0,0 +1,88 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestPrefetchDNS(t *testing.T) {
+	var access sync.Mutex
+	var authorizations []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		access.Lock()
+		authorizations = append(authorizations, request.Method+" "+request.Header.Get("Authorization"))
+		access.Unlock()
+	}))
+	server.StartTLS()
+	defer server.Close()
+
+	// The test certificate is valid for example.com
+	engine := cronet.NewEngine()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if !engine.SetTrustedRootCertificates(string(certificate)) {
+		t.Fatal("failed to trust test certificate")
+	}
+	params := cronet.NewEngineParams()
+	params.SetDefaultHeaders(http.Header{"Authorization": {"Bearer secret"}})
+	if err := params.SetHostResolverRules("MAP example.com " + server.Listener.Addr().String() + ", MAP unresolvable.test ~NOTFOUND"); err != nil {
+		t.Fatal(err)
+	}
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer func() {
+		engine.Shutdown()
+		engine.Destroy()
+	}()
+
+	results := make(map[string]error)
+	for result := range engine.PrefetchDNS(context.Background(), []string{"example.com", "unresolvable.test", "192.0.2.1"}) {
+		results[result.Host] = result.Err
+	}
+	if len(results) != 3 {
+		t.Fatal("expected one result per host, got", results)
+	}
+	if err := results["example.com"]; err != nil {
+		t.Error("unexpected error resolving example.com:", err)
+	}
+	if err := results["192.0.2.1"]; err != nil {
+		t.Error("unexpected error for an address literal:", err)
+	}
+	var nativeErr *cronet.ErrorGo
+	if err := results["unresolvable.test"]; !errors.As(err, &nativeErr) {
+		t.Error("expected a native error for an unresolvable host, got", err)
+	}
+
+	// A prefetch reaching the server carries no default headers, unlike requests
+	request, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	access.Lock()
+	defer access.Unlock()
+	requests := 0
+	for _, authorization := range authorizations {
+		switch authorization {
+		case "GET Bearer secret":
+			requests++
+		case "HEAD ":
+		default:
+			t.Error("unexpected request", authorization)
+		}
+	}
+	if requests != 1 {
+		t.Error("expected the default header on the request, got", authorizations)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -16,18 +18,42 @@ type Engine struct {
 	ptr C.Cronet_EnginePtr
 }
 
+// NewEngine creates an engine holding a reference to the native library, see
+// InitLibrary. Any number of engines may coexist, each with its own
+// configuration, as long as they use different storage paths.
 func NewEngine() Engine {
-	return Engine{C.Cronet_Engine_Create()}
+	return newLibraryEngine()
 }
 
 func (e Engine) Destroy() {
+	engineDefaultHeaders.delete(uintptr(unsafe.Pointer(e.ptr)))
+	engineRequestPolicy.delete(uintptr(unsafe.Pointer(e.ptr)))
+	engineStatsRegistry.delete(uintptr(unsafe.Pointer(e.ptr)))
+	engineNetLogs.delete(uintptr(unsafe.Pointer(e.ptr)))
+	deleteEngineAnnotations(e)
+	releaseLibraryEngine(e)
 	C.Cronet_Engine_Destroy(e.ptr)
 }
 
 // StartWithParams starts Engine using given |params|. The engine must be started once
 // and only once before other methods can be used.
+//
+// If another engine uses the storage path of |params|, ResultIllegalStateStoragePathInUse
+// is returned without starting the engine, instead of aborting the process.
 func (e Engine) StartWithParams(params EngineParams) Result {
-	return Result(C.Cronet_Engine_StartWithParams(e.ptr, params.ptr))
+	if !claimStoragePath(e, params.StoragePath()) {
+		return ResultIllegalStateStoragePathInUse
+	}
+	result := Result(C.Cronet_Engine_StartWithParams(e.ptr, params.ptr))
+	if result != ResultSuccess && result != ResultIllegalStateEngineAlreadyStarted {
+		releaseStoragePath(e)
+	}
+	if result == ResultSuccess {
+		startDefaultHeaders(e, params)
+		startRequestPolicy(e, params)
+		startEngineStats(e)
+	}
+	return result
 }
 
 // StartNetLogToFile starts NetLog logging to a file. The NetLog will contain events emitted
@@ -47,14 +73,22 @@ func (e Engine) StartNetLogToFile(fileName string, logAll bool) bool {
 	cPath := C.CString(fileName)
 	result := C.Cronet_Engine_StartNetLogToFile(e.ptr, cPath, C.bool(logAll))
 	C.free(unsafe.Pointer(cPath))
+	if result {
+		engineNetLogs.store(uintptr(unsafe.Pointer(e.ptr)), fileName)
+	}
 	return bool(result)
 }
 
+// engineNetLogs holds the file of the running NetLog of each engine, as the
+// C API cannot tell whether one is running.
+var engineNetLogs handleRegistry[string]
+
 // StopNetLog Stops NetLog logging and flushes file to disk. If a logging session is
 // not in progress, this call is ignored. This method blocks until the log is
 // closed to ensure that log file is complete and available.
 func (e Engine) StopNetLog() {
 	C.Cronet_Engine_StopNetLog(e.ptr)
+	engineNetLogs.delete(uintptr(unsafe.Pointer(e.ptr)))
 }
 
 // Shutdown shuts down the Engine if there are no active requests,
@@ -65,7 +99,11 @@ func (e Engine) StopNetLog() {
 // callbacks on). This method blocks until all the Engine's resources have
 // been cleaned up.
 func (e Engine) Shutdown() Result {
-	return Result(C.Cronet_Engine_Shutdown(e.ptr))
+	result := Result(C.Cronet_Engine_Shutdown(e.ptr))
+	if result == ResultSuccess {
+		releaseStoragePath(e)
+	}
+	return result
 }
 
 // Version returns a human-readable version string of the engine.
@@ -112,12 +150,14 @@ func (e Engine) DefaultUserAgent() string {
 // @param listener the listener for finished requests.
 // @param executor the executor upon which to run listener.
 func (e Engine) AddRequestFinishListener(listener URLRequestFinishedInfoListener, executor Executor) {
+	addFinishListener(e, listener)
 	C.Cronet_Engine_AddRequestFinishedListener(e.ptr, listener.ptr, executor.ptr)
 }
 
 // RemoveRequestFinishListener unregisters a RequestFinishedInfoListener,
 // including its association with its registered Executor.
 func (e Engine) RemoveRequestFinishListener(listener URLRequestFinishedInfoListener) {
+	removeFinishListener(e, listener)
 	C.Cronet_Engine_RemoveRequestFinishedListener(e.ptr, listener.ptr)
 }
 
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -21,6 +23,8 @@ func NewEngineParams() EngineParams {
 }
 
 func (p EngineParams) Destroy() {
+	engineParamsDefaultHeaders.delete(uintptr(unsafe.Pointer(p.ptr)))
+	engineParamsRequestPolicy.delete(uintptr(unsafe.Pointer(p.ptr)))
 	C.Cronet_EngineParams_Destroy(p.ptr)
 }
 
@@ -46,19 +50,30 @@ func (p EngineParams) UserAgent() string {
 	return C.GoString(C.Cronet_EngineParams_user_agent_get(p.ptr))
 }
 
-// SetAccentLanguage sets a default value for the Accept-Language header value for UrlRequests
+// SetAcceptLanguage sets a default value for the Accept-Language header value for UrlRequests
 // created by this engine. Explicitly setting the Accept-Language header
-// value for individual UrlRequests will override this value.
-func (p EngineParams) SetAccentLanguage(acceptLanguage string) {
+// value for individual UrlRequests will override this value. The value is
+// sent as it is; see AcceptLanguageHeader for the one Chrome would send.
+func (p EngineParams) SetAcceptLanguage(acceptLanguage string) {
 	cAcceptLanguage := C.CString(acceptLanguage)
 	C.Cronet_EngineParams_accept_language_set(p.ptr, cAcceptLanguage)
 	C.free(unsafe.Pointer(cAcceptLanguage))
 }
 
-func (p EngineParams) AccentLanguage() string {
+func (p EngineParams) AcceptLanguage() string {
 	return C.GoString(C.Cronet_EngineParams_accept_language_get(p.ptr))
 }
 
+// Deprecated: use SetAcceptLanguage.
+func (p EngineParams) SetAccentLanguage(acceptLanguage string) {
+	p.SetAcceptLanguage(acceptLanguage)
+}
+
+// Deprecated: use AcceptLanguage.
+func (p EngineParams) AccentLanguage() string {
+	return p.AcceptLanguage()
+}
+
 // SetStoragePath sets directory for HTTP Cache and Prefs Storage. The directory must exist.
 func (p EngineParams) SetStoragePath(storagePath string) {
 	cStoragePath := C.CString(storagePath)
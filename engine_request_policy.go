@@ -0,0 +1,67 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"net/url"
+	"unsafe"
+)
+
+// Like the default headers, the request policy of an engine is kept on the
+// Go side and checked in URLRequest.InitWithParams.
+var (
+	engineParamsRequestPolicy handleRegistry[*RequestPolicy]
+	engineRequestPolicy       handleRegistry[*RequestPolicy]
+)
+
+// SetRequestPolicy sets the policy checking the URL of every request of the
+// engine started with these parameters. URLRequest.InitWithParams returns
+// ResultIllegalArgument for URLs RequestPolicy.CheckURL denies without
+// creating the request. RoundTripper also checks RequestPolicy.CheckConnect
+// and redirects, and fails denied requests with an error wrapping
+// ErrRequestDenied. Users of URLRequest check redirects themselves in
+// URLRequestCallbackHandler.OnRedirectReceived with Engine.RequestPolicy. A
+// nil |policy| removes it.
+func (p EngineParams) SetRequestPolicy(policy *RequestPolicy) {
+	key := uintptr(unsafe.Pointer(p.ptr))
+	if policy == nil {
+		engineParamsRequestPolicy.delete(key)
+		return
+	}
+	engineParamsRequestPolicy.store(key, policy)
+}
+
+// RequestPolicy returns the policy set with SetRequestPolicy, or nil.
+func (p EngineParams) RequestPolicy() *RequestPolicy {
+	policy, _ := engineParamsRequestPolicy.load(uintptr(unsafe.Pointer(p.ptr)))
+	return policy
+}
+
+// RequestPolicy returns the request policy the engine was started with, or
+// nil.
+func (e Engine) RequestPolicy() *RequestPolicy {
+	policy, _ := engineRequestPolicy.load(uintptr(unsafe.Pointer(e.ptr)))
+	return policy
+}
+
+// startRequestPolicy gives |engine| the request policy of |params| it was
+// started with.
+func startRequestPolicy(engine Engine, params EngineParams) {
+	if policy, loaded := engineParamsRequestPolicy.load(uintptr(unsafe.Pointer(params.ptr))); loaded {
+		engineRequestPolicy.store(uintptr(unsafe.Pointer(engine.ptr)), policy)
+	}
+}
+
+// checkEngineRequestPolicy checks |rawURL| against the request policy of
+// |engine|, if any.
+func checkEngineRequestPolicy(engine Engine, rawURL string) error {
+	policy := engine.RequestPolicy()
+	if policy == nil {
+		return nil
+	}
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	return policy.CheckURL(requestURL)
+}
@@ -0,0 +1,233 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// EngineStats is a snapshot of the requests of an engine, see Engine.Stats.
+type EngineStats struct {
+	// ActiveRequests are the requests started and not finished yet.
+	ActiveRequests int64
+	// SucceededRequests, FailedRequests and CanceledRequests count the
+	// finished requests by outcome.
+	SucceededRequests int64
+	FailedRequests    int64
+	CanceledRequests  int64
+	// Responses counts the finished requests that received a response, of
+	// which CachedResponses came from the HTTP cache.
+	Responses       int64
+	CachedResponses int64
+	// ResponsesByProtocol counts the responses by the protocol they were
+	// received over.
+	ResponsesByProtocol map[Protocol]int64
+	// BytesReceived is the number of bytes the finished requests received
+	// over the network, including headers and redirects.
+	BytesReceived int64
+}
+
+// CacheHitRatio returns the share of responses that came from the HTTP cache,
+// or zero before the first response.
+func (s EngineStats) CacheHitRatio() float64 {
+	if s.Responses == 0 {
+		return 0
+	}
+	return float64(s.CachedResponses) / float64(s.Responses)
+}
+
+// engineStats counts the requests of an engine as their callbacks are
+// dispatched.
+type engineStats struct {
+	access sync.Mutex
+	stats  EngineStats
+	// active are the started requests by ID.
+	active map[RequestID]*requestStat
+}
+
+var (
+	engineStatsRegistry handleRegistry[*engineStats]
+	// requestStats maps initialized requests to the stats of their engine.
+	requestStats handleRegistry[*requestStat]
+)
+
+type requestStat struct {
+	engine  *engineStats
+	request URLRequest
+	id      RequestID
+	method  string
+	url     string
+	// started and startTime are guarded by the access of engine.
+	started       bool
+	startTime     time.Time
+	bytesReceived int64
+}
+
+// Stats returns a snapshot of the requests the engine has running and
+// finished, for dashboards and health checks.
+//
+// The C API reports neither the sockets nor the request queue or host cache
+// of the network stack, so the snapshot counts the requests made with
+// URLRequest, which include those of RoundTripper, as they start and finish.
+// MonitorConnections reports failing connections and ReadHostCache the
+// persisted host cache.
+func (e Engine) Stats() EngineStats {
+	stats, loaded := engineStatsRegistry.load(uintptr(unsafe.Pointer(e.ptr)))
+	if !loaded {
+		return EngineStats{}
+	}
+	stats.access.Lock()
+	defer stats.access.Unlock()
+	snapshot := stats.stats
+	snapshot.ResponsesByProtocol = make(map[Protocol]int64, len(stats.stats.ResponsesByProtocol))
+	for protocol, count := range stats.stats.ResponsesByProtocol {
+		snapshot.ResponsesByProtocol[protocol] = count
+	}
+	return snapshot
+}
+
+// startEngineStats starts counting the requests of |engine|.
+func startEngineStats(engine Engine) {
+	engineStatsRegistry.store(uintptr(unsafe.Pointer(engine.ptr)), &engineStats{})
+}
+
+// initRequestStats counts |request| of |engine| to |url| with |params| once
+// it is started. The request keeps the ID RoundTripper annotated |params|
+// with, or gets a new one.
+func initRequestStats(engine Engine, request URLRequest, url string, params URLRequestParams) {
+	stats, loaded := engineStatsRegistry.load(uintptr(unsafe.Pointer(engine.ptr)))
+	if !loaded {
+		return
+	}
+	id := params.requestIDAnnotation()
+	if id == 0 {
+		id = NewRequestID()
+	}
+	method := params.Method()
+	if method == "" {
+		method = "GET"
+	}
+	requestStats.store(uintptr(unsafe.Pointer(request.ptr)), &requestStat{
+		engine:  stats,
+		request: request,
+		id:      id,
+		method:  method,
+		url:     url,
+	})
+}
+
+// startRequestStats counts |request| as active.
+func startRequestStats(request URLRequest) {
+	stat, loaded := requestStats.load(uintptr(unsafe.Pointer(request.ptr)))
+	if !loaded {
+		return
+	}
+	stats := stat.engine
+	stats.access.Lock()
+	stat.started = true
+	stat.startTime = time.Now()
+	stats.stats.ActiveRequests++
+	if stats.active == nil {
+		stats.active = make(map[RequestID]*requestStat)
+	}
+	stats.active[stat.id] = stat
+	stats.access.Unlock()
+}
+
+// updateRequestStats records the bytes |request| received until |info|.
+func updateRequestStats(request URLRequest, info URLResponseInfo) {
+	if stat, loaded := requestStats.load(uintptr(unsafe.Pointer(request.ptr))); loaded {
+		atomic.StoreInt64(&stat.bytesReceived, info.ReceivedByteCount())
+	}
+}
+
+// unstartRequestStats undoes startRequestStats for a request that failed
+// to start.
+func unstartRequestStats(request URLRequest) {
+	stat, loaded := requestStats.load(uintptr(unsafe.Pointer(request.ptr)))
+	if !loaded {
+		return
+	}
+	stat.engine.access.Lock()
+	if stat.started {
+		stat.started = false
+		stat.engine.stats.ActiveRequests--
+		delete(stat.engine.active, stat.id)
+	}
+	stat.engine.access.Unlock()
+}
+
+// deleteRequestStats forgets |request|, e.g. one destroyed without being
+// started.
+func deleteRequestStats(request URLRequest) {
+	stat, loaded := requestStats.loadAndDelete(uintptr(unsafe.Pointer(request.ptr)))
+	if !loaded {
+		return
+	}
+	stat.engine.access.Lock()
+	if stat.started {
+		// Destroyed without a final callback, e.g. while the engine shut down
+		stat.started = false
+		stat.engine.stats.ActiveRequests--
+		delete(stat.engine.active, stat.id)
+	}
+	stat.engine.access.Unlock()
+}
+
+// Outcomes of finished requests for finishRequestStats.
+const (
+	requestSucceeded = iota
+	requestFailed
+	requestCanceled
+)
+
+// finishRequestStats counts |request| as finished with |outcome| and the
+// response of |info|, if any.
+func finishRequestStats(request URLRequest, info URLResponseInfo, outcome int) {
+	stat, loaded := requestStats.loadAndDelete(uintptr(unsafe.Pointer(request.ptr)))
+	if !loaded {
+		return
+	}
+	var (
+		hasResponse bool
+		cached      bool
+		protocol    Protocol
+		received    int64
+	)
+	if info.ptr != nil {
+		hasResponse = true
+		cached = info.Cached()
+		protocol = normalizeProtocol(info.NegotiatedProtocol())
+		received = info.ReceivedByteCount()
+	}
+	stat.engine.access.Lock()
+	defer stat.engine.access.Unlock()
+	if !stat.started {
+		return
+	}
+	delete(stat.engine.active, stat.id)
+	s := &stat.engine.stats
+	s.ActiveRequests--
+	switch outcome {
+	case requestSucceeded:
+		s.SucceededRequests++
+	case requestFailed:
+		s.FailedRequests++
+	case requestCanceled:
+		s.CanceledRequests++
+	}
+	if hasResponse {
+		s.Responses++
+		if cached {
+			s.CachedResponses++
+		}
+		if s.ResponsesByProtocol == nil {
+			s.ResponsesByProtocol = make(map[Protocol]int64)
+		}
+		s.ResponsesByProtocol[protocol]++
+		s.BytesReceived += received
+	}
+}
@@ -0,0 +1,109 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestEngineActiveRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		io.WriteString(writer, "partial")
+		writer.(http.Flusher).Flush()
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	ctx := cronet.WithRequestID(context.Background(), cronet.NewRequestID())
+	id, _ := cronet.RequestIDFromContext(ctx)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/stuck", nil)
+	response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	active := engine.ActiveRequests()
+	if len(active) != 1 || active[0].ID != id || active[0].Method != http.MethodGet || active[0].URL != server.URL+"/stuck" || active[0].Elapsed <= 0 {
+		t.Fatalf("unexpected active requests %+v", active)
+	}
+	if engine.CancelRequest(id + 1) {
+		t.Error("canceled an unknown request")
+	}
+	if !engine.CancelRequest(id) {
+		t.Fatal("request not found")
+	}
+	if _, err := io.ReadAll(response.Body); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled, got", err)
+	}
+	if active := engine.ActiveRequests(); len(active) != 0 {
+		t.Errorf("canceled request still active %+v", active)
+	}
+}
+
+func TestEngineStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			writer.WriteHeader(http.StatusOK)
+			writer.(http.Flusher).Flush()
+			<-request.Context().Done()
+			return
+		}
+		io.WriteString(writer, "body")
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	client := &http.Client{Transport: &cronet.RoundTripper{Engine: engine}}
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(response.Body)
+		response.Body.Close()
+	}
+	response, err := client.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := engine.Stats(); stats.ActiveRequests != 1 {
+		t.Errorf("unexpected stats with a request running %+v", stats)
+	}
+	response.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	stats := engine.Stats()
+	for stats.ActiveRequests != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		stats = engine.Stats()
+	}
+	if stats.ActiveRequests != 0 || stats.SucceededRequests != 2 || stats.CanceledRequests != 1 || stats.FailedRequests != 0 {
+		t.Errorf("unexpected request counts %+v", stats)
+	}
+	if stats.Responses != 3 || stats.ResponsesByProtocol[cronet.ProtocolHTTP11] != 3 || stats.BytesReceived == 0 || stats.CacheHitRatio() != 0 {
+		t.Errorf("unexpected response counts %+v", stats)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 type ErrorGo struct {
@@ -20,6 +22,32 @@ func (e *ErrorGo) Temporary() bool {
 	return e.Retryable
 }
 
+// netErrorICANNNameCollision is net::ERR_ICANN_NAME_COLLISION, reported for
+// host names the resolver refuses to look up.
+const netErrorICANNNameCollision = -166
+
+// netErrorInvalidURL is net::ERR_INVALID_URL.
+const netErrorInvalidURL = -300
+
+// netErrorResponseHeadersTooBig is net::ERR_RESPONSE_HEADERS_TOO_BIG.
+const netErrorResponseHeadersTooBig = -325
+
+// Is reports errors rejecting the host name or URL of a request as
+// ErrInvalidHostname or ErrInvalidURL, and responses with too large headers
+// as ErrHeadersTooLarge.
+func (e *ErrorGo) Is(target error) bool {
+	switch target {
+	case ErrInvalidHostname:
+		return e.InternalErrorCode == netErrorICANNNameCollision
+	case ErrInvalidURL:
+		return e.InternalErrorCode == netErrorICANNNameCollision || e.InternalErrorCode == netErrorInvalidURL
+	case ErrHeadersTooLarge:
+		return e.InternalErrorCode == netErrorResponseHeadersTooBig
+	default:
+		return false
+	}
+}
+
 func ErrorFromError(error Error) *ErrorGo {
 	return &ErrorGo{
 		ErrorCode:             error.ErrorCode(),
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -7,39 +9,25 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
 func NewExecutor(executeFunc ExecutorExecuteFunc) Executor {
 	ptr := C.Cronet_Executor_CreateWith((*[0]byte)(C.cronetExecutorExecute))
-	executorAccess.Lock()
-	executors[uintptr(unsafe.Pointer(ptr))] = executeFunc
-	executorAccess.Unlock()
+	executors.store(uintptr(unsafe.Pointer(ptr)), executeFunc)
 	return Executor{ptr}
 }
 
 func (e Executor) Destroy() {
+	executors.delete(uintptr(unsafe.Pointer(e.ptr)))
 	C.Cronet_Executor_Destroy(e.ptr)
-	executorAccess.Lock()
-	delete(executors, uintptr(unsafe.Pointer(e.ptr)))
-	executorAccess.Unlock()
 }
 
-var (
-	executorAccess sync.RWMutex
-	executors      map[uintptr]ExecutorExecuteFunc
-)
-
-func init() {
-	executors = make(map[uintptr]ExecutorExecuteFunc)
-}
+var executors handleRegistry[ExecutorExecuteFunc]
 
 //export cronetExecutorExecute
 func cronetExecutorExecute(self C.Cronet_ExecutorPtr, command C.Cronet_RunnablePtr) {
-	executorAccess.RLock()
-	executeFunc := executors[uintptr(unsafe.Pointer(self))]
-	executorAccess.RUnlock()
+	executeFunc, _ := executors.load(uintptr(unsafe.Pointer(self)))
 	if executeFunc != nil {
 		executeFunc(Executor{self}, Runnable{command})
 	}
@@ -0,0 +1,66 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestExpectContinueTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		body, _ := io.ReadAll(request.Body)
+		fmt.Fprintf(writer, "%s %d", body, time.Since(start)/time.Millisecond)
+	}))
+	defer server.Close()
+
+	const timeout = 500 * time.Millisecond
+	client := &http.Client{Transport: &cronet.RoundTripper{ExpectContinueTimeout: timeout}}
+	for _, expect := range []bool{true, false} {
+		var waited int32
+		trace := &httptrace.ClientTrace{
+			Wait100Continue: func() {
+				atomic.StoreInt32(&waited, 1)
+			},
+		}
+		request, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodPost, server.URL, strings.NewReader("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect {
+			request.Header.Set("Expect", "100-continue")
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body string
+		var held time.Duration
+		if _, err := fmt.Sscanf(string(content), "%s %d", &body, &held); err != nil || body != "body" {
+			t.Fatalf("unexpected response %q", content)
+		}
+		held *= time.Millisecond
+		if expect && (held < timeout-100*time.Millisecond || atomic.LoadInt32(&waited) == 0) {
+			t.Fatal("body not held back", held)
+		}
+		if !expect && (held >= timeout-100*time.Millisecond || atomic.LoadInt32(&waited) != 0) {
+			t.Fatal("body held back without Expect", held)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SetExperimentalOption sets |key| in the experimental options JSON to
+// |value|, keeping all other options. A nil value removes the key.
+func (p EngineParams) SetExperimentalOption(key string, value any) error {
+	options, err := p.experimentalOptionsMap()
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(options, key)
+	} else {
+		options[key] = value
+	}
+	return p.setExperimentalOptionsMap(options)
+}
+
+// ExperimentalOption returns the value of |key| in the experimental options,
+// or nil if it is not set.
+func (p EngineParams) ExperimentalOption(key string) (any, error) {
+	options, err := p.experimentalOptionsMap()
+	if err != nil {
+		return nil, err
+	}
+	return options[key], nil
+}
+
+// setExperimentalSubOption sets |key| of the nested |section| object, e.g. a
+// QUIC or AsyncDNS setting, keeping the other settings of the section.
+func (p EngineParams) setExperimentalSubOption(section string, key string, value any) error {
+	options, err := p.experimentalOptionsMap()
+	if err != nil {
+		return err
+	}
+	sectionOptions, _ := options[section].(map[string]any)
+	if sectionOptions == nil {
+		sectionOptions = make(map[string]any)
+		options[section] = sectionOptions
+	}
+	if value == nil {
+		delete(sectionOptions, key)
+	} else {
+		sectionOptions[key] = value
+	}
+	return p.setExperimentalOptionsMap(options)
+}
+
+func (p EngineParams) experimentalOptionsMap() (map[string]any, error) {
+	options := make(map[string]any)
+	content := p.ExperimentalOptions()
+	if content == "" {
+		return options, nil
+	}
+	err := json.Unmarshal([]byte(content), &options)
+	if err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func (p EngineParams) setExperimentalOptionsMap(options map[string]any) error {
+	content, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	p.SetExperimentalOptions(string(content))
+	return nil
+}
+
+// SetDisableIPv6OnWiFi makes the engine resolve and connect over IPv4 only
+// while the default network is Wi-Fi, for networks with broken IPv6.
+// Cronet has no setting to prefer or require an address family otherwise,
+// neither per engine nor per request; pin hosts with SetHostResolverRules,
+// and see which family a request used with ReadNetLogRemoteAddresses.
+func (p EngineParams) SetDisableIPv6OnWiFi(disable bool) error {
+	return p.SetExperimentalOption("disable_ipv6_on_wifi", disable)
+}
+
+// SetHostResolverRules sets host resolver rules in the format of Chromium's
+// --host-resolver-rules switch, e.g. "MAP example.com 192.0.2.1, MAP *.test [2001:db8::1]".
+// Mapping a host to an address literal pins the address family used for it.
+func (p EngineParams) SetHostResolverRules(rules string) error {
+	return p.setExperimentalSubOption("HostResolverRules", "host_resolver_rules", rules)
+}
+
+// SetQUICIdleConnectionTimeout sets how long an idle QUIC connection is kept
+// open before it is closed. Cronet has no such setting for TCP connections,
+// whose idle timeout, per-host limits and keep-alive interval are fixed by
+// the network stack. The option is in whole seconds, so |timeout| is rounded
+// up to the next second. Zero restores the default.
+func (p EngineParams) SetQUICIdleConnectionTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("cronet: negative QUIC idle connection timeout %s", timeout)
+	}
+	if timeout == 0 {
+		return p.setExperimentalSubOption("QUIC", "idle_connection_timeout_seconds", nil)
+	}
+	return p.setExperimentalSubOption("QUIC", "idle_connection_timeout_seconds", ceilDuration(timeout, time.Second))
+}
+
+// SetQUICRetransmittableOnWireTimeout makes QUIC connections send a PING once
+// no retransmittable packet has been in flight for |timeout|, keeping NAT
+// bindings alive and detecting dead paths early. The option is in whole
+// milliseconds, so |timeout| is rounded up. Zero restores the default.
+func (p EngineParams) SetQUICRetransmittableOnWireTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("cronet: negative QUIC retransmittable on wire timeout %s", timeout)
+	}
+	if timeout == 0 {
+		return p.setExperimentalSubOption("QUIC", "retransmittable_on_wire_timeout_milliseconds", nil)
+	}
+	return p.setExperimentalSubOption("QUIC", "retransmittable_on_wire_timeout_milliseconds", ceilDuration(timeout, time.Millisecond))
+}
+
+// ceilDuration returns |timeout| in units of |unit|, rounded up so that a
+// positive timeout never becomes zero, which the network stack would ignore.
+func ceilDuration(timeout time.Duration, unit time.Duration) int64 {
+	return int64((timeout + unit - 1) / unit)
+}
@@ -0,0 +1,44 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestQUICTimeoutsRoundUp(t *testing.T) {
+	params := cronet.NewEngineParams()
+	defer params.Destroy()
+	if err := params.SetQUICIdleConnectionTimeout(1500 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := params.SetQUICRetransmittableOnWireTimeout(200 * time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	quic, err := params.ExperimentalOption("QUIC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, _ := quic.(map[string]any)
+	// Numbers come back from JSON as float64
+	if timeout := section["idle_connection_timeout_seconds"]; timeout != float64(2) {
+		t.Error("expected 1.5s to round up to 2 seconds, got", timeout)
+	}
+	if timeout := section["retransmittable_on_wire_timeout_milliseconds"]; timeout != float64(1) {
+		t.Error("expected 200µs to round up to 1 millisecond, got", timeout)
+	}
+
+	if err = params.SetQUICIdleConnectionTimeout(-time.Second); err == nil {
+		t.Error("expected a negative timeout to be rejected")
+	}
+	if err = params.SetQUICIdleConnectionTimeout(0); err != nil {
+		t.Fatal(err)
+	}
+	quic, _ = params.ExperimentalOption("QUIC")
+	if _, loaded := quic.(map[string]any)["idle_connection_timeout_seconds"]; loaded {
+		t.Error("expected zero to remove the option")
+	}
+}
@@ -0,0 +1,278 @@
+package cronet
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FairScheduler shares a number of requests in flight between tenants, e.g.
+// the users of a shared proxy, so a tenant sending many requests cannot
+// starve the others. While requests wait, the free slots go to the tenants
+// in proportion to their weights by weighted fair queuing: each tenant is
+// served in turn once per 1/weight of virtual time, and requests of one
+// tenant in the order they arrived. A tenant that was idle rejoins at the
+// current virtual time and does not catch up on the turns it skipped.
+//
+// Requests are in flight until the response body is read to the end or
+// closed. The fields must not be changed once the FairScheduler is in use. A
+// FairScheduler is safe for concurrent use and can be shared between
+// RoundTrippers, and used with a Throttle, which requests wait for once the
+// scheduler let them through.
+type FairScheduler struct {
+	// MaxConcurrentRequests is the number of requests in flight at once for
+	// all tenants together. Zero means 1.
+	MaxConcurrentRequests int
+	// Tenant returns the tenant of |request|. Nil uses the Tenant of the
+	// RequestOptions of the request. Requests without a tenant share the
+	// tenant "".
+	Tenant func(request *http.Request) string
+	// Weights are the weights of tenants. Tenants not in Weights, or with
+	// weights below 1, have weight 1.
+	Weights map[string]int
+	// QueueTimeout, if set, fails requests that waited this long with an
+	// error wrapping ErrQueueTimeout.
+	QueueTimeout time.Duration
+
+	access sync.Mutex
+	active int
+	// virtualTime is the start of the turn served last.
+	virtualTime float64
+	sequence    uint64
+	tenants     map[string]*schedulerTenant
+}
+
+// schedulerTenant is the state of a tenant, removed once it has no request
+// in flight or waiting.
+type schedulerTenant struct {
+	name string
+	// pass is the virtual time of the next turn of the tenant.
+	pass    float64
+	active  int
+	waiting []*schedulerWaiter
+}
+
+type schedulerWaiter struct {
+	sequence uint64
+	ready    chan struct{}
+	granted  bool
+}
+
+// Active returns the number of requests of |tenant| in flight.
+func (s *FairScheduler) Active(tenant string) int {
+	s.access.Lock()
+	defer s.access.Unlock()
+	if t := s.tenants[tenant]; t != nil {
+		return t.active
+	}
+	return 0
+}
+
+// Waiting returns the number of requests of |tenant| waiting for a slot.
+func (s *FairScheduler) Waiting(tenant string) int {
+	s.access.Lock()
+	defer s.access.Unlock()
+	if t := s.tenants[tenant]; t != nil {
+		return len(t.waiting)
+	}
+	return 0
+}
+
+func (s *FairScheduler) maxConcurrentRequests() int {
+	if s.MaxConcurrentRequests > 0 {
+		return s.MaxConcurrentRequests
+	}
+	return 1
+}
+
+func (s *FairScheduler) stride(tenant string) float64 {
+	if weight := s.Weights[tenant]; weight > 1 {
+		return 1 / float64(weight)
+	}
+	return 1
+}
+
+func (s *FairScheduler) requestTenant(request *http.Request) string {
+	if s.Tenant != nil {
+		return s.Tenant(request)
+	}
+	options, _ := RequestOptionsFromContext(request.Context())
+	return options.Tenant
+}
+
+// tenant returns the state of |name|, joining it at the current virtual time
+// if it has no request in flight or waiting.
+func (s *FairScheduler) tenant(name string) *schedulerTenant {
+	t := s.tenants[name]
+	if t == nil {
+		if s.tenants == nil {
+			s.tenants = make(map[string]*schedulerTenant)
+		}
+		t = &schedulerTenant{name: name, pass: s.virtualTime}
+		s.tenants[name] = t
+	}
+	if len(t.waiting) == 0 && t.pass < s.virtualTime {
+		t.pass = s.virtualTime
+	}
+	return t
+}
+
+// serve takes a turn of |t| for one of its requests.
+func (s *FairScheduler) serve(t *schedulerTenant) {
+	s.virtualTime = t.pass
+	t.pass += s.stride(t.name)
+	t.active++
+	s.active++
+}
+
+// dispatch lets waiting requests in flight while slots are free.
+func (s *FairScheduler) dispatch() {
+	for s.active < s.maxConcurrentRequests() {
+		var next *schedulerTenant
+		for _, t := range s.tenants {
+			if len(t.waiting) == 0 {
+				continue
+			}
+			if next == nil || t.pass < next.pass || t.pass == next.pass && t.waiting[0].sequence < next.waiting[0].sequence {
+				next = t
+			}
+		}
+		if next == nil {
+			return
+		}
+		waiter := next.waiting[0]
+		next.waiting = next.waiting[1:]
+		s.serve(next)
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// removeIdle removes |t| if it has no request in flight or waiting.
+func (s *FairScheduler) removeIdle(t *schedulerTenant) {
+	if t.active == 0 && len(t.waiting) == 0 {
+		delete(s.tenants, t.name)
+	}
+}
+
+// scheduledRequest is a request let in flight by a FairScheduler. Its
+// methods do nothing on a nil scheduledRequest, which is what
+// startScheduler returns without a scheduler.
+type scheduledRequest struct {
+	scheduler   *FairScheduler
+	tenant      *schedulerTenant
+	releaseOnce sync.Once
+}
+
+// startScheduler waits for |request| to be let in flight by |scheduler|,
+// which may be nil.
+func startScheduler(scheduler *FairScheduler, request *http.Request) (*scheduledRequest, error) {
+	if scheduler == nil {
+		return nil, nil
+	}
+	name := scheduler.requestTenant(request)
+	scheduler.access.Lock()
+	t := scheduler.tenant(name)
+	r := &scheduledRequest{scheduler: scheduler, tenant: t}
+	if scheduler.active < scheduler.maxConcurrentRequests() && !scheduler.hasWaiting() {
+		scheduler.serve(t)
+		scheduler.access.Unlock()
+		return r, nil
+	}
+	scheduler.sequence++
+	waiter := &schedulerWaiter{sequence: scheduler.sequence, ready: make(chan struct{})}
+	t.waiting = append(t.waiting, waiter)
+	scheduler.access.Unlock()
+
+	var timeout <-chan time.Time
+	if scheduler.QueueTimeout > 0 {
+		timer := time.NewTimer(scheduler.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-waiter.ready:
+		return r, nil
+	case <-request.Context().Done():
+		err = request.Context().Err()
+	case <-timeout:
+		err = fmt.Errorf("%w: tenant %q for %s", ErrQueueTimeout, name, scheduler.QueueTimeout)
+	}
+	scheduler.access.Lock()
+	if waiter.granted {
+		// The slot was given to the request as it stopped waiting
+		scheduler.access.Unlock()
+		r.release()
+		return nil, err
+	}
+	for i, queued := range t.waiting {
+		if queued == waiter {
+			t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+			break
+		}
+	}
+	scheduler.removeIdle(t)
+	scheduler.access.Unlock()
+	return nil, err
+}
+
+func (s *FairScheduler) hasWaiting() bool {
+	for _, t := range s.tenants {
+		if len(t.waiting) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// release gives the slot of the request to the next waiting request.
+func (r *scheduledRequest) release() {
+	if r == nil {
+		return
+	}
+	r.releaseOnce.Do(func() {
+		s := r.scheduler
+		s.access.Lock()
+		defer s.access.Unlock()
+		r.tenant.active--
+		s.active--
+		s.removeIdle(r.tenant)
+		s.dispatch()
+	})
+}
+
+// response releases the slot once the body of |response| is consumed, or at
+// once if the request failed.
+func (r *scheduledRequest) response(response *http.Response, err error) (*http.Response, error) {
+	if r == nil {
+		return response, err
+	}
+	if err != nil || response.Body == nil || response.Body == http.NoBody {
+		r.release()
+		return response, err
+	}
+	response.Body = &scheduledBody{response.Body, r}
+	return response, nil
+}
+
+// scheduledBody releases the slot of its request at the end of the body.
+type scheduledBody struct {
+	io.ReadCloser
+	request *scheduledRequest
+}
+
+func (b *scheduledBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.request.release()
+	}
+	return n, err
+}
+
+func (b *scheduledBody) Close() error {
+	b.request.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,115 @@
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestFairScheduler(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "body")
+	scheduler := &cronet.FairScheduler{MaxConcurrentRequests: 1, Weights: map[string]int{"b": 2}}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, Scheduler: scheduler}
+	tenantRequest := func(ctx context.Context, tenant string) *http.Request {
+		return newRequest(t, cronet.WithRequestOptions(ctx, cronet.RequestOptions{Tenant: tenant}))
+	}
+
+	holder, err := transport.RoundTrip(tenantRequest(context.Background(), "c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		tenant   string
+		response *http.Response
+		err      error
+	}
+	results := make(chan result)
+	send := func(tenant string) {
+		response, err := transport.RoundTrip(tenantRequest(context.Background(), tenant))
+		results <- result{tenant, response, err}
+	}
+	// The requests of "a" queue up first
+	for i, tenant := range []string{"a", "a", "a", "b", "b", "b"} {
+		go send(tenant)
+		waitFor(t, func() bool { return scheduler.Waiting("a")+scheduler.Waiting("b") == i+1 })
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(tenantRequest(ctx, "d")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the request to wait, got", err)
+	}
+	if waiting := scheduler.Waiting("d"); waiting != 0 {
+		t.Fatal("expected the canceled request to stop waiting, got", waiting)
+	}
+
+	holder.Body.Close()
+	var order string
+	for i := 0; i < 6; i++ {
+		result := <-results
+		if result.err != nil {
+			t.Fatal(result.err)
+		}
+		if active := scheduler.Active(result.tenant); active != 1 {
+			t.Fatal("expected one request in flight, got", active)
+		}
+		order += result.tenant
+		result.response.Body.Close()
+	}
+	// "b" has twice the turns of "a" while both wait
+	if order != "abbaba" {
+		t.Fatal("unexpected order", order)
+	}
+	if active := scheduler.Active("b"); active != 0 {
+		t.Fatal("expected no request in flight, got", active)
+	}
+}
+
+func TestFairSchedulerQueueTimeout(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "body")
+	scheduler := &cronet.FairScheduler{
+		MaxConcurrentRequests: 1,
+		Tenant:                func(request *http.Request) string { return request.Header.Get("Tenant") },
+		QueueTimeout:          20 * time.Millisecond,
+	}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, Scheduler: scheduler}
+
+	first := newRequest(t, context.Background())
+	first.Header.Set("Tenant", "a")
+	response, err := transport.RoundTrip(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := newRequest(t, context.Background())
+	second.Header.Set("Tenant", "b")
+	if _, err := transport.RoundTrip(second); !errors.Is(err, cronet.ErrQueueTimeout) {
+		t.Fatal("expected the request to time out, got", err)
+	}
+	response.Body.Close()
+	if active := scheduler.Active("a"); active != 0 {
+		t.Fatal("expected no request in flight, got", active)
+	}
+	response, err = transport.RoundTrip(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,193 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func newFirstByteEngine(t *testing.T) cronet.Engine {
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	t.Cleanup(func() {
+		engine.Shutdown()
+		engine.Destroy()
+	})
+	return engine
+}
+
+func TestRoundTripReturnsAtHeaders(t *testing.T) {
+	firstChunk := make(chan struct{})
+	secondChunk := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		<-firstChunk
+		io.WriteString(writer, "first")
+		writer.(http.Flusher).Flush()
+		<-secondChunk
+		io.WriteString(writer, "second")
+	}))
+	defer server.Close()
+	defer close(secondChunk)
+
+	var firstByte time.Time
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	transport := &cronet.RoundTripper{Engine: newFirstByteEngine(t)}
+	returned := make(chan *http.Response, 1)
+	go func() {
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Error(err)
+		}
+		returned <- response
+	}()
+	var response *http.Response
+	select {
+	case response = <-returned:
+	case <-time.After(10 * time.Second):
+		close(firstChunk)
+		t.Fatal("RoundTrip waited for the body")
+	}
+	if response == nil {
+		close(firstChunk)
+		return
+	}
+	defer response.Body.Close()
+	if firstByte.IsZero() {
+		t.Error("GotFirstResponseByte not called before RoundTrip returned")
+	}
+
+	// Each chunk is readable as soon as it arrives
+	close(firstChunk)
+	buffer := make([]byte, 64)
+	n, err := response.Body.Read(buffer)
+	if err != nil || string(buffer[:n]) != "first" {
+		t.Fatalf("expected the first chunk, got %q, %v", buffer[:n], err)
+	}
+}
+
+// firstByteHandler records when the response headers of a request made
+// with the low-level API arrived and cancels it.
+type firstByteHandler struct {
+	started chan time.Time
+	done    chan struct{}
+}
+
+func (h *firstByteHandler) OnRedirectReceived(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, newLocationUrl string) {
+	request.FollowRedirect()
+}
+
+func (h *firstByteHandler) OnResponseStarted(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	h.started <- time.Now()
+	request.Cancel()
+}
+
+func (h *firstByteHandler) OnReadCompleted(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, buffer cronet.Buffer, bytesRead int64) {
+}
+
+func (h *firstByteHandler) OnSucceeded(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	close(h.done)
+}
+
+func (h *firstByteHandler) OnFailed(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, error cronet.Error) {
+	close(h.done)
+}
+
+func (h *firstByteHandler) OnCanceled(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	close(h.done)
+}
+
+// lowLevelFirstByte returns the time from starting a request to |url| with
+// the low-level API to its response headers.
+func lowLevelFirstByte(t *testing.T, engine cronet.Engine, url string) time.Duration {
+	executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {
+		go func() {
+			command.Run()
+			command.Destroy()
+		}()
+	})
+	defer executor.Destroy()
+	handler := &firstByteHandler{started: make(chan time.Time, 1), done: make(chan struct{})}
+	callback := cronet.NewURLRequestCallback(handler)
+	defer callback.Destroy()
+	params := cronet.NewURLRequestParams()
+	request := cronet.NewURLRequest()
+	start := time.Now()
+	request.InitWithParams(engine, url, params, callback, executor)
+	params.Destroy()
+	request.Start()
+	var started time.Time
+	select {
+	case started = <-handler.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no response")
+	}
+	<-handler.done
+	request.Destroy()
+	return started.Sub(start)
+}
+
+// roundTripFirstByte returns the time from calling RoundTrip for |url| to
+// its return.
+func roundTripFirstByte(t *testing.T, transport *cronet.RoundTripper, url string) time.Duration {
+	request, _ := http.NewRequest(http.MethodGet, url, nil)
+	start := time.Now()
+	response, err := transport.RoundTrip(request)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return elapsed
+}
+
+func TestRoundTripFirstByteParity(t *testing.T) {
+	const headerDelay = 100 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(headerDelay)
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		// The body never arrives before the request is canceled
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+	engine := newFirstByteEngine(t)
+	transport := &cronet.RoundTripper{Engine: engine}
+
+	// Warm up the connections so both measure the same path
+	lowLevelFirstByte(t, engine, server.URL)
+	roundTripFirstByte(t, transport, server.URL)
+	const rounds = 5
+	lowLevel := make([]time.Duration, rounds)
+	roundTrip := make([]time.Duration, rounds)
+	for i := 0; i < rounds; i++ {
+		lowLevel[i] = lowLevelFirstByte(t, engine, server.URL)
+		roundTrip[i] = roundTripFirstByte(t, transport, server.URL)
+	}
+	median := func(durations []time.Duration) time.Duration {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		return durations[len(durations)/2]
+	}
+	lowLevelMedian, roundTripMedian := median(lowLevel), median(roundTrip)
+	if roundTripMedian < headerDelay || lowLevelMedian < headerDelay {
+		t.Fatalf("headers arrived before the server sent them: %s, %s", lowLevelMedian, roundTripMedian)
+	}
+	if difference := roundTripMedian - lowLevelMedian; difference > 50*time.Millisecond {
+		t.Fatalf("RoundTrip took %s to the headers, %s more than the low-level API", roundTripMedian, difference)
+	}
+}
@@ -0,0 +1,6 @@
+package cronet
+
+// go generate downloads the prebuilt library of the host from the latest
+// release, for checkouts that do not build Chromium.
+
+//go:generate go run ./cmd/build fetch
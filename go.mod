@@ -5,10 +5,14 @@ go 1.18
 require (
 	github.com/sagernet/sing v0.7.13
 	github.com/spf13/cobra v1.4.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/net v0.21.0
+	golang.org/x/sys v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,70 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include <cronet_c.h>
+//
+// static void cronet_add_packed_headers(Cronet_UrlRequestParamsPtr params, const char* buffer, size_t count) {
+//   Cronet_HttpHeaderPtr header = Cronet_HttpHeader_Create();
+//   for (size_t i = 0; i < count; i++) {
+//     const char* name = buffer;
+//     buffer += strlen(buffer) + 1;
+//     const char* value = buffer;
+//     buffer += strlen(buffer) + 1;
+//     Cronet_HttpHeader_name_set(header, name);
+//     Cronet_HttpHeader_value_set(header, value);
+//     Cronet_UrlRequestParams_request_headers_add(params, header);
+//   }
+//   Cronet_HttpHeader_Destroy(header);
+// }
+import "C"
+
+import (
+	"net/http"
+	"strings"
+	"unsafe"
+)
+
+// packedHeaders collects headers as consecutive NUL-terminated names and
+// values, to be added to request parameters in a single native call.
+type packedHeaders struct {
+	buffer []byte
+	count  int
+}
+
+func (h *packedHeaders) add(name string, value string) {
+	// Native strings end at the first NUL, as they did with one call per header
+	if index := strings.IndexByte(name, 0); index >= 0 {
+		name = name[:index]
+	}
+	if index := strings.IndexByte(value, 0); index >= 0 {
+		value = value[:index]
+	}
+	h.buffer = append(h.buffer, name...)
+	h.buffer = append(h.buffer, 0)
+	h.buffer = append(h.buffer, value...)
+	h.buffer = append(h.buffer, 0)
+	h.count++
+}
+
+func (p URLRequestParams) addPackedHeaders(headers *packedHeaders) {
+	if headers.count == 0 {
+		return
+	}
+	C.cronet_add_packed_headers(p.ptr, (*C.char)(unsafe.Pointer(&headers.buffer[0])), C.size_t(headers.count))
+}
+
+// SetHeaders replaces the request headers with |header|. All headers are
+// passed to the native library in a single call.
+func (p URLRequestParams) SetHeaders(header http.Header) {
+	p.ClearHeaders()
+	var packed packedHeaders
+	for key, values := range header {
+		for _, value := range values {
+			packed.add(key, value)
+		}
+	}
+	p.addPackedHeaders(&packed)
+}
@@ -0,0 +1,96 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// #include <stdlib.h>
+// #include <cronet_c.h>
+//
+// static void cronet_add_request_header(Cronet_UrlRequestParamsPtr params, const char* name, const char* value) {
+//   Cronet_HttpHeaderPtr header = Cronet_HttpHeader_Create();
+//   Cronet_HttpHeader_name_set(header, name);
+//   Cronet_HttpHeader_value_set(header, value);
+//   Cronet_UrlRequestParams_request_headers_add(params, header);
+//   Cronet_HttpHeader_Destroy(header);
+// }
+import "C"
+
+import (
+	"net/http"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// maxInternedStrings bounds the native memory held by interned strings,
+	// which are never freed.
+	maxInternedStrings = 4096
+	// maxInternedValueLength is the longest header value that is interned.
+	maxInternedValueLength = 256
+)
+
+// internedValueHeaders are headers whose values are usually the same across
+// requests. Values of other headers, which may be unique or secret, such as
+// Authorization or Cookie, are converted for every request.
+var internedValueHeaders = map[string]bool{
+	"Accept":                    true,
+	"Accept-Encoding":           true,
+	"Accept-Language":           true,
+	"Cache-Control":             true,
+	"Content-Encoding":          true,
+	"Content-Type":              true,
+	"Origin":                    true,
+	"Pragma":                    true,
+	"Sec-Fetch-Dest":            true,
+	"Sec-Fetch-Mode":            true,
+	"Sec-Fetch-Site":            true,
+	"Te":                        true,
+	"Upgrade-Insecure-Requests": true,
+	"User-Agent":                true,
+}
+
+var (
+	internAccess    sync.RWMutex
+	internedStrings = make(map[string]*C.char)
+)
+
+// internCString returns |s| as a native string. Interned strings are cached
+// for the lifetime of the process; otherwise the string is newly allocated
+// and must be freed by the caller, as reported by |free|.
+func internCString(s string, intern bool) (cString *C.char, free bool) {
+	if !intern {
+		return C.CString(s), true
+	}
+	internAccess.RLock()
+	cString = internedStrings[s]
+	internAccess.RUnlock()
+	if cString != nil {
+		return cString, false
+	}
+	internAccess.Lock()
+	defer internAccess.Unlock()
+	if cString = internedStrings[s]; cString != nil {
+		return cString, false
+	}
+	if len(internedStrings) >= maxInternedStrings {
+		return C.CString(s), true
+	}
+	cString = C.CString(s)
+	internedStrings[s] = cString
+	return cString, false
+}
+
+// AddHeaderValue adds a request header without creating an HTTPHeader, in a
+// single call into the native library. Header names and the values of
+// headers that rarely change, such as Accept or User-Agent, are converted to
+// native strings once and reused by later requests.
+func (p URLRequestParams) AddHeaderValue(name string, value string) {
+	cName, freeName := internCString(name, true)
+	cValue, freeValue := internCString(value, len(value) <= maxInternedValueLength && internedValueHeaders[http.CanonicalHeaderKey(name)])
+	C.cronet_add_request_header(p.ptr, cName, cValue)
+	if freeName {
+		C.free(unsafe.Pointer(cName))
+	}
+	if freeValue {
+		C.free(unsafe.Pointer(cValue))
+	}
+}
@@ -0,0 +1,94 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+var benchmarkHeaders = [][2]string{
+	{"Accept", "application/json"},
+	{"Accept-Encoding", "gzip, deflate, br"},
+	{"Accept-Language", "en-US,en;q=0.9"},
+	{"Content-Type", "application/json"},
+	{"User-Agent", "benchmark/1.0"},
+	{"Authorization", "Bearer 0123456789abcdef"},
+}
+
+func BenchmarkAddHeader(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		params := cronet.NewURLRequestParams()
+		for _, pair := range benchmarkHeaders {
+			header := cronet.NewHTTPHeader()
+			header.SetName(pair[0])
+			header.SetValue(pair[1])
+			params.AddHeader(header)
+			header.Destroy()
+		}
+		params.Destroy()
+	}
+}
+
+func BenchmarkAddHeaderValue(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		params := cronet.NewURLRequestParams()
+		for _, pair := range benchmarkHeaders {
+			params.AddHeaderValue(pair[0], pair[1])
+		}
+		params.Destroy()
+	}
+}
+
+func TestAddHeaderValue(t *testing.T) {
+	params := cronet.NewURLRequestParams()
+	defer params.Destroy()
+	for round := 0; round < 2; round++ {
+		for _, pair := range benchmarkHeaders {
+			params.AddHeaderValue(pair[0], pair[1])
+		}
+	}
+	if params.HeaderSize() != 2*len(benchmarkHeaders) {
+		t.Fatal("bad header count", params.HeaderSize())
+	}
+	for i := 0; i < params.HeaderSize(); i++ {
+		header := params.HeaderAt(i)
+		pair := benchmarkHeaders[i%len(benchmarkHeaders)]
+		if header.Name() != pair[0] || header.Value() != pair[1] {
+			t.Fatal("bad header", header.Name(), header.Value())
+		}
+	}
+}
+
+func BenchmarkSetHeaders(b *testing.B) {
+	header := make(http.Header)
+	for _, pair := range benchmarkHeaders {
+		header.Add(pair[0], pair[1])
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		params := cronet.NewURLRequestParams()
+		params.SetHeaders(header)
+		params.Destroy()
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	params := cronet.NewURLRequestParams()
+	defer params.Destroy()
+	params.AddHeaderValue("X-Replaced", "1")
+	params.SetHeaders(http.Header{"Accept": {"text/html", "text/plain"}})
+	if params.HeaderSize() != 2 {
+		t.Fatal("bad header count", params.HeaderSize())
+	}
+	for i, value := range []string{"text/html", "text/plain"} {
+		header := params.HeaderAt(i)
+		if header.Name() != "Accept" || header.Value() != value {
+			t.Fatal("bad header", header.Name(), header.Value())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrHeadersTooLarge is wrapped by the errors of requests whose response or
+// redirect headers exceeded RoundTripper.MaxResponseHeaderBytes or
+// MaxResponseHeaders. The native stack fails HTTP/1 responses with more than
+// 256 KiB of headers by itself, with an error matching it as well.
+var ErrHeadersTooLarge = errors.New("cronet: response headers too large")
+
+// headerLineSize is the size of a header as counted against
+// MaxResponseHeaderBytes, its name and value with the separator and line
+// ending of HTTP/1.
+func headerLineSize(name string, value string) int64 {
+	return int64(len(name) + len(value) + 4)
+}
+
+// checkHeaderLimits returns an error wrapping ErrHeadersTooLarge if |count|
+// headers of |size| bytes exceed |maxBytes| or |maxCount|, which are not
+// enforced if not positive.
+func checkHeaderLimits(maxBytes int64, maxCount int, count int, size int64) error {
+	if maxCount > 0 && count > maxCount {
+		return fmt.Errorf("%w: %d headers, limit %d", ErrHeadersTooLarge, count, maxCount)
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrHeadersTooLarge, size, maxBytes)
+	}
+	return nil
+}
+
+// checkHeaderLimitsOf checks the headers of |header| as checkHeaderLimits.
+func checkHeaderLimitsOf(maxBytes int64, maxCount int, header http.Header) error {
+	if maxBytes <= 0 && maxCount <= 0 {
+		return nil
+	}
+	var count int
+	var size int64
+	for name, values := range header {
+		for _, value := range values {
+			count++
+			size += headerLineSize(name, value)
+		}
+	}
+	return checkHeaderLimits(maxBytes, maxCount, count, size)
+}
@@ -0,0 +1,248 @@
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IDNPolicy controls how internationalized domain names are looked up and
+// displayed. The zero value converts them to punycode for lookup like the
+// network stack does, and displays them as Unicode unless they could be
+// confused with another name.
+type IDNPolicy struct {
+	// ASCIIOnly rejects host names with non-ASCII characters instead of
+	// converting them to punycode. Names already in punycode are accepted.
+	ASCIIOnly bool
+
+	// DisplayPunycode makes DisplayHost always return the punycode form.
+	DisplayPunycode bool
+}
+
+// maxHostnameLength is the longest DNS name in dotted form, without the
+// trailing dot.
+const maxHostnameLength = 253
+
+// ValidateHostname checks |host| as the network stack does before a request
+// is created and returns the ASCII form used for lookup. IP address literals
+// are returned in canonical form. Errors wrap ErrInvalidHostname.
+//
+// Validating hosts up front avoids the process abort Cronet triggers for
+// invalid URLs unless EngineParams.SetEnableCheckResult(false) is set.
+func (p IDNPolicy) ValidateHostname(host string) (string, error) {
+	if p.ASCIIOnly {
+		for i := 0; i < len(host); i++ {
+			if host[i] >= utf8.RuneSelf {
+				return "", fmt.Errorf("%w: non-ASCII host %q not allowed by IDN policy", ErrInvalidHostname, host)
+			}
+		}
+	}
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	canonical, err := CanonicalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(canonical, "[") || net.ParseIP(canonical) != nil {
+		return canonical, nil
+	}
+	if len(strings.TrimSuffix(canonical, ".")) > maxHostnameLength {
+		return "", fmt.Errorf("%w: host %q is longer than %d characters", ErrInvalidHostname, host, maxHostnameLength)
+	}
+	labels := strings.Split(strings.TrimSuffix(canonical, "."), ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("%w: host %q has an empty or too long label", ErrInvalidHostname, host)
+		}
+		if strings.HasPrefix(label, "xn--") {
+			if _, err := punycodeDecode(label[4:]); err != nil {
+				return "", fmt.Errorf("%w: host label %q: %v", ErrInvalidHostname, label, err)
+			}
+		}
+	}
+	return canonical, nil
+}
+
+// DisplayHost returns |host| for display to users. Punycode labels are shown
+// as Unicode when they decode to letters of a single script, or of Latin
+// combined with Chinese, Japanese or Korean, following the restriction level
+// Chromium uses for its omnibox. Other labels stay in punycode, as they could
+// imitate another name, and so do labels written only with Cyrillic, Greek or
+// Armenian letters that look like Latin ones, such as a Cyrillic "аррӏе".
+func (p IDNPolicy) DisplayHost(host string) string {
+	if p.DisplayPunycode {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), "xn--") {
+			continue
+		}
+		decoded, err := punycodeDecode(label[4:])
+		if err != nil || !isSafeIDNLabel(decoded) || isWholeScriptConfusable(decoded) {
+			continue
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, ".")
+}
+
+// idnScripts are the scripts isSafeIDNLabel tells apart. Characters of other
+// scripts make a label unsafe.
+var idnScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Greek", unicode.Greek},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Armenian", unicode.Armenian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Thai", unicode.Thai},
+	{"Devanagari", unicode.Devanagari},
+	{"Georgian", unicode.Georgian},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Bopomofo", unicode.Bopomofo},
+}
+
+// isSafeIDNLabel implements the "highly restrictive" profile of Unicode
+// Technical Standard #39.
+func isSafeIDNLabel(label string) bool {
+	used := make(map[string]bool)
+	for _, r := range label {
+		switch {
+		case r == '-' || unicode.IsDigit(r) || unicode.Is(unicode.Inherited, r):
+			continue
+		case !unicode.IsLetter(r) && !unicode.IsMark(r):
+			return false
+		}
+		script := ""
+		for _, candidate := range idnScripts {
+			if unicode.Is(candidate.table, r) {
+				script = candidate.name
+				break
+			}
+		}
+		if script == "" {
+			return false
+		}
+		used[script] = true
+	}
+	if len(used) <= 1 {
+		return true
+	}
+	delete(used, "Latin")
+	delete(used, "Han")
+	switch {
+	case len(used) == 0:
+		return true
+	case len(used) == 1 && (used["Bopomofo"] || used["Hangul"]):
+		return true
+	case len(used) <= 2 && !used["Bopomofo"] && !used["Hangul"]:
+		for script := range used {
+			if script != "Hiragana" && script != "Katakana" {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// latinLookalikes are the Cyrillic, Greek and Armenian letters that look like
+// Latin letters, after the lists Chromium uses for whole-script confusables.
+const latinLookalikes = "асԁеһіјӏорԛѕԝхуъьҽпгѵѡ" + "αικνορτυχ" + "ագզհոսցօ"
+
+// isWholeScriptConfusable reports whether |label| is written with non-Latin
+// letters that all look like Latin ones, so that it can pass for an ASCII
+// name of the same shape.
+func isWholeScriptConfusable(label string) bool {
+	lookalike := false
+	for _, r := range label {
+		switch {
+		case r == '-' || unicode.IsDigit(r) || unicode.Is(unicode.Inherited, r):
+			continue
+		case !strings.ContainsRune(latinLookalikes, r):
+			return false
+		}
+		lookalike = true
+	}
+	return lookalike
+}
+
+// punycodeDecode decodes a host label encoded as described in RFC 3492.
+func punycodeDecode(encoded string) (string, error) {
+	var output []rune
+	basicEnd := strings.LastIndexByte(encoded, '-')
+	if basicEnd > 0 {
+		for i := 0; i < basicEnd; i++ {
+			if encoded[i] >= utf8.RuneSelf {
+				return "", errors.New("non-ASCII character in punycode")
+			}
+			output = append(output, rune(encoded[i]))
+		}
+	}
+	n, i, bias := int32(punycodeInitialN), int32(0), int32(punycodeInitialBias)
+	for position := basicEnd + 1; position < len(encoded); {
+		oldI, w := i, int32(1)
+		for k := int32(punycodeBase); ; k += punycodeBase {
+			if position >= len(encoded) {
+				return "", errors.New("truncated punycode")
+			}
+			c := encoded[position]
+			position++
+			var digit int32
+			switch {
+			case '0' <= c && c <= '9':
+				digit = int32(c-'0') + 26
+			case 'a' <= c && c <= 'z':
+				digit = int32(c - 'a')
+			case 'A' <= c && c <= 'Z':
+				digit = int32(c - 'A')
+			default:
+				return "", fmt.Errorf("invalid punycode digit %q", c)
+			}
+			if digit > (0x7fffffff-i)/w {
+				return "", errors.New("punycode overflow")
+			}
+			i += digit * w
+			t := punycodeThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > 0x7fffffff/(punycodeBase-t) {
+				return "", errors.New("punycode overflow")
+			}
+			w *= punycodeBase - t
+		}
+		length := int32(len(output) + 1)
+		bias = punycodeAdapt(i-oldI, length, oldI == 0)
+		if i/length > 0x7fffffff-n {
+			return "", errors.New("punycode overflow")
+		}
+		n += i / length
+		i %= length
+		if n > unicode.MaxRune || n >= 0xd800 && n <= 0xdfff {
+			return "", errors.New("invalid code point in punycode")
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+	decoded := string(output)
+	reencoded, err := punycodeEncode(decoded)
+	if err != nil || !strings.EqualFold(reencoded, encoded) {
+		return "", errors.New("punycode is not in canonical form")
+	}
+	return decoded, nil
+}
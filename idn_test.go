@@ -0,0 +1,82 @@
+package cronet_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestValidateHostname(t *testing.T) {
+	var policy cronet.IDNPolicy
+	for _, testCase := range []struct {
+		host  string
+		ascii string
+	}{
+		{"Example.COM", "example.com"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de"},
+		{"example.com.", "example.com."},
+		{"0x7f.0.0.1", "127.0.0.1"},
+		{"::1", "[::1]"},
+	} {
+		ascii, err := policy.ValidateHostname(testCase.host)
+		if err != nil {
+			t.Errorf("ValidateHostname(%q): %v", testCase.host, err)
+			continue
+		}
+		if ascii != testCase.ascii {
+			t.Errorf("ValidateHostname(%q) = %q, want %q", testCase.host, ascii, testCase.ascii)
+		}
+	}
+	for _, host := range []string{
+		"",
+		"exa mple.com",
+		"a..b",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat("a.", 127) + "com",
+		"xn--zz-!.com",
+		"1.2.3.256",
+	} {
+		_, err := policy.ValidateHostname(host)
+		if !errors.Is(err, cronet.ErrInvalidHostname) || !errors.Is(err, cronet.ErrInvalidURL) {
+			t.Errorf("ValidateHostname(%q): expected ErrInvalidHostname, got %v", host, err)
+		}
+	}
+	asciiOnly := cronet.IDNPolicy{ASCIIOnly: true}
+	if _, err := asciiOnly.ValidateHostname("bücher.de"); !errors.Is(err, cronet.ErrInvalidHostname) {
+		t.Errorf("ASCIIOnly accepted a non-ASCII host: %v", err)
+	}
+	if _, err := asciiOnly.ValidateHostname("xn--bcher-kva.de"); err != nil {
+		t.Errorf("ASCIIOnly rejected a punycode host: %v", err)
+	}
+}
+
+func TestDisplayHost(t *testing.T) {
+	var policy cronet.IDNPolicy
+	for _, testCase := range []struct {
+		host    string
+		display string
+	}{
+		{"xn--bcher-kva.de", "bücher.de"},
+		{"xn--mnchen-3ya.example", "münchen.example"},
+		{"xn--fsqu00a.xn--55qx5d", "例子.公司"},
+		// Cyrillic "а" followed by Latin "pple"
+		{"xn--pple-43d.com", "xn--pple-43d.com"},
+		// "аррӏе" and "ѕсоре" written only with Cyrillic letters
+		{"xn--80ak6aa92e.com", "xn--80ak6aa92e.com"},
+		{"xn--e1argc3h.com", "xn--e1argc3h.com"},
+		// Cyrillic words with letters that do not look like Latin ones
+		{"xn--e1afmkfd.xn--p1ai", "пример.рф"},
+		{"example.com", "example.com"},
+	} {
+		display := policy.DisplayHost(testCase.host)
+		if display != testCase.display {
+			t.Errorf("DisplayHost(%q) = %q, want %q", testCase.host, display, testCase.display)
+		}
+	}
+	if display := (cronet.IDNPolicy{DisplayPunycode: true}).DisplayHost("xn--bcher-kva.de"); display != "xn--bcher-kva.de" {
+		t.Errorf("DisplayPunycode decoded the host to %q", display)
+	}
+}
@@ -0,0 +1,79 @@
+package cronet
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InformationalResponse is a 1xx response a request received before its
+// final response, e.g. 103 Early Hints with Link headers of resources to
+// preload.
+type InformationalResponse struct {
+	// SourceID is the NetLog source ID of the request. Match it to a request
+	// with ReadNetLogRequestIDs.
+	SourceID   int64
+	Time       time.Time
+	StatusCode int
+	Header     http.Header
+}
+
+// ReadNetLogInformationalResponses returns the 103 Early Hints responses
+// logged to the NetLog file at |path|, in the order they were received.
+//
+// The C API has no callback for informational responses, the network stack
+// reads past them to the final response, so they are only known from the
+// NetLog once the request is underway; see Capabilities.InformationalResponses.
+// Other 1xx responses are not logged as such, ReadNetLogRawResponseHeaders
+// returns those received over HTTP/1.
+func ReadNetLogInformationalResponses(path string) ([]InformationalResponse, error) {
+	var responses []InformationalResponse
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		if event.Type != "HTTP_TRANSACTION_READ_EARLY_HINTS_RESPONSE_HEADERS" {
+			return nil
+		}
+		var params struct {
+			Headers []string `json:"headers"`
+		}
+		if json.Unmarshal(event.Params, &params) != nil || len(params.Headers) == 0 {
+			return nil
+		}
+		statusCode, header := parseNetLogResponseHeaders(params.Headers)
+		if statusCode == 0 {
+			return nil
+		}
+		responses = append(responses, InformationalResponse{
+			SourceID:   event.SourceID,
+			Time:       event.Time,
+			StatusCode: statusCode,
+			Header:     header,
+		})
+		return nil
+	})
+	return responses, err
+}
+
+// parseNetLogResponseHeaders parses the logged headers of a response, the
+// status line, e.g. "HTTP/1.1 103", followed by "name: value" lines. The
+// status code is zero if the status line is malformed.
+func parseNetLogResponseHeaders(lines []string) (int, http.Header) {
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return 0, nil
+	}
+	statusCode, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, nil
+	}
+	header := make(http.Header)
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return statusCode, header
+}
@@ -0,0 +1,36 @@
+package cronet_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadNetLogInformationalResponses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"HTTP_TRANSACTION_READ_EARLY_HINTS_RESPONSE_HEADERS":1,"HTTP_TRANSACTION_READ_RESPONSE_HEADERS":2},`+
+		`"logSourceType":{"URL_REQUEST":1},"timeTickOffset":"1700000000000"},"events":[`+
+		`{"type":1,"phase":0,"time":"5","source":{"id":3,"type":1},"params":{"headers":["HTTP/1.1 103","link: </style.css>; rel=preload; as=style","link: </app.js>; rel=preload; as=script"]}},`+
+		`{"type":1,"phase":0,"time":"6","source":{"id":3,"type":1},"params":{"headers":["malformed"]}},`+
+		`{"type":2,"phase":0,"time":"7","source":{"id":3,"type":1},"params":{"headers":["HTTP/1.1 200","content-type: text/html"]}}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses, err := cronet.ReadNetLogInformationalResponses(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 {
+		t.Fatal("unexpected responses", responses)
+	}
+	response := responses[0]
+	if response.SourceID != 3 || response.StatusCode != 103 || response.Time.UnixMilli() != 1700000000005 {
+		t.Error("unexpected response", response)
+	}
+	if links := response.Header.Values("Link"); len(links) != 2 || links[1] != "</app.js>; rel=preload; as=script" {
+		t.Error("unexpected links", links)
+	}
+}
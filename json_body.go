@@ -0,0 +1,35 @@
+package cronet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// SetJSONBody sets the body of |request| to |v| encoded as JSON and
+// followed by a newline, as json.Encoder writes it, with Content-Type
+// application/json. The body is encoded once, so its length is known and
+// it can be sent again, e.g. on a redirect. The error of encoding |v| is
+// returned, leaving |request| unchanged.
+func SetJSONBody(request *http.Request, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	request.ContentLength = int64(len(body))
+	request.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// DecodeJSON decodes the JSON body of |response| into |v| as it is read and
+// closes the body. The Content-Type is not checked.
+func DecodeJSON(response *http.Response, v any) error {
+	defer response.Body.Close()
+	return json.NewDecoder(response.Body).Decode(v)
+}
@@ -0,0 +1,72 @@
+package cronet_test
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestJSONBody(t *testing.T) {
+	type message struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodPost, "https://example.com/echo").
+		WithHeader("Content-Type", "application/json").
+		WithBody(func(body []byte) bool {
+			return string(body) == `{"name":"test","count":2}`+"\n"
+		}).
+		RespondString(http.StatusOK, `{"name":"reply","count":3}`)
+	transport := &cronet.RoundTripper{Interceptor: interceptor}
+
+	request, _ := http.NewRequest(http.MethodPost, "https://example.com/echo", nil)
+	if err := cronet.SetJSONBody(request, message{"test", 2}); err != nil {
+		t.Fatal(err)
+	}
+	if request.ContentLength != int64(len(`{"name":"test","count":2}`+"\n")) {
+		t.Error("unexpected content length", request.ContentLength)
+	}
+	rewound, err := request.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(rewound)
+	rewound.Close()
+	if string(body) != `{"name":"test","count":2}`+"\n" {
+		t.Errorf("unexpected rewound body %q", body)
+	}
+
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply message
+	if err := cronet.DecodeJSON(response, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != (message{"reply", 3}) || response.StatusCode != http.StatusOK {
+		t.Error("unexpected reply", response.StatusCode, reply)
+	}
+
+	// A body that is never read can be closed
+	request, _ = http.NewRequest(http.MethodPost, "https://example.com/echo", nil)
+	if err := cronet.SetJSONBody(request, message{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := request.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A value that can not be encoded leaves the request unchanged
+	request, _ = http.NewRequest(http.MethodPost, "https://example.com/echo", nil)
+	if err := cronet.SetJSONBody(request, make(chan int)); err == nil {
+		t.Fatal("expected an error for a channel")
+	}
+	if request.Body != nil || request.Header.Get("Content-Type") != "" {
+		t.Fatal("request changed by a failed encoding")
+	}
+}
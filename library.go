@@ -0,0 +1,137 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// #include <cronet_c.h>
+import "C"
+
+import (
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+// nativeLibrary reports whether the package links the native library, which
+// builds with the cronet_nolib tag do not.
+const nativeLibrary = true
+
+// The native library has process-wide state, its thread pool, network change
+// notifier and NetLog, which every engine shares. It is created with the
+// first engine and cannot be torn down, so the library is reference counted
+// on the Go side: each engine and each InitLibrary call holds a reference.
+var (
+	libraryAccess     sync.Mutex
+	libraryReferences int
+	libraryEngines    = make(map[uintptr]string)
+)
+
+// InitLibrary initializes the process-wide state of the native library and
+// holds a reference to it until ReleaseLibrary. Calling it is optional, as
+// NewEngine initializes the library as well; it moves the initialization cost
+// to program start and keeps LibraryReferences above zero between engines.
+func InitLibrary() {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	if libraryReferences == 0 {
+		// An engine that is never started initializes the global state only
+		C.Cronet_Engine_Destroy(C.Cronet_Engine_Create())
+	}
+	libraryReferences++
+}
+
+// ReleaseLibrary releases a reference taken by InitLibrary. The native state
+// stays alive until the process exits.
+func ReleaseLibrary() {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	if libraryReferences > 0 {
+		libraryReferences--
+	}
+}
+
+// LibraryReferences returns the number of engines that were not destroyed
+// plus the number of InitLibrary calls not yet released, e.g. to check for
+// leaked engines.
+func LibraryReferences() int {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	return libraryReferences
+}
+
+// nativeVersion returns the version string of the linked library.
+func nativeVersion() string {
+	engine := NewEngine()
+	defer engine.Destroy()
+	return engine.Version()
+}
+
+// newLibraryEngine creates an engine holding a library reference. Creation
+// is serialized, so the global state is set up once even when engines are
+// created concurrently.
+func newLibraryEngine() Engine {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	engine := Engine{C.Cronet_Engine_Create()}
+	libraryEngines[uintptr(unsafe.Pointer(engine.ptr))] = ""
+	libraryReferences++
+	return engine
+}
+
+// releaseLibraryEngine releases the library reference of |engine|. Engines
+// destroyed twice or not created by NewEngine are ignored.
+func releaseLibraryEngine(engine Engine) {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	if _, loaded := libraryEngines[uintptr(unsafe.Pointer(engine.ptr))]; loaded {
+		delete(libraryEngines, uintptr(unsafe.Pointer(engine.ptr)))
+		libraryReferences--
+	}
+}
+
+// claimStoragePath records that |engine| starts with |storagePath| and
+// reports false if another engine uses it. Cronet aborts the process in that
+// case unless EngineParams.SetEnableCheckResult(false) is set.
+func claimStoragePath(engine Engine, storagePath string) bool {
+	if storagePath == "" {
+		return true
+	}
+	if absolutePath, err := filepath.Abs(storagePath); err == nil {
+		storagePath = absolutePath
+	}
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	for other, otherPath := range libraryEngines {
+		if otherPath == storagePath && other != uintptr(unsafe.Pointer(engine.ptr)) {
+			return false
+		}
+	}
+	// An engine that already started keeps its path; starting it again fails natively
+	if currentPath, loaded := libraryEngines[uintptr(unsafe.Pointer(engine.ptr))]; loaded && currentPath == "" {
+		libraryEngines[uintptr(unsafe.Pointer(engine.ptr))] = storagePath
+	}
+	return true
+}
+
+// releaseStoragePath records that |engine| no longer uses its storage path.
+func releaseStoragePath(engine Engine) {
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	if _, loaded := libraryEngines[uintptr(unsafe.Pointer(engine.ptr))]; loaded {
+		libraryEngines[uintptr(unsafe.Pointer(engine.ptr))] = ""
+	}
+}
+
+// storagePathInUse reports whether a running engine uses |storagePath|.
+func storagePathInUse(storagePath string) bool {
+	if absolutePath, err := filepath.Abs(storagePath); err == nil {
+		storagePath = absolutePath
+	}
+	libraryAccess.Lock()
+	defer libraryAccess.Unlock()
+	for _, enginePath := range libraryEngines {
+		if enginePath == storagePath {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build cronet_nolib
+
+package cronet
+
+// nativeLibrary reports whether the package links the native library, which
+// builds with the cronet_nolib tag do not.
+const nativeLibrary = false
+
+// nativeVersion returns the version string of the linked library, empty as
+// there is none.
+func nativeVersion() string {
+	return ""
+}
@@ -0,0 +1,90 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestManyEngines(t *testing.T) {
+	cronet.InitLibrary()
+	defer cronet.ReleaseLibrary()
+	references := cronet.LibraryReferences()
+
+	const engineCount = 32
+	storageRoot := t.TempDir()
+	engines := make([]cronet.Engine, engineCount)
+	var wg sync.WaitGroup
+	for i := range engines {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			storagePath := filepath.Join(storageRoot, strconv.Itoa(i))
+			err := os.Mkdir(storagePath, 0o700)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			params := cronet.NewEngineParams()
+			params.SetEnableHTTP2(true)
+			params.SetStoragePath(storagePath)
+			params.SetHTTPCacheMode(cronet.HTTPCacheModeDisk)
+			engines[i] = cronet.NewEngine()
+			result := engines[i].StartWithParams(params)
+			params.Destroy()
+			if result != cronet.ResultSuccess {
+				t.Error("start engine", i, result)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	if cronet.LibraryReferences() != references+engineCount {
+		t.Fatal("bad references", cronet.LibraryReferences())
+	}
+
+	// A storage path can only be used by one engine at a time
+	params := cronet.NewEngineParams()
+	params.SetStoragePath(filepath.Join(storageRoot, "0"))
+	duplicate := cronet.NewEngine()
+	result := duplicate.StartWithParams(params)
+	params.Destroy()
+	duplicate.Destroy()
+	if result != cronet.ResultIllegalStateStoragePathInUse {
+		t.Fatal("duplicate storage path started", result)
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(engine cronet.Engine) {
+			defer wg.Done()
+			client := &http.Client{Transport: &cronet.RoundTripper{Engine: engine}}
+			response, err := client.Get("https://cloudflare.com/cdn-cgi/trace")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			response.Body.Close()
+		}(engines[i])
+	}
+	wg.Wait()
+
+	for i, engine := range engines {
+		if result := engine.Shutdown(); result != cronet.ResultSuccess {
+			t.Error("shutdown engine", i, result)
+		}
+		engine.Destroy()
+	}
+	if cronet.LibraryReferences() != references {
+		t.Fatal("references left", cronet.LibraryReferences())
+	}
+}
@@ -0,0 +1,160 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// ErrNetLogActive is returned by LookupHost while a NetLog runs on the engine.
+var ErrNetLogActive = errors.New("cronet: NetLog already running")
+
+// lookupHostAccess serializes LookupHost calls, as the NetLog they read is
+// shared by all engines.
+var lookupHostAccess sync.Mutex
+
+// LookupHost resolves |host| with the resolver of the engine, including its
+// DNS-over-HTTPS, AsyncDNS and host resolver rules configuration, and returns
+// the addresses requests to the host connect to. Cached results are returned
+// as the engine would use them.
+//
+// The C API has no resolver access, so LookupHost resolves the host like
+// PrefetchDNS and reads the result from a NetLog it records meanwhile. An
+// engine runs one NetLog at a time, so LookupHost fails with ErrNetLogActive
+// while one started with Engine.StartNetLogToFile or Engine.MonitorConnections
+// is running, and a NetLog started during the lookup is not recorded.
+func (e Engine) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	lookupHostAccess.Lock()
+	defer lookupHostAccess.Unlock()
+	if _, active := engineNetLogs.load(uintptr(unsafe.Pointer(e.ptr))); active {
+		return nil, ErrNetLogActive
+	}
+	directory, err := os.MkdirTemp("", "cronet-lookup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(directory)
+	netLogPath := filepath.Join(directory, "netlog.json")
+	if !e.StartNetLogToFile(netLogPath, false) {
+		return nil, errors.New("cronet: failed to start NetLog for host lookup")
+	}
+	executor := newGoroutineExecutor()
+	err = e.prefetchHost(ctx, executor, host)
+	e.StopNetLog()
+	executor.Destroy()
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, IsNotFound: isNameNotResolved(err)}
+	}
+	addresses, err := ReadNetLogHostAddresses(netLogPath, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, &net.DNSError{Err: "no addresses in NetLog", Name: host}
+	}
+	return addresses, nil
+}
+
+func isNameNotResolved(err error) bool {
+	var cronetErr *ErrorGo
+	return errors.As(err, &cronetErr) && cronetErr.ErrorCode == ErrorCodeErrorHostnameNotResolved
+}
+
+// ReadNetLogHostAddresses returns the addresses the host resolver logged for
+// |host| to the NetLog file at |path|, in the order they were logged and
+// without duplicates, as LookupHost does.
+func ReadNetLogHostAddresses(path string, host string) ([]string, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	resolving := make(map[int64]bool)
+	addressesBySource := make(map[int64][]string)
+	var sourceOrder []int64
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		if !strings.HasPrefix(event.Type, "HOST_RESOLVER") || len(event.Params) == 0 {
+			return nil
+		}
+		var params map[string]any
+		if json.Unmarshal(event.Params, &params) != nil {
+			return nil
+		}
+		if loggedHost, _ := params["host"].(string); loggedHost != "" && netLogHostMatches(loggedHost, host) {
+			resolving[event.SourceID] = true
+		}
+		addresses := collectNetLogAddresses(params, nil)
+		if len(addresses) > 0 {
+			if _, loaded := addressesBySource[event.SourceID]; !loaded {
+				sourceOrder = append(sourceOrder, event.SourceID)
+			}
+			addressesBySource[event.SourceID] = append(addressesBySource[event.SourceID], addresses...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var addresses []string
+	for _, sourceID := range sourceOrder {
+		if !resolving[sourceID] {
+			continue
+		}
+		for _, address := range addressesBySource[sourceID] {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, nil
+}
+
+// netLogHostMatches reports whether a host logged by the resolver, e.g.
+// "example.com", "example.com:443" or "https://example.com:443", is |host|.
+func netLogHostMatches(loggedHost string, host string) bool {
+	if index := strings.Index(loggedHost, "://"); index >= 0 {
+		loggedHost = loggedHost[index+3:]
+	}
+	if splitHost, _, err := net.SplitHostPort(loggedHost); err == nil {
+		loggedHost = splitHost
+	}
+	return strings.TrimSuffix(strings.ToLower(loggedHost), ".") == host
+}
+
+// collectNetLogAddresses appends the IP addresses found in the address fields
+// of |value| to |addresses|. Resolver results are logged in different shapes
+// across versions: address lists of "ip:port" strings, or endpoint objects
+// with an address field.
+func collectNetLogAddresses(value any, addresses []string) []string {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			switch key {
+			case "address", "address_list", "addresses", "ip_endpoints", "endpoints", "results":
+				addresses = collectNetLogAddresses(field, addresses)
+			}
+		}
+	case []any:
+		for _, element := range value {
+			addresses = collectNetLogAddresses(element, addresses)
+		}
+	case string:
+		address := value
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			address = host
+		}
+		if ip := net.ParseIP(address); ip != nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,67 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadNetLogHostAddresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"HOST_RESOLVER_MANAGER_REQUEST":1,"HOST_RESOLVER_MANAGER_JOB":2,"HOST_RESOLVER_DNS_TASK":3,"URL_REQUEST_START_JOB":4},`+
+		`"logSourceType":{"HOST_RESOLVER_IMPL_REQUEST":1,"HOST_RESOLVER_IMPL_JOB":2,"URL_REQUEST":3},"timeTickOffset":"1700000000000"},"events":[`+
+		// Endpoint objects of a request for https://Example.COM.:443
+		`{"type":1,"phase":1,"time":"1","source":{"id":1,"type":1},"params":{"host":"https://Example.COM.:443"}},`+
+		`{"type":1,"phase":2,"time":"2","source":{"id":1,"type":1},"params":{"results":{"ip_endpoints":[{"address":"192.0.2.1","port":443},{"address":"2001:db8::1","port":443}]}}},`+
+		// An address list of a job for example.com:443, repeating one address
+		`{"type":2,"phase":1,"time":"3","source":{"id":2,"type":2},"params":{"host":"example.com:443"}},`+
+		`{"type":2,"phase":2,"time":"4","source":{"id":2,"type":2},"params":{"address_list":["192.0.2.1:443","192.0.2.2:443","not an address"]}},`+
+		// Another host and events other than the resolver's
+		`{"type":3,"phase":1,"time":"5","source":{"id":3,"type":2},"params":{"host":"other.example"}},`+
+		`{"type":3,"phase":2,"time":"6","source":{"id":3,"type":2},"params":{"addresses":["192.0.2.9"]}},`+
+		`{"type":4,"phase":0,"time":"7","source":{"id":4,"type":3},"params":{"host":"example.com","address":"192.0.2.10"}}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := cronet.ReadNetLogHostAddresses(path, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"}
+	if len(addresses) != len(want) {
+		t.Fatal("unexpected addresses", addresses)
+	}
+	for i := range want {
+		if addresses[i] != want[i] {
+			t.Fatal("unexpected addresses", addresses)
+		}
+	}
+	addresses, err = cronet.ReadNetLogHostAddresses(path, "example")
+	if err != nil || len(addresses) != 0 {
+		t.Fatal("expected no addresses for a host prefix, got", addresses, err)
+	}
+}
+
+func TestLookupHostWithNetLog(t *testing.T) {
+	engine := newFirstByteEngine(t)
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	if !engine.StartNetLogToFile(path, false) {
+		t.Fatal("failed to start NetLog")
+	}
+	if _, err := engine.LookupHost(context.Background(), "localhost"); err != cronet.ErrNetLogActive {
+		t.Fatal("expected ErrNetLogActive, got", err)
+	}
+	// Address literals need no NetLog
+	if addresses, err := engine.LookupHost(context.Background(), "[::1]"); err != nil || len(addresses) != 1 || addresses[0] != "::1" {
+		t.Fatal("unexpected literal lookup", addresses, err)
+	}
+	engine.StopNetLog()
+	if _, err := engine.LookupHost(context.Background(), "localhost"); err == cronet.ErrNetLogActive {
+		t.Fatal("expected the lookup to run after StopNetLog")
+	}
+}
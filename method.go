@@ -0,0 +1,61 @@
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidMethod is wrapped by the errors of requests with a method that is
+// not a valid HTTP token, e.g. one containing whitespace or NUL.
+var ErrInvalidMethod = errors.New("cronet: invalid HTTP method")
+
+// ValidMethod reports whether |method| is a valid HTTP method, a token of
+// RFC 9110. Methods are case-sensitive; the standard ones are upper case.
+func ValidMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		if !isTokenChar(method[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+	}
+}
+
+// checkMethod returns an error wrapping ErrInvalidMethod for an invalid
+// method. The empty method stands for GET.
+func checkMethod(method string) error {
+	if method != "" && !ValidMethod(method) {
+		return fmt.Errorf("%w: %q", ErrInvalidMethod, method)
+	}
+	return nil
+}
+
+// responseBodyAllowed reports whether a response with |statusCode| to a
+// request with |method| can have a body. Responses to HEAD requests carry
+// the Content-Length of the body a GET would get, but no body.
+func responseBodyAllowed(method string, statusCode int) bool {
+	if method == http.MethodHead {
+		return false
+	}
+	switch {
+	case statusCode >= 100 && statusCode < 200:
+		return false
+	case statusCode == http.StatusNoContent, statusCode == http.StatusNotModified:
+		return false
+	default:
+		return true
+	}
+}
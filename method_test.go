@@ -0,0 +1,48 @@
+package cronet_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestValidMethod(t *testing.T) {
+	for method, valid := range map[string]bool{
+		"GET":        true,
+		"PROPFIND":   true,
+		"M-SEARCH":   true,
+		"get":        true,
+		"":           false,
+		"GET ":       false,
+		"GE\x00T":    false,
+		"POST\r\n":   false,
+		"GET\tX":     false,
+		"(GET)":      false,
+		"MÉTHODE":    false,
+		"GET/HTTP/1": false,
+	} {
+		if cronet.ValidMethod(method) != valid {
+			t.Errorf("ValidMethod(%q) != %v", method, valid)
+		}
+	}
+}
+
+func TestRoundTripperInvalidMethod(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "ok")
+	transport := &cronet.RoundTripper{Interceptor: interceptor}
+	request, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	request.Method = "GET\x00"
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrInvalidMethod) {
+		t.Fatal("expected ErrInvalidMethod, got", err)
+	}
+	request.Method = http.MethodGet
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -179,3 +181,23 @@ func (m Metrics) SentByteCount() int64 {
 func (m Metrics) ReceivedByteCount() int64 {
 	return int64(C.Cronet_Metrics_received_byte_count_get(m.ptr))
 }
+
+// Times returns the timestamps of the metrics mapped by |clock| to Go's
+// monotonic clock.
+func (m Metrics) Times(clock MetricsClock) MetricsTimes {
+	return MetricsTimes{
+		RequestStart:  clock.Time(m.RequestStart().value()),
+		DNSStart:      clock.Time(m.DNSStart().value()),
+		DNSEnd:        clock.Time(m.DNSEnd().value()),
+		ConnectStart:  clock.Time(m.ConnectStart().value()),
+		ConnectEnd:    clock.Time(m.ConnectEnd().value()),
+		SSLStart:      clock.Time(m.SSLStart().value()),
+		SSLEnd:        clock.Time(m.SSLEnd().value()),
+		SendingStart:  clock.Time(m.SendingStart().value()),
+		SendingEnd:    clock.Time(m.SendingEnd().value()),
+		PushStart:     clock.Time(m.PushStart().value()),
+		PushEnd:       clock.Time(m.PushEnd().value()),
+		ResponseStart: clock.Time(m.ResponseStart().value()),
+		ResponseEnd:   clock.Time(m.ResponseEnd().value()),
+	}
+}
@@ -0,0 +1,61 @@
+package cronet
+
+import "time"
+
+// MetricsClock relates the timestamps of Metrics to Go's monotonic clock, so
+// they can be merged with spans timed with time.Now.
+//
+// Metrics timestamps are milliseconds of the system clock: the network stack
+// times events with a monotonic clock and offsets them by the system clock at
+// the start of the request. A MetricsClock pairs a system clock reading with
+// a monotonic one, and maps timestamps through that pair to times carrying a
+// monotonic reading, whose differences to other monotonic times hold while
+// the system clock is adjusted.
+type MetricsClock struct {
+	wall      time.Time
+	monotonic time.Time
+}
+
+// NewMetricsClock returns a MetricsClock calibrated at |now|, a time.Now
+// reading, e.g. the start of the span of a request. Calibrating close to the
+// start of the requests keeps Skew small.
+func NewMetricsClock(now time.Time) MetricsClock {
+	return MetricsClock{wall: now.Round(0), monotonic: now}
+}
+
+// Time returns |timestamp|, read from Metrics, as the time it stands for on
+// the monotonic clock of the calibration. The zero time, a metric that was
+// not recorded, is returned unchanged.
+func (c MetricsClock) Time(timestamp time.Time) time.Time {
+	if timestamp.IsZero() {
+		return timestamp
+	}
+	return c.monotonic.Add(timestamp.Round(0).Sub(c.wall))
+}
+
+// Skew returns how far the system clock moved against the monotonic clock
+// since the calibration, e.g. by NTP adjustments. Timestamps of requests
+// started since then are mapped off by as much; calibrate again once it
+// matters.
+func (c MetricsClock) Skew() time.Duration {
+	now := time.Now()
+	return now.Round(0).Sub(c.wall) - now.Sub(c.monotonic)
+}
+
+// MetricsTimes are the timestamps of Metrics mapped by a MetricsClock. Times
+// of events that were not recorded are zero.
+type MetricsTimes struct {
+	RequestStart  time.Time
+	DNSStart      time.Time
+	DNSEnd        time.Time
+	ConnectStart  time.Time
+	ConnectEnd    time.Time
+	SSLStart      time.Time
+	SSLEnd        time.Time
+	SendingStart  time.Time
+	SendingEnd    time.Time
+	PushStart     time.Time
+	PushEnd       time.Time
+	ResponseStart time.Time
+	ResponseEnd   time.Time
+}
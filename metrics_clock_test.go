@@ -0,0 +1,29 @@
+package cronet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestMetricsClock(t *testing.T) {
+	now := time.Now()
+	clock := cronet.NewMetricsClock(now)
+	// Metrics timestamps are milliseconds of the system clock
+	timestamp := time.UnixMilli(now.UnixMilli()).Add(1500 * time.Millisecond)
+	mapped := clock.Time(timestamp)
+	if elapsed := mapped.Sub(now); elapsed <= time.Second || elapsed > 1500*time.Millisecond {
+		t.Fatal("unexpected time from calibration", elapsed)
+	}
+	// The mapped time carries a monotonic reading, which Round(0) strips
+	if mapped.Round(0) == mapped {
+		t.Fatal("expected a monotonic reading")
+	}
+	if !clock.Time(time.Time{}).IsZero() {
+		t.Fatal("expected the zero time to stay zero")
+	}
+	if skew := clock.Skew(); skew > time.Second || skew < -time.Second {
+		t.Fatal("unexpected skew", skew)
+	}
+}
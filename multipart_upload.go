@@ -0,0 +1,315 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MultipartUpload is an UploadDataProviderHandler streaming a multipart/form-data
+// body. File contents are read part by part while Cronet uploads, so files are
+// never buffered in memory as a whole.
+//
+// The Content-Type header of the request must be set to FormDataContentType().
+type MultipartUpload struct {
+	boundary string
+	parts    []*multipartPart
+	closed   bool
+
+	index   int
+	offset  int64
+	current io.Reader
+	opened  io.Closer
+}
+
+type multipartPart struct {
+	header []byte
+
+	content io.Reader
+	size    int64
+	start   int64
+	path    string
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipartUpload creates an empty MultipartUpload with a random boundary.
+func NewMultipartUpload() *MultipartUpload {
+	return &MultipartUpload{
+		boundary: multipart.NewWriter(io.Discard).Boundary(),
+	}
+}
+
+// Boundary returns the boundary separating the parts.
+func (u *MultipartUpload) Boundary() string {
+	return u.boundary
+}
+
+// SetBoundary overrides the random boundary. It must be called before any part is added.
+func (u *MultipartUpload) SetBoundary(boundary string) error {
+	if len(u.parts) > 0 {
+		return errors.New("cronet: SetBoundary called after parts were added")
+	}
+	err := multipart.NewWriter(io.Discard).SetBoundary(boundary)
+	if err != nil {
+		return err
+	}
+	u.boundary = boundary
+	return nil
+}
+
+// FormDataContentType returns the Content-Type header value for the request.
+func (u *MultipartUpload) FormDataContentType() string {
+	boundary := u.boundary
+	if strings.ContainsAny(boundary, `()<>@,;:\"/[]?= `) {
+		boundary = `"` + boundary + `"`
+	}
+	return "multipart/form-data; boundary=" + boundary
+}
+
+// AddField adds a form field with the given value.
+func (u *MultipartUpload) AddField(name string, value string) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(name)))
+	u.AddPart(header, strings.NewReader(value), int64(len(value)))
+}
+
+// AddFile adds a file part read from |content|. |size| is the exact number of
+// bytes content will produce, or -1 if unknown, which makes the upload chunked.
+// If content implements io.Seeker, the upload can be rewound for redirects and
+// retries.
+func (u *MultipartUpload) AddFile(fieldName string, fileName string, content io.Reader, size int64) {
+	u.AddPart(fileHeader(fieldName, fileName), content, size)
+}
+
+// AddFileFromPath adds a file part read from the file at |path|. The file is
+// opened only when the upload reaches it and reopened on rewind.
+func (u *MultipartUpload) AddFileFromPath(fieldName string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cronet: %s is not a regular file", path)
+	}
+	part := u.newPart(fileHeader(fieldName, filepath.Base(path)))
+	part.path = path
+	part.size = info.Size()
+	return nil
+}
+
+// AddPart adds a part with arbitrary MIME headers. See AddFile for |content| and |size|.
+func (u *MultipartUpload) AddPart(header textproto.MIMEHeader, content io.Reader, size int64) {
+	part := u.newPart(header)
+	part.content = content
+	part.size = size
+	if seeker, isSeeker := content.(io.Seeker); isSeeker {
+		part.start, _ = seeker.Seek(0, io.SeekCurrent)
+	}
+}
+
+func fileHeader(fieldName string, fileName string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(fieldName), quoteEscaper.Replace(fileName)))
+	header.Set("Content-Type", "application/octet-stream")
+	return header
+}
+
+func (u *MultipartUpload) newPart(header textproto.MIMEHeader) *multipartPart {
+	var buffer bytes.Buffer
+	if len(u.parts) > 0 {
+		fmt.Fprintf(&buffer, "\r\n--%s\r\n", u.boundary)
+	} else {
+		fmt.Fprintf(&buffer, "--%s\r\n", u.boundary)
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(&buffer, "%s: %s\r\n", key, value)
+		}
+	}
+	buffer.WriteString("\r\n")
+	part := &multipartPart{header: buffer.Bytes()}
+	u.parts = append(u.parts, part)
+	return part
+}
+
+func (u *MultipartUpload) trailer() []byte {
+	if len(u.parts) > 0 {
+		return []byte(fmt.Sprintf("\r\n--%s--\r\n", u.boundary))
+	}
+	return []byte(fmt.Sprintf("--%s--\r\n", u.boundary))
+}
+
+// ContentLength returns the total size of the body, or -1 if the size of any
+// part is unknown.
+func (u *MultipartUpload) ContentLength() int64 {
+	length := int64(len(u.trailer()))
+	for _, part := range u.parts {
+		if part.size < 0 {
+			return -1
+		}
+		length += int64(len(part.header)) + part.size
+	}
+	return length
+}
+
+// Length implements UploadDataProviderHandler.
+func (u *MultipartUpload) Length(self UploadDataProvider) int64 {
+	return u.ContentLength()
+}
+
+// Read implements UploadDataProviderHandler.
+func (u *MultipartUpload) Read(self UploadDataProvider, sink UploadDataSink, buffer Buffer) {
+	n, err := u.read(buffer.DataSlice())
+	if err == io.EOF {
+		sink.OnReadSucceeded(int64(n), u.ContentLength() == -1)
+	} else if err != nil {
+		sink.OnReadError(err.Error())
+	} else {
+		sink.OnReadSucceeded(int64(n), false)
+	}
+}
+
+// read fills p from the current segment. Segments are, in order, the header
+// and content of each part followed by the trailer; index counts them.
+func (u *MultipartUpload) read(p []byte) (int, error) {
+	for {
+		if u.index > 2*len(u.parts) {
+			return 0, io.EOF
+		}
+		if u.current == nil {
+			err := u.openSegment()
+			if err != nil {
+				return 0, err
+			}
+		}
+		n, err := u.current.Read(p)
+		u.offset += int64(n)
+		if err == io.EOF {
+			err = u.closeSegment()
+			if err != nil {
+				return n, err
+			}
+			if u.index == 2*len(u.parts)+1 {
+				return n, io.EOF
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func (u *MultipartUpload) openSegment() error {
+	u.offset = 0
+	if u.index == 2*len(u.parts) {
+		u.current = bytes.NewReader(u.trailer())
+		return nil
+	}
+	part := u.parts[u.index/2]
+	if u.index%2 == 0 {
+		u.current = bytes.NewReader(part.header)
+		return nil
+	}
+	content := part.content
+	if part.path != "" {
+		file, err := os.Open(part.path)
+		if err != nil {
+			return err
+		}
+		u.opened = file
+		content = file
+	}
+	if part.size >= 0 {
+		content = io.LimitReader(content, part.size)
+	}
+	u.current = content
+	return nil
+}
+
+func (u *MultipartUpload) closeSegment() error {
+	if u.index%2 == 1 && u.index < 2*len(u.parts) {
+		part := u.parts[u.index/2]
+		if part.size >= 0 && u.offset != part.size {
+			return io.ErrUnexpectedEOF
+		}
+		if u.opened != nil {
+			u.opened.Close()
+			u.opened = nil
+		}
+	}
+	u.current = nil
+	u.index++
+	return nil
+}
+
+// Rewind implements UploadDataProviderHandler. Rewinding fails if a part
+// was added from a reader that is not an io.Seeker.
+func (u *MultipartUpload) Rewind(self UploadDataProvider, sink UploadDataSink) {
+	err := u.rewind()
+	if err != nil {
+		sink.OnRewindError(err.Error())
+		return
+	}
+	sink.OnRewindSucceeded()
+}
+
+func (u *MultipartUpload) rewind() error {
+	for _, part := range u.parts {
+		if part.content == nil {
+			continue
+		}
+		seeker, isSeeker := part.content.(io.Seeker)
+		if !isSeeker {
+			return errors.New("unsupported")
+		}
+		_, err := seeker.Seek(part.start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+	if u.opened != nil {
+		u.opened.Close()
+		u.opened = nil
+	}
+	u.index = 0
+	u.offset = 0
+	u.current = nil
+	return nil
+}
+
+// Close implements UploadDataProviderHandler. It destroys the provider and
+// closes every part content implementing io.Closer.
+func (u *MultipartUpload) Close(self UploadDataProvider) {
+	self.Destroy()
+	if u.closed {
+		return
+	}
+	u.closed = true
+	if u.opened != nil {
+		u.opened.Close()
+		u.opened = nil
+	}
+	for _, part := range u.parts {
+		if closer, isCloser := part.content.(io.Closer); isCloser {
+			closer.Close()
+		}
+	}
+}
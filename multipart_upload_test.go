@@ -0,0 +1,174 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// uploadHandler reads the response of a request sent with the low-level API.
+type uploadHandler struct {
+	status int
+	body   bytes.Buffer
+	err    error
+	done   chan struct{}
+}
+
+func (h *uploadHandler) OnRedirectReceived(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, newLocationUrl string) {
+	request.FollowRedirect()
+}
+
+func (h *uploadHandler) OnResponseStarted(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	h.status = info.StatusCode()
+	buffer := cronet.NewBuffer()
+	buffer.InitWithAlloc(4096)
+	request.Read(buffer)
+}
+
+func (h *uploadHandler) OnReadCompleted(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, buffer cronet.Buffer, bytesRead int64) {
+	h.body.Write(buffer.DataSlice()[:bytesRead])
+	request.Read(buffer)
+}
+
+func (h *uploadHandler) OnSucceeded(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	close(h.done)
+}
+
+func (h *uploadHandler) OnFailed(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo, error cronet.Error) {
+	h.err = cronet.ErrorFromError(error)
+	close(h.done)
+}
+
+func (h *uploadHandler) OnCanceled(self cronet.URLRequestCallback, request cronet.URLRequest, info cronet.URLResponseInfo) {
+	h.err = fmt.Errorf("canceled")
+	close(h.done)
+}
+
+// postUpload posts |upload| to |url| with the low-level API and returns the
+// status and body of the response.
+func postUpload(t *testing.T, engine cronet.Engine, url string, upload *cronet.MultipartUpload) (int, string) {
+	executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {
+		go func() {
+			command.Run()
+			command.Destroy()
+		}()
+	})
+	defer executor.Destroy()
+	handler := &uploadHandler{done: make(chan struct{})}
+	callback := cronet.NewURLRequestCallback(handler)
+	defer callback.Destroy()
+	params := cronet.NewURLRequestParams()
+	params.SetMethod(http.MethodPost)
+	params.AddHeaderValue("Content-Type", upload.FormDataContentType())
+	params.SetUploadDataProvider(cronet.NewUploadDataProvider(upload))
+	params.SetUploadDataExecutor(executor)
+	request := cronet.NewURLRequest()
+	request.InitWithParams(engine, url, params, callback, executor)
+	params.Destroy()
+	request.Start()
+	select {
+	case <-handler.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("request not finished")
+	}
+	request.Destroy()
+	if handler.err != nil {
+		t.Fatal(handler.err)
+	}
+	return handler.status, handler.body.String()
+}
+
+func TestMultipartUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/redirect" {
+			io.Copy(io.Discard, request.Body)
+			http.Redirect(writer, request, "/form", http.StatusTemporaryRedirect)
+			return
+		}
+		if err := request.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := request.FormFile("file")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		fmt.Fprintf(writer, "%d %s %s %s %s", request.ContentLength, request.FormValue("field"), request.FormValue("quoted\"name"), header.Filename, content)
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	newUpload := func(size int64) *cronet.MultipartUpload {
+		upload := cronet.NewMultipartUpload()
+		upload.AddField("field", "value")
+		upload.AddField(`quoted"name`, "other")
+		upload.AddFile("file", "name.txt", bytes.NewReader([]byte("file content")), size)
+		return upload
+	}
+
+	upload := newUpload(int64(len("file content")))
+	length := upload.ContentLength()
+	status, body := postUpload(t, engine, server.URL+"/form", upload)
+	if want := strconv.FormatInt(length, 10) + " value other name.txt file content"; status != http.StatusOK || body != want {
+		t.Fatalf("unexpected response %d %q, want %q", status, body, want)
+	}
+
+	// A file of unknown size makes the upload chunked
+	upload = newUpload(-1)
+	if upload.ContentLength() != -1 {
+		t.Fatal("expected an unknown length, got", upload.ContentLength())
+	}
+	status, body = postUpload(t, engine, server.URL+"/form", upload)
+	if status != http.StatusOK || body != "-1 value other name.txt file content" {
+		t.Fatalf("unexpected chunked response %d %q", status, body)
+	}
+
+	// Parts read from seekers are rewound to send the body again
+	status, body = postUpload(t, engine, server.URL+"/redirect", newUpload(int64(len("file content"))))
+	if status != http.StatusOK || !strings.HasSuffix(body, " value other name.txt file content") {
+		t.Fatalf("unexpected response after redirect %d %q", status, body)
+	}
+}
+
+func TestMultipartUploadBoundary(t *testing.T) {
+	upload := cronet.NewMultipartUpload()
+	if err := upload.SetBoundary("with space"); err != nil {
+		t.Fatal(err)
+	}
+	if contentType := upload.FormDataContentType(); contentType != `multipart/form-data; boundary="with space"` {
+		t.Fatal("unexpected content type", contentType)
+	}
+	if err := upload.SetBoundary(strings.Repeat("x", 71)); err == nil {
+		t.Fatal("expected a boundary over 70 bytes to be rejected")
+	}
+	// An empty form is only the closing delimiter
+	if length := upload.ContentLength(); length != int64(len("--with space--\r\n")) {
+		t.Fatal("unexpected empty length", length)
+	}
+	upload.AddField("a", "b")
+	if err := upload.SetBoundary("other"); err == nil {
+		t.Fatal("expected SetBoundary to fail after parts were added")
+	}
+	want := len("--with space\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nb\r\n--with space--\r\n")
+	if length := upload.ContentLength(); length != int64(want) {
+		t.Fatalf("unexpected length %d, want %d", length, want)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// NativeHandles counts the native objects the package keeps Go state for.
+// Counts that grow over the lifetime of a process indicate objects that are
+// never destroyed.
+type NativeHandles struct {
+	Engines               int
+	Executors             int
+	URLRequestCallbacks   int
+	UploadDataProviders   int
+	BufferCallbacks       int
+	StatusListeners       int
+	FinishedInfoListeners int
+	BidirectionalStreams  int
+}
+
+// CountNativeHandles returns the number of live native objects with Go state.
+func CountNativeHandles() NativeHandles {
+	libraryAccess.Lock()
+	engines := len(libraryEngines)
+	libraryAccess.Unlock()
+	return NativeHandles{
+		Engines:               engines,
+		Executors:             executors.len(),
+		URLRequestCallbacks:   urlRequestCallbacks.len(),
+		UploadDataProviders:   uploadDataProviders.len(),
+		BufferCallbacks:       bufferCallbacks.len(),
+		StatusListeners:       urlRequestStatusListeners.len(),
+		FinishedInfoListeners: urlRequestFinishedInfoListeners.len(),
+		BidirectionalStreams:  bidirectionalStreams.len(),
+	}
+}
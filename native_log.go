@@ -0,0 +1,241 @@
+package cronet
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrNativeLogRedirected = errors.New("cronet: native log already redirected")
+
+// NativeLogConfig configures RedirectNativeLog.
+type NativeLogConfig struct {
+	// Path is a file the native log is appended to.
+	Path string
+	// Handler is called for every line of the native log, on a goroutine
+	// reading it. Lines written right before the process aborts may not reach
+	// Handler; only a Path without Handler is crash-safe. Handler must return
+	// quickly, as writes to standard error block while it is behind.
+	Handler func(message NativeLogMessage)
+	// Stderr also writes the native log to the original standard error.
+	// Requires Handler.
+	Stderr bool
+}
+
+// NativeLogMessage is a line of the native log.
+type NativeLogMessage struct {
+	// Severity is INFO, WARNING, ERROR, FATAL or VERBOSEn, or empty for lines
+	// that are not log messages, e.g. continued messages and stack traces.
+	Severity string
+	File     string
+	Line     int
+	Message  string
+	// Raw is the complete line.
+	Raw string
+}
+
+// NativeCrashError is a fatal native log message, e.g. a failed CHECK.
+type NativeCrashError struct {
+	Message NativeLogMessage
+}
+
+func (e *NativeCrashError) Error() string {
+	return "cronet: native crash at " + e.Message.File + ":" + strconv.Itoa(e.Message.Line) + ": " + e.Message.Message
+}
+
+var (
+	nativeLogAccess  sync.Mutex
+	nativeLogRestore func() error
+)
+
+// RedirectNativeLog redirects the native log, Chromium's LOG() and CHECK()
+// output, from standard error to a file or handler until RestoreNativeLog.
+//
+// The native library has no log hooks, so standard error of the process is
+// redirected, including the output of the Go runtime and of anything else
+// writing to it. This keeps the stack trace the Go runtime prints when the
+// native code aborts next to the failed CHECK; see ReadNativeCrash.
+//
+// A failed CHECK aborts the process on a native thread, which Go cannot
+// recover to a panic.
+//
+// The log level and the VLOG flags --v and --vmodule cannot be set: the C
+// API neither takes Chromium command-line flags nor initializes the command
+// line they are read from, so VERBOSE messages are never logged. To debug
+// QUIC and the other network internals, record a NetLog with
+// Engine.StartNetLogToFile, which with logAll includes every QUIC frame.
+func RedirectNativeLog(config NativeLogConfig) error {
+	if config.Path == "" && config.Handler == nil {
+		return errors.New("cronet: native log needs a path or handler")
+	}
+	nativeLogAccess.Lock()
+	defer nativeLogAccess.Unlock()
+	if nativeLogRestore != nil {
+		return ErrNativeLogRedirected
+	}
+	var file *os.File
+	if config.Path != "" {
+		var err error
+		file, err = os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Handler == nil {
+		restore, err := redirectStderr(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		nativeLogRestore = restore
+		return nil
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}
+	var stderr *os.File
+	if config.Stderr {
+		stderr, err = duplicateStderr()
+		if err != nil {
+			reader.Close()
+			writer.Close()
+			if file != nil {
+				file.Close()
+			}
+			return err
+		}
+	}
+	restoreStderr, err := redirectStderr(writer)
+	writer.Close()
+	if err != nil {
+		reader.Close()
+		if file != nil {
+			file.Close()
+		}
+		if stderr != nil {
+			stderr.Close()
+		}
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readNativeLog(reader, file, stderr, config.Handler)
+		reader.Close()
+		if file != nil {
+			file.Close()
+		}
+		if stderr != nil {
+			stderr.Close()
+		}
+	}()
+	nativeLogRestore = func() error {
+		// Restoring closes the last write end of the pipe, which ends the reader
+		err := restoreStderr()
+		<-done
+		return err
+	}
+	return nil
+}
+
+// RestoreNativeLog writes the native log to standard error again.
+func RestoreNativeLog() error {
+	nativeLogAccess.Lock()
+	defer nativeLogAccess.Unlock()
+	if nativeLogRestore == nil {
+		return nil
+	}
+	err := nativeLogRestore()
+	nativeLogRestore = nil
+	return err
+}
+
+func readNativeLog(reader io.Reader, file *os.File, stderr *os.File, handler func(message NativeLogMessage)) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if file != nil {
+			file.WriteString(line + "\n")
+		}
+		if stderr != nil {
+			stderr.WriteString(line + "\n")
+		}
+		handler(ParseNativeLogMessage(line))
+	}
+}
+
+// ParseNativeLogMessage parses a line of the native log, e.g.
+// "[0102/150405.123456:ERROR:socket.cc(42)] message". Prefixes with process
+// and thread IDs are accepted.
+func ParseNativeLogMessage(line string) NativeLogMessage {
+	message := NativeLogMessage{Raw: line}
+	if !strings.HasPrefix(line, "[") {
+		return message
+	}
+	end := strings.Index(line, "] ")
+	if end < 0 {
+		return message
+	}
+	fields := strings.Split(line[1:end], ":")
+	if len(fields) < 2 {
+		return message
+	}
+	severity, location := fields[len(fields)-2], fields[len(fields)-1]
+	if !isNativeLogSeverity(severity) {
+		return message
+	}
+	open := strings.LastIndexByte(location, '(')
+	if open < 0 || !strings.HasSuffix(location, ")") {
+		return message
+	}
+	lineNumber, err := strconv.Atoi(location[open+1 : len(location)-1])
+	if err != nil {
+		return message
+	}
+	message.Severity = severity
+	message.File = location[:open]
+	message.Line = lineNumber
+	message.Message = line[end+2:]
+	return message
+}
+
+func isNativeLogSeverity(severity string) bool {
+	switch severity {
+	case "INFO", "WARNING", "ERROR", "FATAL":
+		return true
+	default:
+		return strings.HasPrefix(severity, "VERBOSE")
+	}
+}
+
+// ReadNativeCrash returns the last fatal message of the native log file at
+// |path|, e.g. to report after a restart why the previous process aborted.
+// It returns nil if the log has no fatal message. Official builds crash on
+// a failed CHECK without a message, in which case only the signal trace of
+// the Go runtime follows in the log.
+func ReadNativeCrash(path string) (*NativeCrashError, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var crash *NativeCrashError
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		message := ParseNativeLogMessage(scanner.Text())
+		if message.Severity == "FATAL" {
+			crash = &NativeCrashError{Message: message}
+		}
+	}
+	return crash, scanner.Err()
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package cronet
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectStderr points the standard error descriptor of the process to
+// |file| and returns a function pointing it back.
+func redirectStderr(file *os.File) (func() error, error) {
+	saved, err := unix.Dup(int(os.Stderr.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	err = unix.Dup2(int(file.Fd()), int(os.Stderr.Fd()))
+	if err != nil {
+		unix.Close(saved)
+		return nil, err
+	}
+	return func() error {
+		defer unix.Close(saved)
+		return unix.Dup2(saved, int(os.Stderr.Fd()))
+	}, nil
+}
+
+// duplicateStderr returns a file writing to the current standard error.
+func duplicateStderr() (*os.File, error) {
+	fd, err := unix.Dup(int(os.Stderr.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "stderr"), nil
+}
@@ -0,0 +1,51 @@
+package cronet_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestParseNativeLogMessage(t *testing.T) {
+	message := cronet.ParseNativeLogMessage("[1234:5678:0102/150405.123456:ERROR:socket_posix.cc(42)] connect failed: 111")
+	if message.Severity != "ERROR" || message.File != "socket_posix.cc" || message.Line != 42 || message.Message != "connect failed: 111" {
+		t.Fatal("bad message", message)
+	}
+	message = cronet.ParseNativeLogMessage("#0 0x55d0c0a1b2c3 base::debug::CollectStackTrace()")
+	if message.Severity != "" || message.Raw == "" {
+		t.Fatal("bad continuation line", message)
+	}
+}
+
+func TestNativeLogHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "native.log")
+	var messages []cronet.NativeLogMessage
+	err := cronet.RedirectNativeLog(cronet.NativeLogConfig{
+		Path: path,
+		Handler: func(message cronet.NativeLogMessage) {
+			messages = append(messages, message)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr, "[0102/150405.123456:WARNING:quic_session.cc(7)] idle")
+	fmt.Fprintln(os.Stderr, "[0102/150405.123457:FATAL:engine.cc(99)] Check failed: started.")
+	err = cronet.RestoreNativeLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Severity != "WARNING" || messages[1].Severity != "FATAL" {
+		t.Fatal("bad messages", messages)
+	}
+	crash, err := cronet.ReadNativeCrash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crash == nil || crash.Message.File != "engine.cc" || crash.Message.Message != "Check failed: started." {
+		t.Fatal("bad crash", crash)
+	}
+}
@@ -0,0 +1,18 @@
+package cronet
+
+import (
+	"errors"
+	"os"
+)
+
+// The native library writes its log through the C runtime, whose standard
+// error handle is fixed at startup, so it cannot be redirected on Windows.
+var errNativeLogUnsupported = errors.New("cronet: native log redirection is not supported on Windows")
+
+func redirectStderr(file *os.File) (func() error, error) {
+	return nil, errNativeLogUnsupported
+}
+
+func duplicateStderr() (*os.File, error) {
+	return nil, errNativeLogUnsupported
+}
@@ -0,0 +1,155 @@
+package cronet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// NetLogPhase is the phase of a NetLog event.
+type NetLogPhase int
+
+const (
+	NetLogPhaseNone  NetLogPhase = 0
+	NetLogPhaseBegin NetLogPhase = 1
+	NetLogPhaseEnd   NetLogPhase = 2
+)
+
+// NetLogEvent is a single event of a NetLog file written by Engine.StartNetLogToFile.
+type NetLogEvent struct {
+	// Type is the event type name, e.g. QUIC_SESSION.
+	Type  string
+	Phase NetLogPhase
+	// SourceID identifies the object that emitted the event, e.g. a single
+	// request or a QUIC session. Events with the same SourceID belong together.
+	SourceID   int64
+	SourceType string
+	Time       time.Time
+	Params     json.RawMessage
+}
+
+type netLogConstants struct {
+	LogEventTypes  map[string]int `json:"logEventTypes"`
+	LogSourceType  map[string]int `json:"logSourceType"`
+	TimeTickOffset string         `json:"timeTickOffset"`
+}
+
+type netLogRawEvent struct {
+	Type   int             `json:"type"`
+	Phase  int             `json:"phase"`
+	Time   string          `json:"time"`
+	Params json.RawMessage `json:"params"`
+	Source struct {
+		ID   int64 `json:"id"`
+		Type int   `json:"type"`
+	} `json:"source"`
+}
+
+// ReadNetLog reads the NetLog file at |path| and calls |handler| for each event.
+// Files that are still being written or were truncated are read up to the last
+// complete event. Reading stops at the first error returned by handler.
+func ReadNetLog(path string, handler func(event NetLogEvent) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return readNetLog(file, handler)
+}
+
+func readNetLog(reader io.Reader, handler func(event NetLogEvent) error) error {
+	decoder := json.NewDecoder(reader)
+	err := expectDelim(decoder, '{')
+	if err != nil {
+		return err
+	}
+	var (
+		eventTypes  map[int]string
+		sourceTypes map[int]string
+		tickOffset  int64
+	)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "constants":
+			var constants netLogConstants
+			err = decoder.Decode(&constants)
+			if err != nil {
+				return fmt.Errorf("netlog constants: %w", err)
+			}
+			eventTypes = invertNetLogConstants(constants.LogEventTypes)
+			sourceTypes = invertNetLogConstants(constants.LogSourceType)
+			tickOffset, _ = strconv.ParseInt(constants.TimeTickOffset, 10, 64)
+		case "events":
+			if eventTypes == nil {
+				return errors.New("netlog: events before constants")
+			}
+			err = expectDelim(decoder, '[')
+			if err != nil {
+				return err
+			}
+			for decoder.More() {
+				var rawEvent netLogRawEvent
+				err = decoder.Decode(&rawEvent)
+				if err != nil {
+					if errors.Is(err, io.ErrUnexpectedEOF) {
+						return nil
+					}
+					return err
+				}
+				ticks, _ := strconv.ParseInt(rawEvent.Time, 10, 64)
+				err = handler(NetLogEvent{
+					Type:       eventTypes[rawEvent.Type],
+					Phase:      NetLogPhase(rawEvent.Phase),
+					SourceID:   rawEvent.Source.ID,
+					SourceType: sourceTypes[rawEvent.Source.Type],
+					Time:       time.UnixMilli(tickOffset + ticks),
+					Params:     rawEvent.Params,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		default:
+			var ignored json.RawMessage
+			err = decoder.Decode(&ignored)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("netlog: expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+func invertNetLogConstants(constants map[string]int) map[int]string {
+	names := make(map[int]string, len(constants))
+	for name, value := range constants {
+		names[value] = name
+	}
+	return names
+}
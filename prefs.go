@@ -0,0 +1,109 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Paths of the prefs an engine persists in its storage path.
+const (
+	// PrefHTTPServerProperties holds the HTTP/2 and QUIC support of servers,
+	// Alt-Svc mappings, broken alternative services and QUIC server
+	// configurations with their session data.
+	PrefHTTPServerProperties = "net.http_server_properties"
+	// PrefHostCache holds the host cache, see StaleDNSOptions.PersistToDisk.
+	PrefHostCache = "net.host_cache"
+	// PrefNetworkQualities holds the network quality estimates per network.
+	PrefNetworkQualities = "net.network_qualities"
+)
+
+// Prefs is the pref store an engine persists in its storage path, the
+// JSON pref store of Chromium's components/prefs. Prefs are addressed by
+// dotted paths such as PrefHTTPServerProperties.
+//
+// The engine reads the store when it starts and writes it periodically and
+// on Engine.Shutdown, so changes must be written while no engine runs on the
+// storage path and take effect with the next engine.
+type Prefs struct {
+	storagePath string
+	values      map[string]any
+}
+
+// ReadPrefs reads the prefs persisted in |storagePath|. A storage path
+// without prefs returns an empty store.
+func ReadPrefs(storagePath string) (*Prefs, error) {
+	values, err := readLocalPrefs(storagePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		values = make(map[string]any)
+	}
+	return &Prefs{storagePath: storagePath, values: values}, nil
+}
+
+// Get returns the value at |path|, decoded from JSON: a map[string]any,
+// []any, string, float64, bool or nil.
+func (p *Prefs) Get(path string) (any, bool) {
+	var value any = p.values
+	for _, key := range strings.Split(path, ".") {
+		object, isObject := value.(map[string]any)
+		if !isObject {
+			return nil, false
+		}
+		value, isObject = object[key]
+		if !isObject {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Set sets the value at |path|, creating the parent objects as needed.
+// |value| must be encodable as JSON.
+func (p *Prefs) Set(path string, value any) error {
+	keys := strings.Split(path, ".")
+	object := p.values
+	for i, key := range keys[:len(keys)-1] {
+		child, loaded := object[key]
+		if !loaded {
+			child = make(map[string]any)
+			object[key] = child
+		}
+		childObject, isObject := child.(map[string]any)
+		if !isObject {
+			return fmt.Errorf("cronet: pref %s is not an object", strings.Join(keys[:i+1], "."))
+		}
+		object = childObject
+	}
+	object[keys[len(keys)-1]] = value
+	return nil
+}
+
+// Delete removes the value at |path|.
+func (p *Prefs) Delete(path string) {
+	keys := strings.Split(path, ".")
+	object := p.values
+	for _, key := range keys[:len(keys)-1] {
+		child, isObject := object[key].(map[string]any)
+		if !isObject {
+			return
+		}
+		object = child
+	}
+	delete(object, keys[len(keys)-1])
+}
+
+// Write persists the prefs to the storage path they were read from. It
+// fails with ErrProfileInUse while an engine runs on the storage path, as
+// the engine would overwrite them.
+func (p *Prefs) Write() error {
+	if storagePathInUse(p.storagePath) {
+		return ErrProfileInUse
+	}
+	return writeLocalPrefs(p.storagePath, p.values)
+}
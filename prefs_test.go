@@ -0,0 +1,51 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestPrefs(t *testing.T) {
+	storagePath := t.TempDir()
+	prefs, err := cronet.ReadPrefs(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, loaded := prefs.Get(cronet.PrefHTTPServerProperties); loaded {
+		t.Fatal("empty prefs have values")
+	}
+	err = prefs.Set(cronet.PrefHTTPServerProperties+".version", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = prefs.Set(cronet.PrefHostCache, []any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefs.Set(cronet.PrefHostCache+".entry", 1) == nil {
+		t.Fatal("set below a list")
+	}
+	err = prefs.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefs, err = cronet.ReadPrefs(storagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, _ := prefs.Get(cronet.PrefHTTPServerProperties + ".version")
+	if version != float64(5) {
+		t.Fatal("bad version", version)
+	}
+	prefs.Delete(cronet.PrefHostCache)
+	if _, loaded := prefs.Get(cronet.PrefHostCache); loaded {
+		t.Fatal("deleted pref left")
+	}
+	if _, loaded := prefs.Get("net"); !loaded {
+		t.Fatal("parent of deleted pref removed")
+	}
+}
@@ -0,0 +1,114 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrProfileLocked = errors.New("cronet: profile is locked by another process or Profile")
+	ErrProfileInUse  = errors.New("cronet: storage path is in use by a running engine")
+)
+
+// profileLockFile is the lock file kept in the profile directory while it is open.
+const profileLockFile = "cronet.lock"
+
+// Profile is a storage directory of an engine, holding the HTTP cache and
+// the prefs with the host cache, HTTP server properties and QUIC server
+// information. It is locked while open, so no second process or Profile
+// starts an engine on it.
+//
+// Cronet does not persist cookies; a cookie jar set on http.Client is
+// separate from the profile.
+type Profile struct {
+	path string
+	lock *os.File
+}
+
+// OpenProfile creates the directory |path| if needed and locks it. It fails
+// with ErrProfileLocked if another process or Profile holds the lock.
+func OpenProfile(path string) (*Profile, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(path, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(path, profileLockFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = lockProfileFile(lock)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return &Profile{path: path, lock: lock}, nil
+}
+
+// Path returns the absolute path of the profile directory.
+func (p *Profile) Path() string {
+	return p.path
+}
+
+// Configure sets the profile as storage path of |params| and enables the
+// disk cache.
+func (p *Profile) Configure(params EngineParams) {
+	params.SetStoragePath(p.path)
+	params.SetHTTPCacheMode(HTTPCacheModeDisk)
+}
+
+// Size returns the total size of the files in the profile in bytes.
+func (p *Profile) Size() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(p.path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files of a running engine may be removed while walking
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Wipe removes all data of the profile, keeping it open. It fails with
+// ErrProfileInUse while an engine runs on the profile.
+func (p *Profile) Wipe() error {
+	if storagePathInUse(p.path) {
+		return ErrProfileInUse
+	}
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == profileLockFile {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(p.path, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the lock of the profile.
+func (p *Profile) Close() error {
+	return p.lock.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !windows && !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func lockProfileFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrProfileLocked
+	}
+	return err
+}
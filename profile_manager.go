@@ -0,0 +1,340 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrProfileManagerClosed = errors.New("cronet: profile manager closed")
+
+// ProfileManagerConfig configures a ProfileManager.
+type ProfileManagerConfig struct {
+	// StorageRoot is the directory holding one storage directory per profile,
+	// used for the HTTP cache and prefs. If empty, profiles use an in-memory cache.
+	StorageRoot string
+
+	// MaxProfiles is the maximum number of engines kept alive at the same time.
+	// When exceeded, the least recently used profile is evicted once its
+	// in-flight requests finish. Zero means unlimited.
+	MaxProfiles int
+
+	// MaxRequestsPerProfile caps the concurrent requests of a single profile.
+	// Further requests wait for a slot or for their context. Zero means unlimited.
+	MaxRequestsPerProfile int
+
+	// HTTPCacheMaxSize is the cache size of each profile in bytes. Zero uses the
+	// Cronet default.
+	HTTPCacheMaxSize int64
+
+	// ConfigureEngine is called with the parameters of each new profile engine
+	// before it starts, e.g. to set per-profile proxy or experimental options.
+	ConfigureEngine func(profile string, params EngineParams)
+}
+
+// ProfileManager maintains an isolated Engine, cookie jar and storage directory
+// per profile, for applications acting on behalf of many accounts at once.
+type ProfileManager struct {
+	config ProfileManagerConfig
+
+	access   sync.Mutex
+	closed   bool
+	profiles map[string]*list.Element
+	lru      *list.List
+	// closing are closed once the engines of evicted profiles being shut
+	// down are gone, so a profile is not started again on storage in use.
+	closing map[string]chan struct{}
+}
+
+type managedProfile struct {
+	name      string
+	transport *RoundTripper
+	jar       http.CookieJar
+	slots     chan struct{}
+
+	active  int
+	evicted bool
+	closing chan struct{}
+}
+
+func NewProfileManager(config ProfileManagerConfig) *ProfileManager {
+	return &ProfileManager{
+		config:   config,
+		profiles: make(map[string]*list.Element),
+		lru:      list.New(),
+		closing:  make(map[string]chan struct{}),
+	}
+}
+
+// Transport returns a RoundTripper sending requests with the engine of |profile|.
+// The engine is created on first use and recreated if it has been evicted.
+func (m *ProfileManager) Transport(profile string) http.RoundTripper {
+	return &profileTransport{m, profile}
+}
+
+// Client returns an http.Client using the engine and cookie jar of |profile|.
+// Cookies are kept in memory and dropped when the profile is evicted.
+func (m *ProfileManager) Client(profile string) (*http.Client, error) {
+	entry, err := m.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	jar := entry.jar
+	m.release(entry)
+	return &http.Client{
+		Transport: m.Transport(profile),
+		Jar:       jar,
+	}, nil
+}
+
+// Profiles returns the names of the live profiles, most recently used first.
+func (m *ProfileManager) Profiles() []string {
+	m.access.Lock()
+	defer m.access.Unlock()
+	names := make([]string, 0, m.lru.Len())
+	for element := m.lru.Front(); element != nil; element = element.Next() {
+		names = append(names, element.Value.(*managedProfile).name)
+	}
+	return names
+}
+
+// Remove evicts |profile|. Its engine is shut down once in-flight requests finish.
+// The storage directory is kept.
+func (m *ProfileManager) Remove(profile string) {
+	m.access.Lock()
+	var retired []*managedProfile
+	if element := m.profiles[profile]; element != nil {
+		retired = m.evict(element, retired)
+	}
+	m.access.Unlock()
+	m.shutdown(retired)
+}
+
+// Close evicts all profiles and rejects further requests.
+func (m *ProfileManager) Close() error {
+	m.access.Lock()
+	if m.closed {
+		m.access.Unlock()
+		return os.ErrClosed
+	}
+	m.closed = true
+	var retired []*managedProfile
+	for m.lru.Len() > 0 {
+		retired = m.evict(m.lru.Back(), retired)
+	}
+	m.access.Unlock()
+	m.shutdown(retired)
+	return nil
+}
+
+func (m *ProfileManager) acquire(profile string) (*managedProfile, error) {
+	if profile == "" || profile == "." || profile == ".." || strings.ContainsAny(profile, `/\`) {
+		return nil, fmt.Errorf("cronet: invalid profile name %q", profile)
+	}
+
+	m.access.Lock()
+	var element *list.Element
+	for {
+		if m.closed {
+			m.access.Unlock()
+			return nil, ErrProfileManagerClosed
+		}
+		element = m.profiles[profile]
+		closing := m.closing[profile]
+		if element != nil || closing == nil {
+			break
+		}
+		// The previous engine of the profile still holds its storage
+		m.access.Unlock()
+		<-closing
+		m.access.Lock()
+	}
+
+	var retired []*managedProfile
+	if element != nil {
+		m.lru.MoveToFront(element)
+	} else {
+		entry, err := m.newProfile(profile)
+		if err != nil {
+			m.access.Unlock()
+			return nil, err
+		}
+		element = m.lru.PushFront(entry)
+		m.profiles[profile] = element
+		if m.config.MaxProfiles > 0 {
+			for m.lru.Len() > m.config.MaxProfiles {
+				retired = m.evict(m.lru.Back(), retired)
+			}
+		}
+	}
+	entry := element.Value.(*managedProfile)
+	entry.active++
+	m.access.Unlock()
+	m.shutdown(retired)
+	return entry, nil
+}
+
+func (m *ProfileManager) release(entry *managedProfile) {
+	m.access.Lock()
+	var retired []*managedProfile
+	entry.active--
+	if entry.evicted && entry.active == 0 {
+		retired = m.retire(entry, retired)
+	}
+	m.access.Unlock()
+	m.shutdown(retired)
+}
+
+// evict removes the profile of |element| and appends it to |retired| if it
+// has no request in flight. It must be called with access held.
+func (m *ProfileManager) evict(element *list.Element, retired []*managedProfile) []*managedProfile {
+	entry := element.Value.(*managedProfile)
+	m.lru.Remove(element)
+	delete(m.profiles, entry.name)
+	entry.evicted = true
+	if entry.active == 0 {
+		retired = m.retire(entry, retired)
+	}
+	return retired
+}
+
+// retire marks the engine of |entry| as being shut down and appends it to
+// |retired|. It must be called with access held.
+func (m *ProfileManager) retire(entry *managedProfile, retired []*managedProfile) []*managedProfile {
+	entry.closing = make(chan struct{})
+	m.closing[entry.name] = entry.closing
+	return append(retired, entry)
+}
+
+// shutdown shuts down the engines of |retired|, without holding access as
+// Engine.Shutdown blocks.
+func (m *ProfileManager) shutdown(retired []*managedProfile) {
+	for _, entry := range retired {
+		entry.transport.close()
+		m.access.Lock()
+		if m.closing[entry.name] == entry.closing {
+			delete(m.closing, entry.name)
+		}
+		m.access.Unlock()
+		close(entry.closing)
+	}
+}
+
+func (m *ProfileManager) newProfile(profile string) (*managedProfile, error) {
+	params := NewEngineParams()
+	defer params.Destroy()
+	params.SetEnableHTTP2(true)
+	params.SetEnableQuic(true)
+	params.SetEnableBrotli(true)
+	params.SetUserAgent(defaultUserAgent)
+	if m.config.StorageRoot != "" {
+		storagePath := filepath.Join(m.config.StorageRoot, profile)
+		err := os.MkdirAll(storagePath, 0o700)
+		if err != nil {
+			return nil, err
+		}
+		params.SetStoragePath(storagePath)
+		params.SetHTTPCacheMode(HTTPCacheModeDisk)
+	} else {
+		params.SetHTTPCacheMode(HTTPCacheModeInMemory)
+	}
+	if m.config.HTTPCacheMaxSize > 0 {
+		params.SetHTTPCacheMaxSize(m.config.HTTPCacheMaxSize)
+	}
+	if m.config.ConfigureEngine != nil {
+		m.config.ConfigureEngine(profile, params)
+	}
+
+	engine := NewEngine()
+	result := engine.StartWithParams(params)
+	if result != ResultSuccess {
+		engine.Destroy()
+		return nil, fmt.Errorf("cronet: start engine for profile %s: result %d", profile, result)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	entry := &managedProfile{
+		name: profile,
+		transport: &RoundTripper{
+			Engine: engine,
+			Executor: NewExecutor(func(executor Executor, command Runnable) {
+				go func() {
+					command.Run()
+					command.Destroy()
+				}()
+			}),
+			closeEngine:   true,
+			closeExecutor: true,
+		},
+		jar: jar,
+	}
+	if m.config.MaxRequestsPerProfile > 0 {
+		entry.slots = make(chan struct{}, m.config.MaxRequestsPerProfile)
+	}
+	return entry, nil
+}
+
+type profileTransport struct {
+	manager *ProfileManager
+	profile string
+}
+
+func (t *profileTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	entry, err := t.manager.acquire(t.profile)
+	if err != nil {
+		closeRequestBody(request)
+		return nil, err
+	}
+	if entry.slots != nil {
+		select {
+		case entry.slots <- struct{}{}:
+		case <-request.Context().Done():
+			t.manager.release(entry)
+			closeRequestBody(request)
+			return nil, request.Context().Err()
+		}
+	}
+	response, err := entry.transport.RoundTrip(request)
+	if err != nil {
+		t.finish(entry)
+		return nil, err
+	}
+	response.Body = &profileResponseBody{ReadCloser: response.Body, finish: func() {
+		t.finish(entry)
+	}}
+	return response, nil
+}
+
+func (t *profileTransport) finish(entry *managedProfile) {
+	if entry.slots != nil {
+		<-entry.slots
+	}
+	t.manager.release(entry)
+}
+
+type profileResponseBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+func (b *profileResponseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		// The engine can only be shut down after the native request is gone
+		if response, isResponse := b.ReadCloser.(*urlResponse); isResponse {
+			<-response.done
+		}
+		b.finish()
+	})
+	return err
+}
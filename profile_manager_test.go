@@ -0,0 +1,84 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestProfileManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if cookie, err := request.Cookie("session"); err == nil {
+			io.WriteString(writer, cookie.Value)
+			return
+		}
+		http.SetCookie(writer, &http.Cookie{Name: "session", Value: "set"})
+	}))
+	defer server.Close()
+
+	manager := cronet.NewProfileManager(cronet.ProfileManagerConfig{StorageRoot: t.TempDir(), MaxProfiles: 1})
+	get := func(profile string) string {
+		client, err := manager.Client(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		return string(body)
+	}
+
+	get("a")
+	if body := get("a"); body != "set" {
+		t.Fatalf("expected the cookie of the profile, got %q", body)
+	}
+	if profiles := manager.Profiles(); !reflect.DeepEqual(profiles, []string{"a"}) {
+		t.Fatal("unexpected profiles", profiles)
+	}
+	// A second profile evicts the first, whose engine is shut down
+	get("b")
+	if profiles := manager.Profiles(); !reflect.DeepEqual(profiles, []string{"b"}) {
+		t.Fatal("unexpected profiles", profiles)
+	}
+	// Coming back starts a new engine on the same storage and an empty jar
+	if body := get("a"); body != "" {
+		t.Fatalf("expected the cookies to be dropped on eviction, got %q", body)
+	}
+	manager.Remove("a")
+	if profiles := manager.Profiles(); len(profiles) != 0 {
+		t.Fatal("unexpected profiles", profiles)
+	}
+
+	if _, err := manager.Client("../escape"); err == nil {
+		t.Fatal("expected an invalid profile name to be rejected")
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Client("a"); !errors.Is(err, cronet.ErrProfileManagerClosed) {
+		t.Fatal("expected ErrProfileManagerClosed, got", err)
+	}
+
+	// Requests failing before they are sent close their body
+	for _, profile := range []string{"a", "../escape"} {
+		body := &closeCountingBody{Reader: strings.NewReader("body")}
+		request, _ := http.NewRequest(http.MethodPost, server.URL, body)
+		if _, err := manager.Transport(profile).RoundTrip(request); err == nil {
+			t.Fatal("expected the request to fail for profile", profile)
+		}
+		if body.closed != 1 {
+			t.Fatalf("%s: body closed %d times", profile, body.closed)
+		}
+	}
+}
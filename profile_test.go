@@ -0,0 +1,65 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile")
+	profile, err := cronet.OpenProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer profile.Close()
+	_, err = cronet.OpenProfile(path)
+	if !errors.Is(err, cronet.ErrProfileLocked) {
+		t.Fatal("profile opened twice", err)
+	}
+
+	params := cronet.NewEngineParams()
+	profile.Configure(params)
+	engine := cronet.NewEngine()
+	result := engine.StartWithParams(params)
+	params.Destroy()
+	if result != cronet.ResultSuccess {
+		t.Fatal("start engine", result)
+	}
+	if err = profile.Wipe(); !errors.Is(err, cronet.ErrProfileInUse) {
+		t.Fatal("wiped profile of running engine", err)
+	}
+	engine.Shutdown()
+	engine.Destroy()
+
+	err = os.WriteFile(filepath.Join(path, "data"), make([]byte, 1000), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := profile.Size()
+	if err != nil || size < 1000 {
+		t.Fatal("bad size", size, err)
+	}
+	err = profile.Wipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err = profile.Size()
+	if err != nil || size != 0 {
+		t.Fatal("data left after wipe", size, err)
+	}
+
+	err = profile.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err = cronet.OpenProfile(path)
+	if err != nil {
+		t.Fatal("reopen", err)
+	}
+}
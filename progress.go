@@ -0,0 +1,274 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestProgress is the progress of an in-flight request.
+type RequestProgress struct {
+	ID     RequestID `json:"id"`
+	Method string    `json:"method"`
+	// URL is the request URL without userinfo, query and fragment, which
+	// may carry credentials.
+	URL     string    `json:"url"`
+	Origin  string    `json:"origin"`
+	Started time.Time `json:"started"`
+	// StatusCode and Protocol are zero until the response headers arrived.
+	StatusCode int    `json:"status_code,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	// BytesSent is the number of request body bytes handed to the network stack.
+	BytesSent int64 `json:"bytes_sent"`
+	// BytesReceived is the number of bytes received on the wire, including
+	// headers and before decompression.
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+// OriginProgress aggregates the requests of one origin.
+type OriginProgress struct {
+	Origin string `json:"origin"`
+	// Active is the number of in-flight requests.
+	Active int `json:"active"`
+	// Completed is the number of finished requests since the monitor was created.
+	Completed int64 `json:"completed"`
+	// BytesSent and BytesReceived are totals including finished requests.
+	BytesSent     int64 `json:"bytes_sent"`
+	BytesReceived int64 `json:"bytes_received"`
+	// SendRate and ReceiveRate are in bytes per second since the previous
+	// sample of the same subscription. They are zero in Snapshot.
+	SendRate    float64 `json:"send_rate"`
+	ReceiveRate float64 `json:"receive_rate"`
+}
+
+// ProgressSample is a point-in-time view of all requests of a ProgressMonitor.
+type ProgressSample struct {
+	Time     time.Time         `json:"time"`
+	Requests []RequestProgress `json:"requests"`
+	Origins  []OriginProgress  `json:"origins"`
+}
+
+// ProgressMonitor tracks the progress of requests sent by RoundTripper with
+// the Progress field set. Counters are updated with atomic operations on the
+// network thread; all other work happens when a sample is taken.
+type ProgressMonitor struct {
+	access   sync.Mutex
+	requests map[RequestID]*requestProgress
+	finished map[string]*originTotals
+}
+
+type requestProgress struct {
+	id      RequestID
+	method  string
+	url     string
+	origin  string
+	started time.Time
+
+	statusCode    int32
+	protocol      atomic.Value
+	bytesSent     int64
+	bytesReceived int64
+}
+
+type originTotals struct {
+	completed     int64
+	bytesSent     int64
+	bytesReceived int64
+}
+
+func NewProgressMonitor() *ProgressMonitor {
+	return &ProgressMonitor{
+		requests: make(map[RequestID]*requestProgress),
+		finished: make(map[string]*originTotals),
+	}
+}
+
+func (m *ProgressMonitor) start(request *http.Request, id RequestID) *requestProgress {
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	progress := &requestProgress{
+		id:      id,
+		method:  method,
+		url:     progressURL(request.URL),
+		origin:  progressOrigin(request.URL),
+		started: time.Now(),
+	}
+	m.access.Lock()
+	m.requests[progress.id] = progress
+	m.access.Unlock()
+	return progress
+}
+
+func (m *ProgressMonitor) finish(progress *requestProgress) {
+	m.access.Lock()
+	defer m.access.Unlock()
+	if _, loaded := m.requests[progress.id]; !loaded {
+		return
+	}
+	delete(m.requests, progress.id)
+	totals := m.finished[progress.origin]
+	if totals == nil {
+		totals = &originTotals{}
+		m.finished[progress.origin] = totals
+	}
+	totals.completed++
+	totals.bytesSent += atomic.LoadInt64(&progress.bytesSent)
+	totals.bytesReceived += atomic.LoadInt64(&progress.bytesReceived)
+}
+
+// Snapshot returns the current progress of all in-flight requests, oldest
+// first, and the per-origin aggregation sorted by origin.
+func (m *ProgressMonitor) Snapshot() ProgressSample {
+	m.access.Lock()
+	defer m.access.Unlock()
+	sample := ProgressSample{
+		Time:     time.Now(),
+		Requests: make([]RequestProgress, 0, len(m.requests)),
+	}
+	origins := make(map[string]*OriginProgress)
+	originOf := func(name string) *OriginProgress {
+		origin := origins[name]
+		if origin == nil {
+			origin = &OriginProgress{Origin: name}
+			origins[name] = origin
+		}
+		return origin
+	}
+	for name, totals := range m.finished {
+		origin := originOf(name)
+		origin.Completed = totals.completed
+		origin.BytesSent = totals.bytesSent
+		origin.BytesReceived = totals.bytesReceived
+	}
+	for _, progress := range m.requests {
+		current := progress.snapshot()
+		sample.Requests = append(sample.Requests, current)
+		origin := originOf(current.Origin)
+		origin.Active++
+		origin.BytesSent += current.BytesSent
+		origin.BytesReceived += current.BytesReceived
+	}
+	sort.Slice(sample.Requests, func(i, j int) bool {
+		return sample.Requests[i].ID < sample.Requests[j].ID
+	})
+	sample.Origins = make([]OriginProgress, 0, len(origins))
+	for _, origin := range origins {
+		sample.Origins = append(sample.Origins, *origin)
+	}
+	sort.Slice(sample.Origins, func(i, j int) bool {
+		return sample.Origins[i].Origin < sample.Origins[j].Origin
+	})
+	return sample
+}
+
+// Subscribe returns a channel receiving |perSecond| samples per second until
+// |ctx| is done. Samples are dropped rather than queued if the receiver falls
+// behind, so a slow dashboard never slows down requests.
+func (m *ProgressMonitor) Subscribe(ctx context.Context, perSecond int) <-chan ProgressSample {
+	if perSecond <= 0 {
+		perSecond = 1
+	}
+	samples := make(chan ProgressSample, 1)
+	go func() {
+		defer close(samples)
+		ticker := time.NewTicker(time.Second / time.Duration(perSecond))
+		defer ticker.Stop()
+		var previous ProgressSample
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			sample := m.Snapshot()
+			computeProgressRates(&sample, &previous)
+			previous = sample
+			select {
+			case samples <- sample:
+			default:
+			}
+		}
+	}()
+	return samples
+}
+
+// ServeHTTP streams samples as JSON lines, at the rate given by the "rate"
+// query parameter (default 1 per second), for tools like cmd/cronet-top.
+func (m *ProgressMonitor) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	perSecond, _ := strconv.Atoi(request.URL.Query().Get("rate"))
+	writer.Header().Set("Content-Type", "application/x-ndjson")
+	writer.Header().Set("Cache-Control", "no-store")
+	flusher, _ := writer.(http.Flusher)
+	encoder := json.NewEncoder(writer)
+	for sample := range m.Subscribe(request.Context(), perSecond) {
+		err := encoder.Encode(sample)
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func computeProgressRates(sample *ProgressSample, previous *ProgressSample) {
+	elapsed := sample.Time.Sub(previous.Time).Seconds()
+	if previous.Time.IsZero() || elapsed <= 0 {
+		return
+	}
+	previousOrigins := make(map[string]OriginProgress, len(previous.Origins))
+	for _, origin := range previous.Origins {
+		previousOrigins[origin.Origin] = origin
+	}
+	for i := range sample.Origins {
+		origin := &sample.Origins[i]
+		last := previousOrigins[origin.Origin]
+		origin.SendRate = float64(origin.BytesSent-last.BytesSent) / elapsed
+		origin.ReceiveRate = float64(origin.BytesReceived-last.BytesReceived) / elapsed
+	}
+}
+
+func (p *requestProgress) snapshot() RequestProgress {
+	protocol, _ := p.protocol.Load().(string)
+	return RequestProgress{
+		ID:            p.id,
+		Method:        p.method,
+		URL:           p.url,
+		Origin:        p.origin,
+		Started:       p.started,
+		StatusCode:    int(atomic.LoadInt32(&p.statusCode)),
+		Protocol:      protocol,
+		BytesSent:     atomic.LoadInt64(&p.bytesSent),
+		BytesReceived: atomic.LoadInt64(&p.bytesReceived),
+	}
+}
+
+func (p *requestProgress) onResponse(info URLResponseInfo) {
+	atomic.StoreInt32(&p.statusCode, int32(info.StatusCode()))
+	p.protocol.Store(info.NegotiatedProtocol())
+	atomic.StoreInt64(&p.bytesReceived, info.ReceivedByteCount())
+}
+
+func progressURL(requestURL *url.URL) string {
+	redacted := *requestURL
+	redacted.User = nil
+	redacted.RawQuery = ""
+	redacted.ForceQuery = false
+	redacted.Fragment = ""
+	redacted.RawFragment = ""
+	return redacted.String()
+}
+
+func progressOrigin(requestURL *url.URL) string {
+	return requestURL.Scheme + "://" + requestURL.Host
+}
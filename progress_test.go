@@ -0,0 +1,122 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestProgressMonitor(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.Copy(io.Discard, request.Body)
+		writer.WriteHeader(http.StatusOK)
+		io.WriteString(writer, "first")
+		writer.(http.Flusher).Flush()
+		<-release
+		io.WriteString(writer, "second")
+	}))
+	defer server.Close()
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+
+	monitor := cronet.NewProgressMonitor()
+	transport := &cronet.RoundTripper{Engine: newFirstByteEngine(t), Progress: monitor}
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/upload?token=secret#fragment", strings.NewReader("request body"))
+	request.URL.User = url.UserPassword("user", "password")
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, len("first"))
+	if _, err = io.ReadFull(response.Body, buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stalled request is in flight with its headers and upload counted,
+	// and its URL is listed without credentials or query
+	sample := monitor.Snapshot()
+	if len(sample.Requests) != 1 {
+		t.Fatal("expected one request in flight, got", len(sample.Requests))
+	}
+	current := sample.Requests[0]
+	if current.Method != http.MethodPost || current.URL != server.URL+"/upload" || current.Origin != server.URL {
+		t.Fatalf("unexpected request %+v", current)
+	}
+	if current.StatusCode != http.StatusOK || current.BytesSent != int64(len("request body")) || current.BytesReceived == 0 {
+		t.Fatalf("unexpected counters %+v", current)
+	}
+	if len(sample.Origins) != 1 || sample.Origins[0].Active != 1 || sample.Origins[0].Completed != 0 {
+		t.Fatalf("unexpected origins %+v", sample.Origins)
+	}
+
+	// Subscribers receive samples and the HTTP handler streams them as JSON lines
+	ctx, cancel := context.WithCancel(context.Background())
+	select {
+	case sample = <-monitor.Subscribe(ctx, 20):
+		if len(sample.Requests) != 1 {
+			t.Fatal("expected the request in the subscribed sample")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sample received")
+	}
+	cancel()
+	progressServer := httptest.NewServer(monitor)
+	defer progressServer.Close()
+	streamed, err := http.Get(progressServer.URL + "?rate=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType := streamed.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Error("unexpected content type", contentType)
+	}
+	scanner := bufio.NewScanner(streamed.Body)
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			t.Fatal("stream ended", scanner.Err())
+		}
+		var line cronet.ProgressSample
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if len(line.Requests) != 1 || line.Requests[0].ID != current.ID {
+			t.Fatalf("unexpected streamed sample %s", scanner.Bytes())
+		}
+	}
+	streamed.Body.Close()
+
+	// Finished requests move into the per-origin totals
+	close(release)
+	if _, err = io.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	waitFor(t, func() bool { return len(monitor.Snapshot().Requests) == 0 })
+	sample = monitor.Snapshot()
+	if len(sample.Origins) != 1 {
+		t.Fatalf("unexpected origins %+v", sample.Origins)
+	}
+	origin := sample.Origins[0]
+	if origin.Active != 0 || origin.Completed != 1 || origin.BytesSent != int64(len("request body")) || origin.BytesReceived < current.BytesReceived {
+		t.Fatalf("unexpected totals %+v", origin)
+	}
+	if origin.SendRate != 0 || origin.ReceiveRate != 0 {
+		t.Error("expected no rates in a snapshot")
+	}
+}
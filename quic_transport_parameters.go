@@ -0,0 +1,129 @@
+package cronet
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QUICTransportParameters are the transport parameters a QUIC peer sent during
+// the handshake. The C API does not expose them, so they are recovered from a
+// NetLog file; see ReadQUICTransportParameters.
+type QUICTransportParameters struct {
+	// Host and Port identify the QUIC session the parameters belong to.
+	Host string
+	Port int
+	// SessionID is the NetLog source id of the QUIC session.
+	SessionID int64
+	Time      time.Time
+
+	MaxIdleTimeout                 time.Duration
+	MaxUDPPayloadSize              uint64
+	InitialMaxData                 uint64
+	InitialMaxStreamDataBidiLocal  uint64
+	InitialMaxStreamDataBidiRemote uint64
+	InitialMaxStreamDataUni        uint64
+	InitialMaxStreamsBidi          uint64
+	InitialMaxStreamsUni           uint64
+	AckDelayExponent               uint64
+	MaxAckDelay                    time.Duration
+	ActiveConnectionIDLimit        uint64
+	MaxDatagramFrameSize           uint64
+	DisableActiveMigration         bool
+
+	// Raw is the parameter list as logged by the native stack, e.g.
+	// "[Server max_idle_timeout 30000 initial_max_streams_bidi 100 ...]".
+	Raw string
+}
+
+// ReadQUICTransportParameters returns the transport parameters received from
+// QUIC peers in the NetLog file at |path|, in the order sessions were established.
+//
+// The NetLog must have been captured with Engine.StartNetLogToFile; logAll is not required.
+func ReadQUICTransportParameters(path string) ([]QUICTransportParameters, error) {
+	type quicSession struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	sessions := make(map[int64]quicSession)
+	var parameters []QUICTransportParameters
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		switch event.Type {
+		case "QUIC_SESSION":
+			if event.Phase == NetLogPhaseBegin {
+				var session quicSession
+				json.Unmarshal(event.Params, &session)
+				sessions[event.SourceID] = session
+			}
+		case "QUIC_SESSION_TRANSPORT_PARAMETERS_RECEIVED":
+			var params struct {
+				Parameters string `json:"quic_transport_parameters"`
+			}
+			json.Unmarshal(event.Params, &params)
+			parsed := ParseQUICTransportParameters(params.Parameters)
+			session := sessions[event.SourceID]
+			parsed.Host = session.Host
+			parsed.Port = session.Port
+			parsed.SessionID = event.SourceID
+			parsed.Time = event.Time
+			parameters = append(parameters, parsed)
+		}
+		return nil
+	})
+	return parameters, err
+}
+
+// ParseQUICTransportParameters parses the textual form of transport parameters
+// logged by the native stack. Parameters missing from the text have their
+// RFC 9000 default values.
+func ParseQUICTransportParameters(raw string) QUICTransportParameters {
+	parameters := QUICTransportParameters{
+		MaxUDPPayloadSize:       65527,
+		AckDelayExponent:        3,
+		MaxAckDelay:             25 * time.Millisecond,
+		ActiveConnectionIDLimit: 2,
+		Raw:                     raw,
+	}
+	fields := strings.Fields(strings.Trim(raw, "[]"))
+	for i, field := range fields {
+		if field == "disable_active_migration" {
+			parameters.DisableActiveMigration = true
+			continue
+		}
+		if i+1 >= len(fields) {
+			break
+		}
+		value, err := strconv.ParseUint(fields[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch field {
+		case "max_idle_timeout":
+			parameters.MaxIdleTimeout = time.Duration(value) * time.Millisecond
+		case "max_udp_payload_size":
+			parameters.MaxUDPPayloadSize = value
+		case "initial_max_data":
+			parameters.InitialMaxData = value
+		case "initial_max_stream_data_bidi_local":
+			parameters.InitialMaxStreamDataBidiLocal = value
+		case "initial_max_stream_data_bidi_remote":
+			parameters.InitialMaxStreamDataBidiRemote = value
+		case "initial_max_stream_data_uni":
+			parameters.InitialMaxStreamDataUni = value
+		case "initial_max_streams_bidi":
+			parameters.InitialMaxStreamsBidi = value
+		case "initial_max_streams_uni":
+			parameters.InitialMaxStreamsUni = value
+		case "ack_delay_exponent":
+			parameters.AckDelayExponent = value
+		case "max_ack_delay":
+			parameters.MaxAckDelay = time.Duration(value) * time.Millisecond
+		case "active_connection_id_limit":
+			parameters.ActiveConnectionIDLimit = value
+		case "max_datagram_frame_size":
+			parameters.MaxDatagramFrameSize = value
+		}
+	}
+	return parameters
+}
@@ -0,0 +1,24 @@
+package cronet_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestParseQUICTransportParameters(t *testing.T) {
+	parameters := cronet.ParseQUICTransportParameters("[Server max_idle_timeout 30000 max_udp_payload_size 1472 initial_max_data 15728640 initial_max_streams_bidi 100 disable_active_migration]")
+	if parameters.MaxIdleTimeout != 30*time.Second {
+		t.Fatal("bad max_idle_timeout", parameters.MaxIdleTimeout)
+	}
+	if parameters.MaxUDPPayloadSize != 1472 || parameters.InitialMaxData != 15728640 || parameters.InitialMaxStreamsBidi != 100 {
+		t.Fatal("bad integer parameters", parameters)
+	}
+	if !parameters.DisableActiveMigration {
+		t.Fatal("missing disable_active_migration")
+	}
+	if parameters.AckDelayExponent != 3 || parameters.ActiveConnectionIDLimit != 2 {
+		t.Fatal("missing defaults", parameters)
+	}
+}
@@ -0,0 +1,190 @@
+package cronet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RawResponseHeaders is an HTTP/1 response header block exactly as it was
+// received, before the network stack parsed it.
+type RawResponseHeaders struct {
+	// SocketID is the NetLog source ID of the connection.
+	SocketID int64
+	// Time is when the end of the header block was received.
+	Time time.Time
+	// Request is the request the response answers, as it was sent, without
+	// its body. Match it to a request with RoundTripper.RequestIDHeader.
+	Request *http.Request
+	// StatusLine is the status line without its line ending.
+	StatusLine string
+	// Block is the header block from the status line up to and including
+	// the empty line ending it. Informational responses, e.g. 100 Continue,
+	// have blocks of their own.
+	Block []byte
+	// ParseError is the error Go's parser reports for the block, if any.
+	// The connection is not read further after a block that fails to parse.
+	ParseError error
+}
+
+// ReadNetLogRawResponseHeaders returns the HTTP/1 response header blocks in
+// the NetLog file at |path|, grouped by connection in the order they were
+// received, e.g. to find out what an intermediary sent that the parsed
+// headers of URLResponseInfo do not show.
+//
+// The C API has no access to the bytes received, so they are read from the
+// socket data, which is only logged with Engine.StartNetLogToFile(path,
+// true). HTTP/2 and HTTP/3 headers are compressed and not included; their
+// decoded headers are logged as HTTP2_SESSION_RECV_HEADERS and
+// HTTP3_HEADERS_DECODED events.
+func ReadNetLogRawResponseHeaders(path string) ([]RawResponseHeaders, error) {
+	type socketData struct {
+		plain, decrypted netLogSocketStream
+	}
+	var order []int64
+	sockets := make(map[int64]*socketData)
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		var stream *netLogSocketStream
+		socket := sockets[event.SourceID]
+		if socket == nil {
+			socket = &socketData{}
+		}
+		switch event.Type {
+		case "SOCKET_BYTES_SENT":
+			stream = &socket.plain
+			stream.sent = appendNetLogBytes(stream.sent, event.Params)
+		case "SOCKET_BYTES_RECEIVED":
+			stream = &socket.plain
+			stream.receive(event)
+		case "SSL_SOCKET_BYTES_SENT":
+			stream = &socket.decrypted
+			stream.sent = appendNetLogBytes(stream.sent, event.Params)
+		case "SSL_SOCKET_BYTES_RECEIVED":
+			stream = &socket.decrypted
+			stream.receive(event)
+		default:
+			return nil
+		}
+		if sockets[event.SourceID] == nil {
+			sockets[event.SourceID] = socket
+			order = append(order, event.SourceID)
+		}
+		return nil
+	})
+	var headers []RawResponseHeaders
+	for _, socketID := range order {
+		socket := sockets[socketID]
+		stream := &socket.plain
+		// The socket bytes of a TLS connection are encrypted
+		if len(socket.decrypted.sent) > 0 || len(socket.decrypted.received) > 0 {
+			stream = &socket.decrypted
+		}
+		headers = stream.responseHeaders(socketID, headers)
+	}
+	return headers, err
+}
+
+// netLogSocketStream is the data sent and received on a connection.
+type netLogSocketStream struct {
+	sent     []byte
+	received []byte
+	// receivedEnds and receivedTimes are the end offsets in received of the
+	// logged reads and their times.
+	receivedEnds  []int
+	receivedTimes []time.Time
+}
+
+func (s *netLogSocketStream) receive(event NetLogEvent) {
+	s.received = appendNetLogBytes(s.received, event.Params)
+	s.receivedEnds = append(s.receivedEnds, len(s.received))
+	s.receivedTimes = append(s.receivedTimes, event.Time)
+}
+
+// receivedAt returns the time the byte at |offset| was received.
+func (s *netLogSocketStream) receivedAt(offset int) time.Time {
+	for i, end := range s.receivedEnds {
+		if offset < end {
+			return s.receivedTimes[i]
+		}
+	}
+	return time.Time{}
+}
+
+// responseHeaders appends the response header blocks of the stream to
+// |headers|, pairing the responses with the requests in the order they were
+// sent, as HTTP/1 answers them.
+func (s *netLogSocketStream) responseHeaders(socketID int64, headers []RawResponseHeaders) []RawResponseHeaders {
+	requests := bufio.NewReader(bytes.NewReader(s.sent))
+	received := bytes.NewReader(s.received)
+	responses := bufio.NewReader(received)
+	for {
+		request, err := http.ReadRequest(requests)
+		if err != nil {
+			return headers
+		}
+		io.Copy(io.Discard, request.Body)
+		request.Body = http.NoBody
+		for {
+			offset := len(s.received) - received.Len() - responses.Buffered()
+			block, complete := headerBlock(s.received[offset:])
+			if !complete {
+				return headers
+			}
+			raw := RawResponseHeaders{
+				SocketID:   socketID,
+				Time:       s.receivedAt(offset + len(block) - 1),
+				Request:    request,
+				StatusLine: string(bytes.TrimRight(block[:bytes.IndexByte(block, '\n')+1], "\r\n")),
+				Block:      block,
+			}
+			response, err := http.ReadResponse(responses, request)
+			if err != nil {
+				raw.ParseError = err
+				return append(headers, raw)
+			}
+			headers = append(headers, raw)
+			if response.StatusCode >= 100 && response.StatusCode < 200 && response.StatusCode != http.StatusSwitchingProtocols {
+				continue
+			}
+			if _, err := io.Copy(io.Discard, response.Body); err != nil {
+				return headers
+			}
+			if response.StatusCode == http.StatusSwitchingProtocols || response.Close {
+				return headers
+			}
+			break
+		}
+	}
+}
+
+// headerBlock returns the header block at the start of |data| up to and
+// including the empty line ending it, and whether it is complete.
+func headerBlock(data []byte) ([]byte, bool) {
+	for offset := 0; offset < len(data); {
+		lineEnd := bytes.IndexByte(data[offset:], '\n')
+		if lineEnd < 0 {
+			return nil, false
+		}
+		line := data[offset : offset+lineEnd+1]
+		offset += lineEnd + 1
+		if len(line) == 1 || len(line) == 2 && line[0] == '\r' {
+			return data[:offset], true
+		}
+	}
+	return nil, false
+}
+
+// appendNetLogBytes appends the base64 bytes of a socket data event to
+// |data|.
+func appendNetLogBytes(data []byte, params json.RawMessage) []byte {
+	var parsed struct {
+		Bytes []byte `json:"bytes"`
+	}
+	if json.Unmarshal(params, &parsed) != nil {
+		return data
+	}
+	return append(data, parsed.Bytes...)
+}
@@ -0,0 +1,65 @@
+package cronet_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadNetLogRawResponseHeaders(t *testing.T) {
+	var events []string
+	addEvent := func(eventType int, sourceID int, data string) {
+		events = append(events, fmt.Sprintf(`{"type":%d,"phase":0,"time":"%d","source":{"id":%d,"type":1},"params":{"byte_count":%d,"bytes":"%s"}}`,
+			eventType, len(events)+1, sourceID, len(data), base64.StdEncoding.EncodeToString([]byte(data))))
+	}
+	const (
+		socketSent = iota + 1
+		socketReceived
+		sslSent
+		sslReceived
+	)
+	addEvent(socketSent, 1, "\x16\x03\x01 encrypted")
+	addEvent(sslSent, 1, "POST /upload HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nContent-Length: 4\r\nX-Request-Id: 7\r\n\r\n")
+	addEvent(sslReceived, 1, "HTTP/1.1 100 Continue\r\n\r\n")
+	addEvent(sslSent, 1, "data")
+	addEvent(sslReceived, 1, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n")
+	addEvent(sslReceived, 1, "x-odd-case:  spaced \r\n\r\nhello")
+	addEvent(sslSent, 1, "GET /two HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	addEvent(sslReceived, 1, "HTTP/1.1 404 Not Found\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	addEvent(socketSent, 2, "GET / HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	addEvent(socketReceived, 2, "HTTP/1.1 200 OK\nBad Header\n\n")
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"SOCKET_BYTES_SENT":1,"SOCKET_BYTES_RECEIVED":2,"SSL_SOCKET_BYTES_SENT":3,"SSL_SOCKET_BYTES_RECEIVED":4},`+
+		`"logSourceType":{"SOCKET":1},"timeTickOffset":"1700000000000"},"events":[`+strings.Join(events, ",")+`]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers, err := cronet.ReadNetLogRawResponseHeaders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 4 {
+		t.Fatal("unexpected header blocks", headers)
+	}
+	if headers[0].StatusLine != "HTTP/1.1 100 Continue" || headers[0].Request.Header.Get("X-Request-Id") != "7" {
+		t.Error("unexpected interim response", headers[0])
+	}
+	if string(headers[1].Block) != "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nx-odd-case:  spaced \r\n\r\n" || headers[1].ParseError != nil {
+		t.Errorf("unexpected block %q: %v", headers[1].Block, headers[1].ParseError)
+	}
+	if headers[1].Time.UnixMilli() != 1700000000006 {
+		t.Error("unexpected time", headers[1].Time)
+	}
+	if headers[2].StatusLine != "HTTP/1.1 404 Not Found" || headers[2].Request.URL.Path != "/two" {
+		t.Error("unexpected response to the second request", headers[2])
+	}
+	if headers[3].SocketID != 2 || headers[3].StatusLine != "HTTP/1.1 200 OK" || headers[3].ParseError == nil {
+		t.Error("expected the malformed block with a parse error", headers[3])
+	}
+}
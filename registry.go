@@ -0,0 +1,176 @@
+package cronet
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/cpu"
+)
+
+// registryShardCount is the number of shards of a handleRegistry. Callbacks
+// of concurrent requests mostly hit different shards.
+const registryShardCount = 64
+
+// registryMinTableSize is the size of the first table of a shard.
+const registryMinTableSize = 16
+
+// handleRegistry maps the native objects the package creates to the Go
+// values their callbacks dispatch to. The zero value is ready to use.
+//
+// A value is stored before the native object is handed to Cronet and
+// deleted before the native object is destroyed, so a native object the
+// allocator reuses for a later registration never finds a stale value or
+// loses its new one to a late delete.
+//
+// Lookups, made by every callback, take no lock. Each shard is an open
+// addressing table whose slots are read atomically; only stores and deletes
+// serialize on the shard.
+type handleRegistry[T any] struct {
+	shards [registryShardCount]registryShard[T]
+}
+
+type registryShard[T any] struct {
+	// Keeps the locks of neighbouring shards off each other's cache line
+	_      cpu.CacheLinePad
+	access sync.Mutex
+	// table is the *registryTable[T] lookups read, replaced when rehashed.
+	table unsafe.Pointer
+	// live counts slots with a value, used slots with a key.
+	live int
+	used int
+}
+
+// registryTable is a linear probing table. The key of a slot is set once and
+// never changes, so a lookup that finds its key or an empty slot is done; a
+// deleted value leaves its key as a tombstone until the next rehash.
+type registryTable[T any] struct {
+	slots []registrySlot
+	shift uint
+}
+
+type registrySlot struct {
+	key uintptr
+	// value is a *T, nil once deleted.
+	value unsafe.Pointer
+}
+
+func newRegistryTable[T any](size int) *registryTable[T] {
+	shift := uint(64)
+	for n := size; n > 1; n >>= 1 {
+		shift--
+	}
+	return &registryTable[T]{slots: make([]registrySlot, size), shift: shift}
+}
+
+func (t *registryTable[T]) index(ptr uintptr) int {
+	// Fibonacci hashing spreads the aligned pointers over the table
+	return int((uint64(ptr>>4) * 0x9e3779b97f4a7c15) >> t.shift)
+}
+
+// slot returns the slot of |ptr|, or the empty slot it would take.
+func (t *registryTable[T]) slot(ptr uintptr) *registrySlot {
+	mask := len(t.slots) - 1
+	for i := t.index(ptr); ; i = (i + 1) & mask {
+		slot := &t.slots[i]
+		key := atomic.LoadUintptr(&slot.key)
+		if key == ptr || key == 0 {
+			return slot
+		}
+	}
+}
+
+func (r *handleRegistry[T]) shard(ptr uintptr) *registryShard[T] {
+	// Native objects are at least 16-byte aligned
+	return &r.shards[(ptr>>4^ptr>>12)%registryShardCount]
+}
+
+func (s *registryShard[T]) loadTable() *registryTable[T] {
+	return (*registryTable[T])(atomic.LoadPointer(&s.table))
+}
+
+// rehash replaces the table with one sized for the live values, dropping the
+// tombstones. Lookups still reading the old table find the same values.
+func (s *registryShard[T]) rehash(table *registryTable[T]) *registryTable[T] {
+	size := registryMinTableSize
+	for size*3/8 < s.live+1 {
+		size *= 2
+	}
+	next := newRegistryTable[T](size)
+	if table != nil {
+		for i := range table.slots {
+			slot := &table.slots[i]
+			if slot.value != nil {
+				*next.slot(slot.key) = registrySlot{key: slot.key, value: slot.value}
+			}
+		}
+	}
+	atomic.StorePointer(&s.table, unsafe.Pointer(next))
+	s.used = s.live
+	return next
+}
+
+func (r *handleRegistry[T]) store(ptr uintptr, value T) {
+	shard := r.shard(ptr)
+	shard.access.Lock()
+	table := shard.loadTable()
+	if table == nil || (shard.used+1)*4 > len(table.slots)*3 {
+		table = shard.rehash(table)
+	}
+	slot := table.slot(ptr)
+	if slot.value == nil {
+		shard.live++
+	}
+	atomic.StorePointer(&slot.value, unsafe.Pointer(&value))
+	if slot.key == 0 {
+		// Published after the value, so a lookup finding the key finds the value
+		atomic.StoreUintptr(&slot.key, ptr)
+		shard.used++
+	}
+	shard.access.Unlock()
+}
+
+func (r *handleRegistry[T]) load(ptr uintptr) (T, bool) {
+	if table := r.shard(ptr).loadTable(); table != nil {
+		if value := (*T)(atomic.LoadPointer(&table.slot(ptr).value)); value != nil {
+			return *value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func (r *handleRegistry[T]) loadAndDelete(ptr uintptr) (T, bool) {
+	shard := r.shard(ptr)
+	shard.access.Lock()
+	var value *T
+	if table := shard.loadTable(); table != nil {
+		slot := table.slot(ptr)
+		value = (*T)(slot.value)
+		if value != nil {
+			atomic.StorePointer(&slot.value, nil)
+			shard.live--
+		}
+	}
+	shard.access.Unlock()
+	if value == nil {
+		var zero T
+		return zero, false
+	}
+	return *value, true
+}
+
+func (r *handleRegistry[T]) delete(ptr uintptr) {
+	r.loadAndDelete(ptr)
+}
+
+func (r *handleRegistry[T]) len() int {
+	var length int
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.access.Lock()
+		length += shard.live
+		shard.access.Unlock()
+	}
+	return length
+}
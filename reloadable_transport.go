@@ -0,0 +1,265 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+var ErrTransportClosed = errors.New("cronet: transport closed")
+
+// ReloadableTransport is an http.RoundTripper whose engine can be replaced
+// with one of a new configuration, e.g. another proxy, DNS-over-HTTPS server
+// or cache path, without failing requests, for servers reloading their
+// configuration.
+//
+// An Engine is a handle to a native engine that is started once, so the
+// configuration of a running engine cannot change; ReloadableTransport owns
+// its engines and swaps them instead.
+type ReloadableTransport struct {
+	configure func(transport *RoundTripper)
+
+	reloadAccess sync.Mutex
+
+	access  sync.Mutex
+	current *reloadGeneration
+	// resumed is closed when requests paused by Reload may continue.
+	resumed chan struct{}
+	err     error
+	closed  bool
+}
+
+type reloadGeneration struct {
+	transport   *RoundTripper
+	storagePath string
+	active      int
+	retired     bool
+	drained     chan struct{}
+}
+
+// NewReloadableTransport starts an engine with |params|. |configure|, if not
+// nil, is called with the RoundTripper of every engine, e.g. to set
+// CheckRedirect or Progress; the Engine it sets is replaced. The caller keeps
+// ownership of |params|.
+func NewReloadableTransport(params EngineParams, configure func(transport *RoundTripper)) (*ReloadableTransport, error) {
+	t := &ReloadableTransport{configure: configure}
+	generation, err := t.newGeneration(params, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.current = generation
+	return t, nil
+}
+
+// Engine returns the current engine, e.g. to start a NetLog. It may be shut
+// down by a later Reload.
+func (t *ReloadableTransport) Engine() Engine {
+	t.access.Lock()
+	defer t.access.Unlock()
+	if t.current == nil {
+		return Engine{}
+	}
+	return t.current.transport.Engine
+}
+
+// Reload starts an engine with |params| and sends new requests with it. The
+// previous engine is shut down once its requests finished and their response
+// bodies were closed.
+//
+// Two engines cannot share a storage path. If |params| has the storage path
+// of the current engine, new requests wait until the current engine drained
+// and the new one started. If the new engine fails to start then, the
+// transport fails all requests with that error until a Reload succeeds.
+func (t *ReloadableTransport) Reload(params EngineParams) error {
+	return t.reload(params, nil)
+}
+
+// FlushDNSCache empties the host cache by reloading the transport with
+// |params|, normally those of the current engine, as Reload does: the
+// in-memory cache of a running engine cannot be flushed through the C API,
+// so it goes with the previous engine. The host cache persisted in the
+// storage path of |params| is cleared before the new engine starts, after
+// the previous engine shut down if it shares the storage path.
+func (t *ReloadableTransport) FlushDNSCache(params EngineParams) error {
+	return t.reload(params, func() error {
+		if params.StoragePath() == "" {
+			return nil
+		}
+		return ClearHostCache(params.StoragePath())
+	})
+}
+
+// reload starts an engine with |params| as Reload describes, calling
+// |prepare|, if not nil, right before.
+func (t *ReloadableTransport) reload(params EngineParams, prepare func() error) error {
+	t.reloadAccess.Lock()
+	defer t.reloadAccess.Unlock()
+	t.access.Lock()
+	if t.closed {
+		t.access.Unlock()
+		return ErrTransportClosed
+	}
+	previous := t.current
+	t.access.Unlock()
+
+	if previous == nil || !sameStoragePath(previous.storagePath, params.StoragePath()) {
+		generation, err := t.newGeneration(params, prepare)
+		if err != nil {
+			return err
+		}
+		t.access.Lock()
+		t.current = generation
+		t.err = nil
+		drained := previous != nil && t.retire(previous)
+		t.access.Unlock()
+		if drained {
+			previous.shutdown()
+		}
+		return nil
+	}
+
+	t.access.Lock()
+	t.resumed = make(chan struct{})
+	t.current = nil
+	drained := t.retire(previous)
+	t.access.Unlock()
+	if drained {
+		previous.shutdown()
+	}
+	<-previous.drained
+	generation, err := t.newGeneration(params, prepare)
+	t.access.Lock()
+	defer t.access.Unlock()
+	if err != nil {
+		t.err = err
+	} else {
+		t.current = generation
+		t.err = nil
+	}
+	close(t.resumed)
+	t.resumed = nil
+	return err
+}
+
+// Close shuts down the engine once its requests finished. Further requests
+// fail with ErrTransportClosed.
+func (t *ReloadableTransport) Close() error {
+	t.reloadAccess.Lock()
+	defer t.reloadAccess.Unlock()
+	t.access.Lock()
+	if t.closed {
+		t.access.Unlock()
+		return ErrTransportClosed
+	}
+	t.closed = true
+	current := t.current
+	t.current = nil
+	drained := current != nil && t.retire(current)
+	t.access.Unlock()
+	if drained {
+		current.shutdown()
+	}
+	return nil
+}
+
+func (t *ReloadableTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	generation, err := t.acquire(request)
+	if err != nil {
+		return nil, err
+	}
+	response, err := generation.transport.RoundTrip(request)
+	if err != nil {
+		t.release(generation)
+		return nil, err
+	}
+	response.Body = &profileResponseBody{ReadCloser: response.Body, finish: func() {
+		t.release(generation)
+	}}
+	return response, nil
+}
+
+func (t *ReloadableTransport) acquire(request *http.Request) (*reloadGeneration, error) {
+	t.access.Lock()
+	defer t.access.Unlock()
+	for t.resumed != nil {
+		resumed := t.resumed
+		t.access.Unlock()
+		select {
+		case <-resumed:
+		case <-request.Context().Done():
+			t.access.Lock()
+			return nil, request.Context().Err()
+		}
+		t.access.Lock()
+	}
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+	if t.current == nil {
+		return nil, t.err
+	}
+	t.current.active++
+	return t.current, nil
+}
+
+func (t *ReloadableTransport) release(generation *reloadGeneration) {
+	t.access.Lock()
+	generation.active--
+	drained := generation.retired && generation.active == 0
+	t.access.Unlock()
+	if drained {
+		generation.shutdown()
+	}
+}
+
+// retire must be called with access held. It reports whether |generation|
+// has no requests left, so the caller shuts it down once access is released.
+func (t *ReloadableTransport) retire(generation *reloadGeneration) bool {
+	generation.retired = true
+	return generation.active == 0
+}
+
+// shutdown shuts down the engine of a drained generation. It blocks until
+// the engine released its resources, so it runs without access held.
+func (g *reloadGeneration) shutdown() {
+	g.transport.close()
+	close(g.drained)
+}
+
+func (t *ReloadableTransport) newGeneration(params EngineParams, prepare func() error) (*reloadGeneration, error) {
+	if prepare != nil {
+		if err := prepare(); err != nil {
+			return nil, err
+		}
+	}
+	engine := NewEngine()
+	result := engine.StartWithParams(params)
+	if result != ResultSuccess {
+		engine.Destroy()
+		return nil, fmt.Errorf("cronet: start engine: result %d", result)
+	}
+	transport := &RoundTripper{}
+	if t.configure != nil {
+		t.configure(transport)
+	}
+	transport.Engine = engine
+	transport.closeEngine = true
+	var emptyExecutor Executor
+	if transport.Executor == emptyExecutor {
+		transport.Executor = newGoroutineExecutor()
+		transport.closeExecutor = true
+	}
+	return &reloadGeneration{
+		transport:   transport,
+		storagePath: params.StoragePath(),
+		drained:     make(chan struct{}),
+	}, nil
+}
+
+func sameStoragePath(path string, other string) bool {
+	return path != "" && other != "" && filepath.Clean(path) == filepath.Clean(other)
+}
@@ -0,0 +1,115 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReloadableTransport(t *testing.T) {
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	transport, err := cronet.NewReloadableTransport(params, nil)
+	params.Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	response, err := client.Get("https://cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params = cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	params.SetEnableQuic(true)
+	err = transport.Reload(params)
+	params.Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The response of the previous engine stays readable until closed
+	_, err = io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err = client.Get("https://cloudflare.com/cdn-cgi/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	err = transport.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get("https://cloudflare.com/cdn-cgi/trace")
+	if err == nil {
+		t.Fatal("request after close succeeded")
+	}
+}
+
+func TestReloadableTransportEmptyBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Length", "5")
+		if request.Method != http.MethodHead {
+			writer.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	transport, err := cronet.NewReloadableTransport(params, nil)
+	params.Destroy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	request, _ := http.NewRequest(http.MethodHead, server.URL, nil)
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ContentLength != 5 {
+		t.Fatal("unexpected content length", response.ContentLength)
+	}
+	reloaded := make(chan error, 1)
+	go func() {
+		params := cronet.NewEngineParams()
+		defer params.Destroy()
+		reloaded <- transport.Reload(params)
+	}()
+	// The engine is only shut down once the body is closed and the request
+	// behind it is done
+	select {
+	case err := <-reloaded:
+		t.Fatal("reloaded before the body was closed", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if content, err := io.ReadAll(response.Body); err != nil || len(content) != 0 {
+		t.Fatalf("unexpected body %q %v", content, err)
+	}
+	response.Body.Close()
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("reload did not finish")
+	}
+
+	request, _ = http.NewRequest(http.MethodHead, server.URL, nil)
+	response, err = transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
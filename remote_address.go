@@ -0,0 +1,107 @@
+package cronet
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+)
+
+// ReadNetLogRemoteAddresses maps the NetLog source IDs of the requests in the
+// NetLog file at |path| to the address of the connection each was sent on,
+// e.g. to see whether Addr().Is4() for dual-stack debugging. The C API does
+// not report the address, so it is found by following the sockets, HTTP/2 and
+// QUIC sessions a request was bound to. Requests through a proxy report the
+// proxy address; requests answered from the cache or failing before a
+// connection was bound are left out. Use ReadNetLogRequestIDs to find the
+// source of a request sent by RoundTripper.
+func ReadNetLogRemoteAddresses(path string) (map[int64]netip.AddrPort, error) {
+	requests := make(map[int64]bool)
+	bindings := make(map[int64][]int64)
+	attempts := make(map[int64]netip.AddrPort)
+	addresses := make(map[int64]netip.AddrPort)
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		if event.SourceType == "URL_REQUEST" {
+			requests[event.SourceID] = true
+		}
+		if len(event.Params) == 0 {
+			if event.Type == "TCP_CONNECT_ATTEMPT" && event.Phase == NetLogPhaseEnd {
+				// Successful attempts end without a net error
+				if address, loaded := attempts[event.SourceID]; loaded {
+					addresses[event.SourceID] = address
+				}
+			}
+			return nil
+		}
+		var params struct {
+			Address          string `json:"address"`
+			PeerAddress      string `json:"peer_address"`
+			NetError         int    `json:"net_error"`
+			SourceDependency *struct {
+				ID int64 `json:"id"`
+			} `json:"source_dependency"`
+		}
+		// Params of other versions may not match; the fields that do are used
+		json.Unmarshal(event.Params, &params)
+		switch {
+		case event.Type == "TCP_CONNECT_ATTEMPT":
+			if event.Phase == NetLogPhaseBegin {
+				if address, err := netip.ParseAddrPort(params.Address); err == nil {
+					attempts[event.SourceID] = address
+				}
+			} else if event.Phase == NetLogPhaseEnd && params.NetError == 0 {
+				if address, loaded := attempts[event.SourceID]; loaded {
+					addresses[event.SourceID] = address
+				}
+			}
+		case params.PeerAddress != "" && strings.HasPrefix(event.Type, "QUIC_SESSION"):
+			if _, loaded := addresses[event.SourceID]; !loaded {
+				if address, err := netip.ParseAddrPort(params.PeerAddress); err == nil {
+					addresses[event.SourceID] = address
+				}
+			}
+		case params.SourceDependency != nil && netLogBindsSource(event.Type):
+			bindings[event.SourceID] = append(bindings[event.SourceID], params.SourceDependency.ID)
+		}
+		return nil
+	})
+	remotes := make(map[int64]netip.AddrPort)
+	for request := range requests {
+		if address, found := netLogBoundAddress(request, bindings, addresses); found {
+			remotes[request] = address
+		}
+	}
+	return remotes, err
+}
+
+// netLogBindsSource reports whether events of |eventType| bind their source
+// to the source in their source_dependency, e.g. a stream job to a socket.
+func netLogBindsSource(eventType string) bool {
+	if strings.HasSuffix(eventType, "_BOUND_TO_REQUEST") {
+		// Back to the request the source was bound from
+		return false
+	}
+	return strings.Contains(eventType, "_BOUND_TO_") ||
+		strings.HasPrefix(eventType, "HTTP2_SESSION_POOL_") ||
+		eventType == "HTTP2_SESSION_INITIALIZED"
+}
+
+// netLogBoundAddress returns the address of the source closest to |request|
+// in the bindings.
+func netLogBoundAddress(request int64, bindings map[int64][]int64, addresses map[int64]netip.AddrPort) (netip.AddrPort, bool) {
+	visited := map[int64]bool{request: true}
+	queue := []int64{request}
+	for len(queue) > 0 {
+		source := queue[0]
+		queue = queue[1:]
+		if address, loaded := addresses[source]; loaded {
+			return address, true
+		}
+		for _, bound := range bindings[source] {
+			if !visited[bound] {
+				visited[bound] = true
+				queue = append(queue, bound)
+			}
+		}
+	}
+	return netip.AddrPort{}, false
+}
@@ -0,0 +1,57 @@
+package cronet_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadNetLogRemoteAddresses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"REQUEST_ALIVE":1,"HTTP_STREAM_REQUEST_BOUND_TO_JOB":2,"SOCKET_POOL_BOUND_TO_SOCKET":3,`+
+		`"TCP_CONNECT_ATTEMPT":4,"HTTP2_SESSION_POOL_FOUND_EXISTING_SESSION":5,"HTTP2_SESSION_INITIALIZED":6,"HTTP_STREAM_REQUEST_BOUND_TO_QUIC_SESSION":7,`+
+		`"QUIC_SESSION_PACKET_RECEIVED":8,"HTTP_STREAM_JOB_BOUND_TO_REQUEST":9},`+
+		`"logSourceType":{"URL_REQUEST":1,"HTTP_STREAM_JOB":2,"SOCKET":3,"HTTP2_SESSION":4,"QUIC_SESSION":5},"timeTickOffset":"1700000000000"},"events":[`+
+		// Request 1 is sent on socket 11, whose IPv6 attempt failed
+		`{"type":1,"phase":1,"time":"1","source":{"id":1,"type":1}},`+
+		`{"type":4,"phase":1,"time":"2","source":{"id":11,"type":3},"params":{"address":"[2001:db8::1]:443"}},`+
+		`{"type":4,"phase":2,"time":"3","source":{"id":11,"type":3},"params":{"net_error":-118}},`+
+		`{"type":4,"phase":1,"time":"4","source":{"id":11,"type":3},"params":{"address":"192.0.2.1:443"}},`+
+		`{"type":4,"phase":2,"time":"5","source":{"id":11,"type":3}},`+
+		`{"type":9,"phase":0,"time":"6","source":{"id":10,"type":2},"params":{"source_dependency":{"id":1,"type":1}}},`+
+		`{"type":3,"phase":0,"time":"6","source":{"id":10,"type":2},"params":{"source_dependency":{"id":11,"type":3}}},`+
+		`{"type":2,"phase":0,"time":"7","source":{"id":1,"type":1},"params":{"source_dependency":{"id":10,"type":2}}},`+
+		// Request 2 reuses HTTP/2 session 21 on socket 22
+		`{"type":4,"phase":1,"time":"8","source":{"id":22,"type":3},"params":{"address":"[2001:db8::2]:443"}},`+
+		`{"type":4,"phase":2,"time":"9","source":{"id":22,"type":3}},`+
+		`{"type":6,"phase":0,"time":"9","source":{"id":21,"type":4},"params":{"protocol":"h2","source_dependency":{"id":22,"type":3}}},`+
+		`{"type":5,"phase":0,"time":"10","source":{"id":20,"type":2},"params":{"source_dependency":{"id":21,"type":4}}},`+
+		`{"type":2,"phase":0,"time":"11","source":{"id":2,"type":1},"params":{"source_dependency":{"id":20,"type":2}}},`+
+		// Request 3 is sent on QUIC session 31
+		`{"type":8,"phase":0,"time":"12","source":{"id":31,"type":5},"params":{"peer_address":"[::ffff:192.0.2.3]:443","size":1200}},`+
+		`{"type":7,"phase":0,"time":"13","source":{"id":3,"type":1},"params":{"source_dependency":{"id":31,"type":5}}},`+
+		// Request 4 never got a connection
+		`{"type":1,"phase":1,"time":"14","source":{"id":4,"type":1}}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remotes, err := cronet.ReadNetLogRemoteAddresses(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remotes) != 3 {
+		t.Fatal("unexpected remotes", remotes)
+	}
+	if remote := remotes[1]; remote.String() != "192.0.2.1:443" || !remote.Addr().Is4() {
+		t.Error("unexpected TCP remote", remote)
+	}
+	if remote := remotes[2]; remote.String() != "[2001:db8::2]:443" || !remote.Addr().Is6() {
+		t.Error("unexpected HTTP/2 remote", remote)
+	}
+	if remote := remotes[3]; remote.String() != "[::ffff:192.0.2.3]:443" || !remote.Addr().Is4In6() {
+		t.Error("unexpected QUIC remote", remote)
+	}
+}
@@ -0,0 +1,398 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRequestQueued     = errors.New("cronet: request queued for replay")
+	ErrReplayQueueClosed = errors.New("cronet: replay queue closed")
+)
+
+// QueuedError is returned by ReplayQueue.RoundTrip for a request that failed
+// and was queued. It matches ErrRequestQueued and unwraps to the failure.
+type QueuedError struct {
+	ID  string
+	Err error
+}
+
+func (e *QueuedError) Error() string {
+	return ErrRequestQueued.Error() + ": " + e.Err.Error()
+}
+
+func (e *QueuedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *QueuedError) Is(target error) bool {
+	return target == ErrRequestQueued
+}
+
+// QueuedRequest is a failed request stored by ReplayQueue.
+type QueuedRequest struct {
+	ID       string      `json:"id"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body,omitempty"`
+	Queued   time.Time   `json:"queued"`
+	Attempts int         `json:"attempts"`
+}
+
+// ReplayQueueConfig configures a ReplayQueue.
+type ReplayQueueConfig struct {
+	// Directory persists queued requests, one file each, so they survive
+	// restarts. If empty, the queue is kept in memory.
+	Directory string
+
+	// Methods are the methods of requests that are queued. Empty means POST and PUT.
+	Methods []string
+
+	// MaxBodySize is the largest request body that is queued; requests with
+	// larger bodies are sent without buffering and never queued.
+	// Zero means 1 MiB.
+	MaxBodySize int64
+
+	// MaxRequests limits the number of queued requests. Requests failing while
+	// the queue is full are not queued. Zero means unlimited.
+	MaxRequests int
+
+	// ShouldQueue decides whether a failed request is queued. The default
+	// queues errors of an unavailable network or unreachable server, after
+	// which the request most likely did not reach the server.
+	ShouldQueue func(err error) bool
+
+	// RetryInterval replays the queue periodically while it is not empty.
+	// Zero replays only when Replay is called.
+	RetryInterval time.Duration
+
+	// OnReplayed is called for every replayed request with the response or
+	// the error that removed it from the queue. The response body must be closed.
+	OnReplayed func(request QueuedRequest, response *http.Response, err error)
+}
+
+// ReplayQueue is an http.RoundTripper storing requests that failed for lack
+// of connectivity and sending them again later, for mobile and embedded
+// clients that are intermittently offline.
+//
+// The C API reports no network changes, so the application calls Replay from
+// its platform connectivity callback, e.g. ConnectivityManager.NetworkCallback
+// on Android or NWPathMonitor on iOS, or sets RetryInterval.
+//
+// A replayed request is sent again in full; servers should deduplicate with
+// an idempotency key header set by the application.
+type ReplayQueue struct {
+	transport http.RoundTripper
+	config    ReplayQueueConfig
+
+	access   sync.Mutex
+	requests []QueuedRequest
+	nextID   uint64
+	closed   bool
+
+	replayAccess sync.Mutex
+	done         chan struct{}
+}
+
+// NewReplayQueue returns a queue sending requests with |transport| and loads
+// the requests persisted in config.Directory.
+func NewReplayQueue(transport http.RoundTripper, config ReplayQueueConfig) (*ReplayQueue, error) {
+	if len(config.Methods) == 0 {
+		config.Methods = []string{http.MethodPost, http.MethodPut}
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.ShouldQueue == nil {
+		config.ShouldQueue = isConnectivityError
+	}
+	queue := &ReplayQueue{
+		transport: transport,
+		config:    config,
+		done:      make(chan struct{}),
+	}
+	if config.Directory != "" {
+		err := os.MkdirAll(config.Directory, 0o700)
+		if err != nil {
+			return nil, err
+		}
+		err = queue.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.RetryInterval > 0 {
+		go queue.loopReplay()
+	}
+	return queue, nil
+}
+
+func (q *ReplayQueue) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !q.queueable(request) {
+		return q.transport.RoundTrip(request)
+	}
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(request.Body, q.config.MaxBodySize+1))
+		if err != nil {
+			request.Body.Close()
+			return nil, err
+		}
+		if int64(len(body)) > q.config.MaxBodySize {
+			request = request.Clone(request.Context())
+			request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+			return q.transport.RoundTrip(request)
+		}
+		request.Body.Close()
+		request = request.Clone(request.Context())
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		request.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	response, err := q.transport.RoundTrip(request)
+	if err == nil || !q.config.ShouldQueue(err) {
+		return response, err
+	}
+	queued := QueuedRequest{
+		Method: request.Method,
+		URL:    request.URL.String(),
+		Header: request.Header.Clone(),
+		Body:   body,
+		Queued: time.Now(),
+	}
+	id, queueErr := q.push(queued)
+	if queueErr != nil {
+		return nil, err
+	}
+	return nil, &QueuedError{ID: id, Err: err}
+}
+
+func (q *ReplayQueue) queueable(request *http.Request) bool {
+	for _, method := range q.config.Methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending returns the queued requests, oldest first.
+func (q *ReplayQueue) Pending() []QueuedRequest {
+	q.access.Lock()
+	defer q.access.Unlock()
+	return append([]QueuedRequest(nil), q.requests...)
+}
+
+// Replay sends the queued requests in order. A request is removed once it
+// got a response, whatever its status, or failed with an error ShouldQueue
+// rejects. Replay stops at the first request failing with a queueable error,
+// as the network is still unavailable, and returns that error.
+func (q *ReplayQueue) Replay(ctx context.Context) error {
+	q.replayAccess.Lock()
+	defer q.replayAccess.Unlock()
+	for {
+		q.access.Lock()
+		if q.closed {
+			q.access.Unlock()
+			return ErrReplayQueueClosed
+		}
+		if len(q.requests) == 0 {
+			q.access.Unlock()
+			return nil
+		}
+		queued := q.requests[0]
+		q.access.Unlock()
+
+		request, err := queued.newRequest(ctx)
+		var response *http.Response
+		if err == nil {
+			response, err = q.transport.RoundTrip(request)
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && q.config.ShouldQueue(err) {
+			queued.Attempts++
+			q.update(queued)
+			return err
+		}
+		q.remove(queued.ID)
+		if q.config.OnReplayed != nil {
+			q.config.OnReplayed(queued, response, err)
+		} else if response != nil {
+			response.Body.Close()
+		}
+	}
+}
+
+// Close stops periodic replays. Persisted requests stay in the directory.
+func (q *ReplayQueue) Close() error {
+	q.access.Lock()
+	defer q.access.Unlock()
+	if q.closed {
+		return ErrReplayQueueClosed
+	}
+	q.closed = true
+	close(q.done)
+	return nil
+}
+
+func (q *ReplayQueue) loopReplay() {
+	ticker := time.NewTicker(q.config.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		q.access.Lock()
+		pending := len(q.requests)
+		q.access.Unlock()
+		if pending > 0 {
+			q.Replay(context.Background())
+		}
+	}
+}
+
+func (q *ReplayQueue) push(queued QueuedRequest) (string, error) {
+	q.access.Lock()
+	defer q.access.Unlock()
+	if q.closed {
+		return "", ErrReplayQueueClosed
+	}
+	if q.config.MaxRequests > 0 && len(q.requests) >= q.config.MaxRequests {
+		return "", errors.New("cronet: replay queue full")
+	}
+	q.nextID++
+	// IDs sort in queue order, which is also the order of the persisted files
+	queued.ID = fmt.Sprintf("%020d-%06d", queued.Queued.UnixNano(), q.nextID%1000000)
+	err := q.save(queued)
+	if err != nil {
+		return "", err
+	}
+	q.requests = append(q.requests, queued)
+	return queued.ID, nil
+}
+
+func (q *ReplayQueue) update(queued QueuedRequest) {
+	q.access.Lock()
+	defer q.access.Unlock()
+	for i := range q.requests {
+		if q.requests[i].ID == queued.ID {
+			q.requests[i] = queued
+			q.save(queued)
+			return
+		}
+	}
+}
+
+func (q *ReplayQueue) remove(id string) {
+	q.access.Lock()
+	defer q.access.Unlock()
+	for i := range q.requests {
+		if q.requests[i].ID == id {
+			q.requests = append(q.requests[:i], q.requests[i+1:]...)
+			break
+		}
+	}
+	if q.config.Directory != "" {
+		os.Remove(filepath.Join(q.config.Directory, id+".json"))
+	}
+}
+
+func (q *ReplayQueue) save(queued QueuedRequest) error {
+	if q.config.Directory == "" {
+		return nil
+	}
+	content, err := json.Marshal(queued)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(q.config.Directory, queued.ID+".json")
+	err = os.WriteFile(path+".tmp", content, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (q *ReplayQueue) load() error {
+	files, err := os.ReadDir(q.config.Directory)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(q.config.Directory, name))
+		if err != nil {
+			return err
+		}
+		var queued QueuedRequest
+		err = json.Unmarshal(content, &queued)
+		if err != nil || queued.ID+".json" != name {
+			// Not a queued request, e.g. written by another program
+			continue
+		}
+		q.requests = append(q.requests, queued)
+		if sequence := strings.LastIndexByte(queued.ID, '-'); sequence >= 0 {
+			if value, err := strconv.ParseUint(queued.ID[sequence+1:], 10, 64); err == nil && value > q.nextID {
+				q.nextID = value
+			}
+		}
+	}
+	return nil
+}
+
+func (r QueuedRequest) newRequest(ctx context.Context) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, r.Method, r.URL, bytes.NewReader(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header = r.Header.Clone()
+	if request.Header == nil {
+		request.Header = make(http.Header)
+	}
+	return request, nil
+}
+
+// isConnectivityError reports errors of an unavailable network or server.
+func isConnectivityError(err error) bool {
+	var cronetErr *ErrorGo
+	if !errors.As(err, &cronetErr) {
+		return false
+	}
+	switch cronetErr.ErrorCode {
+	case ErrorCodeErrorHostnameNotResolved, ErrorCodeErrorInternetDisconnected, ErrorCodeErrorNetworkChanged,
+		ErrorCodeErrorConnectionTimedOut, ErrorCodeErrorConnectionRefused, ErrorCodeErrorAddressUnreachable:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+type flakyTransport struct {
+	access  sync.Mutex
+	offline bool
+	bodies  []string
+}
+
+func (t *flakyTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	t.access.Lock()
+	defer t.access.Unlock()
+	if t.offline {
+		return nil, &cronet.ErrorGo{ErrorCode: cronet.ErrorCodeErrorInternetDisconnected, Message: "net::ERR_INTERNET_DISCONNECTED"}
+	}
+	body, _ := io.ReadAll(request.Body)
+	t.bodies = append(t.bodies, request.Method+" "+string(body))
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: request}, nil
+}
+
+func TestReplayQueue(t *testing.T) {
+	directory := t.TempDir()
+	transport := &flakyTransport{offline: true}
+	queue, err := cronet.NewReplayQueue(transport, cronet.ReplayQueueConfig{Directory: directory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"first", "second"} {
+		request, _ := http.NewRequest(http.MethodPost, "https://example.com/upload", strings.NewReader(body))
+		_, err = queue.RoundTrip(request)
+		var queuedErr *cronet.QueuedError
+		if !errors.Is(err, cronet.ErrRequestQueued) || !errors.As(err, &queuedErr) {
+			t.Fatal("expected queued error, got", err)
+		}
+	}
+	request, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	_, err = queue.RoundTrip(request)
+	if err == nil || errors.Is(err, cronet.ErrRequestQueued) {
+		t.Fatal("GET must fail without being queued, got", err)
+	}
+	if err = queue.Replay(context.Background()); err == nil {
+		t.Fatal("replay succeeded while offline")
+	}
+	if pending := queue.Pending(); len(pending) != 2 || pending[0].Attempts != 1 {
+		t.Fatal("bad pending requests", pending)
+	}
+	queue.Close()
+
+	// A new queue on the same directory picks up the persisted requests
+	queue, err = cronet.NewReplayQueue(transport, cronet.ReplayQueueConfig{Directory: directory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	if pending := queue.Pending(); len(pending) != 2 || string(pending[0].Body) != "first" {
+		t.Fatal("bad loaded requests", pending)
+	}
+	transport.access.Lock()
+	transport.offline = false
+	transport.access.Unlock()
+	if err = queue.Replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Pending()) != 0 {
+		t.Fatal("requests left after replay", queue.Pending())
+	}
+	if strings.Join(transport.bodies, ",") != "POST first,POST second" {
+		t.Fatal("bad replayed requests", transport.bodies)
+	}
+}
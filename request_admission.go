@@ -0,0 +1,110 @@
+package cronet
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// admittedRequest is a request RoundTripper let through its checks, circuit
+// breaker, scheduler and throttle, ready to be sent.
+type admittedRequest struct {
+	// request is the request to send, with the throttled and compressed body.
+	request *http.Request
+	// target is the URL the request is sent to, nil for the Interceptor.
+	target    *url.URL
+	circuit   *circuitRequest
+	scheduled *scheduledRequest
+	throttle  *requestThrottle
+}
+
+// admitRequest checks |request| and waits for it to be let in flight. On an
+// error nothing read the body; the caller closes it with closeRequestBody, as
+// http.RoundTripper requires.
+func (t *RoundTripper) admitRequest(request *http.Request) (*admittedRequest, error) {
+	target, err := t.checkRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	circuit, err := startCircuit(t.CircuitBreaker, request)
+	if err != nil {
+		return nil, err
+	}
+	scheduled, err := startScheduler(t.Scheduler, request)
+	if err != nil {
+		circuit.abort()
+		return nil, err
+	}
+	throttle, err := startThrottle(t.Throttle, request)
+	if err != nil {
+		scheduled.release()
+		circuit.abort()
+		return nil, err
+	}
+	admitted := &admittedRequest{
+		request:   throttle.request(request),
+		target:    target,
+		circuit:   circuit,
+		scheduled: scheduled,
+		throttle:  throttle,
+	}
+	options, _ := RequestOptionsFromContext(request.Context())
+	if t.Interceptor == nil && options.UploadEncoding != "" && request.Body != nil && request.Body != http.NoBody {
+		compressed, err := compressRequestBody(admitted.request, options.UploadEncoding)
+		if err != nil {
+			throttle.release()
+			scheduled.release()
+			circuit.abort()
+			return nil, err
+		}
+		admitted.request = compressed
+	}
+	return admitted, nil
+}
+
+// finish counts the outcome of the request and releases its slots once the
+// response body is closed.
+func (r *admittedRequest) finish(response *http.Response, err error) (*http.Response, error) {
+	r.circuit.finish(response, err)
+	return r.scheduled.response(r.throttle.response(response, err))
+}
+
+// checkRequest returns the URL to send |request| to, or the error of a
+// request that must not be sent: an invalid method or URL, a hostname
+// IDNPolicy rejects or a URL a request policy denies. Requests for the
+// Interceptor are only checked for their method.
+func (t *RoundTripper) checkRequest(request *http.Request) (*url.URL, error) {
+	if err := checkMethod(request.Method); err != nil {
+		return nil, err
+	}
+	if t.Interceptor != nil {
+		return nil, nil
+	}
+	options, _ := RequestOptionsFromContext(request.Context())
+	hosts := []string{request.URL.Hostname()}
+	if options.ServerName != "" {
+		hosts = append(hosts, options.ServerName)
+	}
+	for _, host := range hosts {
+		if _, err := t.IDNPolicy.ValidateHostname(host); err != nil {
+			return nil, err
+		}
+	}
+	requestURL, _ := requestTarget(request, options)
+	target, err := url.Parse(requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if err := checkRequestPolicies(request.Context(), target, t.requestPolicies()...); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// closeRequestBody closes the body of a request that failed before it was
+// handed on to be sent.
+func closeRequestBody(request *http.Request) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+}
@@ -0,0 +1,79 @@
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// closeCountingBody counts the times it is closed.
+type closeCountingBody struct {
+	*strings.Reader
+	closed int
+}
+
+func (b *closeCountingBody) Close() error {
+	b.closed++
+	return nil
+}
+
+func TestRoundTripClosesBodyOnEarlyError(t *testing.T) {
+	transport := &cronet.RoundTripper{
+		RequestPolicy: &cronet.RequestPolicy{DenyHosts: []string{"denied.example"}},
+	}
+	for _, test := range []struct {
+		name    string
+		method  string
+		url     string
+		options cronet.RequestOptions
+		want    error
+	}{
+		{"method", "BAD METHOD", "https://example.com/", cronet.RequestOptions{}, cronet.ErrInvalidMethod},
+		{"policy", http.MethodPost, "https://denied.example/", cronet.RequestOptions{}, cronet.ErrRequestDenied},
+		{"encoding", http.MethodPost, "https://example.com/", cronet.RequestOptions{UploadEncoding: "x-unknown"}, nil},
+	} {
+		body := &closeCountingBody{Reader: strings.NewReader("body")}
+		ctx := cronet.WithRequestOptions(context.Background(), test.options)
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, test.url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Method = test.method
+		_, err = transport.RoundTrip(request)
+		if err == nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if body.closed != 1 {
+			t.Fatalf("%s: body closed %d times", test.name, body.closed)
+		}
+	}
+}
+
+func TestRoundTripChecksBeforeSending(t *testing.T) {
+	transport := &cronet.RoundTripper{
+		RequestPolicy: &cronet.RequestPolicy{DenyHosts: []string{"denied.example"}},
+	}
+	// The policy is checked before the body is compressed
+	ctx := cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{UploadEncoding: "x-unknown"})
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://denied.example/", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrRequestDenied) {
+		t.Fatal("expected the policy to deny the request, got", err)
+	}
+
+	// A URL the policy can not check is not sent
+	request, err = http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.URL.Host = "example.com:port"
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrInvalidURL) {
+		t.Fatal("expected ErrInvalidURL, got", err)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// heldAnnotations are the annotations of a request sent by RoundTripper,
+// kept until the request is done and the finished request listeners of its
+// engine have run.
+type heldAnnotations struct {
+	engine      uintptr
+	annotations map[string]any
+	// listeners are the finished request listeners still to run, by
+	// listener pointer.
+	listeners map[uintptr]bool
+	done      bool
+}
+
+var (
+	annotationsAccess  sync.Mutex
+	requestAnnotations = make(map[RequestID]*heldAnnotations)
+	// finishListeners are the finished request listeners of the engines, by
+	// engine and listener pointer.
+	finishListeners = make(map[uintptr]map[uintptr]bool)
+)
+
+// holdRequestAnnotations keeps |annotations| of the request |id| on |engine|
+// for URLRequestFinishedInfo.Annotations until releaseRequestAnnotations was
+// called for the request and every finished request listener of the engine
+// ran or was removed.
+func holdRequestAnnotations(engine Engine, id RequestID, annotations map[string]any) {
+	if len(annotations) == 0 {
+		return
+	}
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	enginePtr := uintptr(unsafe.Pointer(engine.ptr))
+	listeners := make(map[uintptr]bool, len(finishListeners[enginePtr]))
+	for listener := range finishListeners[enginePtr] {
+		listeners[listener] = true
+	}
+	requestAnnotations[id] = &heldAnnotations{
+		engine:      enginePtr,
+		annotations: annotations,
+		listeners:   listeners,
+	}
+}
+
+// releaseRequestAnnotations drops the hold of the request |id| on its
+// annotations, if any.
+func releaseRequestAnnotations(id RequestID) {
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	held := requestAnnotations[id]
+	if held == nil {
+		return
+	}
+	held.done = true
+	if len(held.listeners) == 0 {
+		delete(requestAnnotations, id)
+	}
+}
+
+// releaseListenerAnnotations drops the hold of |listener| on the annotations
+// of the request |id|, if any, once it ran for the request.
+func releaseListenerAnnotations(id RequestID, listener URLRequestFinishedInfoListener) {
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	held := requestAnnotations[id]
+	if held == nil {
+		return
+	}
+	delete(held.listeners, uintptr(unsafe.Pointer(listener.ptr)))
+	if held.done && len(held.listeners) == 0 {
+		delete(requestAnnotations, id)
+	}
+}
+
+func addFinishListener(engine Engine, listener URLRequestFinishedInfoListener) {
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	enginePtr := uintptr(unsafe.Pointer(engine.ptr))
+	if finishListeners[enginePtr] == nil {
+		finishListeners[enginePtr] = make(map[uintptr]bool)
+	}
+	finishListeners[enginePtr][uintptr(unsafe.Pointer(listener.ptr))] = true
+}
+
+// removeFinishListener forgets |listener| of |engine| and drops its hold on
+// the annotations of the requests it did not run for yet.
+func removeFinishListener(engine Engine, listener URLRequestFinishedInfoListener) {
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	enginePtr := uintptr(unsafe.Pointer(engine.ptr))
+	listenerPtr := uintptr(unsafe.Pointer(listener.ptr))
+	delete(finishListeners[enginePtr], listenerPtr)
+	if len(finishListeners[enginePtr]) == 0 {
+		delete(finishListeners, enginePtr)
+	}
+	for id, held := range requestAnnotations {
+		if held.engine != enginePtr {
+			continue
+		}
+		delete(held.listeners, listenerPtr)
+		if held.done && len(held.listeners) == 0 {
+			delete(requestAnnotations, id)
+		}
+	}
+}
+
+// deleteEngineAnnotations drops the annotations held for the requests of
+// |engine|, e.g. of requests whose listeners did not run before shutdown.
+func deleteEngineAnnotations(engine Engine) {
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	enginePtr := uintptr(unsafe.Pointer(engine.ptr))
+	delete(finishListeners, enginePtr)
+	for id, held := range requestAnnotations {
+		if held.engine == enginePtr {
+			delete(requestAnnotations, id)
+		}
+	}
+}
+
+// Annotations returns the annotations the context of a request sent by
+// RoundTripper carried, set with WithAnnotations, or nil. They are kept for
+// the listeners added with Engine.AddRequestFinishListener before the
+// request was sent, until they ran or were removed.
+func (i URLRequestFinishedInfo) Annotations() map[string]any {
+	id, loaded := i.RequestID()
+	if !loaded {
+		return nil
+	}
+	annotationsAccess.Lock()
+	defer annotationsAccess.Unlock()
+	if held := requestAnnotations[id]; held != nil {
+		return held.annotations
+	}
+	return nil
+}
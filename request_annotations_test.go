@@ -0,0 +1,134 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestRequestFinishedInfoAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "body")
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	finished := make(chan map[string]any, 1)
+	listener := cronet.NewURLRequestFinishedInfoListener(func(listener cronet.URLRequestFinishedInfoListener, requestInfo cronet.URLRequestFinishedInfo, responseInfo cronet.URLResponseInfo, error cronet.Error) {
+		finished <- requestInfo.Annotations()
+	})
+	defer listener.Destroy()
+	executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {
+		go func() {
+			command.Run()
+			command.Destroy()
+		}()
+	})
+	defer executor.Destroy()
+	engine.AddRequestFinishListener(listener, executor)
+	defer engine.RemoveRequestFinishListener(listener)
+
+	ctx := cronet.WithAnnotations(context.Background(), map[string]any{"trace": 42})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	select {
+	case annotations := <-finished:
+		if annotations["trace"] != 42 {
+			t.Fatal("unexpected annotations", annotations)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("listener not called")
+	}
+}
+
+func TestRequestFinishedInfoAnnotationsLateListener(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+		io.WriteString(writer, "body")
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	newListener := func(finished chan map[string]any, delay time.Duration) (cronet.URLRequestFinishedInfoListener, cronet.Executor) {
+		listener := cronet.NewURLRequestFinishedInfoListener(func(listener cronet.URLRequestFinishedInfoListener, requestInfo cronet.URLRequestFinishedInfo, responseInfo cronet.URLResponseInfo, error cronet.Error) {
+			finished <- requestInfo.Annotations()
+		})
+		executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {
+			go func() {
+				time.Sleep(delay)
+				command.Run()
+				command.Destroy()
+			}()
+		})
+		return listener, executor
+	}
+	// The listener added before the request runs last, after the one added
+	// while the request was in flight
+	early := make(chan map[string]any, 1)
+	earlyListener, earlyExecutor := newListener(early, 500*time.Millisecond)
+	defer earlyListener.Destroy()
+	defer earlyExecutor.Destroy()
+	engine.AddRequestFinishListener(earlyListener, earlyExecutor)
+	defer engine.RemoveRequestFinishListener(earlyListener)
+
+	ctx := cronet.WithAnnotations(context.Background(), map[string]any{"trace": 42})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- response
+	}()
+	time.Sleep(200 * time.Millisecond)
+	late := make(chan map[string]any, 1)
+	lateListener, lateExecutor := newListener(late, 0)
+	defer lateListener.Destroy()
+	defer lateExecutor.Destroy()
+	engine.AddRequestFinishListener(lateListener, lateExecutor)
+	defer engine.RemoveRequestFinishListener(lateListener)
+	close(release)
+
+	response := <-responses
+	if response == nil {
+		t.FailNow()
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	select {
+	case annotations := <-early:
+		if annotations["trace"] != 42 {
+			t.Fatal("annotations released by a listener added later", annotations)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("listener not called")
+	}
+}
@@ -0,0 +1,76 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestHostOverrideRedirect(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, request.Host)
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/cross-origin":
+			http.Redirect(writer, request, other.URL+"/target", http.StatusFound)
+		case "/same-origin":
+			http.Redirect(writer, request, "/target", http.StatusFound)
+		default:
+			io.WriteString(writer, request.Host)
+		}
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+	transport := &cronet.RoundTripper{Engine: engine}
+	get := func(roundTripper http.RoundTripper, path string) *http.Response {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		request.Host = "virtual.example"
+		response, err := roundTripper.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	readHost := func(response *http.Response) string {
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		return string(body)
+	}
+
+	// The redirect to another origin is returned rather than followed with
+	// the Host header
+	response := get(transport, "/cross-origin")
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound || response.Header.Get("Location") != other.URL+"/target" {
+		t.Fatalf("expected the redirect to be returned, got %d", response.StatusCode)
+	}
+	// http.Client follows it without the Host header
+	client := &http.Client{Transport: transport}
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/cross-origin", nil)
+	request.Host = "virtual.example"
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host := readHost(response); host != other.Listener.Addr().String() {
+		t.Fatalf("expected the Host of the new origin, got %q", host)
+	}
+
+	// Redirects within the origin keep it
+	if host := readHost(get(transport, "/same-origin")); host != "virtual.example" {
+		t.Fatalf("expected the Host override to be kept, got %q", host)
+	}
+}
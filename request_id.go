@@ -0,0 +1,133 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// #include <stdint.h>
+// #include <cronet_c.h>
+//
+// // Request IDs are stored as odd integers in the annotation pointer, which
+// // can not collide with the aligned pointers of other annotations.
+// static void cronet_add_request_id_annotation(Cronet_UrlRequestParamsPtr params, uint64_t id) {
+//   Cronet_UrlRequestParams_annotations_add(params, (Cronet_RawDataPtr)(uintptr_t)((id << 1) | 1));
+// }
+//
+// static uint64_t cronet_params_request_id_annotation(Cronet_UrlRequestParamsPtr params) {
+//   uint32_t size = Cronet_UrlRequestParams_annotations_size(params);
+//   for (uint32_t i = 0; i < size; i++) {
+//     uintptr_t value = (uintptr_t)Cronet_UrlRequestParams_annotations_at(params, i);
+//     if (value & 1) {
+//       return value >> 1;
+//     }
+//   }
+//   return 0;
+// }
+//
+// static uint64_t cronet_request_id_annotation(Cronet_RequestFinishedInfoPtr info) {
+//   uint32_t size = Cronet_RequestFinishedInfo_annotations_size(info);
+//   for (uint32_t i = 0; i < size; i++) {
+//     uintptr_t value = (uintptr_t)Cronet_RequestFinishedInfo_annotations_at(info, i);
+//     if (value & 1) {
+//       return value >> 1;
+//     }
+//   }
+//   return 0;
+// }
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// RequestID identifies a request sent by RoundTripper. IDs are unique within
+// the process and never zero.
+type RequestID uint64
+
+func (id RequestID) String() string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+var lastRequestID uint64
+
+// NewRequestID returns a new unique request ID, for use with WithRequestID.
+func NewRequestID() RequestID {
+	return RequestID(atomic.AddUint64(&lastRequestID, 1))
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of |ctx| carrying |id|, so the ID of a request
+// is known before it is sent. RoundTripper assigns a new ID to requests
+// without one.
+func WithRequestID(ctx context.Context, id RequestID) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID in |ctx|. The context of
+// http.Response.Request always carries the ID of the request.
+func RequestIDFromContext(ctx context.Context) (RequestID, bool) {
+	id, loaded := ctx.Value(requestIDKey{}).(RequestID)
+	return id, loaded
+}
+
+// requestWithID returns |request| with a request ID in its context, and the ID.
+func requestWithID(request *http.Request) (*http.Request, RequestID) {
+	if id, loaded := RequestIDFromContext(request.Context()); loaded {
+		return request, id
+	}
+	id := NewRequestID()
+	return request.WithContext(WithRequestID(request.Context(), id)), id
+}
+
+// addRequestIDAnnotation attaches |id| to the request, to be read back with
+// URLRequestFinishedInfo.RequestID.
+func (p URLRequestParams) addRequestIDAnnotation(id RequestID) {
+	C.cronet_add_request_id_annotation(p.ptr, C.uint64_t(id))
+}
+
+// requestIDAnnotation returns the ID attached with addRequestIDAnnotation,
+// or zero.
+func (p URLRequestParams) requestIDAnnotation() RequestID {
+	return RequestID(C.cronet_params_request_id_annotation(p.ptr))
+}
+
+// RequestID returns the ID of a request sent by RoundTripper, for finished
+// request listeners added with Engine.AddRequestFinishListener.
+func (i URLRequestFinishedInfo) RequestID() (RequestID, bool) {
+	id := RequestID(C.cronet_request_id_annotation(i.ptr))
+	return id, id != 0
+}
+
+// ReadNetLogRequestIDs maps the IDs of requests sent with
+// RoundTripper.RequestIDHeader set to the NetLog source IDs of the requests,
+// by finding |header| in the request headers logged to the NetLog file at |path|.
+func ReadNetLogRequestIDs(path string, header string) (map[RequestID]int64, error) {
+	prefix := strings.ToLower(header) + ": "
+	sources := make(map[RequestID]int64)
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		if !strings.HasSuffix(event.Type, "SEND_REQUEST_HEADERS") || len(event.Params) == 0 {
+			return nil
+		}
+		var params struct {
+			Headers []string `json:"headers"`
+		}
+		if json.Unmarshal(event.Params, &params) != nil {
+			return nil
+		}
+		for _, line := range params.Headers {
+			if len(line) <= len(prefix) || strings.ToLower(line[:len(prefix)]) != prefix {
+				continue
+			}
+			id, err := strconv.ParseUint(strings.TrimSpace(line[len(prefix):]), 10, 64)
+			if err == nil {
+				sources[RequestID(id)] = event.SourceID
+			}
+		}
+		return nil
+	})
+	return sources, err
+}
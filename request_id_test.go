@@ -0,0 +1,123 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestRequestIDAnnotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "body")
+	}))
+	defer server.Close()
+
+	engine := newFirstByteEngine(t)
+	type finishedRequest struct {
+		id          cronet.RequestID
+		loaded      bool
+		annotations []uintptr
+	}
+	finished := make(chan finishedRequest, 1)
+	listener := cronet.NewURLRequestFinishedInfoListener(func(listener cronet.URLRequestFinishedInfoListener, requestInfo cronet.URLRequestFinishedInfo, responseInfo cronet.URLResponseInfo, error cronet.Error) {
+		request := finishedRequest{}
+		request.id, request.loaded = requestInfo.RequestID()
+		for i := 0; i < requestInfo.AnnotationSize(); i++ {
+			request.annotations = append(request.annotations, uintptr(requestInfo.AnnotationAt(i)))
+		}
+		finished <- request
+	})
+	defer listener.Destroy()
+	executor := cronet.NewExecutor(func(executor cronet.Executor, command cronet.Runnable) {
+		go func() {
+			command.Run()
+			command.Destroy()
+		}()
+	})
+	defer executor.Destroy()
+	engine.AddRequestFinishListener(listener, executor)
+	defer engine.RemoveRequestFinishListener(listener)
+	waitFinished := func() finishedRequest {
+		select {
+		case request := <-finished:
+			return request
+		case <-time.After(10 * time.Second):
+			t.Fatal("listener not called")
+			return finishedRequest{}
+		}
+	}
+
+	// The ID is stored shifted left with the lowest bit set
+	id := cronet.RequestID(1<<40 + 3)
+	request, _ := http.NewRequestWithContext(cronet.WithRequestID(context.Background(), id), http.MethodGet, server.URL, nil)
+	response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responseID, _ := cronet.RequestIDFromContext(response.Request.Context()); responseID != id {
+		t.Error("unexpected ID in the response request", responseID)
+	}
+	io.ReadAll(response.Body)
+	response.Body.Close()
+	finishedID := waitFinished()
+	if !finishedID.loaded || finishedID.id != id {
+		t.Fatalf("unexpected finished ID %v %v", finishedID.id, finishedID.loaded)
+	}
+	odd := 0
+	for _, annotation := range finishedID.annotations {
+		if annotation&1 == 1 {
+			odd++
+			if annotation != uintptr(id)<<1|1 {
+				t.Errorf("unexpected annotation %#x", annotation)
+			}
+		}
+	}
+	if odd != 1 {
+		t.Error("expected a single odd annotation, got", odd)
+	}
+
+	// Requests sent without RoundTripper have no ID
+	params := cronet.NewURLRequestParams()
+	params.SetMethod(http.MethodGet)
+	handler := &uploadHandler{done: make(chan struct{})}
+	callback := cronet.NewURLRequestCallback(handler)
+	defer callback.Destroy()
+	lowLevel := cronet.NewURLRequest()
+	lowLevel.InitWithParams(engine, server.URL, params, callback, executor)
+	params.Destroy()
+	lowLevel.Start()
+	<-handler.done
+	lowLevel.Destroy()
+	if finishedID = waitFinished(); finishedID.loaded || finishedID.id != 0 {
+		t.Fatal("unexpected ID of a low-level request", finishedID.id)
+	}
+}
+
+func TestReadNetLogRequestIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"HTTP_TRANSACTION_SEND_REQUEST_HEADERS":1,"HTTP_TRANSACTION_HTTP2_SEND_REQUEST_HEADERS":2,"HTTP_TRANSACTION_READ_RESPONSE_HEADERS":3},`+
+		`"logSourceType":{"URL_REQUEST":1},"timeTickOffset":"1700000000000"},"events":[`+
+		`{"type":1,"phase":0,"time":"1","source":{"id":5,"type":1},"params":{"line":"GET / HTTP/1.1\r\n","headers":["Host: example.com","X-Request-Id: 7"]}},`+
+		`{"type":2,"phase":0,"time":"2","source":{"id":6,"type":1},"params":{"headers":[":method: GET","x-request-id: 8"]}},`+
+		`{"type":1,"phase":0,"time":"3","source":{"id":9,"type":1},"params":{"headers":["x-request-id: not a number","x-request-id-other: 10"]}},`+
+		`{"type":3,"phase":0,"time":"4","source":{"id":11,"type":1},"params":{"headers":["HTTP/1.1 200","x-request-id: 12"]}}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources, err := cronet.ReadNetLogRequestIDs(path, "X-Request-ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[7] != 5 || sources[8] != 6 {
+		t.Fatal("unexpected sources", sources)
+	}
+}
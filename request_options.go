@@ -0,0 +1,129 @@
+package cronet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Protocol is an application protocol as reported by URLResponseInfo.NegotiatedProtocol.
+type Protocol string
+
+const (
+	ProtocolHTTP11 Protocol = "http/1.1"
+	ProtocolHTTP2  Protocol = "h2"
+	ProtocolHTTP3  Protocol = "h3"
+)
+
+var ErrProtocolUnavailable = errors.New("cronet: protocol unavailable")
+
+// RequestOptions are per-request settings of the RoundTripper, attached to the
+// request context with WithRequestOptions.
+//
+// There is no per-request address family preference: connections are shared
+// between requests and the network stack chooses between IPv4 and IPv6
+// itself. See EngineParams.SetDisableIPv6OnWiFi and SetHostResolverRules.
+type RequestOptions struct {
+	// Protocols restricts the request to the given protocols. If a response
+	// (including a redirect) arrives over any other protocol, the request is
+	// canceled and RoundTrip returns an error wrapping ErrProtocolUnavailable
+	// instead of silently using the fallback.
+	//
+	// Cronet chooses the protocol itself, so this validates rather than steers:
+	// enable QUIC and add QUIC hints for origins expected to speak HTTP/3.
+	Protocols []Protocol
+
+	// ServerName overrides the host the request connects to and sends as TLS
+	// SNI, while the Host header (or :authority) keeps the URL host, or
+	// http.Request.Host if set. The certificate must be valid for ServerName.
+	//
+	// The connection goes to the addresses of ServerName. To reach another
+	// address with this SNI, map ServerName with the engine's host resolver rules.
+	ServerName string
+
+	// UploadEncoding compresses the request body with the named encoding,
+	// "gzip", "deflate" or one added with RegisterUploadEncoder, and sets
+	// Content-Encoding. The body is sent chunked as its compressed length is
+	// unknown up front.
+	UploadEncoding string
+
+	// UploadBytesPerSecond and DownloadBytesPerSecond limit the rates of the
+	// request and response body of the request, in addition to the Throttle
+	// of the RoundTripper. Zero means unlimited.
+	UploadBytesPerSecond   int64
+	DownloadBytesPerSecond int64
+
+	// Tenant is the tenant the request is scheduled for by the FairScheduler
+	// of the RoundTripper.
+	Tenant string
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of |ctx| carrying |options| for requests
+// sent by RoundTripper.
+func WithRequestOptions(ctx context.Context, options RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, options)
+}
+
+// RequestOptionsFromContext returns the options attached by WithRequestOptions.
+func RequestOptionsFromContext(ctx context.Context) (RequestOptions, bool) {
+	options, loaded := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return options, loaded
+}
+
+// normalizeProtocol maps the protocol names reported by the native stack to
+// a Protocol. HTTP/1 without ALPN is reported as "unknown", QUIC drafts as
+// e.g. "h3-29".
+func normalizeProtocol(negotiated string) Protocol {
+	switch {
+	case negotiated == "" || negotiated == "unknown" || strings.HasPrefix(negotiated, "http/1"):
+		return ProtocolHTTP11
+	case negotiated == "h2":
+		return ProtocolHTTP2
+	case strings.HasPrefix(negotiated, "h3") || strings.HasPrefix(negotiated, "quic"):
+		return ProtocolHTTP3
+	default:
+		return Protocol(negotiated)
+	}
+}
+
+// requestTarget returns the URL to send |request| to and the Host header to
+// send, empty if it follows from the URL.
+func requestTarget(request *http.Request, options RequestOptions) (requestURL string, hostHeader string) {
+	hostHeader = request.Host
+	if options.ServerName == "" {
+		if hostHeader == request.URL.Host {
+			hostHeader = ""
+		}
+		return request.URL.String(), hostHeader
+	}
+	if hostHeader == "" {
+		hostHeader = request.URL.Host
+	}
+	target := *request.URL
+	if port := target.Port(); port != "" {
+		target.Host = net.JoinHostPort(options.ServerName, port)
+	} else if strings.Contains(options.ServerName, ":") {
+		target.Host = "[" + options.ServerName + "]"
+	} else {
+		target.Host = options.ServerName
+	}
+	return target.String(), hostHeader
+}
+
+func checkProtocol(allowed []Protocol, negotiated string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	protocol := normalizeProtocol(negotiated)
+	for _, allowedProtocol := range allowed {
+		if protocol == allowedProtocol {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: negotiated %s", ErrProtocolUnavailable, negotiated)
+}
@@ -0,0 +1,223 @@
+package cronet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ErrRequestDenied is wrapped by the errors of requests a RequestPolicy
+// denied.
+var ErrRequestDenied = errors.New("cronet: request denied by policy")
+
+// Built-in networks for RequestPolicy.
+var (
+	// LoopbackNetworks are the loopback addresses.
+	LoopbackNetworks = mustParsePrefixes("127.0.0.0/8", "::1/128")
+	// PrivateNetworks are the private IPv4 ranges of RFC 1918, the shared
+	// address space of carrier-grade NAT and the IPv6 unique local addresses.
+	PrivateNetworks = mustParsePrefixes("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+	// LinkLocalNetworks are the link-local addresses, which include the
+	// metadata services of cloud providers at 169.254.169.254.
+	LinkLocalNetworks = mustParsePrefixes("169.254.0.0/16", "fe80::/10")
+	// UnspecifiedNetworks are the addresses meaning "this host", which
+	// connect to the local machine.
+	UnspecifiedNetworks = mustParsePrefixes("0.0.0.0/8", "::/128")
+)
+
+// RequestPolicy decides which URLs requests may go to before they are
+// created, e.g. to protect a server fetching URLs supplied by its users
+// against server-side request forgery. Set it on an engine with
+// EngineParams.SetRequestPolicy or on a RoundTripper. The RoundTripper checks
+// redirects as well.
+//
+// Hosts are canonicalized as the network stack does, so IPv4 addresses in
+// octal or hexadecimal form are matched as the address they stand for. Host
+// names are only resolved for OnConnect.
+type RequestPolicy struct {
+	// Schemes are the allowed schemes. Nil allows http and https.
+	Schemes []string
+	// AllowHosts and AllowNetworks, if either is not empty, are the only host
+	// names and the only networks of IP address literals requests may go
+	// to. "example.com" matches the name only, "*.example.com" its
+	// subdomains. Addresses in AllowNetworks are allowed even with
+	// DenyPrivateNetworks.
+	AllowHosts    []string
+	AllowNetworks []netip.Prefix
+	// DenyHosts are host names requests may not go to, matched as AllowHosts.
+	DenyHosts []string
+	// DenyNetworks are networks requests may not go to.
+	DenyNetworks []netip.Prefix
+	// DenyPrivateNetworks denies the addresses of LoopbackNetworks,
+	// PrivateNetworks, LinkLocalNetworks and UnspecifiedNetworks, and the
+	// names "localhost" and "*.localhost", which resolve to loopback. IPv4
+	// addresses embedded in IPv4-mapped and NAT64 (64:ff9b::/96) addresses
+	// are checked as well.
+	DenyPrivateNetworks bool
+	// Check, if set, is called for requests passing the other rules and
+	// denies the request by returning an error.
+	Check func(requestURL *url.URL) error
+
+	// OnConnect, if set, is called with the addresses the host of a request
+	// resolves to, or its IP address literal, before the request is sent,
+	// and denies it by returning an error, e.g. DenyPrivateAddresses to stop
+	// public names resolving to private addresses. See CheckConnect.
+	OnConnect func(host string, addresses []netip.Addr) error
+	// Resolver resolves host names for OnConnect. Nil means
+	// net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// CheckURL returns an error wrapping ErrRequestDenied if |requestURL| is
+// denied by the policy.
+func (p *RequestPolicy) CheckURL(requestURL *url.URL) error {
+	scheme := strings.ToLower(requestURL.Scheme)
+	schemes := p.Schemes
+	if schemes == nil {
+		schemes = []string{"http", "https"}
+	}
+	if !containsFold(schemes, scheme) {
+		return fmt.Errorf("%w: scheme %q not allowed", ErrRequestDenied, requestURL.Scheme)
+	}
+	host := requestURL.Hostname()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	canonical, err := CanonicalizeHost(host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRequestDenied, err)
+	}
+	address, err := netip.ParseAddr(strings.Trim(canonical, "[]"))
+	if err == nil {
+		err = p.checkAddress(address)
+	} else {
+		err = p.checkHostname(strings.TrimSuffix(canonical, "."))
+	}
+	if err != nil {
+		return err
+	}
+	if p.Check != nil {
+		if err := p.Check(requestURL); err != nil {
+			return fmt.Errorf("%w: %v", ErrRequestDenied, err)
+		}
+	}
+	return nil
+}
+
+// checkAddress checks |address| and the IPv4 address it embeds, if any.
+func (p *RequestPolicy) checkAddress(address netip.Addr) error {
+	embedded := unwrapAddress(address)
+	if containsAddress(p.DenyNetworks, address) || containsAddress(p.DenyNetworks, embedded) {
+		return fmt.Errorf("%w: address %s denied", ErrRequestDenied, address)
+	}
+	if containsAddress(p.AllowNetworks, address) || containsAddress(p.AllowNetworks, embedded) {
+		return nil
+	}
+	if p.DenyPrivateNetworks && isPrivateAddress(embedded) {
+		return fmt.Errorf("%w: private address %s", ErrRequestDenied, address)
+	}
+	if len(p.AllowNetworks) > 0 || len(p.AllowHosts) > 0 {
+		return fmt.Errorf("%w: address %s not allowed", ErrRequestDenied, address)
+	}
+	return nil
+}
+
+func (p *RequestPolicy) checkHostname(hostname string) error {
+	if matchHostPatterns(p.DenyHosts, hostname) {
+		return fmt.Errorf("%w: host %s denied", ErrRequestDenied, hostname)
+	}
+	if p.DenyPrivateNetworks && (hostname == "localhost" || strings.HasSuffix(hostname, ".localhost")) {
+		return fmt.Errorf("%w: local host %s", ErrRequestDenied, hostname)
+	}
+	if (len(p.AllowHosts) > 0 || len(p.AllowNetworks) > 0) && !matchHostPatterns(p.AllowHosts, hostname) {
+		return fmt.Errorf("%w: host %s not allowed", ErrRequestDenied, hostname)
+	}
+	return nil
+}
+
+// isPrivateAddress reports whether |address| is in a network denied by
+// RequestPolicy.DenyPrivateNetworks.
+// nat64Network is the well-known prefix of NAT64, which embeds an IPv4
+// address in the last four bytes.
+var nat64Network = netip.MustParsePrefix("64:ff9b::/96")
+
+// unwrapAddress returns the IPv4 address embedded in an IPv4-mapped or NAT64
+// address, which connections to |address| reach, or |address| itself.
+func unwrapAddress(address netip.Addr) netip.Addr {
+	address = address.Unmap()
+	if nat64Network.Contains(address) {
+		embedded := address.As16()
+		return netip.AddrFrom4([4]byte{embedded[12], embedded[13], embedded[14], embedded[15]})
+	}
+	return address
+}
+
+func isPrivateAddress(address netip.Addr) bool {
+	return containsAddress(LoopbackNetworks, address) ||
+		containsAddress(PrivateNetworks, address) ||
+		containsAddress(LinkLocalNetworks, address) ||
+		containsAddress(UnspecifiedNetworks, address)
+}
+
+func containsAddress(networks []netip.Prefix, address netip.Addr) bool {
+	for _, network := range networks {
+		if network.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHostPatterns reports whether |hostname| matches one of |patterns|,
+// "example.com" or "*.example.com".
+func matchHostPatterns(patterns []string, hostname string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern {
+			if strings.HasSuffix(hostname, suffix) && len(hostname) > len(suffix) {
+				return true
+			}
+		} else if hostname == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequestPolicies checks |requestURL| with CheckURL and CheckConnect of
+// each of |policies| that is not nil.
+func checkRequestPolicies(ctx context.Context, requestURL *url.URL, policies ...*RequestPolicy) error {
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		if err := policy.CheckURL(requestURL); err != nil {
+			return err
+		}
+		if err := policy.CheckConnect(ctx, requestURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, prefix := range prefixes {
+		parsed[i] = netip.MustParsePrefix(prefix)
+	}
+	return parsed
+}
@@ -0,0 +1,79 @@
+package cronet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// ReservedNetworks are the addresses reserved for purposes other than
+// reaching public hosts: multicast, the former class E, benchmarking and the
+// IETF protocol assignments.
+var ReservedNetworks = mustParsePrefixes("192.0.0.0/24", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4", "ff00::/8")
+
+// CheckConnect resolves the host of |requestURL| and passes its addresses to
+// OnConnect, returning its error wrapped in ErrRequestDenied. It returns nil
+// without OnConnect, and the error of the resolver if the host does not
+// resolve.
+//
+// The C API has no hook between the resolution of a host and the connection
+// to it, so the network stack resolves the host again on its own. A
+// rebinding name answering each query with other addresses can pass the
+// check with a public address and be connected to at a private one. The
+// host cache of the engine narrows the window to names with a TTL of zero;
+// where that is not enough, map the hosts to checked addresses with
+// EngineParams.SetHostResolverRules or send requests through a proxy
+// enforcing the policy.
+func (p *RequestPolicy) CheckConnect(ctx context.Context, requestURL *url.URL) error {
+	if p.OnConnect == nil {
+		return nil
+	}
+	host := requestURL.Hostname()
+	var addresses []netip.Addr
+	if address, err := netip.ParseAddr(host); err == nil {
+		addresses = []netip.Addr{address}
+	} else {
+		canonical, err := CanonicalizeHost(host)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrRequestDenied, err)
+		}
+		if address, err := netip.ParseAddr(canonical); err == nil {
+			// IPv4 in another form, e.g. 0x7f.1
+			addresses = []netip.Addr{address}
+		} else {
+			resolver := p.Resolver
+			if resolver == nil {
+				resolver = net.DefaultResolver
+			}
+			addresses, err = resolver.LookupNetIP(ctx, "ip", strings.TrimSuffix(canonical, "."))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for i := range addresses {
+		addresses[i] = addresses[i].Unmap()
+	}
+	if err := p.OnConnect(host, addresses); err != nil {
+		return fmt.Errorf("%w: %v", ErrRequestDenied, err)
+	}
+	return nil
+}
+
+// DenyPrivateAddresses is an OnConnect callback of RequestPolicy denying
+// hosts with an address in LoopbackNetworks, PrivateNetworks,
+// LinkLocalNetworks, UnspecifiedNetworks or ReservedNetworks, including
+// IPv4 addresses embedded in NAT64 addresses. All addresses of a host are
+// checked, as the network stack may connect to any of them.
+func DenyPrivateAddresses(host string, addresses []netip.Addr) error {
+	for _, address := range addresses {
+		checked := unwrapAddress(address)
+		if isPrivateAddress(checked) || containsAddress(ReservedNetworks, checked) {
+			return fmt.Errorf("%s resolves to non-public address %s", host, address)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestRequestPolicy(t *testing.T) {
+	policy := &cronet.RequestPolicy{
+		DenyPrivateNetworks: true,
+		DenyHosts:           []string{"*.internal.example.com"},
+		AllowNetworks:       []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("203.0.113.0/24")},
+		AllowHosts:          []string{"example.com", "*.example.com"},
+	}
+	for _, testCase := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/", true},
+		{"https://api.example.com/", true},
+		{"https://EXAMPLE.com./", true},
+		{"https://db.internal.example.com/", false},
+		{"https://example.org/", false},
+		{"ftp://example.com/", false},
+		{"http://localhost/", false},
+		{"http://app.localhost/", false},
+		{"http://127.0.0.1/", false},
+		{"http://0x7f.1/", false},
+		{"http://2130706433/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://[::1]/", false},
+		{"http://0.0.0.0/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[fe80::1]/", false},
+		{"http://192.168.1.1/", false},
+		{"http://10.1.2.3/", true},
+		{"http://10.2.2.3/", false},
+		{"http://203.0.113.7/", true},
+		{"http://198.51.100.7/", false},
+	} {
+		requestURL, err := url.Parse(testCase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.CheckURL(requestURL)
+		if testCase.allowed && err != nil {
+			t.Errorf("%s denied: %v", testCase.url, err)
+		} else if !testCase.allowed && !errors.Is(err, cronet.ErrRequestDenied) {
+			t.Errorf("%s not denied: %v", testCase.url, err)
+		}
+	}
+
+	hook := &cronet.RequestPolicy{Check: func(requestURL *url.URL) error {
+		if requestURL.Port() != "" {
+			return errors.New("non-default port")
+		}
+		return nil
+	}}
+	requestURL, _ := url.Parse("https://example.com:8443/")
+	if err := hook.CheckURL(requestURL); !errors.Is(err, cronet.ErrRequestDenied) || !strings.Contains(err.Error(), "non-default port") {
+		t.Error("expected the hook to deny, got", err)
+	}
+}
+
+func TestRequestPolicyHostMapping(t *testing.T) {
+	// Hosts are checked as the network stack maps them before connecting
+	policy := &cronet.RequestPolicy{
+		DenyPrivateNetworks: true,
+		DenyHosts:           []string{"internal.corp"},
+	}
+	for _, testCase := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://１２７.０.０.１/", false},
+		{"http://127。0。0。1/", false},
+		{"http://127．0｡0.1/", false},
+		{"http://ｌｏｃａｌｈｏｓｔ/", false},
+		{"http://ＩＮＴＥＲＮＡＬ.corp/", false},
+		{"http://[64:ff9b::7f00:1]/", false},
+		{"http://[64:ff9b::a00:1]/", false},
+		{"http://[::ffff:a00:1]/", false},
+		{"http://[64:ff9b::cb00:7107]/", true},
+		{"http://ｅｘａｍｐｌｅ.corp/", true},
+	} {
+		requestURL, err := url.Parse(testCase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.CheckURL(requestURL)
+		if testCase.allowed && err != nil {
+			t.Errorf("%s denied: %v", testCase.url, err)
+		} else if !testCase.allowed && !errors.Is(err, cronet.ErrRequestDenied) {
+			t.Errorf("%s not denied: %v", testCase.url, err)
+		}
+	}
+}
+
+func TestRoundTripperRequestPolicy(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/redirect" {
+			http.Redirect(writer, request, strings.Replace(server.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &cronet.RoundTripper{
+		RequestPolicy: &cronet.RequestPolicy{DenyPrivateNetworks: true},
+	}}
+	if _, err := client.Get(server.URL); !errors.Is(err, cronet.ErrRequestDenied) {
+		t.Fatal("expected ErrRequestDenied, got", err)
+	}
+
+	client.Transport = &cronet.RoundTripper{
+		RequestPolicy: &cronet.RequestPolicy{
+			DenyPrivateNetworks: true,
+			AllowNetworks:       []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")},
+		},
+	}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if _, err := client.Get(server.URL + "/redirect"); !errors.Is(err, cronet.ErrRequestDenied) {
+		t.Fatal("expected the redirect to be denied, got", err)
+	}
+}
+
+func TestRequestPolicyOnConnect(t *testing.T) {
+	policy := &cronet.RequestPolicy{OnConnect: cronet.DenyPrivateAddresses}
+	for _, testCase := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://localhost/", false},
+		{"http://0x7f.1/", false},
+		{"http://[::ffff:10.0.0.1]/", false},
+		{"http://[64:ff9b::a00:1]/", false},
+		{"http://224.0.0.1/", false},
+		{"http://8.8.8.8/", true},
+		{"http://[2001:4860:4860::8888]/", true},
+	} {
+		requestURL, err := url.Parse(testCase.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = policy.CheckConnect(context.Background(), requestURL)
+		if testCase.allowed && err != nil {
+			t.Errorf("%s denied: %v", testCase.url, err)
+		} else if !testCase.allowed && !errors.Is(err, cronet.ErrRequestDenied) {
+			t.Errorf("%s not denied: %v", testCase.url, err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &cronet.RoundTripper{RequestPolicy: policy}}
+	_, err := client.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	if !errors.Is(err, cronet.ErrRequestDenied) {
+		t.Fatal("expected ErrRequestDenied, got", err)
+	}
+}
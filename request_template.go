@@ -0,0 +1,89 @@
+//go:build !cronet_nolib
+
+package cronet
+
+// #include <stdlib.h>
+// #include <stdbool.h>
+// #include <cronet_c.h>
+//
+// static Cronet_UrlRequestParamsPtr cronet_clone_request_params(Cronet_UrlRequestParamsPtr source) {
+//   Cronet_UrlRequestParamsPtr params = Cronet_UrlRequestParams_Create();
+//   Cronet_UrlRequestParams_http_method_set(params, Cronet_UrlRequestParams_http_method_get(source));
+//   Cronet_UrlRequestParams_disable_cache_set(params, Cronet_UrlRequestParams_disable_cache_get(source));
+//   Cronet_UrlRequestParams_priority_set(params, Cronet_UrlRequestParams_priority_get(source));
+//   Cronet_UrlRequestParams_upload_data_provider_set(params, Cronet_UrlRequestParams_upload_data_provider_get(source));
+//   Cronet_UrlRequestParams_upload_data_provider_executor_set(params, Cronet_UrlRequestParams_upload_data_provider_executor_get(source));
+//   Cronet_UrlRequestParams_allow_direct_executor_set(params, Cronet_UrlRequestParams_allow_direct_executor_get(source));
+//   Cronet_UrlRequestParams_request_finished_listener_set(params, Cronet_UrlRequestParams_request_finished_listener_get(source));
+//   Cronet_UrlRequestParams_request_finished_executor_set(params, Cronet_UrlRequestParams_request_finished_executor_get(source));
+//   Cronet_UrlRequestParams_idempotency_set(params, Cronet_UrlRequestParams_idempotency_get(source));
+//   uint32_t size = Cronet_UrlRequestParams_request_headers_size(source);
+//   for (uint32_t i = 0; i < size; i++) {
+//     Cronet_UrlRequestParams_request_headers_add(params, Cronet_UrlRequestParams_request_headers_at(source, i));
+//   }
+//   size = Cronet_UrlRequestParams_annotations_size(source);
+//   for (uint32_t i = 0; i < size; i++) {
+//     Cronet_UrlRequestParams_annotations_add(params, Cronet_UrlRequestParams_annotations_at(source, i));
+//   }
+//   return params;
+// }
+import "C"
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Clone returns a copy of the parameters, including headers and annotations,
+// made in a single call into the native library. Referenced objects such as
+// the upload data provider and executors are shared, not copied.
+func (p URLRequestParams) Clone() URLRequestParams {
+	clone := URLRequestParams{C.cronet_clone_request_params(p.ptr)}
+	cloneRemovedHeaders(p, clone)
+	return clone
+}
+
+// RequestTemplate holds the method, headers and priority shared by many
+// requests in native form, so stamping out the parameters of a request
+// costs one call into the native library instead of several per header.
+type RequestTemplate struct {
+	params URLRequestParams
+}
+
+// NewRequestTemplate returns a template for requests with |method|, |header|
+// and |priority|. Headers are added in sorted order, so templates built from
+// the same values are identical. The template must be destroyed with Destroy.
+func NewRequestTemplate(method string, header http.Header, priority URLRequestParamsRequestPriority) *RequestTemplate {
+	params := NewURLRequestParams()
+	if method == "" {
+		method = http.MethodGet
+	}
+	params.SetMethod(method)
+	params.SetPriority(priority)
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var packed packedHeaders
+	for _, key := range keys {
+		for _, value := range header[key] {
+			packed.add(key, value)
+		}
+	}
+	params.addPackedHeaders(&packed)
+	return &RequestTemplate{params}
+}
+
+// NewParams returns new request parameters filled from the template. More
+// headers, an upload or annotations can be added before the parameters are
+// passed to URLRequest.InitWithParams; they are destroyed by the caller.
+func (t *RequestTemplate) NewParams() URLRequestParams {
+	return t.params.Clone()
+}
+
+// Destroy releases the native parameters of the template. Parameters created
+// from it stay valid.
+func (t *RequestTemplate) Destroy() {
+	t.params.Destroy()
+}
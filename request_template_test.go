@@ -0,0 +1,48 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestRequestTemplate(t *testing.T) {
+	template := cronet.NewRequestTemplate(http.MethodPost, http.Header{
+		"Content-Type": {"application/json"},
+		"Accept":       {"application/json", "text/plain"},
+	}, cronet.URLRequestParamsRequestPriorityHighest)
+	params := template.NewParams()
+	template.Destroy()
+	defer params.Destroy()
+
+	extra := cronet.NewHTTPHeader()
+	extra.SetName("X-Extra")
+	extra.SetValue("1")
+	params.AddHeader(extra)
+	extra.Destroy()
+	clone := params.Clone()
+	defer clone.Destroy()
+
+	for _, p := range []cronet.URLRequestParams{params, clone} {
+		if p.Method() != http.MethodPost || p.Priority() != cronet.URLRequestParamsRequestPriorityHighest {
+			t.Fatal("bad method or priority", p.Method(), p.Priority())
+		}
+		var headers []string
+		for i := 0; i < p.HeaderSize(); i++ {
+			header := p.HeaderAt(i)
+			headers = append(headers, header.Name()+": "+header.Value())
+		}
+		expected := []string{"Accept: application/json", "Accept: text/plain", "Content-Type: application/json", "X-Extra: 1"}
+		if len(headers) != len(expected) {
+			t.Fatal("bad headers", headers)
+		}
+		for i := range expected {
+			if headers[i] != expected[i] {
+				t.Fatal("bad headers", headers)
+			}
+		}
+	}
+}
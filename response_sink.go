@@ -0,0 +1,90 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// sinkBufferSize is the size of the native buffer responses are read into
+// when written to a sink.
+const sinkBufferSize = 64 * 1024
+
+// SinkToWriter sends |request| and writes the response body to |writer|
+// directly from the native read callback, without handing each chunk to a
+// reader goroutine as reading http.Response.Body does. It returns once the
+// body is complete, with the response, whose Body is empty, and the number of
+// bytes written. The body is written whatever the status code.
+//
+// |writer| is called on the executor of the RoundTripper and must not block
+// for long; a Throttle with a download rate blocks it to shape the
+// transfer. Validators are not used.
+func (t *RoundTripper) SinkToWriter(request *http.Request, writer io.Writer) (*http.Response, int64, error) {
+	admitted, err := t.admitRequest(request)
+	if err != nil {
+		closeRequestBody(request)
+		return nil, 0, err
+	}
+	defer admitted.scheduled.release()
+	defer admitted.throttle.release()
+	response, written, err := t.sinkToWriter(admitted.request, admitted.throttle.writer(writer))
+	admitted.circuit.finish(response, err)
+	return response, written, err
+}
+
+func (t *RoundTripper) sinkToWriter(request *http.Request, writer io.Writer) (*http.Response, int64, error) {
+	if t.Interceptor != nil {
+		response, err := t.Interceptor.RoundTrip(request)
+		if err != nil {
+			return nil, 0, err
+		}
+		written, err := io.Copy(writer, response.Body)
+		response.Body.Close()
+		response.Body = http.NoBody
+		return response, written, err
+	}
+	response, err := t.roundTrip(request, writer)
+	if err != nil {
+		return nil, 0, err
+	}
+	handler, isHandler := response.Body.(*urlResponse)
+	if !isHandler {
+		// A redirect rejected by CheckRedirect has no body to read
+		return response, 0, nil
+	}
+	select {
+	case <-handler.done:
+	case <-handler.stalled:
+	}
+	response.Body = http.NoBody
+	written := atomic.LoadInt64(&handler.sinkWritten)
+	handler.access.Lock()
+	err = handler.err
+	handler.access.Unlock()
+	if err != io.EOF {
+		return response, written, err
+	}
+	return response, written, nil
+}
+
+// SinkToFile is SinkToWriter writing to a file at |path|, which is created or
+// truncated. The file is removed if the request fails.
+func (t *RoundTripper) SinkToFile(request *http.Request, path string) (*http.Response, int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	response, written, err := t.SinkToWriter(request, file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, written, err
+	}
+	return response, written, nil
+}
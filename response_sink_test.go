@@ -0,0 +1,37 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestSinkToWriter(t *testing.T) {
+	transport := &cronet.RoundTripper{}
+	request, _ := http.NewRequest(http.MethodGet, "https://cloudflare.com/cdn-cgi/trace", nil)
+	var buffer bytes.Buffer
+	response, written, err := transport.SinkToWriter(request, &buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != 200 || written == 0 || int64(buffer.Len()) != written {
+		t.Fatal("bad sink result", response.Status, written, buffer.Len())
+	}
+
+	path := filepath.Join(t.TempDir(), "trace")
+	request, _ = http.NewRequest(http.MethodGet, "https://cloudflare.com/cdn-cgi/trace", nil)
+	_, written, err = transport.SinkToFile(request, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || int64(len(content)) != written {
+		t.Fatal("bad file", len(content), written, err)
+	}
+}
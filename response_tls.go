@@ -0,0 +1,30 @@
+package cronet
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+)
+
+type responseTLSKey struct{}
+
+// ResponseTLSState returns what is known about the TLS connection |response|
+// was received on, or nil if it was not received over TLS.
+//
+// RoundTripper leaves http.Response.TLS nil, as the C API does not report the
+// certificates code reading PeerCertificates expects; its partial state,
+// described at RoundTripper, is returned here instead. For responses of other
+// transports ResponseTLSState returns http.Response.TLS.
+func ResponseTLSState(response *http.Response) *tls.ConnectionState {
+	if response.TLS != nil || response.Request == nil {
+		return response.TLS
+	}
+	state, _ := response.Request.Context().Value(responseTLSKey{}).(*tls.ConnectionState)
+	return state
+}
+
+// withResponseTLSState returns a copy of |request| whose context carries the
+// TLS state returned by ResponseTLSState for its response.
+func withResponseTLSState(request *http.Request, state *tls.ConnectionState) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), responseTLSKey{}, state))
+}
@@ -0,0 +1,61 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// seekingBody is a request body rewound by seeking.
+type seekingBody struct {
+	*strings.Reader
+}
+
+func (b seekingBody) Close() error {
+	return nil
+}
+
+func TestRoundTripBodyNotRewindable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if request.URL.Path == "/redirect" {
+			http.Redirect(writer, request, "/target", http.StatusTemporaryRedirect)
+			return
+		}
+		writer.Write(body)
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+	transport := &cronet.RoundTripper{Engine: engine}
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/redirect", &countingCloser{Reader: strings.NewReader("payload")})
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrBodyNotRewindable) {
+		t.Fatal("expected ErrBodyNotRewindable, got", err)
+	}
+
+	// A body that can seek is rewound without GetBody
+	request, _ = http.NewRequest(http.MethodPost, server.URL+"/redirect", seekingBody{strings.NewReader("payload")})
+	request.ContentLength = int64(len("payload"))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "payload" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
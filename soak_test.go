@@ -0,0 +1,188 @@
+//go:build soak
+
+package cronet_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// TestSoak sends many requests over HTTP/1.1, HTTP/2 and optionally HTTP/3
+// while sampling the resident set size and the native handle counts, and
+// fails if either grows. Run it with
+//
+//	go test -tags soak -run TestSoak -timeout 0 .
+//
+// and configure it with the environment variables:
+//
+//	CRONET_SOAK_REQUESTS            requests to send, default 1000000
+//	CRONET_SOAK_CONCURRENCY         concurrent requests, default 64
+//	CRONET_SOAK_MAX_RSS_GROWTH_MB   allowed RSS growth after warmup, default 64
+//	CRONET_SOAK_QUIC_URL            an HTTP/3 URL to include, e.g. https://cloudflare-quic.com/
+func TestSoak(t *testing.T) {
+	requests := soakEnvInt(t, "CRONET_SOAK_REQUESTS", 1000000)
+	concurrency := soakEnvInt(t, "CRONET_SOAK_CONCURRENCY", 64)
+	maxGrowth := int64(soakEnvInt(t, "CRONET_SOAK_MAX_RSS_GROWTH_MB", 64)) << 20
+
+	payload := bytes.Repeat([]byte("cronet-go soak "), 1024)
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Body != nil {
+			io.Copy(io.Discard, request.Body)
+		}
+		writer.Write(payload)
+	})
+	http1Server := httptest.NewServer(handler)
+	defer http1Server.Close()
+	http2Server := httptest.NewUnstartedServer(handler)
+	http2Server.EnableHTTP2 = true
+	http2Server.StartTLS()
+	defer http2Server.Close()
+
+	engine := cronet.NewEngine()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: http2Server.Certificate().Raw})
+	if !engine.SetTrustedRootCertificates(string(certificate)) {
+		t.Fatal("failed to trust test certificate")
+	}
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	params.SetEnableQuic(true)
+	engine.StartWithParams(params)
+	params.Destroy()
+	transport := &cronet.RoundTripper{Engine: engine}
+
+	targets := []string{http1Server.URL + "/", http2Server.URL + "/"}
+	if quicURL := os.Getenv("CRONET_SOAK_QUIC_URL"); quicURL != "" {
+		targets = append(targets, quicURL)
+	}
+	initialHandles := cronet.CountNativeHandles()
+
+	warmup := requests / 10
+	var (
+		sent     int64
+		failed   int64
+		baseline int64
+	)
+	sampleEvery := int64(requests / 100)
+	if sampleEvery == 0 {
+		sampleEvery = 1
+	}
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				n := atomic.AddInt64(&sent, 1)
+				if n > int64(requests) {
+					return
+				}
+				if err := soakRequest(transport, targets[int(n)%len(targets)], int(n)); err != nil {
+					atomic.AddInt64(&failed, 1)
+				}
+				if n == int64(warmup) {
+					runtime.GC()
+					atomic.StoreInt64(&baseline, soakRSS())
+				}
+				if n%sampleEvery == 0 {
+					handles := cronet.CountNativeHandles()
+					t.Logf("%d requests, %d failed, RSS %d MiB, %d callbacks, %d upload providers",
+						n, atomic.LoadInt64(&failed), soakRSS()>>20, handles.URLRequestCallbacks, handles.UploadDataProviders)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	// Finished requests release their handles on the executor
+	deadline := time.Now().Add(10 * time.Second)
+	for cronet.CountNativeHandles() != initialHandles && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if handles := cronet.CountNativeHandles(); handles != initialHandles {
+		t.Errorf("native handles leaked: %+v, started with %+v", handles, initialHandles)
+	}
+	runtime.GC()
+	if final := soakRSS(); baseline > 0 && final > 0 && final-baseline > maxGrowth {
+		t.Errorf("RSS grew from %d MiB to %d MiB", baseline>>20, final>>20)
+	}
+	if failed > int64(requests)/100 {
+		t.Errorf("%d of %d requests failed", failed, requests)
+	}
+}
+
+// soakRequest sends a request of a kind selected by |n|: GET read to the
+// end, POST with a body, GET closed before the body is read, or GET canceled
+// by its context.
+func soakRequest(transport http.RoundTripper, target string, n int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var request *http.Request
+	switch n % 4 {
+	case 1:
+		request, _ = http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(strconv.Itoa(n)))
+	case 3:
+		var cancelEarly context.CancelFunc
+		ctx, cancelEarly = context.WithTimeout(ctx, time.Millisecond)
+		defer cancelEarly()
+		request, _ = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	default:
+		request, _ = http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	}
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		if n%4 == 3 {
+			return nil
+		}
+		return err
+	}
+	defer response.Body.Close()
+	if n%4 == 2 {
+		return nil
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	if n%4 == 3 {
+		return nil
+	}
+	return err
+}
+
+// soakRSS returns the resident set size of the process in bytes, or zero
+// where it is not available.
+func soakRSS() int64 {
+	content, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, _ := strconv.ParseInt(fields[1], 10, 64)
+	return pages * int64(os.Getpagesize())
+}
+
+func soakEnvInt(t *testing.T, name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		t.Fatalf("invalid %s: %q", name, value)
+	}
+	return n
+}
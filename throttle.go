@@ -0,0 +1,401 @@
+package cronet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is wrapped by the errors of requests that waited longer
+// than Throttle.QueueTimeout for a concurrency limit.
+var ErrQueueTimeout = errors.New("cronet: timed out waiting for a throttle slot")
+
+// Throttle limits the number of concurrent requests and the bandwidth of the
+// RoundTrippers sharing it, e.g. all RoundTrippers of an engine, so crawlers
+// and proxies can keep to politeness and fair-share limits. Bandwidth is
+// shaped with token buckets as the request body is read and the response
+// body is consumed; the network stack then slows the transfer through flow
+// control once its buffers are full. RequestOptions limit single requests
+// further.
+//
+// The C API does not configure the connection pools of the network stack,
+// which keep up to 6 connections per origin and 256 in total. Limiting the
+// requests in flight bounds the HTTP/1 connections and the HTTP/2 and HTTP/3
+// streams used at once.
+//
+// The fields must not be changed once the Throttle is in use. A Throttle is
+// safe for concurrent use.
+type Throttle struct {
+	// MaxConcurrentRequests is the number of requests in flight at once,
+	// zero for any. Further requests wait for one to finish or for their
+	// context to be done. A request is in flight until its response body is
+	// read to the end or closed.
+	MaxConcurrentRequests int
+	// MaxConcurrentRequestsPerOrigin is the number of requests in flight at
+	// once to one origin, its scheme, host and port, zero for any. Requests
+	// wait for their origin before they wait for MaxConcurrentRequests, so
+	// requests to a busy origin do not hold up others.
+	MaxConcurrentRequestsPerOrigin int
+	// QueueTimeout, if set, fails requests that waited this long for the
+	// concurrency limits with an error wrapping ErrQueueTimeout.
+	QueueTimeout time.Duration
+	// UploadBytesPerSecond and DownloadBytesPerSecond are the rates of request
+	// and response body bytes shared by all requests, zero for unlimited.
+	UploadBytesPerSecond   int64
+	DownloadBytesPerSecond int64
+	// Burst is the number of bytes that can be transferred at once at full
+	// speed after an idle period. Zero means the bytes of one second.
+	Burst int64
+
+	initOnce sync.Once
+	slots    chan struct{}
+	upload   *tokenBucket
+	download *tokenBucket
+
+	originAccess sync.Mutex
+	origins      map[string]*originSlots
+}
+
+// originSlots are the slots of an origin, removed once no request holds or
+// waits for one.
+type originSlots struct {
+	slots chan struct{}
+	users int
+}
+
+func (t *Throttle) init() {
+	t.initOnce.Do(func() {
+		if t.MaxConcurrentRequests > 0 {
+			t.slots = make(chan struct{}, t.MaxConcurrentRequests)
+		}
+		t.upload = newTokenBucket(t.UploadBytesPerSecond, t.Burst)
+		t.download = newTokenBucket(t.DownloadBytesPerSecond, t.Burst)
+	})
+}
+
+// Active returns the number of requests in flight.
+func (t *Throttle) Active() int {
+	t.init()
+	return len(t.slots)
+}
+
+// ActiveForOrigin returns the number of requests in flight to |origin|, e.g.
+// "https://example.com:443", counted with MaxConcurrentRequestsPerOrigin.
+func (t *Throttle) ActiveForOrigin(origin string) int {
+	t.originAccess.Lock()
+	defer t.originAccess.Unlock()
+	if origin := t.origins[strings.ToLower(origin)]; origin != nil {
+		return len(origin.slots)
+	}
+	return 0
+}
+
+// acquireOrigin returns the slots of |origin| for a request to use.
+func (t *Throttle) acquireOrigin(origin string) *originSlots {
+	t.originAccess.Lock()
+	defer t.originAccess.Unlock()
+	slots := t.origins[origin]
+	if slots == nil {
+		if t.origins == nil {
+			t.origins = make(map[string]*originSlots)
+		}
+		slots = &originSlots{slots: make(chan struct{}, t.MaxConcurrentRequestsPerOrigin)}
+		t.origins[origin] = slots
+	}
+	slots.users++
+	return slots
+}
+
+// releaseOrigin gives up the use of the slots of |origin|.
+func (t *Throttle) releaseOrigin(origin string, slots *originSlots) {
+	t.originAccess.Lock()
+	defer t.originAccess.Unlock()
+	slots.users--
+	if slots.users == 0 {
+		delete(t.origins, origin)
+	}
+}
+
+// throttleOrigin returns the origin of |requestURL| with its port, as
+// counted by Throttle.MaxConcurrentRequestsPerOrigin.
+func throttleOrigin(requestURL *url.URL) string {
+	scheme := strings.ToLower(requestURL.Scheme)
+	host := strings.ToLower(requestURL.Host)
+	if requestURL.Port() == "" {
+		switch scheme {
+		case "https", "wss":
+			host += ":443"
+		case "http", "ws":
+			host += ":80"
+		}
+	}
+	return scheme + "://" + host
+}
+
+// tokenBucket is a token bucket of bytes. Takes may exceed the available
+// tokens, later takes then wait for the debt to be paid off, so concurrent
+// takers are served in order.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	access sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket of |rate| bytes per second holding up to
+// |burst| bytes, or nil if |rate| is not positive.
+func newTokenBucket(rate int64, burst int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take takes |n| tokens, waiting until the bucket has paid them off or
+// |ctx| is done.
+func (b *tokenBucket) take(ctx context.Context, n int) error {
+	b.access.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.access.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Nothing is transferred, so the bytes are not charged to later takers
+		b.access.Lock()
+		b.tokens += float64(n)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.access.Unlock()
+		return ctx.Err()
+	}
+}
+
+// maxTake returns the most bytes to transfer at once within the burst of
+// |buckets|, at least one.
+func maxTake(buckets []*tokenBucket, n int) int {
+	for _, bucket := range buckets {
+		if burst := int(bucket.burst); burst < n {
+			n = burst
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func takeAll(ctx context.Context, buckets []*tokenBucket, n int) error {
+	for _, bucket := range buckets {
+		if err := bucket.take(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestThrottle throttles one request by a Throttle and the rates of its
+// RequestOptions. Its methods do nothing on a nil requestThrottle, which is
+// what startThrottle returns for requests without limits.
+type requestThrottle struct {
+	ctx         context.Context
+	upload      []*tokenBucket
+	download    []*tokenBucket
+	releaseOnce sync.Once
+	slots       chan struct{}
+	throttle    *Throttle
+	origin      string
+	originSlots *originSlots
+}
+
+// startThrottle waits for |request| to be allowed in flight by |throttle|,
+// which may be nil, and returns its throttling.
+func startThrottle(throttle *Throttle, request *http.Request) (*requestThrottle, error) {
+	options, _ := RequestOptionsFromContext(request.Context())
+	r := &requestThrottle{ctx: request.Context(), throttle: throttle}
+	if throttle != nil {
+		throttle.init()
+		var timeout <-chan time.Time
+		if throttle.QueueTimeout > 0 && (throttle.slots != nil || throttle.MaxConcurrentRequestsPerOrigin > 0) {
+			timer := time.NewTimer(throttle.QueueTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		if throttle.MaxConcurrentRequestsPerOrigin > 0 {
+			r.origin = throttleOrigin(request.URL)
+			origin := throttle.acquireOrigin(r.origin)
+			select {
+			case origin.slots <- struct{}{}:
+				r.originSlots = origin
+			case <-request.Context().Done():
+				throttle.releaseOrigin(r.origin, origin)
+				return nil, request.Context().Err()
+			case <-timeout:
+				throttle.releaseOrigin(r.origin, origin)
+				return nil, fmt.Errorf("%w: %s for %s", ErrQueueTimeout, r.origin, throttle.QueueTimeout)
+			}
+		}
+		if throttle.slots != nil {
+			select {
+			case throttle.slots <- struct{}{}:
+				r.slots = throttle.slots
+			case <-request.Context().Done():
+				r.release()
+				return nil, request.Context().Err()
+			case <-timeout:
+				r.release()
+				return nil, fmt.Errorf("%w: %s", ErrQueueTimeout, throttle.QueueTimeout)
+			}
+		}
+		if throttle.upload != nil {
+			r.upload = append(r.upload, throttle.upload)
+		}
+		if throttle.download != nil {
+			r.download = append(r.download, throttle.download)
+		}
+	}
+	if bucket := newTokenBucket(options.UploadBytesPerSecond, 0); bucket != nil {
+		r.upload = append(r.upload, bucket)
+	}
+	if bucket := newTokenBucket(options.DownloadBytesPerSecond, 0); bucket != nil {
+		r.download = append(r.download, bucket)
+	}
+	if r.slots == nil && r.originSlots == nil && len(r.upload) == 0 && len(r.download) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// release lets the next request waiting for the throttle in flight.
+func (r *requestThrottle) release() {
+	if r == nil {
+		return
+	}
+	r.releaseOnce.Do(func() {
+		if r.slots != nil {
+			<-r.slots
+		}
+		if r.originSlots != nil {
+			<-r.originSlots.slots
+			r.throttle.releaseOrigin(r.origin, r.originSlots)
+		}
+	})
+}
+
+// request returns |request| with its body throttled.
+func (r *requestThrottle) request(request *http.Request) *http.Request {
+	if r == nil || len(r.upload) == 0 || request.Body == nil || request.Body == http.NoBody {
+		return request
+	}
+	throttled := request.Clone(request.Context())
+	throttled.Body = &throttledReader{ReadCloser: request.Body, ctx: r.ctx, buckets: r.upload}
+	if request.GetBody != nil {
+		throttled.GetBody = func() (io.ReadCloser, error) {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return &throttledReader{ReadCloser: body, ctx: r.ctx, buckets: r.upload}, nil
+		}
+	}
+	return throttled
+}
+
+// response throttles the body of |response| and releases the throttle once
+// it is consumed, or at once if the request failed.
+func (r *requestThrottle) response(response *http.Response, err error) (*http.Response, error) {
+	if r == nil {
+		return response, err
+	}
+	if err != nil || response.Body == nil || response.Body == http.NoBody {
+		r.release()
+		return response, err
+	}
+	response.Body = &throttledReader{ReadCloser: response.Body, ctx: r.ctx, buckets: r.download, throttle: r}
+	return response, nil
+}
+
+// writer returns |writer| throttled as response bodies are.
+func (r *requestThrottle) writer(writer io.Writer) io.Writer {
+	if r == nil || len(r.download) == 0 {
+		return writer
+	}
+	return &throttledWriter{writer, r.ctx, r.download}
+}
+
+// throttledReader reads at the rate of its buckets and releases its throttle,
+// if any, at the end of the body.
+type throttledReader struct {
+	io.ReadCloser
+	ctx      context.Context
+	buckets  []*tokenBucket
+	throttle *requestThrottle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(r.buckets) > 0 && len(p) > 0 {
+		p = p[:maxTake(r.buckets, len(p))]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := takeAll(r.ctx, r.buckets, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	if err != nil {
+		r.throttle.release()
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	r.throttle.release()
+	return r.ReadCloser.Close()
+}
+
+type throttledWriter struct {
+	writer  io.Writer
+	ctx     context.Context
+	buckets []*tokenBucket
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:maxTake(w.buckets, len(p))]
+		if err := takeAll(w.ctx, w.buckets, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
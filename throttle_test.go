@@ -0,0 +1,168 @@
+package cronet_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
+)
+
+func TestThrottleConcurrency(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "body")
+	throttle := &cronet.Throttle{MaxConcurrentRequests: 1}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, Throttle: throttle}
+
+	first, err := transport.RoundTrip(newRequest(t, context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Active() != 1 {
+		t.Fatal("expected one request in flight, got", throttle.Active())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := transport.RoundTrip(newRequest(t, ctx)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the second request to wait, got", err)
+	}
+
+	// Reading the body to the end releases the slot
+	io.ReadAll(first.Body)
+	if throttle.Active() != 0 {
+		t.Fatal("expected no request in flight, got", throttle.Active())
+	}
+	second, err := transport.RoundTrip(newRequest(t, context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+	first.Body.Close()
+	if throttle.Active() != 0 {
+		t.Fatal("expected no request in flight, got", throttle.Active())
+	}
+}
+
+func TestThrottlePerOrigin(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.OnMatch(func(request *http.Request) bool { return true }).RespondString(http.StatusOK, "body")
+	throttle := &cronet.Throttle{MaxConcurrentRequestsPerOrigin: 1, QueueTimeout: 50 * time.Millisecond}
+	transport := &cronet.RoundTripper{Interceptor: interceptor, Throttle: throttle}
+	get := func(url string) (*http.Response, error) {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transport.RoundTrip(request)
+	}
+
+	first, err := get("https://example.com/first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active := throttle.ActiveForOrigin("https://EXAMPLE.com:443"); active != 1 {
+		t.Fatal("expected one request in flight to the origin, got", active)
+	}
+	if _, err := get("https://example.com:443/second"); !errors.Is(err, cronet.ErrQueueTimeout) {
+		t.Fatal("expected the second request to the origin to time out, got", err)
+	}
+	other, err := get("http://example.com/")
+	if err != nil {
+		t.Fatal("request to another origin held up:", err)
+	}
+	other.Body.Close()
+
+	first.Body.Close()
+	if active := throttle.ActiveForOrigin("https://example.com:443"); active != 0 {
+		t.Fatal("expected no request in flight to the origin, got", active)
+	}
+	second, err := get("https://example.com/second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Body.Close()
+}
+
+func TestThrottleBandwidth(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 40000)
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").Respond(http.StatusOK, nil, body)
+	interceptor.On(http.MethodPost, "https://example.com/").RespondString(http.StatusOK, "")
+	transport := &cronet.RoundTripper{
+		Interceptor: interceptor,
+		Throttle:    &cronet.Throttle{UploadBytesPerSecond: 20000},
+	}
+
+	// The first 20000 bytes are the burst, the rest takes a second
+	start := time.Now()
+	request, _ := http.NewRequest(http.MethodPost, "https://example.com/", bytes.NewReader(body))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Error("upload not throttled, took", elapsed)
+	}
+
+	start = time.Now()
+	ctx := cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{DownloadBytesPerSecond: 20000})
+	response, err = transport.RoundTrip(newRequest(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if !bytes.Equal(received, body) {
+		t.Fatal("unexpected body of", len(received), "bytes")
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Error("download not throttled, took", elapsed)
+	}
+}
+
+func TestThrottleCanceledTransfer(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodPost, "https://example.com/").RespondString(http.StatusOK, "")
+	transport := &cronet.RoundTripper{
+		Interceptor: interceptor,
+		Throttle:    &cronet.Throttle{UploadBytesPerSecond: 20000},
+	}
+	post := func(ctx context.Context, size int) error {
+		request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://example.com/", bytes.NewReader(make([]byte, size)))
+		response, err := transport.RoundTrip(request)
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+
+	// The upload is canceled while it waits for the second 20000 bytes
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := post(ctx, 40000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected the upload to be canceled, got", err)
+	}
+
+	// The bytes it did not send are not charged to the next upload
+	start := time.Now()
+	if err := post(context.Background(), 1000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Error("upload waited for a canceled one, took", elapsed)
+	}
+}
+
+func newRequest(t *testing.T, ctx context.Context) *http.Request {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
@@ -0,0 +1,200 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseTLSState returns the TLS state known from the C API for a response
+// to an https URL. Only fields backed by data are set: HandshakeComplete unless
+// the response came from the cache, ServerName unless the host is an IP
+// address (no SNI is sent then), NegotiatedProtocol, and Version for HTTP/3.
+// The cipher suite and certificates are only logged to NetLog, see
+// ReadTLSSessions.
+func responseTLSState(requestURL string, info URLResponseInfo) *tls.ConnectionState {
+	parsedURL, err := url.Parse(requestURL)
+	if err != nil || parsedURL.Scheme != "https" {
+		return nil
+	}
+	state := &tls.ConnectionState{}
+	if net.ParseIP(parsedURL.Hostname()) == nil {
+		state.ServerName = parsedURL.Hostname()
+	}
+	if info.Cached() {
+		return state
+	}
+	state.HandshakeComplete = true
+	state.NegotiatedProtocol = alpnFromNegotiatedProtocol(info.NegotiatedProtocol())
+	if state.NegotiatedProtocol == string(ProtocolHTTP3) {
+		// QUIC always uses TLS 1.3
+		state.Version = tls.VersionTLS13
+	}
+	return state
+}
+
+func alpnFromNegotiatedProtocol(negotiated string) string {
+	protocol := normalizeProtocol(negotiated)
+	if protocol == ProtocolHTTP11 && negotiated != string(ProtocolHTTP11) {
+		// HTTP/1 without ALPN
+		return ""
+	}
+	return string(protocol)
+}
+
+// TLSSession is a TLS handshake recorded in a NetLog file.
+type TLSSession struct {
+	// SourceID is the NetLog source id of the socket.
+	SourceID int64
+	Time     time.Time
+	// RemoteAddress is the address the socket connected to, if logged.
+	RemoteAddress      string
+	Version            uint16
+	CipherSuite        uint16
+	NegotiatedProtocol string
+	DidResume          bool
+	PeerCertificates   []*x509.Certificate
+	// SignedCertificateTimestamps reports whether the server provided SCTs,
+	// embedded in the certificate, stapled in OCSP or in the TLS extension.
+	SignedCertificateTimestamps bool
+}
+
+// ConnectionState converts the session to a tls.ConnectionState.
+func (s TLSSession) ConnectionState() tls.ConnectionState {
+	state := tls.ConnectionState{
+		Version:            s.Version,
+		HandshakeComplete:  true,
+		DidResume:          s.DidResume,
+		CipherSuite:        s.CipherSuite,
+		NegotiatedProtocol: s.NegotiatedProtocol,
+		PeerCertificates:   s.PeerCertificates,
+	}
+	if len(s.PeerCertificates) > 0 {
+		leaf := s.PeerCertificates[0]
+		if len(leaf.DNSNames) > 0 {
+			state.ServerName = leaf.DNSNames[0]
+		}
+	}
+	return state
+}
+
+// ReadTLSSessions returns the TCP TLS handshakes in the NetLog file at |path|,
+// in the order they completed. Match a response to its session with
+// VerifyHostname on the leaf certificate or with the remote address.
+//
+// QUIC handshakes are not included: they always use TLS 1.3, and their
+// certificates are not logged.
+func ReadTLSSessions(path string) ([]TLSSession, error) {
+	sessions := make(map[int64]*TLSSession)
+	sessionOf := func(sourceID int64) *TLSSession {
+		session := sessions[sourceID]
+		if session == nil {
+			session = &TLSSession{SourceID: sourceID}
+			sessions[sourceID] = session
+		}
+		return session
+	}
+	var completed []TLSSession
+	err := ReadNetLog(path, func(event NetLogEvent) error {
+		switch event.Type {
+		case "TCP_CONNECT_ATTEMPT":
+			if event.Phase == NetLogPhaseBegin {
+				var params struct {
+					Address string `json:"address"`
+				}
+				json.Unmarshal(event.Params, &params)
+				sessionOf(event.SourceID).RemoteAddress = params.Address
+			}
+		case "SSL_CERTIFICATES_RECEIVED":
+			var params struct {
+				Certificates []string `json:"certificates"`
+			}
+			json.Unmarshal(event.Params, &params)
+			sessionOf(event.SourceID).PeerCertificates = parsePEMCertificates(params.Certificates)
+		case "SIGNED_CERTIFICATE_TIMESTAMPS_RECEIVED":
+			var params map[string]json.RawMessage
+			json.Unmarshal(event.Params, &params)
+			for _, value := range params {
+				if string(value) != `""` && string(value) != "null" {
+					sessionOf(event.SourceID).SignedCertificateTimestamps = true
+				}
+			}
+		case "SSL_CONNECT":
+			if event.Phase != NetLogPhaseEnd {
+				return nil
+			}
+			var params struct {
+				Version     json.RawMessage `json:"version"`
+				CipherSuite uint16          `json:"cipher_suite"`
+				IsResumed   bool            `json:"is_resumed"`
+				NextProto   string          `json:"next_proto"`
+				NetError    int             `json:"net_error"`
+			}
+			json.Unmarshal(event.Params, &params)
+			if params.NetError != 0 {
+				delete(sessions, event.SourceID)
+				return nil
+			}
+			session := sessionOf(event.SourceID)
+			session.Time = event.Time
+			session.Version = parseNetLogTLSVersion(params.Version)
+			session.CipherSuite = params.CipherSuite
+			session.DidResume = params.IsResumed
+			session.NegotiatedProtocol = alpnFromNegotiatedProtocol(params.NextProto)
+			completed = append(completed, *session)
+			delete(sessions, event.SourceID)
+		}
+		return nil
+	})
+	return completed, err
+}
+
+func parsePEMCertificates(certificates []string) []*x509.Certificate {
+	var parsed []*x509.Certificate
+	for _, certificate := range certificates {
+		block, _ := pem.Decode([]byte(certificate))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, cert)
+	}
+	return parsed
+}
+
+// parseNetLogTLSVersion accepts the version as logged by the native stack,
+// either a name such as "TLS 1.3" or the numeric protocol version.
+func parseNetLogTLSVersion(raw json.RawMessage) uint16 {
+	var number uint16
+	if json.Unmarshal(raw, &number) == nil {
+		return number
+	}
+	var name string
+	json.Unmarshal(raw, &name)
+	name = strings.NewReplacer("TLSv", "", "TLS", "", " ", "").Replace(name)
+	switch name {
+	case "1.0", "1":
+		return tls.VersionTLS10
+	case "1.1":
+		return tls.VersionTLS11
+	case "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	}
+	if value, err := strconv.ParseUint(name, 0, 16); err == nil {
+		return uint16(value)
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestReadTLSSessions(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	certificate, _ := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	var events []string
+	sslConnect := func(source int, params string) {
+		events = append(events, fmt.Sprintf(`{"type":3,"phase":2,"time":"%d","source":{"id":%d,"type":1},"params":%s}`, 10+len(events), source, params))
+	}
+	events = append(events,
+		`{"type":1,"phase":1,"time":"1","source":{"id":1,"type":1},"params":{"address":"127.0.0.1:443"}}`,
+		`{"type":2,"phase":0,"time":"2","source":{"id":1,"type":1},"params":{"certificates":[`+string(certificate)+`,"not pem"]}}`,
+		`{"type":4,"phase":0,"time":"3","source":{"id":1,"type":1},"params":{"embedded_scts":"","tls_extension_scts":"AAEC"}}`,
+		`{"type":3,"phase":1,"time":"4","source":{"id":1,"type":1},"params":{}}`,
+	)
+	sslConnect(1, `{"version":"TLS 1.3","cipher_suite":4865,"next_proto":"h2","is_resumed":true}`)
+	sslConnect(2, `{"version":771,"cipher_suite":49199,"next_proto":"http/1.1"}`)
+	sslConnect(3, `{"version":"TLSv1.1","next_proto":"unknown"}`)
+	sslConnect(4, `{"version":"0x0304"}`)
+	sslConnect(5, `{"version":"TLS 1.3","net_error":-200}`)
+	sslConnect(6, `{"version":"SSL 3.0"}`)
+
+	path := filepath.Join(t.TempDir(), "netlog.json")
+	err := os.WriteFile(path, []byte(`{"constants":{"logEventTypes":{"TCP_CONNECT_ATTEMPT":1,"SSL_CERTIFICATES_RECEIVED":2,"SSL_CONNECT":3,"SIGNED_CERTIFICATE_TIMESTAMPS_RECEIVED":4},`+
+		`"logSourceType":{"SOCKET":1},"timeTickOffset":"1700000000000"},"events":[`+strings.Join(events, ",")+`]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := cronet.ReadTLSSessions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failed handshake of source 5 is left out
+	if len(sessions) != 5 {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	session := sessions[0]
+	if session.SourceID != 1 || session.RemoteAddress != "127.0.0.1:443" || session.Time.UnixMilli() != 1700000000014 {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if session.Version != tls.VersionTLS13 || session.CipherSuite != tls.TLS_AES_128_GCM_SHA256 || session.NegotiatedProtocol != "h2" || !session.DidResume || !session.SignedCertificateTimestamps {
+		t.Errorf("unexpected handshake %+v", session)
+	}
+	if len(session.PeerCertificates) != 1 || !session.PeerCertificates[0].Equal(server.Certificate()) {
+		t.Fatal("expected the parsable certificate, got", len(session.PeerCertificates))
+	}
+	state := session.ConnectionState()
+	if !state.HandshakeComplete || state.Version != tls.VersionTLS13 || state.ServerName != server.Certificate().DNSNames[0] {
+		t.Errorf("unexpected connection state %+v", state)
+	}
+
+	// The version is logged either as a name or as a number
+	for i, want := range []uint16{tls.VersionTLS12, tls.VersionTLS11, tls.VersionTLS13, 0} {
+		if version := sessions[i+1].Version; version != want {
+			t.Errorf("source %d: unexpected version %#x, want %#x", sessions[i+1].SourceID, version, want)
+		}
+	}
+	if sessions[1].NegotiatedProtocol != "http/1.1" || sessions[2].NegotiatedProtocol != "" || sessions[1].PeerCertificates != nil || sessions[1].SignedCertificateTimestamps {
+		t.Errorf("unexpected session %+v", sessions[1])
+	}
+}
+
+func TestResponseTLSState(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	engine := cronet.NewEngine()
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if !engine.SetTrustedRootCertificates(string(certificate)) {
+		t.Fatal("failed to trust test certificate")
+	}
+	params := cronet.NewEngineParams()
+	params.SetEnableHTTP2(true)
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer func() {
+		engine.Shutdown()
+		engine.Destroy()
+	}()
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	response, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	// Without certificates the state is only available from ResponseTLSState
+	if response.TLS != nil {
+		t.Fatalf("unexpected Response.TLS %+v", response.TLS)
+	}
+	state := cronet.ResponseTLSState(response)
+	if state == nil || !state.HandshakeComplete || state.NegotiatedProtocol != "h2" || state.ServerName != "" {
+		t.Fatalf("unexpected TLS state %+v", state)
+	}
+
+	// Responses of other transports keep their own state
+	response, err = server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if state := cronet.ResponseTLSState(response); state != response.TLS || len(state.PeerCertificates) == 0 {
+		t.Fatalf("unexpected TLS state %+v", state)
+	}
+}
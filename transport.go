@@ -1,22 +1,140 @@
+//go:build !cronet_nolib
+
 package cronet
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // RoundTripper is a wrapper from URLRequest to http.RoundTripper
+//
+// RoundTrip returns as soon as the network stack received the response
+// headers, as OnResponseStarted of URLRequestCallbackHandler does, and the
+// body is read from the network stack as the caller reads it, without
+// buffering ahead. GotFirstResponseByte of an httptrace.ClientTrace in the
+// request context is called when the headers of the first response,
+// including a redirect, arrived; the network stack does not report the
+// first byte itself.
+//
+// http.Request.Host overrides the Host header (:authority for HTTP/2 and HTTP/3)
+// without changing the TLS server name; see RequestOptions.ServerName for the reverse.
+// Redirects to another origin are then returned instead of followed, so that
+// http.Client follows them without the Host header.
+//
+// http.Response.TLS is nil, as the C API does not report the TLS version
+// except for HTTP/3, the cipher suite or the certificates. ResponseTLSState
+// returns the partial state that is known, with Version, CipherSuite,
+// PeerCertificates and VerifiedChains usually zero. Do not use it to check
+// certificates; read them with ReadTLSSessions.
+//
+// An "Expect: 100-continue" header is sent as is. The network stack skips
+// the interim response without a callback, so the body can not wait for it:
+// it is held back for ExpectContinueTimeout after the headers, then sent
+// whatever the server answered. Servers rejecting the request early still
+// answer after the body was sent. See Capabilities.ExpectContinue.
 type RoundTripper struct {
 	CheckRedirect func(newLocationUrl string) bool
 	Engine        Engine
 	Executor      Executor
 
+	// Validators enables conditional GET requests when set. Responses with an
+	// ETag or Last-Modified header are stored, later requests for the same URL
+	// carry If-None-Match/If-Modified-Since, and a 304 Not Modified is returned
+	// as the stored response. Intended for engines with the HTTP cache disabled.
+	Validators ValidatorStore
+	// ValidatorMaxBodySize is the largest body stored in Validators.
+	// Zero means 1 MiB.
+	ValidatorMaxBodySize int64
+
+	// Progress receives the progress of every request when set.
+	Progress *ProgressMonitor
+
+	// UserAgent is sent by requests without a User-Agent header. If both are
+	// empty, the engine User-Agent set with EngineParams.SetUserAgent is used.
+	//
+	// The engine User-Agent is also the one proxies see in CONNECT requests:
+	// tunnels are shared between requests, so neither this field nor the
+	// User-Agent header of a request reach the proxy.
+	UserAgent string
+	// AppendVersionToken appends a "cronet-go Cronet/<version>" token to the
+	// User-Agent header of a request or to UserAgent. The engine User-Agent is
+	// sent unchanged, except for the engine the RoundTripper creates when
+	// Engine is unset, which includes the token.
+	AppendVersionToken bool
+
+	// AcceptLanguage is sent by requests without an Accept-Language header, in
+	// place of the engine default set with EngineParams.SetAcceptLanguage.
+	// The engine the RoundTripper creates when Engine is unset uses it as its
+	// default.
+	AcceptLanguage string
+
+	// RequestIDHeader, if set, is the name of a header carrying the request ID
+	// of every request, e.g. "X-Request-Id", so the ID shows up in server logs
+	// and the NetLog. See ReadNetLogRequestIDs.
+	RequestIDHeader string
+
+	// IDNPolicy validates the host of every request before it is created.
+	// Requests to rejected hosts fail with an error wrapping ErrInvalidHostname.
+	IDNPolicy IDNPolicy
+
+	// StallTimeout, if set, cancels requests that got no callback from the
+	// network stack for this long while waiting for response headers or body
+	// data, failing them with a *StalledError. Time the application takes to
+	// produce the request body or to read the response is not counted.
+	StallTimeout time.Duration
+
+	// ExpectContinueTimeout, if set, is how long requests with an
+	// "Expect: 100-continue" header hold back their body before sending it.
+	// The hold ends early if the request is done or canceled. Zero sends the
+	// body right after the headers. Wait100Continue of an
+	// httptrace.ClientTrace in the request context is called when the hold
+	// starts; Got100Continue is never called.
+	ExpectContinueTimeout time.Duration
+
+	// Interceptor, if set, answers every request in place of the engine,
+	// which is then neither started nor used, e.g. with the canned responses
+	// of package cronettest in tests. Validators still apply.
+	Interceptor http.RoundTripper
+
+	// Throttle, if set, limits the concurrent requests and the bandwidth of
+	// the RoundTripper, shared with the other RoundTrippers using it.
+	Throttle *Throttle
+
+	// Scheduler, if set, shares the requests in flight between tenants,
+	// shared with the other RoundTrippers using it.
+	Scheduler *FairScheduler
+
+	// CircuitBreaker, if set, fails requests to hosts that keep failing with
+	// an error wrapping ErrCircuitOpen.
+	CircuitBreaker *CircuitBreaker
+
+	// RequestPolicy, if set, denies requests and redirects to URLs it does
+	// not allow with an error wrapping ErrRequestDenied, in addition to the
+	// policy of the engine set with EngineParams.SetRequestPolicy.
+	RequestPolicy *RequestPolicy
+
+	// MaxResponseHeaderBytes and MaxResponseHeaders, if positive, limit the
+	// size and number of the headers of every response and redirect,
+	// failing requests beyond them with an error wrapping
+	// ErrHeadersTooLarge. The size counts the name and value of each header
+	// plus four bytes. The headers are checked once the network stack
+	// received them all, within its own limit of 256 KiB for HTTP/1.
+	MaxResponseHeaderBytes int64
+	MaxResponseHeaders     int
+
 	closeEngine   bool
 	closeExecutor bool
 }
@@ -32,14 +150,46 @@ func (t *RoundTripper) close() {
 }
 
 func (t *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	admitted, err := t.admitRequest(request)
+	if err != nil {
+		closeRequestBody(request)
+		return nil, err
+	}
+	var response *http.Response
+	if t.Validators != nil {
+		response, err = t.roundTripConditional(admitted.request)
+	} else {
+		response, err = t.roundTrip(admitted.request, nil)
+	}
+	return admitted.finish(response, err)
+}
+
+// requestPolicies returns the request policies of the RoundTripper and its
+// engine.
+func (t *RoundTripper) requestPolicies() []*RequestPolicy {
+	return []*RequestPolicy{t.RequestPolicy, t.Engine.RequestPolicy()}
+}
+
+// roundTrip sends |request| admitted by admitRequest. With a |sink|, the
+// response body is written to it from the read callbacks instead of being
+// read through the response.
+func (t *RoundTripper) roundTrip(request *http.Request, sink io.Writer) (*http.Response, error) {
+	if t.Interceptor != nil {
+		return t.Interceptor.RoundTrip(request)
+	}
 	var emptyEngine Engine
 	if t.Engine == emptyEngine {
+		t.Engine = NewEngine()
+		engineUserAgent := t.UserAgent
+		if engineUserAgent == "" {
+			engineUserAgent = defaultUserAgent
+		}
 		engineParams := NewEngineParams()
 		engineParams.SetEnableHTTP2(true)
 		engineParams.SetEnableQuic(true)
 		engineParams.SetEnableBrotli(true)
-		engineParams.SetUserAgent("Go-http-client/1.1")
-		t.Engine = NewEngine()
+		engineParams.SetUserAgent(t.requestUserAgent(engineUserAgent))
+		engineParams.SetAcceptLanguage(t.AcceptLanguage)
 		t.Engine.StartWithParams(engineParams)
 		engineParams.Destroy()
 		t.closeEngine = true
@@ -59,28 +209,68 @@ func (t *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		}
 	}
 
+	request, requestID := requestWithID(request)
 	requestParams := NewURLRequestParams()
+	requestParams.addRequestIDAnnotation(requestID)
 	if request.Method == "" {
 		requestParams.SetMethod("GET")
 	} else {
 		requestParams.SetMethod(request.Method)
 	}
+	options, _ := RequestOptionsFromContext(request.Context())
+	requestURL, hostHeader := requestTarget(request, options)
+	policies := t.requestPolicies()
+	userAgent := t.requestUserAgent(request.Header.Get("User-Agent"))
+	var headers packedHeaders
 	for key, values := range request.Header {
+		if hostHeader != "" && http.CanonicalHeaderKey(key) == "Host" {
+			continue
+		}
+		if userAgent != "" && http.CanonicalHeaderKey(key) == "User-Agent" {
+			continue
+		}
+		if len(values) == 0 {
+			// Present without values, as net/http suppresses its User-Agent
+			requestParams.RemoveDefaultHeader(key)
+			continue
+		}
 		for _, value := range values {
-			header := NewHTTPHeader()
-			header.SetName(key)
-			header.SetValue(value)
-			requestParams.AddHeader(header)
-			header.Destroy()
+			headers.add(key, value)
 		}
 	}
-	if request.Body != nil {
-		uploadProvider := NewUploadDataProvider(&bodyUploadProvider{request.Body, request.GetBody, request.ContentLength})
-		requestParams.SetUploadDataProvider(uploadProvider)
-		requestParams.SetUploadDataExecutor(t.Executor)
+	if hostHeader != "" {
+		headers.add("Host", hostHeader)
+	}
+	if userAgent != "" {
+		headers.add("User-Agent", userAgent)
+	}
+	if t.AcceptLanguage != "" {
+		if _, present := request.Header["Accept-Language"]; !present {
+			headers.add("Accept-Language", t.AcceptLanguage)
+		}
+	}
+	if t.RequestIDHeader != "" && request.Header.Get(t.RequestIDHeader) == "" {
+		headers.add(t.RequestIDHeader, requestID.String())
+	}
+	requestParams.addPackedHeaders(&headers)
+	var progress *requestProgress
+	if t.Progress != nil {
+		progress = t.Progress.start(request, requestID)
 	}
 	responseHandler := urlResponse{
-		checkRedirect: t.CheckRedirect,
+		checkRedirect:  t.CheckRedirect,
+		hostOverride:   hostHeader != "",
+		protocols:      options.Protocols,
+		policies:       policies,
+		maxHeaderBytes: t.MaxResponseHeaderBytes,
+		maxHeaders:     t.MaxResponseHeaders,
+		monitor:        t.Progress,
+		progress:       progress,
+		sink:           sink,
+		requestID:      requestID,
+		trace:          httptrace.ContextClientTrace(request.Context()),
+		stallTimeout:   t.StallTimeout,
+		started:        time.Now(),
 		response: http.Response{
 			Request:    request,
 			Proto:      request.Proto,
@@ -88,31 +278,99 @@ func (t *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 			ProtoMinor: request.ProtoMinor,
 			Header:     make(http.Header),
 		},
-		read:   make(chan int),
-		cancel: make(chan struct{}),
-		done:   make(chan struct{}),
+		read:    make(chan int),
+		cancel:  make(chan struct{}),
+		done:    make(chan struct{}),
+		stalled: make(chan struct{}),
 	}
 	responseHandler.response.Body = &responseHandler
+	if request.Body != nil {
+		responseHandler.upload = &bodyUploadProvider{body: request.Body, getBody: request.GetBody, contentLength: request.ContentLength, progress: progress, response: &responseHandler}
+		if expectsContinue(request.Header) {
+			responseHandler.upload.expectContinue = t.ExpectContinueTimeout
+		}
+		if request.GetBody == nil {
+			responseHandler.upload.seeker, responseHandler.upload.seekStart = seekableBody(request.Body)
+		}
+		uploadProvider := NewUploadDataProvider(responseHandler.upload)
+		requestParams.SetUploadDataProvider(uploadProvider)
+		requestParams.SetUploadDataExecutor(t.Executor)
+	}
 	responseHandler.wg.Add(1)
 	go responseHandler.monitorContext(request.Context())
 
+	holdRequestAnnotations(t.Engine, requestID, AnnotationsFromContext(request.Context()))
 	callback := NewURLRequestCallback(&responseHandler)
 	urlRequest := NewURLRequest()
 	responseHandler.request = urlRequest
-	urlRequest.InitWithParams(t.Engine, request.URL.String(), requestParams, callback, t.Executor)
+	responseHandler.callback = callback
+	result := urlRequest.InitWithParams(t.Engine, requestURL, requestParams, callback, t.Executor)
 	requestParams.Destroy()
-	urlRequest.Start()
+	if result != ResultSuccess {
+		responseHandler.close(urlRequest, initResultError(result))
+		responseHandler.destroy(urlRequest)
+	} else {
+		responseHandler.touch(stallStateHeaders)
+		if t.StallTimeout > 0 {
+			go responseHandler.watchStall()
+		}
+		urlRequest.Start()
+	}
 	responseHandler.wg.Wait()
-	return &responseHandler.response, responseHandler.err
+	if responseHandler.headersErr != nil {
+		return nil, responseHandler.headersErr
+	}
+	return &responseHandler.response, nil
 }
 
-type urlResponse struct {
-	checkRedirect func(newLocationUrl string) bool
+// initResultError returns the error for a request that could not be
+// initialized. It is only reached with EngineParams.SetEnableCheckResult(false),
+// Cronet aborts the process otherwise.
+func initResultError(result Result) error {
+	switch result {
+	case ResultIllegalArgumentInvalidHostname:
+		return ErrInvalidHostname
+	case ResultIllegalArgument:
+		return ErrInvalidURL
+	case ResultIllegalArgumentInvalidHttpMethod:
+		return ErrInvalidMethod
+	default:
+		return fmt.Errorf("cronet: request initialization failed with result %d", result)
+	}
+}
 
-	wg       sync.WaitGroup
-	request  URLRequest
-	response http.Response
-	err      error
+type urlResponse struct {
+	checkRedirect  func(newLocationUrl string) bool
+	hostOverride   bool
+	protocols      []Protocol
+	policies       []*RequestPolicy
+	maxHeaderBytes int64
+	maxHeaders     int
+	monitor        *ProgressMonitor
+	progress       *requestProgress
+	sink           io.Writer
+	sinkWritten    int64
+	upload         *bodyUploadProvider
+	requestID      RequestID
+	trace          *httptrace.ClientTrace
+	firstByteOnce  sync.Once
+
+	stallTimeout     time.Duration
+	started          time.Time
+	stallState       int32
+	lastActivity     int64
+	applicationCalls int32
+	statusCode       int32
+	bytesReceived    int64
+	stalled          chan struct{}
+
+	wg          sync.WaitGroup
+	headersOnce sync.Once
+	headersErr  error
+	request     URLRequest
+	callback    URLRequestCallback
+	response    http.Response
+	err         error
 
 	access     sync.Mutex
 	read       chan int
@@ -129,28 +387,169 @@ func (r *urlResponse) monitorContext(ctx context.Context) {
 	case <-r.cancel:
 	case <-r.done:
 	case <-ctx.Done():
+		r.access.Lock()
+		select {
+		case <-r.done:
+			r.access.Unlock()
+			return
+		default:
+		}
 		r.err = ctx.Err()
+		r.access.Unlock()
 		r.Close()
 	}
 }
 
-func (r *urlResponse) OnRedirectReceived(self URLRequestCallback, request URLRequest, info URLResponseInfo, newLocationUrl string) {
-	if r.checkRedirect != nil && !r.checkRedirect(newLocationUrl) {
-		r.response.Status = info.StatusText()
-		r.response.StatusCode = info.StatusCode()
-		headerLen := info.HeaderSize()
-		for i := 0; i < headerLen; i++ {
-			header := info.HeaderAt(i)
-			r.response.Header.Set(header.Name(), header.Value())
-		}
-		r.response.Body = io.NopCloser(io.MultiReader())
+// gotFirstResponseByte calls GotFirstResponseByte of the trace of the
+// request for the first response.
+func (r *urlResponse) gotFirstResponseByte() {
+	if r.trace == nil || r.trace.GotFirstResponseByte == nil {
+		return
+	}
+	r.firstByteOnce.Do(r.trace.GotFirstResponseByte)
+}
+
+// headersDone releases RoundTrip once the response headers arrived or the
+// request failed before them.
+func (r *urlResponse) headersDone(err error) {
+	r.headersOnce.Do(func() {
+		r.headersErr = err
 		r.wg.Done()
+	})
+}
+
+// checkProtocol cancels the request if it was answered over a protocol
+// excluded by the request options.
+func (r *urlResponse) checkProtocol(request URLRequest, info URLResponseInfo) bool {
+	err := checkProtocol(r.protocols, info.NegotiatedProtocol())
+	if err == nil {
+		return true
+	}
+	r.fail(request, err)
+	return false
+}
+
+// checkHeaderLimits cancels the request if the headers of |info| exceed the
+// limits of the RoundTripper.
+func (r *urlResponse) checkHeaderLimits(request URLRequest, info URLResponseInfo) bool {
+	if r.maxHeaderBytes <= 0 && r.maxHeaders <= 0 {
+		return true
+	}
+	count := info.HeaderSize()
+	var size int64
+	for i := 0; i < count; i++ {
+		header := info.HeaderAt(i)
+		size += headerLineSize(header.Name(), header.Value())
+	}
+	err := checkHeaderLimits(r.maxHeaderBytes, r.maxHeaders, count, size)
+	if err == nil {
+		return true
+	}
+	r.fail(request, err)
+	return false
+}
+
+// checkRedirectPolicies cancels the request if a request policy denies the
+// redirect to |newLocationUrl|.
+func (r *urlResponse) checkRedirectPolicies(request URLRequest, newLocationUrl string) bool {
+	target, err := url.Parse(newLocationUrl)
+	if err == nil {
+		err = checkRequestPolicies(r.response.Request.Context(), target, r.policies...)
+	}
+	if err == nil {
+		return true
+	}
+	r.fail(request, err)
+	return false
+}
+
+// fail cancels the request before its response headers with |err|.
+func (r *urlResponse) fail(request URLRequest, err error) {
+	r.access.Lock()
+	r.err = err
+	r.access.Unlock()
+	r.headersDone(err)
+	request.Cancel()
+}
+
+func (r *urlResponse) OnRedirectReceived(self URLRequestCallback, request URLRequest, info URLResponseInfo, newLocationUrl string) {
+	r.gotFirstResponseByte()
+	r.touch(stallStateHeaders)
+	if r.progress != nil {
+		r.progress.onResponse(info)
+	}
+	if !r.checkProtocol(request, info) || !r.checkHeaderLimits(request, info) || !r.checkRedirectPolicies(request, newLocationUrl) {
+		return
+	}
+	if r.checkRedirect != nil && !r.checkRedirect(newLocationUrl) || r.hostOverride && !sameOrigin(info.URL(), newLocationUrl) {
+		// The network stack would send the Host header overriding the host of
+		// the request URL to the new location too; http.Client drops it when
+		// following the redirect to another origin
+		r.returnRedirect(info)
+		return
+	}
+	if statusCode := info.StatusCode(); r.upload != nil && !r.upload.rewindable() && redirectKeepsBody(r.response.Request.Method, statusCode) {
+		// Fail before the network stack finds out it can not send the body
+		// again, with an error saying why
+		r.fail(request, fmt.Errorf("%w: redirect %d to %s", ErrBodyNotRewindable, statusCode, newLocationUrl))
 		return
 	}
 	request.FollowRedirect()
 }
 
+// returnRedirect ends the request with the redirect response |info| instead
+// of following it.
+func (r *urlResponse) returnRedirect(info URLResponseInfo) {
+	r.response.Status = info.StatusText()
+	r.response.StatusCode = info.StatusCode()
+	headerLen := info.HeaderSize()
+	for i := 0; i < headerLen; i++ {
+		header := info.HeaderAt(i)
+		r.response.Header.Set(header.Name(), header.Value())
+	}
+	r.response.Body = io.NopCloser(io.MultiReader())
+	r.touch(stallStateIdle)
+	r.headersDone(nil)
+}
+
+// sameOrigin reports whether |newLocationUrl| has the origin of |currentURL|.
+func sameOrigin(currentURL string, newLocationUrl string) bool {
+	current, err := url.Parse(currentURL)
+	if err != nil {
+		return false
+	}
+	location, err := url.Parse(newLocationUrl)
+	if err != nil {
+		return false
+	}
+	return throttleOrigin(current) == throttleOrigin(location)
+}
+
+// redirectKeepsBody reports whether the network stack sends the body of a
+// |method| request again when following a redirect with |statusCode|: 303
+// changes the method to GET, 301 and 302 only that of POST.
+func redirectKeepsBody(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	case http.StatusMovedPermanently, http.StatusFound:
+		return method != http.MethodPost
+	default:
+		return false
+	}
+}
+
 func (r *urlResponse) OnResponseStarted(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
+	r.gotFirstResponseByte()
+	atomic.StoreInt32(&r.statusCode, int32(info.StatusCode()))
+	atomic.StoreInt64(&r.bytesReceived, info.ReceivedByteCount())
+	r.touch(stallStateIdle)
+	if r.progress != nil {
+		r.progress.onResponse(info)
+	}
+	if !r.checkProtocol(request, info) || !r.checkHeaderLimits(request, info) {
+		return
+	}
 	r.response.Status = info.StatusText()
 	r.response.StatusCode = info.StatusCode()
 	headerLen := info.HeaderSize()
@@ -162,7 +561,41 @@ func (r *urlResponse) OnResponseStarted(self URLRequestCallback, request URLRequ
 	contentLength, _ := strconv.Atoi(r.response.Header.Get("Content-Length"))
 	r.response.ContentLength = int64(contentLength)
 	r.response.TransferEncoding = r.response.Header.Values("Content-Transfer-Encoding")
-	r.wg.Done()
+	if state := responseTLSState(info.URL(), info); state != nil {
+		r.response.Request = withResponseTLSState(r.response.Request, state)
+	}
+	if r.sink == nil && !responseBodyAllowed(r.response.Request.Method, r.response.StatusCode) {
+		// Nothing for the caller to read, as with net/http; the request still
+		// has to be read to its end, which happens in the background
+		r.response.Body = emptyResponseBody{response: r}
+		if r.response.Request.Method != http.MethodHead {
+			r.response.ContentLength = 0
+		}
+		r.sink = io.Discard
+	}
+	r.headersDone(nil)
+	if r.sink != nil {
+		r.touch(stallStateBody)
+		buffer := NewBuffer()
+		buffer.InitWithAlloc(sinkBufferSize)
+		request.Read(buffer)
+	}
+}
+
+// emptyResponseBody is the body of a response that can not have one, e.g.
+// to a HEAD request, read to its end in the background. Close waits for the
+// request to be done, so that the engine can be shut down after it.
+type emptyResponseBody struct {
+	response *urlResponse
+}
+
+func (b emptyResponseBody) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (b emptyResponseBody) Close() error {
+	<-b.response.done
+	return nil
 }
 
 func (r *urlResponse) Read(p []byte) (n int, err error) {
@@ -176,12 +609,16 @@ func (r *urlResponse) Read(p []byte) (n int, err error) {
 
 	select {
 	case <-r.done:
+		r.access.Unlock()
 		return 0, r.err
 	default:
 	}
 
 	r.readBuffer = NewBuffer()
-	r.readBuffer.InitWithDataAndCallback(p, NewBufferCallback(nil))
+	// p stays owned by the caller, so the buffer needs no destroy callback,
+	// which would be a native object per read
+	r.readBuffer.InitWithDataAndCallback(p, BufferCallback{})
+	r.touch(stallStateBody)
 	r.request.Read(r.readBuffer)
 	r.access.Unlock()
 
@@ -190,6 +627,10 @@ func (r *urlResponse) Read(p []byte) (n int, err error) {
 		return bytesRead, nil
 	case <-r.cancel:
 		return 0, net.ErrClosed
+	case <-r.stalled:
+		r.access.Lock()
+		defer r.access.Unlock()
+		return 0, r.err
 	case <-r.done:
 		return 0, r.err
 	}
@@ -211,6 +652,15 @@ func (r *urlResponse) Close() error {
 }
 
 func (r *urlResponse) OnReadCompleted(self URLRequestCallback, request URLRequest, info URLResponseInfo, buffer Buffer, bytesRead int64) {
+	atomic.StoreInt64(&r.bytesReceived, info.ReceivedByteCount())
+	if r.progress != nil {
+		atomic.StoreInt64(&r.progress.bytesReceived, info.ReceivedByteCount())
+	}
+	if r.sink != nil {
+		r.sinkRead(request, buffer, bytesRead)
+		return
+	}
+	r.touch(stallStateIdle)
 	r.access.Lock()
 	defer r.access.Unlock()
 
@@ -228,16 +678,51 @@ func (r *urlResponse) OnReadCompleted(self URLRequestCallback, request URLReques
 	}
 }
 
+// sinkRead writes the data read into the native |buffer| to the sink and
+// reads again into the same buffer.
+func (r *urlResponse) sinkRead(request URLRequest, buffer Buffer, bytesRead int64) {
+	if bytesRead == 0 {
+		buffer.Destroy()
+		r.close(request, io.EOF)
+		return
+	}
+	r.beginApplicationCall()
+	n, err := r.sink.Write(buffer.DataSlice()[:bytesRead])
+	r.endApplicationCall()
+	atomic.AddInt64(&r.sinkWritten, int64(n))
+	if err != nil {
+		buffer.Destroy()
+		r.access.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.access.Unlock()
+		request.Cancel()
+		return
+	}
+	request.Read(buffer)
+}
+
 func (r *urlResponse) OnSucceeded(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
+	if r.progress != nil {
+		atomic.StoreInt64(&r.progress.bytesReceived, info.ReceivedByteCount())
+	}
 	r.close(request, io.EOF)
+	r.destroy(request)
 }
 
 func (r *urlResponse) OnFailed(self URLRequestCallback, request URLRequest, info URLResponseInfo, error Error) {
-	r.close(request, ErrorFromError(error))
+	if r.upload.rewindFailed() {
+		r.close(request, fmt.Errorf("%w: %v", ErrBodyNotRewindable, ErrorFromError(error)))
+	} else {
+		r.close(request, ErrorFromError(error))
+	}
+	r.destroy(request)
 }
 
 func (r *urlResponse) OnCanceled(self URLRequestCallback, request URLRequest, info URLResponseInfo) {
 	r.close(request, context.Canceled)
+	r.destroy(request)
 }
 
 func (r *urlResponse) close(request URLRequest, err error) {
@@ -255,13 +740,79 @@ func (r *urlResponse) close(request URLRequest, err error) {
 	}
 
 	close(r.done)
+	// A read of the body blocked on its supplier would hold up the close
+	// of the upload
+	r.upload.closeBody()
+	releaseRequestAnnotations(r.requestID)
+	r.headersDone(r.err)
+	if r.progress != nil {
+		r.monitor.finish(r.progress)
+	}
+}
+
+// destroy frees the native request and its callback. It is only called once
+// no callback follows: from OnSucceeded, OnFailed and OnCanceled, or if the
+// request could not be started. close may run before, as the body ends with
+// the last read.
+func (r *urlResponse) destroy(request URLRequest) {
 	request.Destroy()
+	r.callback.Destroy()
 }
 
+// bodyUploadProvider uploads the body of a request. The body is closed
+// exactly once, by Close or when the request is done, whichever is first;
+// reads and rewinds after that fail. Bodies without getBody are rewound by
+// seeking if they are an io.Seeker.
 type bodyUploadProvider struct {
-	body          io.ReadCloser
 	getBody       func() (io.ReadCloser, error)
+	seeker        io.Seeker
+	seekStart     int64
 	contentLength int64
+	progress      *requestProgress
+	response      *urlResponse
+	// expectContinue is how long the first read holds back the body.
+	expectContinue time.Duration
+
+	access sync.Mutex
+	body   io.ReadCloser
+	closed bool
+	// started is set by the first read, notRewindable by a rewind that was
+	// not possible.
+	started       bool
+	notRewindable bool
+}
+
+// seekableBody returns |body| as an io.Seeker and its offset, if it can seek.
+func seekableBody(body io.Reader) (io.Seeker, int64) {
+	seeker, isSeeker := body.(io.Seeker)
+	if !isSeeker {
+		return nil, 0
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0
+	}
+	return seeker, offset
+}
+
+// rewindable reports whether the body can be sent again.
+func (p *bodyUploadProvider) rewindable() bool {
+	if p.getBody != nil || p.seeker != nil {
+		return true
+	}
+	p.access.Lock()
+	defer p.access.Unlock()
+	return !p.started
+}
+
+// rewindFailed reports whether a rewind was not possible.
+func (p *bodyUploadProvider) rewindFailed() bool {
+	if p == nil {
+		return false
+	}
+	p.access.Lock()
+	defer p.access.Unlock()
+	return p.notRewindable
 }
 
 func (p *bodyUploadProvider) Length(self UploadDataProvider) int64 {
@@ -269,7 +820,27 @@ func (p *bodyUploadProvider) Length(self UploadDataProvider) int64 {
 }
 
 func (p *bodyUploadProvider) Read(self UploadDataProvider, sink UploadDataSink, buffer Buffer) {
-	n, err := p.body.Read(buffer.DataSlice())
+	p.access.Lock()
+	hold := !p.started && p.expectContinue > 0
+	p.started = true
+	p.access.Unlock()
+	if hold {
+		p.waitContinue()
+	}
+	p.access.Lock()
+	body, closed := p.body, p.closed
+	p.access.Unlock()
+	if closed {
+		sink.OnReadError("request body closed")
+		return
+	}
+	p.response.beginApplicationCall()
+	n, err := body.Read(buffer.DataSlice())
+	p.response.endApplicationCall()
+	if err == io.EOF && n > 0 {
+		// Report the data now, the next read returns io.EOF again
+		err = nil
+	}
 	if err != nil {
 		if p.contentLength == -1 && err == io.EOF {
 			sink.OnReadSucceeded(0, true)
@@ -277,26 +848,132 @@ func (p *bodyUploadProvider) Read(self UploadDataProvider, sink UploadDataSink,
 		}
 		sink.OnReadError(err.Error())
 	} else {
+		if p.progress != nil {
+			atomic.AddInt64(&p.progress.bytesSent, int64(n))
+		}
 		sink.OnReadSucceeded(int64(n), false)
 	}
 }
 
+// waitContinue holds back the body of a request with an "Expect:
+// 100-continue" header for expectContinue, or until the request is done or
+// canceled. The hold counts as time the application takes to produce the
+// body, not as a stall.
+func (p *bodyUploadProvider) waitContinue() {
+	if trace := p.response.trace; trace != nil && trace.Wait100Continue != nil {
+		trace.Wait100Continue()
+	}
+	p.response.beginApplicationCall()
+	defer p.response.endApplicationCall()
+	timer := time.NewTimer(p.expectContinue)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.response.cancel:
+	case <-p.response.done:
+	}
+}
+
+// expectsContinue reports whether |header| asks the server for a 100
+// Continue before the body is sent.
+func expectsContinue(header http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(header.Get("Expect")), "100-continue")
+}
+
 func (p *bodyUploadProvider) Rewind(self UploadDataProvider, sink UploadDataSink) {
+	p.access.Lock()
+	if p.closed {
+		p.access.Unlock()
+		sink.OnRewindError("request body closed")
+		return
+	}
+	if !p.started {
+		// Nothing was read to send again
+		p.access.Unlock()
+		sink.OnRewindSucceeded()
+		return
+	}
 	if p.getBody == nil {
-		sink.OnRewindError("unsupported")
+		if p.seeker == nil {
+			p.notRewindable = true
+			p.access.Unlock()
+			sink.OnRewindError(ErrBodyNotRewindable.Error())
+			return
+		}
+		_, err := p.seeker.Seek(p.seekStart, io.SeekStart)
+		p.access.Unlock()
+		if err != nil {
+			sink.OnRewindError(err.Error())
+			return
+		}
+		if p.progress != nil {
+			atomic.StoreInt64(&p.progress.bytesSent, 0)
+		}
+		sink.OnRewindSucceeded()
 		return
 	}
-	p.body.Close()
+	oldBody := p.body
+	p.body = nil
+	p.access.Unlock()
+	oldBody.Close()
 	newBody, err := p.getBody()
 	if err != nil {
 		sink.OnRewindError(err.Error())
 		return
 	}
+	p.access.Lock()
+	if p.closed {
+		// The request was done while the body was recreated
+		p.access.Unlock()
+		newBody.Close()
+		sink.OnRewindError("request body closed")
+		return
+	}
 	p.body = newBody
+	p.access.Unlock()
+	if p.progress != nil {
+		atomic.StoreInt64(&p.progress.bytesSent, 0)
+	}
 	sink.OnRewindSucceeded()
 }
 
 func (p *bodyUploadProvider) Close(self UploadDataProvider) {
 	self.Destroy()
-	p.body.Close()
+	p.closeBody()
+}
+
+// closeBody closes the body unless it was closed before. It may interrupt a
+// read in progress.
+func (p *bodyUploadProvider) closeBody() {
+	if p == nil {
+		return
+	}
+	p.access.Lock()
+	if p.closed {
+		p.access.Unlock()
+		return
+	}
+	p.closed = true
+	body := p.body
+	p.access.Unlock()
+	// Without a body, a rewind is replacing it and closes both
+	if body != nil {
+		body.Close()
+	}
+}
+
+// userAgentVersionToken returns the product token RoundTripper.AppendVersionToken
+// adds, naming this library and the native Cronet version of |engine|.
+func userAgentVersionToken(engine Engine) string {
+	return "cronet-go Cronet/" + engine.Version()
+}
+
+// requestUserAgent returns the User-Agent header for |request| as described
+// by RoundTripper.UserAgent.
+func (t *RoundTripper) requestUserAgent(requestUserAgent string) string {
+	var versionToken string
+	if t.AppendVersionToken {
+		versionToken = userAgentVersionToken(t.Engine)
+	}
+	return layerUserAgent(requestUserAgent, t.UserAgent, versionToken)
 }
@@ -0,0 +1,201 @@
+//go:build cronet_nolib
+
+package cronet
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// maxRedirects is the redirect limit of the native stack, applied to the
+// redirects the fallback follows.
+const maxRedirects = 20
+
+// RoundTripper sends requests with net/http in builds with the cronet_nolib
+// tag, which do not link the native library. It keeps the fields of the
+// native RoundTripper that need no engine, and like it follows redirects
+// itself; SupportedCapabilities reports what the fallback lacks.
+//
+// RequestOptions are honored: Protocols is checked against the protocol of
+// each response, ServerName and UploadEncoding work as with the native
+// library.
+//
+// Unlike the native stack, requests with an "Expect: 100-continue" header
+// hold back their body until the server answers 100 Continue, or for the
+// ExpectContinueTimeout of Transport, one second with http.DefaultTransport.
+// Got100Continue of an httptrace.ClientTrace in the request context reports
+// the interim response, Got1xxResponse other 1xx responses such as 103 Early
+// Hints.
+//
+// Request bodies are sent again for redirects with http.Request.GetBody only,
+// as net/http does; bodies that are an io.Seeker are not rewound by seeking.
+type RoundTripper struct {
+	CheckRedirect func(newLocationUrl string) bool
+
+	// Transport sends the requests. If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// UserAgent is sent by requests without a User-Agent header.
+	UserAgent string
+	// AppendVersionToken appends a "cronet-go" token to the User-Agent header
+	// of a request or to UserAgent.
+	AppendVersionToken bool
+
+	// AcceptLanguage is sent by requests without an Accept-Language header,
+	// e.g. one made with AcceptLanguageHeader.
+	AcceptLanguage string
+
+	// IDNPolicy validates the host of every request before it is sent.
+	// Requests to rejected hosts fail with an error wrapping ErrInvalidHostname.
+	IDNPolicy IDNPolicy
+
+	// Interceptor, if set, answers every request in place of Transport, e.g.
+	// with the canned responses of package cronettest in tests.
+	Interceptor http.RoundTripper
+
+	// Throttle, if set, limits the concurrent requests and the bandwidth of
+	// the RoundTripper, shared with the other RoundTrippers using it.
+	Throttle *Throttle
+
+	// Scheduler, if set, shares the requests in flight between tenants,
+	// shared with the other RoundTrippers using it.
+	Scheduler *FairScheduler
+
+	// CircuitBreaker, if set, fails requests to hosts that keep failing with
+	// an error wrapping ErrCircuitOpen.
+	CircuitBreaker *CircuitBreaker
+
+	// RequestPolicy, if set, denies requests and redirects to URLs it does
+	// not allow with an error wrapping ErrRequestDenied.
+	RequestPolicy *RequestPolicy
+
+	// MaxResponseHeaderBytes and MaxResponseHeaders, if positive, limit the
+	// size and number of the headers of every response and redirect,
+	// failing requests beyond them with an error wrapping
+	// ErrHeadersTooLarge. The size counts the name and value of each header
+	// plus four bytes. The MaxResponseHeaderBytes of Transport, one MiB by
+	// default, applies as well.
+	MaxResponseHeaderBytes int64
+	MaxResponseHeaders     int
+}
+
+func (t *RoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	admitted, err := t.admitRequest(request)
+	if err != nil {
+		closeRequestBody(request)
+		return nil, err
+	}
+	response, err := t.roundTrip(admitted.request, admitted.target)
+	return admitted.finish(response, err)
+}
+
+// requestPolicies returns the request policies of the RoundTripper.
+func (t *RoundTripper) requestPolicies() []*RequestPolicy {
+	return []*RequestPolicy{t.RequestPolicy}
+}
+
+// roundTrip sends |request| admitted by admitRequest to |target|.
+func (t *RoundTripper) roundTrip(request *http.Request, target *url.URL) (*http.Response, error) {
+	if t.Interceptor != nil {
+		return t.Interceptor.RoundTrip(request)
+	}
+	options, _ := RequestOptionsFromContext(request.Context())
+	_, hostHeader := requestTarget(request, options)
+	outgoing := request.Clone(request.Context())
+	outgoing.URL = target
+	outgoing.Host = hostHeader
+	if outgoing.Method == "" {
+		outgoing.Method = http.MethodGet
+	}
+	if userAgent := t.requestUserAgent(request.Header.Get("User-Agent")); userAgent != "" {
+		outgoing.Header.Set("User-Agent", userAgent)
+	}
+	if _, present := outgoing.Header["Accept-Language"]; !present && t.AcceptLanguage != "" {
+		outgoing.Header.Set("Accept-Language", t.AcceptLanguage)
+	}
+
+	client := http.Client{
+		Transport: t.Transport,
+		CheckRedirect: func(redirect *http.Request, via []*http.Request) error {
+			if err := checkProtocol(options.Protocols, responseProtocol(redirect.Response)); err != nil {
+				return err
+			}
+			if err := checkHeaderLimitsOf(t.MaxResponseHeaderBytes, t.MaxResponseHeaders, redirect.Response.Header); err != nil {
+				return err
+			}
+			if err := checkRequestPolicies(redirect.Context(), redirect.URL, t.requestPolicies()...); err != nil {
+				return err
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("cronet: stopped after %d redirects", maxRedirects)
+			}
+			if t.CheckRedirect != nil && !t.CheckRedirect(redirect.URL.String()) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	response, err := client.Do(outgoing)
+	if err != nil {
+		// Errors are returned as the native RoundTripper does, without the
+		// *url.Error of http.Client, which a client on top adds again
+		if urlError, isURLError := err.(*url.Error); isURLError {
+			err = urlError.Err
+		}
+		return nil, err
+	}
+	if err := checkProtocol(options.Protocols, responseProtocol(response)); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	if err := checkHeaderLimitsOf(t.MaxResponseHeaderBytes, t.MaxResponseHeaders, response.Header); err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	if location, unfollowed := t.unfollowedRedirect(response); unfollowed {
+		response.Body.Close()
+		return nil, fmt.Errorf("%w: redirect %d to %s", ErrBodyNotRewindable, response.StatusCode, location)
+	}
+	return response, nil
+}
+
+// unfollowedRedirect returns the location of |response| if it is a 307 or
+// 308 redirect http.Client returned instead of following it because the body
+// of the request can not be sent again, and CheckRedirect allows it.
+func (t *RoundTripper) unfollowedRedirect(response *http.Response) (*url.URL, bool) {
+	if response.StatusCode != http.StatusTemporaryRedirect && response.StatusCode != http.StatusPermanentRedirect {
+		return nil, false
+	}
+	sent := response.Request
+	if sent.GetBody != nil || sent.Body == nil || sent.Body == http.NoBody {
+		return nil, false
+	}
+	location, err := response.Location()
+	if err != nil {
+		return nil, false
+	}
+	if t.CheckRedirect != nil && !t.CheckRedirect(location.String()) {
+		return nil, false
+	}
+	return location, true
+}
+
+// responseProtocol returns the protocol name the native stack reports for
+// the protocol of |response|.
+func responseProtocol(response *http.Response) string {
+	if response != nil && response.ProtoMajor == 2 {
+		return string(ProtocolHTTP2)
+	}
+	return string(ProtocolHTTP11)
+}
+
+// requestUserAgent returns the User-Agent header for |request| as described
+// by RoundTripper.UserAgent.
+func (t *RoundTripper) requestUserAgent(requestUserAgent string) string {
+	var versionToken string
+	if t.AppendVersionToken {
+		versionToken = "cronet-go"
+	}
+	return layerUserAgent(requestUserAgent, t.UserAgent, versionToken)
+}
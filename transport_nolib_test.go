@@ -0,0 +1,265 @@
+//go:build cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestFallbackCapabilities(t *testing.T) {
+	capabilities := cronet.SupportedCapabilities()
+	if capabilities.NativeLibrary || capabilities.HTTP3 || !capabilities.HTTP2 || !capabilities.ExpectContinue || !capabilities.InformationalResponses {
+		t.Errorf("unexpected capabilities %+v", capabilities)
+	}
+	if version := cronet.Version(); version.Cronet != "" || version.HasBuild {
+		t.Errorf("unexpected version %+v", version)
+	}
+}
+
+// countingReader counts the reads of a request body.
+type countingReader struct {
+	io.Reader
+	reads int32
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	atomic.AddInt32(&r.reads, 1)
+	return r.Reader.Read(p)
+}
+
+func TestFallbackExpectContinue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/reject" {
+			writer.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		io.Copy(writer, request.Body)
+	}))
+	defer server.Close()
+
+	transport := &cronet.RoundTripper{}
+	for _, test := range []struct {
+		path       string
+		statusCode int
+		continued  bool
+	}{
+		{"/reject", http.StatusRequestEntityTooLarge, false},
+		{"/accept", http.StatusOK, true},
+	} {
+		var continued int32
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			Got100Continue: func() {
+				atomic.AddInt32(&continued, 1)
+			},
+		})
+		body := &countingReader{Reader: strings.NewReader("payload")}
+		request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+test.path, body)
+		request.Header.Set("Expect", "100-continue")
+		response, err := transport.RoundTrip(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseBody, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != test.statusCode {
+			t.Errorf("%s: unexpected status %d", test.path, response.StatusCode)
+		}
+		if (atomic.LoadInt32(&continued) == 1) != test.continued {
+			t.Errorf("%s: got %d interim responses", test.path, continued)
+		}
+		if test.continued && string(responseBody) != "payload" {
+			t.Errorf("%s: unexpected body %q", test.path, responseBody)
+		}
+		if !test.continued && atomic.LoadInt32(&body.reads) != 0 {
+			t.Errorf("%s: body sent to a server rejecting it", test.path)
+		}
+	}
+}
+
+func TestFallbackEarlyHints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		writer.WriteHeader(http.StatusEarlyHints)
+		writer.Header().Del("Link")
+		io.WriteString(writer, "final")
+	}))
+	defer server.Close()
+
+	var links []string
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				links = append(links, header.Values("Link")...)
+			}
+			return nil
+		},
+	})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := (&cronet.RoundTripper{}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "final" || response.Header.Get("Link") != "" {
+		t.Errorf("unexpected final response %q %v", body, response.Header)
+	}
+	if len(links) != 1 || links[0] != "</style.css>; rel=preload; as=style" {
+		t.Error("unexpected early hints", links)
+	}
+}
+
+func TestFallbackHead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Length", "5")
+		io.WriteString(writer, "hello")
+	}))
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodHead, server.URL, nil)
+	response, err := (&cronet.RoundTripper{}).RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != http.NoBody || response.ContentLength != 5 {
+		t.Errorf("unexpected HEAD response %v %d", response.Body, response.ContentLength)
+	}
+}
+
+func TestFallbackHeaderLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/redirect" {
+			writer.Header().Set("X-Large", strings.Repeat("x", 1000))
+			http.Redirect(writer, request, "/", http.StatusFound)
+			return
+		}
+		for i := 0; i < 10; i++ {
+			writer.Header().Add("X-Many", "value")
+		}
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		path      string
+		transport *cronet.RoundTripper
+		tooLarge  bool
+	}{
+		{"/", &cronet.RoundTripper{MaxResponseHeaders: 20}, false},
+		{"/", &cronet.RoundTripper{MaxResponseHeaders: 5}, true},
+		{"/", &cronet.RoundTripper{MaxResponseHeaderBytes: 100}, true},
+		{"/redirect", &cronet.RoundTripper{MaxResponseHeaderBytes: 500}, true},
+	} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+test.path, nil)
+		response, err := test.transport.RoundTrip(request)
+		if test.tooLarge {
+			if !errors.Is(err, cronet.ErrHeadersTooLarge) {
+				t.Errorf("%s %+v: expected ErrHeadersTooLarge, got %v", test.path, test.transport, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+}
+
+func TestFallbackTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/redirect" {
+			http.Redirect(writer, request, "/target", http.StatusFound)
+			return
+		}
+		writer.Header().Set("X-Host", request.Host)
+		io.WriteString(writer, request.UserAgent())
+	}))
+	defer server.Close()
+
+	transport := &cronet.RoundTripper{UserAgent: "test", AppendVersionToken: true}
+	client := &http.Client{Transport: transport}
+	response, err := client.Get(server.URL + "/redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(body) != "test cronet-go" {
+		t.Errorf("unexpected response %d %q", response.StatusCode, body)
+	}
+
+	transport.CheckRedirect = func(newLocationUrl string) bool {
+		return false
+	}
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/redirect", nil)
+	response, err = transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("expected the redirect, got %d", response.StatusCode)
+	}
+
+	// The connection goes to ServerName, the Host header keeps the URL host
+	serverURL, _ := url.Parse(server.URL)
+	request, _ = http.NewRequestWithContext(cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{
+		ServerName: serverURL.Hostname(),
+	}), http.MethodGet, "http://example.test:"+serverURL.Port()+"/", nil)
+	response, err = transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if host := response.Header.Get("X-Host"); host != "example.test:"+serverURL.Port() {
+		t.Errorf("unexpected Host header %q", host)
+	}
+
+	request, _ = http.NewRequestWithContext(cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{
+		Protocols: []cronet.Protocol{cronet.ProtocolHTTP2},
+	}), http.MethodGet, server.URL, nil)
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrProtocolUnavailable) {
+		t.Errorf("expected ErrProtocolUnavailable, got %v", err)
+	}
+}
+
+func TestFallbackBodyNotRewindable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if request.URL.Path == "/redirect" {
+			http.Redirect(writer, request, "/target", http.StatusTemporaryRedirect)
+			return
+		}
+		writer.Write(body)
+	}))
+	defer server.Close()
+	transport := &cronet.RoundTripper{}
+
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/redirect", &countingCloser{Reader: strings.NewReader("payload")})
+	if _, err := transport.RoundTrip(request); !errors.Is(err, cronet.ErrBodyNotRewindable) {
+		t.Fatal("expected ErrBodyNotRewindable, got", err)
+	}
+
+	// Bodies with GetBody follow the redirect
+	request, _ = http.NewRequest(http.MethodPost, server.URL+"/redirect", strings.NewReader("payload"))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "payload" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
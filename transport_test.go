@@ -1,11 +1,13 @@
 package cronet_test
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"testing"
 
 	"github.com/sagernet/cronet-go"
+	"github.com/sagernet/cronet-go/cronettest"
 )
 
 func TestTransport(t *testing.T) {
@@ -19,3 +21,18 @@ func TestTransport(t *testing.T) {
 	response.Write(os.Stderr)
 	response.Body.Close()
 }
+
+func TestRoundTripperInterceptor(t *testing.T) {
+	interceptor := cronettest.NewInterceptor()
+	interceptor.On(http.MethodGet, "https://example.com/").RespondString(http.StatusOK, "intercepted")
+	transport := &cronet.RoundTripper{Interceptor: interceptor}
+	response, err := (&http.Client{Transport: transport}).Get("https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "intercepted" {
+		t.Fatal("unexpected body", string(body))
+	}
+}
@@ -0,0 +1,58 @@
+package cronet
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrBodyNotRewindable is wrapped by the errors of requests whose body had to
+// be sent again, e.g. for a 307 or 308 redirect or a retry on a stale
+// connection, but could not be read again: it has no http.Request.GetBody
+// and is not an io.Seeker.
+var ErrBodyNotRewindable = errors.New("cronet: request body can not be sent again")
+
+// UploadBody is a request body that tells its supplier when the request no
+// longer needs it, so a producer writing into a pipe can stop instead of
+// blocking on a request that was canceled or answered before the upload
+// ended. RoundTripper closes request bodies exactly once, once the request
+// is done with them, and while a Read is in progress if the request is
+// canceled mid-upload, to unblock it.
+type UploadBody struct {
+	reader    io.Reader
+	closeOnce sync.Once
+	closeErr  error
+	done      chan struct{}
+}
+
+// NewUploadBody returns an UploadBody reading from |reader|, which is closed
+// with the body if it is an io.Closer. Closing it may interrupt a Read in
+// progress, as with io.PipeReader.
+func NewUploadBody(reader io.Reader) *UploadBody {
+	return &UploadBody{reader: reader, done: make(chan struct{})}
+}
+
+func (b *UploadBody) Read(p []byte) (int, error) {
+	select {
+	case <-b.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+	return b.reader.Read(p)
+}
+
+// Close closes the body and Done. Only the first call has an effect.
+func (b *UploadBody) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		if closer, isCloser := b.reader.(io.Closer); isCloser {
+			b.closeErr = closer.Close()
+		}
+	})
+	return b.closeErr
+}
+
+// Done returns a channel closed once the body is closed.
+func (b *UploadBody) Done() <-chan struct{} {
+	return b.done
+}
@@ -0,0 +1,61 @@
+package cronet_test
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+type countingCloser struct {
+	io.Reader
+	closes int32
+}
+
+func (c *countingCloser) Close() error {
+	atomic.AddInt32(&c.closes, 1)
+	return nil
+}
+
+func TestUploadBody(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	body := cronet.NewUploadBody(pipeReader)
+	read := make(chan error, 1)
+	go func() {
+		_, err := body.Read(make([]byte, 16))
+		read <- err
+	}()
+	select {
+	case <-body.Done():
+		t.Fatal("done before the body was closed")
+	default:
+	}
+	// Closing unblocks the read waiting for the supplier
+	body.Close()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Fatal("expected the read to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not interrupted")
+	}
+	select {
+	case <-body.Done():
+	default:
+		t.Fatal("expected done once closed")
+	}
+	if _, err := pipeWriter.Write([]byte("data")); err == nil {
+		t.Fatal("expected the supplier to see the closed pipe")
+	}
+
+	closer := &countingCloser{}
+	body = cronet.NewUploadBody(closer)
+	body.Close()
+	body.Close()
+	if closes := atomic.LoadInt32(&closer.closes); closes != 1 {
+		t.Fatal("expected one close, got", closes)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestRoundTripCancelMidUpload(t *testing.T) {
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.ReadFull(request.Body, make([]byte, 5))
+		close(received)
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+
+	params := cronet.NewEngineParams()
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer engine.Destroy()
+	defer engine.Shutdown()
+
+	pipeReader, pipeWriter := io.Pipe()
+	closer := &countingCloser{Reader: pipeReader}
+	body := cronet.NewUploadBody(closer)
+	go func() {
+		// The supplier sends the start of the body and stalls
+		pipeWriter.Write([]byte("hello"))
+		<-body.Done()
+		pipeWriter.CloseWithError(io.ErrClosedPipe)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, body)
+	returned := make(chan error, 1)
+	go func() {
+		_, err := (&cronet.RoundTripper{Engine: engine}).RoundTrip(request)
+		returned <- err
+	}()
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("upload not started")
+	}
+	cancel()
+	select {
+	case err := <-returned:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal("expected context.Canceled, got", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RoundTrip held up by the stalled upload")
+	}
+	select {
+	case <-body.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("body not closed")
+	}
+	// Give a late close of the provider the chance to show up
+	time.Sleep(100 * time.Millisecond)
+	if closes := atomic.LoadInt32(&closer.closes); closes != 1 {
+		t.Fatal("expected the body closed once, got", closes)
+	}
+}
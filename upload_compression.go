@@ -0,0 +1,89 @@
+package cronet
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// UploadEncoder creates a writer compressing to |w| for an upload encoding.
+type UploadEncoder func(w io.Writer) (io.WriteCloser, error)
+
+var (
+	uploadEncodersAccess sync.RWMutex
+	uploadEncoders       = map[string]UploadEncoder{
+		"gzip": func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		"deflate": func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		},
+	}
+)
+
+// RegisterUploadEncoder makes |encoding| available as RequestOptions.UploadEncoding.
+// Only gzip and deflate are built in, as the standard library has no brotli or
+// zstd encoder; register "br" or "zstd" with an encoder from a third-party
+// package.
+func RegisterUploadEncoder(encoding string, encoder UploadEncoder) {
+	uploadEncodersAccess.Lock()
+	defer uploadEncodersAccess.Unlock()
+	uploadEncoders[encoding] = encoder
+}
+
+func uploadEncoder(encoding string) (UploadEncoder, error) {
+	uploadEncodersAccess.RLock()
+	defer uploadEncodersAccess.RUnlock()
+	encoder := uploadEncoders[encoding]
+	if encoder == nil {
+		return nil, fmt.Errorf("cronet: unknown upload encoding %q", encoding)
+	}
+	return encoder, nil
+}
+
+// compressRequestBody returns a copy of |request| whose body is compressed
+// with |encoding|. The compressed length is unknown, so the body is sent chunked.
+func compressRequestBody(request *http.Request, encoding string) (*http.Request, error) {
+	if request.Header.Get("Content-Encoding") != "" {
+		return nil, fmt.Errorf("cronet: request already has Content-Encoding %s", request.Header.Get("Content-Encoding"))
+	}
+	encoder, err := uploadEncoder(encoding)
+	if err != nil {
+		return nil, err
+	}
+	compressed := request.Clone(request.Context())
+	compressed.Header.Set("Content-Encoding", encoding)
+	compressed.Header.Del("Content-Length")
+	compressed.ContentLength = -1
+	compressed.Body = compressBody(request.Body, encoder)
+	if request.GetBody != nil {
+		compressed.GetBody = func() (io.ReadCloser, error) {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return compressBody(body, encoder), nil
+		}
+	}
+	return compressed, nil
+}
+
+func compressBody(body io.ReadCloser, encoder UploadEncoder) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		defer body.Close()
+		compressor, err := encoder(writer)
+		if err == nil {
+			_, err = io.Copy(compressor, body)
+			closeErr := compressor.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
@@ -0,0 +1,97 @@
+package cronet_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestUploadEncoding(t *testing.T) {
+	cronet.RegisterUploadEncoder("x-upper", func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/redirect" {
+			io.Copy(io.Discard, request.Body)
+			http.Redirect(writer, request, "/echo", http.StatusTemporaryRedirect)
+			return
+		}
+		if request.ContentLength != -1 {
+			http.Error(writer, "expected a chunked body", http.StatusBadRequest)
+			return
+		}
+		var body io.Reader
+		switch encoding := request.Header.Get("Content-Encoding"); encoding {
+		case "gzip":
+			reader, err := gzip.NewReader(request.Body)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = reader
+		case "deflate":
+			body = flate.NewReader(request.Body)
+		case "x-upper":
+			body = request.Body
+		default:
+			http.Error(writer, "unexpected encoding "+encoding, http.StatusBadRequest)
+			return
+		}
+		content, err := io.ReadAll(body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.WriteString(writer, request.Header.Get("Content-Encoding")+" ")
+		writer.Write(content)
+	}))
+	defer server.Close()
+
+	transport := &cronet.RoundTripper{}
+	content := strings.Repeat("compressible ", 100)
+	post := func(encoding string, path string) (*http.Response, error) {
+		ctx := cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{UploadEncoding: encoding})
+		request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+path, bytes.NewReader([]byte(content)))
+		return transport.RoundTrip(request)
+	}
+	for _, encoding := range []string{"gzip", "deflate", "x-upper"} {
+		// The redirect sends the body again, compressed from GetBody
+		for _, path := range []string{"/echo", "/redirect"} {
+			response, err := post(encoding, path)
+			if err != nil {
+				t.Fatal(encoding, path, err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK || string(body) != encoding+" "+content {
+				t.Fatalf("%s %s: unexpected response %d %.60q", encoding, path, response.StatusCode, body)
+			}
+		}
+	}
+
+	if _, err := post("unknown", "/echo"); err == nil {
+		t.Error("expected an unknown encoding to fail")
+	}
+	ctx := cronet.WithRequestOptions(context.Background(), cronet.RequestOptions{UploadEncoding: "gzip"})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/echo", strings.NewReader(content))
+	request.Header.Set("Content-Encoding", "br")
+	if _, err := transport.RoundTrip(request); err == nil {
+		t.Error("expected a body with Content-Encoding to be rejected")
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -10,7 +12,6 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
@@ -21,32 +22,19 @@ func NewUploadDataProvider(handler UploadDataProviderHandler) UploadDataProvider
 		(*[0]byte)(C.cronetUploadDataProviderRewind),
 		(*[0]byte)(C.cronetUploadDataProviderClose),
 	)
-	uploadDataAccess.Lock()
-	uploadDataProviderMap[uintptr(unsafe.Pointer(ptr))] = handler
-	uploadDataAccess.Unlock()
+	uploadDataProviders.store(uintptr(unsafe.Pointer(ptr)), handler)
 	return UploadDataProvider{ptr}
 }
 
 func (p UploadDataProvider) Destroy() {
+	uploadDataProviders.delete(uintptr(unsafe.Pointer(p.ptr)))
 	C.Cronet_UploadDataProvider_Destroy(p.ptr)
-	uploadDataAccess.Lock()
-	delete(uploadDataProviderMap, uintptr(unsafe.Pointer(p.ptr)))
-	uploadDataAccess.Unlock()
 }
 
-var (
-	uploadDataAccess      sync.RWMutex
-	uploadDataProviderMap map[uintptr]UploadDataProviderHandler
-)
-
-func init() {
-	uploadDataProviderMap = make(map[uintptr]UploadDataProviderHandler)
-}
+var uploadDataProviders handleRegistry[UploadDataProviderHandler]
 
 func instanceOfUploadDataProvider(self C.Cronet_UploadDataProviderPtr) UploadDataProviderHandler {
-	uploadDataAccess.RLock()
-	defer uploadDataAccess.RUnlock()
-	provider := uploadDataProviderMap[uintptr(unsafe.Pointer(self))]
+	provider, _ := uploadDataProviders.load(uintptr(unsafe.Pointer(self)))
 	if provider == nil {
 		panic("nil data provider")
 	}
@@ -0,0 +1,511 @@
+package cronet
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidURL = errors.New("cronet: invalid URL")
+
+// ErrInvalidHostname is returned for host names that can not be looked up.
+// Errors wrapping it also match ErrInvalidURL.
+var ErrInvalidHostname error = invalidHostnameError{}
+
+type invalidHostnameError struct{}
+
+func (invalidHostnameError) Error() string {
+	return "cronet: invalid hostname"
+}
+
+func (invalidHostnameError) Is(target error) bool {
+	return target == ErrInvalidURL
+}
+
+// defaultPorts are the standard schemes with an authority, and their
+// default ports removed during canonicalization.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// CanonicalizeURL returns |rawURL| in the canonical form the network stack
+// sends and reports it in, following the rules of Chromium's URL parser for
+// standard schemes (http, https, ws, wss, ftp):
+//
+//   - scheme and host are lower-cased, a default port is removed
+//   - internationalized host names are mapped with UTS #46 and converted to
+//     punycode
+//   - IPv4 hosts in hexadecimal, octal or shortened form are rewritten as
+//     dotted decimal, and IPv6 hosts are compressed
+//   - backslashes become slashes, "." and ".." path segments are resolved
+//     and an empty path becomes "/"
+//   - characters not allowed in the path, query or fragment are percent-encoded
+//
+// Other schemes are only checked for syntax and returned unchanged.
+// Errors wrap ErrInvalidURL.
+func CanonicalizeURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	schemeEnd := strings.IndexByte(rawURL, ':')
+	if schemeEnd <= 0 || !isValidScheme(rawURL[:schemeEnd]) {
+		return "", fmt.Errorf("%w: missing or invalid scheme in %q", ErrInvalidURL, rawURL)
+	}
+	scheme := strings.ToLower(rawURL[:schemeEnd])
+	defaultPort, isStandard := defaultPorts[scheme]
+	if !isStandard {
+		_, err := url.Parse(rawURL)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+		return scheme + rawURL[schemeEnd:], nil
+	}
+
+	rest := strings.ReplaceAll(rawURL[schemeEnd+1:], `\`, "/")
+	rest = strings.TrimLeft(rest, "/")
+	var fragment, query string
+	hasFragment, hasQuery := false, false
+	if index := strings.IndexByte(rest, '#'); index >= 0 {
+		rest, fragment, hasFragment = rest[:index], rest[index+1:], true
+	}
+	if index := strings.IndexByte(rest, '?'); index >= 0 {
+		rest, query, hasQuery = rest[:index], rest[index+1:], true
+	}
+	authority, path := rest, ""
+	if index := strings.IndexByte(rest, '/'); index >= 0 {
+		authority, path = rest[:index], rest[index:]
+	}
+
+	var userinfo string
+	if index := strings.LastIndexByte(authority, '@'); index >= 0 {
+		userinfo, authority = authority[:index+1], authority[index+1:]
+	}
+	host, port := splitAuthority(authority)
+	canonicalHost, err := CanonicalizeHost(host)
+	if err != nil {
+		return "", err
+	}
+	if port != "" {
+		portNumber, err := strconv.Atoi(port)
+		if err != nil || !isDigits(port) || portNumber > 65535 {
+			return "", fmt.Errorf("%w: invalid port %q", ErrInvalidURL, port)
+		}
+		port = strconv.Itoa(portNumber)
+		if port == defaultPort {
+			port = ""
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(scheme)
+	builder.WriteString("://")
+	if userinfo != "" {
+		// Only the first ':' separates the password, and only the last '@'
+		// ends the userinfo: all others are escaped
+		username, password, hasPassword := strings.Cut(userinfo[:len(userinfo)-1], ":")
+		builder.WriteString(escapeURLComponent(username, ""))
+		if hasPassword {
+			builder.WriteByte(':')
+			builder.WriteString(escapeURLComponent(password, ""))
+		}
+		builder.WriteByte('@')
+	}
+	builder.WriteString(canonicalHost)
+	if port != "" {
+		builder.WriteByte(':')
+		builder.WriteString(port)
+	}
+	builder.WriteString(escapeURLComponent(removeDotSegments(path), "/"))
+	if hasQuery {
+		builder.WriteByte('?')
+		builder.WriteString(escapeURLComponent(query, "/?&=+,;:@$!'()*[]"))
+	}
+	if hasFragment {
+		builder.WriteByte('#')
+		builder.WriteString(escapeURLComponent(fragment, "/?&=+,;:@$!'()*[]#"))
+	}
+	return builder.String(), nil
+}
+
+// CanonicalizeHost returns the canonical form of a host name or IP address
+// literal as used in URLs, the host Chromium's URL parser connects to.
+// Percent escapes are decoded, ASCII hosts are lower-cased and other hosts
+// are mapped with UTS #46 and converted to punycode. A host that is an IPv4
+// address after that, e.g. "１２７.０.０.１" or "0x7f.1", is returned in
+// dotted decimal. Errors wrap ErrInvalidHostname.
+func CanonicalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("%w: empty host", ErrInvalidHostname)
+	}
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", fmt.Errorf("%w: invalid IPv6 host %q", ErrInvalidHostname, host)
+		}
+		ip, err := netip.ParseAddr(host[1 : len(host)-1])
+		if err != nil || !ip.Is6() || ip.Zone() != "" {
+			return "", fmt.Errorf("%w: invalid IPv6 host %q", ErrInvalidHostname, host)
+		}
+		return "[" + formatIPv6(ip.As16()) + "]", nil
+	}
+	unescaped, err := url.PathUnescape(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid escape in host %q", ErrInvalidHostname, host)
+	}
+	if !utf8.ValidString(unescaped) {
+		return "", fmt.Errorf("%w: invalid UTF-8 in host %q", ErrInvalidHostname, host)
+	}
+	if err := checkHostCharacters(unescaped, host); err != nil {
+		return "", err
+	}
+	ascii, err := hostToASCII(unescaped)
+	if err != nil {
+		return "", err
+	}
+	if err := checkHostCharacters(ascii, host); err != nil {
+		return "", err
+	}
+	if ipv4, isIPv4, err := canonicalizeIPv4(ascii); isIPv4 {
+		return ipv4, err
+	}
+	return ascii, nil
+}
+
+// checkHostCharacters returns an error if |host|, the form of |original| at
+// some step of canonicalization, has a character not allowed in hosts.
+func checkHostCharacters(host string, original string) error {
+	for _, r := range host {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune(`#%/:<>?@[\]^|`, r) {
+			return fmt.Errorf("%w: forbidden character %q in host %q", ErrInvalidHostname, r, original)
+		}
+	}
+	return nil
+}
+
+// hostIDNA maps hosts as Chromium's URL parser does with ICU: UTS #46
+// nontransitional processing with the Bidi and ContextJ checks, but without
+// the STD3 rules, which would reject e.g. "_" in names.
+var hostIDNA = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+	idna.CheckHyphens(false),
+	idna.BidiRule(),
+)
+
+// hostToASCII lower-cases an ASCII host. A host with other characters goes
+// through UTS #46 mapping first, which also maps e.g. full-width letters and
+// digits and the ideographic full stop, and is normalized to NFC, and its
+// non-ASCII labels are converted to punycode.
+func hostToASCII(host string) (string, error) {
+	isASCII := true
+	for i := 0; i < len(host); i++ {
+		if host[i] >= utf8.RuneSelf {
+			isASCII = false
+			break
+		}
+	}
+	if isASCII {
+		return strings.ToLower(host), nil
+	}
+	ascii, err := hostIDNA.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: host %q: %v", ErrInvalidHostname, host, err)
+	}
+	return ascii, nil
+}
+
+// canonicalizeIPv4 parses hosts whose last label is numeric as IPv4 the way
+// browsers do, accepting 1 to 4 decimal, octal (0 prefix) or hexadecimal
+// (0x prefix) parts.
+func canonicalizeIPv4(host string) (string, bool, error) {
+	parts := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if len(parts) == 0 || !isIPv4Number(parts[len(parts)-1]) {
+		return "", false, nil
+	}
+	if len(parts) > 4 {
+		return "", true, fmt.Errorf("%w: invalid IPv4 host %q", ErrInvalidHostname, host)
+	}
+	var values []uint64
+	for _, part := range parts {
+		value, err := parseIPv4Number(part)
+		if err != nil {
+			return "", true, fmt.Errorf("%w: invalid IPv4 host %q", ErrInvalidHostname, host)
+		}
+		values = append(values, value)
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return "", true, fmt.Errorf("%w: invalid IPv4 host %q", ErrInvalidHostname, host)
+	}
+	address := last
+	for i, value := range values[:len(values)-1] {
+		if value > 255 {
+			return "", true, fmt.Errorf("%w: invalid IPv4 host %q", ErrInvalidHostname, host)
+		}
+		address |= value << (8 * (3 - i))
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", byte(address>>24), byte(address>>16), byte(address>>8), byte(address)), true, nil
+}
+
+func isIPv4Number(part string) bool {
+	if part == "" {
+		return false
+	}
+	if strings.HasPrefix(part, "0x") {
+		for _, r := range part[2:] {
+			if !strings.ContainsRune("0123456789abcdef", r) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, r := range part {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseIPv4Number(part string) (uint64, error) {
+	switch {
+	case strings.HasPrefix(part, "0x"):
+		if part == "0x" {
+			return 0, nil
+		}
+		return strconv.ParseUint(part[2:], 16, 32)
+	case len(part) > 1 && part[0] == '0':
+		return strconv.ParseUint(part[1:], 8, 32)
+	default:
+		return strconv.ParseUint(part, 10, 32)
+	}
+}
+
+func splitAuthority(authority string) (host string, port string) {
+	if strings.HasPrefix(authority, "[") {
+		end := strings.IndexByte(authority, ']')
+		if end < 0 {
+			return authority, ""
+		}
+		host, rest := authority[:end+1], authority[end+1:]
+		return host, strings.TrimPrefix(rest, ":")
+	}
+	if index := strings.LastIndexByte(authority, ':'); index >= 0 {
+		return authority[:index], authority[index+1:]
+	}
+	return authority, ""
+}
+
+func removeDotSegments(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path[1:], "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		isLast := i == len(segments)-1
+		switch strings.ToLower(segment) {
+		case ".", "%2e":
+			if isLast {
+				output = append(output, "")
+			}
+		case "..", ".%2e", "%2e.", "%2e%2e":
+			if len(output) > 0 {
+				output = output[:len(output)-1]
+			}
+			if isLast {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+	return "/" + strings.Join(output, "/")
+}
+
+// escapeURLComponent percent-encodes bytes that are not unreserved and not in
+// |allowed|. Existing escapes are kept as they are.
+func escapeURLComponent(component string, allowed string) string {
+	var builder strings.Builder
+	for i := 0; i < len(component); i++ {
+		c := component[i]
+		switch {
+		case c == '%' && i+2 < len(component) && isHex(component[i+1]) && isHex(component[i+2]):
+			builder.WriteByte(c)
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0:
+			builder.WriteByte(c)
+		case c < utf8.RuneSelf && strings.IndexByte(allowed, c) >= 0:
+			builder.WriteByte(c)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+// formatIPv6 formats |ip| as Chromium does: hexadecimal groups with the
+// longest run of at least two zero groups compressed, and unlike net/netip
+// no dotted quad for IPv4-mapped addresses.
+func formatIPv6(ip [16]byte) string {
+	var groups [8]uint16
+	for i := range groups {
+		groups[i] = uint16(ip[2*i])<<8 | uint16(ip[2*i+1])
+	}
+	zerosStart, zerosLength := -1, 1
+	for i := 0; i < len(groups); {
+		if groups[i] != 0 {
+			i++
+			continue
+		}
+		start := i
+		for i < len(groups) && groups[i] == 0 {
+			i++
+		}
+		if i-start > zerosLength {
+			zerosStart, zerosLength = start, i-start
+		}
+	}
+	var builder strings.Builder
+	for i := 0; i < len(groups); i++ {
+		if i == zerosStart {
+			builder.WriteString("::")
+			i += zerosLength - 1
+			continue
+		}
+		if i > 0 && i != zerosStart+zerosLength {
+			builder.WriteByte(':')
+		}
+		builder.WriteString(strconv.FormatUint(uint64(groups[i]), 16))
+	}
+	return builder.String()
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isValidScheme(scheme string) bool {
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters from RFC 3492 section 5.
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+func punycodeAdapt(delta int32, numPoints int32, firstTime bool) int32 {
+	if firstTime {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := int32(0)
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeThreshold(k int32, bias int32) int32 {
+	t := k - bias
+	if t < punycodeTMin {
+		return punycodeTMin
+	} else if t > punycodeTMax {
+		return punycodeTMax
+	}
+	return t
+}
+
+// punycodeEncode encodes a host label as described in RFC 3492.
+func punycodeEncode(label string) (string, error) {
+	digit := func(d int32) byte {
+		if d < 26 {
+			return byte('a' + d)
+		}
+		return byte('0' + d - 26)
+	}
+
+	runes := []rune(label)
+	output := make([]byte, 0, len(label))
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+	basicCount := int32(len(output))
+	handled := basicCount
+	if basicCount > 0 {
+		output = append(output, '-')
+	}
+	n, delta, bias := int32(punycodeInitialN), int32(0), int32(punycodeInitialBias)
+	for handled < int32(len(runes)) {
+		m := int32(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if (m - n) > (0x7fffffff-delta)/(handled+1) {
+			return "", errors.New("punycode overflow")
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r == n {
+				q := delta
+				for k := int32(punycodeBase); ; k += punycodeBase {
+					t := punycodeThreshold(k, bias)
+					if q < t {
+						break
+					}
+					output = append(output, digit(t+(q-t)%(punycodeBase-t)))
+					q = (q - t) / (punycodeBase - t)
+				}
+				output = append(output, digit(q))
+				bias = punycodeAdapt(delta, handled+1, handled == basicCount)
+				delta = 0
+				handled++
+			}
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
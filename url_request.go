@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -19,6 +21,7 @@ func NewURLRequest() URLRequest {
 }
 
 func (r URLRequest) Destroy() {
+	deleteRequestStats(r)
 	C.Cronet_UrlRequest_Destroy(r.ptr)
 }
 
@@ -33,17 +36,35 @@ func (r URLRequest) Destroy() {
 // @param params additional parameters for the request, like headers and priority.
 // @param callback Callback that gets invoked on different events.
 // @param executor Executor on which all callbacks will be invoked.
+//
+// The default headers of |engine| are added to |params|, see
+// EngineParams.SetDefaultHeaders. Requests the request policy of |engine|
+// denies return ResultIllegalArgument, see EngineParams.SetRequestPolicy.
 func (r URLRequest) InitWithParams(engine Engine, url string, params URLRequestParams, callback URLRequestCallback, executor Executor) Result {
+	if checkEngineRequestPolicy(engine, url) != nil {
+		return ResultIllegalArgument
+	}
+	addDefaultHeaders(engine, params)
 	cURL := C.CString(url)
 	defer C.free(unsafe.Pointer(cURL))
 
-	return Result(C.Cronet_UrlRequest_InitWithParams(r.ptr, engine.ptr, cURL, params.ptr, callback.ptr, executor.ptr))
+	result := Result(C.Cronet_UrlRequest_InitWithParams(r.ptr, engine.ptr, cURL, params.ptr, callback.ptr, executor.ptr))
+	if result == ResultSuccess {
+		initRequestStats(engine, r, url, params)
+	}
+	return result
 }
 
 // Start starts the request, all callbacks go to URLRequestCallbackHandler. May only be called
 // once. May not be called if Cancel() has been called.
 func (r URLRequest) Start() Result {
-	return Result(C.Cronet_UrlRequest_Start(r.ptr))
+	// Counted before the first callback can finish the request
+	startRequestStats(r)
+	result := Result(C.Cronet_UrlRequest_Start(r.ptr))
+	if result != ResultSuccess {
+		unstartRequestStats(r)
+	}
+	return result
 }
 
 // FollowRedirect
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -12,7 +14,6 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
@@ -25,32 +26,19 @@ func NewURLRequestCallback(handler URLRequestCallbackHandler) URLRequestCallback
 		(*[0]byte)(C.cronetURLRequestCallbackOnFailed),
 		(*[0]byte)(C.cronetURLRequestCallbackOnCanceled),
 	)
-	urlRequestCallbackAccess.Lock()
-	urlRequestCallbackMap[uintptr(unsafe.Pointer(ptr))] = handler
-	urlRequestCallbackAccess.Unlock()
+	urlRequestCallbacks.store(uintptr(unsafe.Pointer(ptr)), handler)
 	return URLRequestCallback{ptr}
 }
 
 func (l URLRequestCallback) Destroy() {
+	urlRequestCallbacks.delete(uintptr(unsafe.Pointer(l.ptr)))
 	C.Cronet_UrlRequestCallback_Destroy(l.ptr)
-	urlRequestCallbackAccess.Lock()
-	delete(urlRequestCallbackMap, uintptr(unsafe.Pointer(l.ptr)))
-	urlRequestCallbackAccess.RUnlock()
 }
 
-var (
-	urlRequestCallbackAccess sync.RWMutex
-	urlRequestCallbackMap    map[uintptr]URLRequestCallbackHandler
-)
-
-func init() {
-	urlRequestCallbackMap = make(map[uintptr]URLRequestCallbackHandler)
-}
+var urlRequestCallbacks handleRegistry[URLRequestCallbackHandler]
 
 func instanceOfURLRequestCallback(self C.Cronet_UrlRequestCallbackPtr) URLRequestCallbackHandler {
-	urlRequestCallbackAccess.RLock()
-	defer urlRequestCallbackAccess.RUnlock()
-	callback := urlRequestCallbackMap[uintptr(unsafe.Pointer(self))]
+	callback, _ := urlRequestCallbacks.load(uintptr(unsafe.Pointer(self)))
 	if callback == nil {
 		panic("nil url request callback")
 	}
@@ -59,30 +47,36 @@ func instanceOfURLRequestCallback(self C.Cronet_UrlRequestCallbackPtr) URLReques
 
 //export cronetURLRequestCallbackOnRedirectReceived
 func cronetURLRequestCallbackOnRedirectReceived(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr, newLocationUrl C.Cronet_String) {
+	updateRequestStats(URLRequest{request}, URLResponseInfo{info})
 	instanceOfURLRequestCallback(self).OnRedirectReceived(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info}, C.GoString(newLocationUrl))
 }
 
 //export cronetURLRequestCallbackOnResponseStarted
 func cronetURLRequestCallbackOnResponseStarted(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr) {
+	updateRequestStats(URLRequest{request}, URLResponseInfo{info})
 	instanceOfURLRequestCallback(self).OnResponseStarted(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info})
 }
 
 //export cronetURLRequestCallbackOnReadCompleted
 func cronetURLRequestCallbackOnReadCompleted(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr, buffer C.Cronet_BufferPtr, bytesRead C.uint64_t) {
+	updateRequestStats(URLRequest{request}, URLResponseInfo{info})
 	instanceOfURLRequestCallback(self).OnReadCompleted(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info}, Buffer{buffer}, int64(bytesRead))
 }
 
 //export cronetURLRequestCallbackOnSucceeded
 func cronetURLRequestCallbackOnSucceeded(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr) {
+	finishRequestStats(URLRequest{request}, URLResponseInfo{info}, requestSucceeded)
 	instanceOfURLRequestCallback(self).OnSucceeded(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info})
 }
 
 //export cronetURLRequestCallbackOnFailed
 func cronetURLRequestCallbackOnFailed(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr, error C.Cronet_ErrorPtr) {
+	finishRequestStats(URLRequest{request}, URLResponseInfo{info}, requestFailed)
 	instanceOfURLRequestCallback(self).OnFailed(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info}, Error{error})
 }
 
 //export cronetURLRequestCallbackOnCanceled
 func cronetURLRequestCallbackOnCanceled(self C.Cronet_UrlRequestCallbackPtr, request C.Cronet_UrlRequestPtr, info C.Cronet_UrlResponseInfoPtr) {
+	finishRequestStats(URLRequest{request}, URLResponseInfo{info}, requestCanceled)
 	instanceOfURLRequestCallback(self).OnCanceled(URLRequestCallback{self}, URLRequest{request}, URLResponseInfo{info})
 }
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -7,38 +9,31 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
 func NewURLRequestFinishedInfoListener(finishedFunc URLRequestFinishedInfoListenerOnRequestFinishedFunc) URLRequestFinishedInfoListener {
 	ptr := C.Cronet_RequestFinishedInfoListener_CreateWith((*[0]byte)(C.cronetURLRequestFinishedInfoListenerOnRequestFinished))
-	urlRequestFinishedInfoListenerAccess.Lock()
-	urlRequestFinishedInfoListenerMap[uintptr(unsafe.Pointer(ptr))] = finishedFunc
-	urlRequestFinishedInfoListenerAccess.Unlock()
+	urlRequestFinishedInfoListeners.store(uintptr(unsafe.Pointer(ptr)), finishedFunc)
 	return URLRequestFinishedInfoListener{ptr}
 }
 
 func (l URLRequestFinishedInfoListener) Destroy() {
+	urlRequestFinishedInfoListeners.delete(uintptr(unsafe.Pointer(l.ptr)))
 	C.Cronet_RequestFinishedInfoListener_Destroy(l.ptr)
 }
 
-var (
-	urlRequestFinishedInfoListenerAccess sync.RWMutex
-	urlRequestFinishedInfoListenerMap    map[uintptr]URLRequestFinishedInfoListenerOnRequestFinishedFunc
-)
-
-func init() {
-	urlRequestFinishedInfoListenerMap = make(map[uintptr]URLRequestFinishedInfoListenerOnRequestFinishedFunc)
-}
+var urlRequestFinishedInfoListeners handleRegistry[URLRequestFinishedInfoListenerOnRequestFinishedFunc]
 
 //export cronetURLRequestFinishedInfoListenerOnRequestFinished
 func cronetURLRequestFinishedInfoListenerOnRequestFinished(self C.Cronet_RequestFinishedInfoListenerPtr, requestInfo C.Cronet_RequestFinishedInfoPtr, responseInfo C.Cronet_UrlResponseInfoPtr, error C.Cronet_ErrorPtr) {
-	urlRequestFinishedInfoListenerAccess.RLock()
-	listener := urlRequestFinishedInfoListenerMap[uintptr(unsafe.Pointer(self))]
-	urlRequestFinishedInfoListenerAccess.RUnlock()
+	listener, _ := urlRequestFinishedInfoListeners.load(uintptr(unsafe.Pointer(self)))
 	if listener == nil {
 		panic("nil url request finished info listener")
 	}
-	listener(URLRequestFinishedInfoListener{self}, URLRequestFinishedInfo{requestInfo}, URLResponseInfo{responseInfo}, Error{error})
+	info := URLRequestFinishedInfo{requestInfo}
+	listener(URLRequestFinishedInfoListener{self}, info, URLResponseInfo{responseInfo}, Error{error})
+	if id, loaded := info.RequestID(); loaded {
+		releaseListenerAnnotations(id, URLRequestFinishedInfoListener{self})
+	}
 }
@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -42,6 +44,7 @@ func NewURLRequestParams() URLRequestParams {
 }
 
 func (p URLRequestParams) Destroy() {
+	requestParamsRemovedHeaders.delete(uintptr(unsafe.Pointer(p.ptr)))
 	C.Cronet_UrlRequestParams_Destroy(p.ptr)
 }
 
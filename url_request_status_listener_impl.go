@@ -1,3 +1,5 @@
+//go:build !cronet_nolib
+
 package cronet
 
 // #include <stdlib.h>
@@ -7,38 +9,26 @@ package cronet
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 )
 
 func NewURLRequestStatusListener(onStatusFunc URLRequestStatusListenerOnStatusFunc) URLRequestStatusListener {
 	ptr := C.Cronet_UrlRequestStatusListener_CreateWith((*[0]byte)(C.cronetURLRequestStatusListenerOnStatus))
-	urlRequestStatusListenerAccess.Lock()
-	urlRequestStatusListenerMap[uintptr(unsafe.Pointer(ptr))] = onStatusFunc
-	urlRequestStatusListenerAccess.Unlock()
+	urlRequestStatusListeners.store(uintptr(unsafe.Pointer(ptr)), onStatusFunc)
 	return URLRequestStatusListener{ptr}
 }
 
 func (l URLRequestStatusListener) Destroy() {
+	urlRequestStatusListeners.delete(uintptr(unsafe.Pointer(l.ptr)))
 	C.Cronet_UrlRequestStatusListener_Destroy(l.ptr)
 }
 
-var (
-	urlRequestStatusListenerAccess sync.Mutex
-	urlRequestStatusListenerMap    map[uintptr]URLRequestStatusListenerOnStatusFunc
-)
-
-func init() {
-	urlRequestStatusListenerMap = make(map[uintptr]URLRequestStatusListenerOnStatusFunc)
-}
+var urlRequestStatusListeners handleRegistry[URLRequestStatusListenerOnStatusFunc]
 
 //export cronetURLRequestStatusListenerOnStatus
 func cronetURLRequestStatusListenerOnStatus(self C.Cronet_UrlRequestStatusListenerPtr, status C.Cronet_UrlRequestStatusListener_Status) {
-	ptr := uintptr(unsafe.Pointer(self))
-	urlRequestStatusListenerAccess.Lock()
-	listener := urlRequestStatusListenerMap[ptr]
-	delete(urlRequestCallbackMap, ptr)
-	urlRequestStatusListenerAccess.Unlock()
+	// The status is reported once per listener
+	listener, _ := urlRequestStatusListeners.loadAndDelete(uintptr(unsafe.Pointer(self)))
 	if listener == nil {
 		panic("nil url status listener")
 	}
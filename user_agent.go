@@ -0,0 +1,21 @@
+package cronet
+
+import "strings"
+
+// defaultUserAgent is the engine User-Agent of a RoundTripper without Engine.
+const defaultUserAgent = "Go-http-client/1.1"
+
+// layerUserAgent returns the User-Agent header to send for a request, or an
+// empty string to leave the engine User-Agent in place. A User-Agent set on
+// the request wins over the transport default, and |versionToken| is appended
+// to whichever is used unless it is already present.
+func layerUserAgent(requestUserAgent string, transportUserAgent string, versionToken string) string {
+	userAgent := requestUserAgent
+	if userAgent == "" {
+		userAgent = transportUserAgent
+	}
+	if userAgent == "" || versionToken == "" || strings.Contains(userAgent, versionToken) {
+		return userAgent
+	}
+	return userAgent + " " + versionToken
+}
@@ -0,0 +1,124 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+// TestUserAgentLayering runs requests through a local HTTP proxy, picked up
+// by the engine from the proxy environment variables, and checks the
+// User-Agent of CONNECT and of proxied requests.
+func TestUserAgentLayering(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	seen := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					request, err := http.ReadRequest(reader)
+					if err != nil {
+						return
+					}
+					io.Copy(io.Discard, request.Body)
+					seen <- request.Method + " " + request.UserAgent()
+					if request.Method == http.MethodConnect {
+						io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+						return
+					}
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+	proxyURL := "http://" + listener.Addr().String()
+	t.Setenv("http_proxy", proxyURL)
+	t.Setenv("https_proxy", proxyURL)
+
+	params := cronet.NewEngineParams()
+	params.SetUserAgent("engine-agent/1.0")
+	engine := cronet.NewEngine()
+	engine.StartWithParams(params)
+	params.Destroy()
+	defer func() {
+		engine.Shutdown()
+		engine.Destroy()
+	}()
+	versionToken := "cronet-go Cronet/" + engine.Version()
+
+	for _, testCase := range []struct {
+		name      string
+		transport *cronet.RoundTripper
+		url       string
+		userAgent string
+		expected  string
+	}{
+		{
+			name:      "engine",
+			transport: &cronet.RoundTripper{Engine: engine},
+			url:       "http://example.com/",
+			expected:  "GET engine-agent/1.0",
+		},
+		{
+			name:      "transport",
+			transport: &cronet.RoundTripper{Engine: engine, UserAgent: "transport-agent/2.0"},
+			url:       "http://example.com/",
+			expected:  "GET transport-agent/2.0",
+		},
+		{
+			name:      "request",
+			transport: &cronet.RoundTripper{Engine: engine, UserAgent: "transport-agent/2.0", AppendVersionToken: true},
+			url:       "http://example.com/",
+			userAgent: "request-agent/3.0",
+			expected:  "GET request-agent/3.0 " + versionToken,
+		},
+		{
+			name:      "connect",
+			transport: &cronet.RoundTripper{Engine: engine, UserAgent: "transport-agent/2.0", AppendVersionToken: true},
+			url:       "https://example.com/",
+			userAgent: "request-agent/3.0",
+			expected:  "CONNECT engine-agent/1.0",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, testCase.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.userAgent != "" {
+				request.Header.Set("User-Agent", testCase.userAgent)
+			}
+			response, err := testCase.transport.RoundTrip(request)
+			if err == nil {
+				response.Body.Close()
+			} else if !strings.HasPrefix(testCase.expected, http.MethodConnect) {
+				t.Fatal(err)
+			}
+			select {
+			case actual := <-seen:
+				if actual != testCase.expected {
+					t.Errorf("proxy saw %q, want %q", actual, testCase.expected)
+				}
+			default:
+				t.Fatal("request did not go through the proxy")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cronet
+
+import (
+	"strings"
+	"sync"
+)
+
+// VersionInfo describes the native stack linked into the binary.
+type VersionInfo struct {
+	// Cronet is the version string of the linked Cronet library, empty in
+	// builds with the cronet_nolib tag.
+	Cronet string
+	// Chromium is the Chromium version Cronet was built from.
+	Chromium string
+	// NaiveProxyPatch is the naiveproxy patch level on top of Chromium, the
+	// revision of its release tag, e.g. 1 for v143.0.7499.109-1. It is empty
+	// if the libraries were not packaged from a release tag.
+	NaiveProxyPatch string
+	// Build is the manifest of the packaged libraries, valid if HasBuild.
+	Build    BuildManifest
+	HasBuild bool
+}
+
+var (
+	versionOnce sync.Once
+	versionInfo VersionInfo
+)
+
+// Version returns the versions of the native stack linked into the binary
+// and how it was built, e.g. to log at startup.
+func Version() VersionInfo {
+	versionOnce.Do(func() {
+		versionInfo.Cronet = nativeVersion()
+		if versionInfo.Cronet == "" {
+			// Nothing is linked with the cronet_nolib tag, and the manifest
+			// describes libraries the binary does not use
+			return
+		}
+		versionInfo.Build, versionInfo.HasBuild = BuildInfo()
+		versionInfo.Chromium = versionInfo.Build.ChromiumVersion
+		if versionInfo.Chromium == "" {
+			// The Cronet version is the Chromium version, possibly followed by
+			// the revision, e.g. 143.0.7499.109@5a1c3b9e
+			versionInfo.Chromium, _, _ = strings.Cut(versionInfo.Cronet, "@")
+		}
+		versionInfo.NaiveProxyPatch = naiveProxyPatch(versionInfo.Build.NaiveProxyVersion, versionInfo.Chromium)
+	})
+	return versionInfo
+}
+
+// naiveProxyPatch returns the revision of the naiveproxy release tag
+// |describe| of |chromium|, or an empty string if it is not one.
+func naiveProxyPatch(describe string, chromium string) string {
+	prefix := "v" + chromium + "-"
+	if chromium == "" || !strings.HasPrefix(describe, prefix) {
+		return ""
+	}
+	patch := describe[len(prefix):]
+	if patch == "" || strings.Contains(patch, "-") {
+		// Commits after the tag, e.g. v143.0.7499.109-1-3-gabcdef0
+		return ""
+	}
+	return patch
+}
+
+// String formats the versions on a single line, e.g.
+// "Cronet 143.0.7499.109, naiveproxy v143.0.7499.109-1 (c0ffee0)".
+func (v VersionInfo) String() string {
+	var builder strings.Builder
+	builder.WriteString("Cronet ")
+	if v.Cronet == "" {
+		builder.WriteString("not linked")
+	} else {
+		builder.WriteString(v.Cronet)
+	}
+	if v.HasBuild && v.Build.NaiveProxyVersion != "" {
+		builder.WriteString(", naiveproxy ")
+		builder.WriteString(v.Build.NaiveProxyVersion)
+		if commit := v.Build.NaiveProxyCommit; len(commit) >= 7 {
+			builder.WriteString(" (")
+			builder.WriteString(commit[:7])
+			builder.WriteString(")")
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,23 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestVersion(t *testing.T) {
+	version := cronet.Version()
+	if version.Cronet == "" || version.Chromium == "" {
+		t.Fatalf("missing version: %+v", version)
+	}
+	if !strings.HasPrefix(version.Cronet, version.Chromium) {
+		t.Errorf("Cronet %s is not built from Chromium %s", version.Cronet, version.Chromium)
+	}
+	if !strings.HasPrefix(version.String(), "Cronet "+version.Cronet) {
+		t.Errorf("unexpected version string %q", version.String())
+	}
+}
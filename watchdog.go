@@ -0,0 +1,131 @@
+//go:build !cronet_nolib
+
+package cronet
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var ErrRequestStalled = errors.New("cronet: request stalled")
+
+// StalledError is returned for a request canceled by the watchdog of
+// RoundTripper.StallTimeout. It matches ErrRequestStalled.
+type StalledError struct {
+	// State is what the request was waiting for: "response headers" or
+	// "response body".
+	State string
+	// Idle is the time since the last callback of the request.
+	Idle time.Duration
+	// StatusCode is the status of the response, zero if no headers arrived.
+	StatusCode int
+	// BytesReceived is the number of bytes received on the wire until the
+	// last callback.
+	BytesReceived int64
+}
+
+func (e *StalledError) Error() string {
+	message := ErrRequestStalled.Error() + ": no " + e.State + " for " + e.Idle.Round(time.Millisecond).String()
+	if e.StatusCode != 0 {
+		message += " after status " + strconv.Itoa(e.StatusCode)
+	}
+	return message + ", " + strconv.FormatInt(e.BytesReceived, 10) + " bytes received"
+}
+
+func (e *StalledError) Is(target error) bool {
+	return target == ErrRequestStalled
+}
+
+func (e *StalledError) Timeout() bool {
+	return true
+}
+
+// What a request waits for from the network stack. A request waiting for
+// the application, which has not read the body yet or is busy producing the
+// upload or consuming a sink write, cannot stall.
+const (
+	stallStateIdle int32 = iota
+	stallStateHeaders
+	stallStateBody
+)
+
+// touch records a callback of the request and what it waits for next.
+func (r *urlResponse) touch(state int32) {
+	if r.stallTimeout == 0 {
+		return
+	}
+	atomic.StoreInt32(&r.stallState, state)
+	atomic.StoreInt64(&r.lastActivity, int64(time.Since(r.started)))
+}
+
+// beginApplicationCall marks the request as waiting for the application,
+// e.g. while the request body is read, until endApplicationCall.
+func (r *urlResponse) beginApplicationCall() {
+	if r.stallTimeout != 0 {
+		atomic.AddInt32(&r.applicationCalls, 1)
+	}
+}
+
+func (r *urlResponse) endApplicationCall() {
+	if r.stallTimeout != 0 {
+		atomic.AddInt32(&r.applicationCalls, -1)
+		r.touch(atomic.LoadInt32(&r.stallState))
+	}
+}
+
+// watchStall cancels the request once the network stack made no callback
+// for stallTimeout while the request waits for one.
+func (r *urlResponse) watchStall() {
+	timer := time.NewTimer(r.stallTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-timer.C:
+		}
+		idle := time.Since(r.started) - time.Duration(atomic.LoadInt64(&r.lastActivity))
+		state := atomic.LoadInt32(&r.stallState)
+		if state == stallStateIdle || atomic.LoadInt32(&r.applicationCalls) > 0 {
+			timer.Reset(r.stallTimeout)
+			continue
+		}
+		if idle < r.stallTimeout {
+			timer.Reset(r.stallTimeout - idle)
+			continue
+		}
+		r.stall(state, idle)
+		return
+	}
+}
+
+// stall fails the request with a StalledError and cancels it. Waiters are
+// released without waiting for the cancellation, which a stalled network
+// stack may never confirm.
+func (r *urlResponse) stall(state int32, idle time.Duration) {
+	r.access.Lock()
+	select {
+	case <-r.done:
+		r.access.Unlock()
+		return
+	default:
+	}
+	stalledErr := &StalledError{
+		State:         "response headers",
+		Idle:          idle,
+		StatusCode:    int(atomic.LoadInt32(&r.statusCode)),
+		BytesReceived: atomic.LoadInt64(&r.bytesReceived),
+	}
+	if state == stallStateBody {
+		stalledErr.State = "response body"
+	}
+	if r.err == nil {
+		r.err = stalledErr
+	}
+	close(r.stalled)
+	r.request.Cancel()
+	r.access.Unlock()
+	r.headersDone(stalledErr)
+}
@@ -0,0 +1,46 @@
+//go:build !cronet_nolib
+
+package cronet_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sagernet/cronet-go"
+)
+
+func TestStallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("partial"))
+		writer.(http.Flusher).Flush()
+		<-release
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &cronet.RoundTripper{StallTimeout: 300 * time.Millisecond}}
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	// Time spent before reading does not count as a stall
+	time.Sleep(500 * time.Millisecond)
+	start := time.Now()
+	_, err = io.ReadAll(response.Body)
+	if !errors.Is(err, cronet.ErrRequestStalled) {
+		t.Fatal("expected stall, got", err)
+	}
+	var stalledErr *cronet.StalledError
+	if !errors.As(err, &stalledErr) || stalledErr.State != "response body" || stalledErr.StatusCode != 200 {
+		t.Fatal("bad stall error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatal("stall detected late", elapsed)
+	}
+}